@@ -18,7 +18,10 @@ import (
 	"devops-assessment/internal/config"
 	"devops-assessment/internal/database"
 	"devops-assessment/internal/handlers"
+	"devops-assessment/internal/mail"
 	"devops-assessment/internal/models"
+	"devops-assessment/internal/notify"
+	"devops-assessment/internal/scheduler"
 	"devops-assessment/internal/services"
 
 	"github.com/gin-gonic/gin"
@@ -50,44 +53,147 @@ func main() {
 	}
 	defer db.Close()
 
+	// Load questionnaire templates
+	questionnaireTemplates, err := models.LoadTemplateRegistry(
+		cfg.Files.QuestionnaireTemplatesPath, cfg.Files.QuestionsPath, cfg.Files.AdvicePath, cfg.Files.MaturityPath,
+	)
+	if err != nil {
+		log.Fatalf("Failed to load questionnaire templates: %v", err)
+	}
+
 	// Initialize services
 	userService := models.NewUserService(db)
 	teamService := models.NewTeamService(db)
 	groupService := models.NewGroupService(db)
 	roleService := models.NewRoleService(db)
 	rbacService := models.NewRBACService(db)
+	settingService := models.NewSettingService(db)
+	auditService := models.NewAuditService(db)
 	assessmentService := models.NewAssessmentService(db)
-	questionService := models.NewQuestionService(cfg.Files.QuestionsPath, cfg.Files.AdvicePath)
-	surveyService := services.NewSurveyService(db, cfg.Files.QuestionsPath, cfg.Files.AdvicePath)
+	respondentService := models.NewRespondentService(db)
+	revisionService := models.NewRevisionService(db)
+	organizationService := models.NewOrganizationService(db)
+	campaignModelService := models.NewCampaignService(db)
+	actionItemService := models.NewActionItemService(db)
+	targetService := models.NewTargetService(db)
+	surveyService := services.NewSurveyService(db, questionnaireTemplates)
 	authService := auth.NewAuthService(db)
 
+	// Initialize notifications
+	mailer := newMailer(cfg)
+	campaignService := services.NewCampaignService(
+		campaignModelService, teamService, groupService, respondentService, rbacService, surveyService,
+		newNotifier(cfg, mailer), cfg.Server.PublicURL,
+	)
+
+	// Rewrite responses saved before questions had stable IDs
+	if err := database.ApplyMigration(db.DB, database.Migration{
+		Version:     2,
+		Description: "Rewrite positional response IDs to stable question IDs",
+		Up:          surveyService.MigrateLegacyResponseIDs,
+	}); err != nil {
+		log.Fatalf("Failed to migrate responses: %v", err)
+	}
+
+	// Import the questions files as the current questionnaire versions
+	if err := surveyService.SyncQuestionnaire(); err != nil {
+		log.Fatalf("Failed to import questionnaire: %v", err)
+	}
+
 	// Load templates
 	templates, err := loadTemplates(cfg.Files.TemplatesPath)
 	if err != nil {
 		log.Fatalf("Failed to load templates: %v", err)
 	}
 
+	// Initialize credential verifiers
+	verifiers, err := credentialVerifiers(cfg, db, userService)
+	if err != nil {
+		log.Fatalf("Failed to initialize authentication backends: %v", err)
+	}
+	authService.SetCredentialVerifiers(verifiers...)
+
+	// Initialize password policy and login throttling
+	passwordPolicy, err := newPasswordPolicy(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize password policy: %v", err)
+	}
+	authService.SetPasswordPolicy(passwordPolicy)
+	authService.SetLoginThrottle(auth.NewLoginThrottle(db, auth.ThrottleConfig{
+		AccountMaxFailures: cfg.Security.LoginThrottle.AccountMaxFailures,
+		IPMaxFailures:      cfg.Security.LoginThrottle.IPMaxFailures,
+		BackoffBase:        cfg.Security.LoginThrottle.BackoffBase,
+		LockoutDuration:    cfg.Security.LoginThrottle.LockoutDuration,
+	}))
+
+	// Initialize OIDC single sign-on
+	var oidcProvider *auth.OIDCProvider
+	if cfg.OIDC.Enabled {
+		mappings, err := auth.ParseGroupMappings(cfg.OIDC.GroupMappings)
+		if err != nil {
+			log.Fatalf("Invalid OIDC group mappings: %v", err)
+		}
+
+		oidcProvider, err = auth.NewOIDCProvider(context.Background(), db, authService, auth.OIDCConfig{
+			IssuerURL:     cfg.OIDC.IssuerURL,
+			ClientID:      cfg.OIDC.ClientID,
+			ClientSecret:  cfg.OIDC.ClientSecret,
+			RedirectURL:   cfg.OIDC.RedirectURL,
+			Scopes:        cfg.OIDC.Scopes,
+			GroupsClaim:   cfg.OIDC.GroupsClaim,
+			GroupMappings: mappings,
+			Organization:  cfg.OIDC.Organization,
+
+			TrustProviderMFA: cfg.OIDC.TrustProviderMFA,
+		})
+		if err != nil {
+			log.Fatalf("Failed to initialize OIDC: %v", err)
+		}
+	}
+
 	// Initialize middleware
-	authMiddleware := auth.NewMiddleware(authService, rbacService)
+	authMiddleware := auth.NewMiddleware(authService, rbacService, cfg.Server.TenantDomain)
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(authService, userService)
-	userHandler := handlers.NewUserHandler(userService, roleService, authService)
-	teamHandler := handlers.NewTeamHandler(teamService, groupService)
-	surveyHandler := handlers.NewSurveyHandler(surveyService, questionService, assessmentService, rbacService)
-	resultsHandler := handlers.NewResultsHandler(surveyService, questionService, assessmentService, rbacService, templates)
+	userHandler := handlers.NewUserHandler(userService, roleService, rbacService, authService)
+	roleHandler := handlers.NewRoleHandler(roleService, rbacService)
+	teamHandler := handlers.NewTeamHandler(teamService, groupService, rbacService)
+	surveyHandler := handlers.NewSurveyHandler(
+		surveyService, assessmentService, respondentService, revisionService, rbacService,
+	)
+	resultsHandler := handlers.NewResultsHandler(surveyService, assessmentService, actionItemService, targetService, rbacService, templates)
+	mfaHandler := handlers.NewMFAHandler(authService, userService, settingService, auditService)
+	tokenHandler := handlers.NewTokenHandler(authService, userService)
+	organizationHandler := handlers.NewOrganizationHandler(organizationService)
+	accountHandler := handlers.NewAccountHandler(
+		authService, teamService, roleService, rbacService, auditService, mailer, cfg.Server.PublicURL,
+	)
+	campaignHandler := handlers.NewCampaignHandler(campaignService, campaignModelService, rbacService)
+	actionItemHandler := handlers.NewActionItemHandler(surveyService, assessmentService, actionItemService)
+	targetHandler := handlers.NewTargetHandler(surveyService, targetService)
+
+	var oidcHandler *handlers.OIDCHandler
+	if oidcProvider != nil {
+		oidcHandler = handlers.NewOIDCHandler(oidcProvider)
+	}
 
 	// Setup router
-	router := setupRouter(cfg, templates, authMiddleware, authHandler, userHandler, teamHandler, surveyHandler, resultsHandler)
+	router := setupRouter(cfg, templates, authMiddleware, authHandler, userHandler, roleHandler, teamHandler, surveyHandler, resultsHandler, mfaHandler, tokenHandler, accountHandler, organizationHandler, campaignHandler, actionItemHandler, targetHandler, oidcHandler)
 
 	// Start background tasks
-	go startBackgroundTasks(authService)
+	tasksCtx, stopTasks := context.WithCancel(context.Background())
+	defer stopTasks()
+	go startBackgroundTasks(tasksCtx, cfg, authService, oidcProvider, campaignService)
 
 	// Create default admin user if none exists
-	if err := createDefaultAdmin(userService, teamService, roleService); err != nil {
+	if err := createDefaultAdmin(userService, teamService, roleService, organizationService); err != nil {
 		log.Printf("Warning: Failed to create default admin: %v", err)
 	}
 
+	// Make the configured users super admins
+	grantSuperAdmins(userService, cfg.Security.SuperAdmins)
+
 	// Setup graceful shutdown
 	srv := &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port),
@@ -109,6 +215,7 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	log.Println("Shutting down server...")
+	stopTasks()
 
 	// Give outstanding requests 30 seconds to complete
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -128,16 +235,29 @@ func setupRouter(
 	authMiddleware *auth.Middleware,
 	authHandler *handlers.AuthHandler,
 	userHandler *handlers.UserHandler,
+	roleHandler *handlers.RoleHandler,
 	teamHandler *handlers.TeamHandler,
 	surveyHandler *handlers.SurveyHandler,
 	resultsHandler *handlers.ResultsHandler,
+	mfaHandler *handlers.MFAHandler,
+	tokenHandler *handlers.TokenHandler,
+	accountHandler *handlers.AccountHandler,
+	organizationHandler *handlers.OrganizationHandler,
+	campaignHandler *handlers.CampaignHandler,
+	actionItemHandler *handlers.ActionItemHandler,
+	targetHandler *handlers.TargetHandler,
+	oidcHandler *handlers.OIDCHandler, // nil when OIDC is disabled
 ) *gin.Engine {
 	router := gin.New()
 
 	// Global middleware
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
-	router.Use(authMiddleware.CORS())
+	router.Use(authMiddleware.CORS(cfg.Security.AllowedOrigins))
+
+	// CSRF protection for cookie sessions
+	csrf := auth.NewCSRFProtection(cfg.Security.CSRFSecret)
+	router.Use(csrf.Middleware())
 
 	// Trust proxies if configured
 	if len(cfg.Security.TrustedProxies) > 0 {
@@ -161,7 +281,10 @@ func setupRouter(
 		htmlRouter.GET("/", func(c *gin.Context) {
 			c.Redirect(http.StatusMovedPermanently, "/login")
 		})
-		htmlRouter.GET("/login", renderLogin)
+		htmlRouter.GET("/login", renderLogin(oidcHandler != nil, hasAuthBackend(cfg, "ldap"), hasAuthBackend(cfg, "local")))
+		htmlRouter.GET("/forgot-password", renderAccountPage("forgot-password.html", "Forgot Password"))
+		htmlRouter.GET("/reset-password", renderAccountPage("reset-password.html", "Reset Password"))
+		htmlRouter.GET("/accept-invitation", renderAccountPage("accept-invitation.html", "Accept Invitation"))
 		htmlRouter.GET("/about", renderAbout)
 
 		// Results and resources (optional auth)
@@ -179,10 +302,23 @@ func setupRouter(
 	api := router.Group("/api/v1")
 	{
 		// Register all API handlers
+		api.GET("/auth/csrf", csrf.Token)
 		authHandler.RegisterRoutes(api, authMiddleware)
 		userHandler.RegisterRoutes(api, authMiddleware)
+		roleHandler.RegisterRoutes(api, authMiddleware)
 		teamHandler.RegisterRoutes(api, authMiddleware)
 		surveyHandler.RegisterRoutes(api, authMiddleware)
+		mfaHandler.RegisterRoutes(api, authMiddleware)
+		tokenHandler.RegisterRoutes(api, authMiddleware)
+		accountHandler.RegisterRoutes(api, authMiddleware)
+		organizationHandler.RegisterRoutes(api, authMiddleware)
+		campaignHandler.RegisterRoutes(api, authMiddleware)
+		actionItemHandler.RegisterRoutes(api, authMiddleware)
+		targetHandler.RegisterRoutes(api, authMiddleware)
+
+		if oidcHandler != nil {
+			oidcHandler.RegisterRoutes(api, authMiddleware)
+		}
 	}
 
 	// Health check
@@ -198,6 +334,7 @@ func setupRouter(
 		c.HTML(http.StatusNotFound, "error.html", gin.H{
 			"Title":      "Page Not Found",
 			"StatusCode": 404,
+			"CSRFToken":  auth.GetCSRFToken(c),
 		})
 	})
 
@@ -249,26 +386,43 @@ func loadTemplates(templatesPath string) (*template.Template, error) {
 	return tmpl, nil
 }
 
-// startBackgroundTasks starts background maintenance tasks
-func startBackgroundTasks(authService *auth.AuthService) {
-	// Clean up expired sessions every hour
-	ticker := time.NewTicker(1 * time.Hour)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			if err := authService.CleanupExpiredSessions(); err != nil {
-				log.Printf("Error cleaning up sessions: %v", err)
-			}
-		}
+// startBackgroundTasks runs background maintenance tasks and campaigns
+// until the context is canceled
+func startBackgroundTasks(
+	ctx context.Context,
+	cfg *config.Config,
+	authService *auth.AuthService,
+	oidcProvider *auth.OIDCProvider,
+	campaignService *services.CampaignService,
+) {
+	tasks := scheduler.New()
+
+	// Clean up expired sessions and tokens every hour
+	tasks.Every(time.Hour, "cleaning up sessions", authService.CleanupExpiredSessions)
+	tasks.Every(time.Hour, "cleaning up MFA challenges", authService.MFA().CleanupExpiredChallenges)
+	tasks.Every(time.Hour, "cleaning up login throttles", authService.Throttle().CleanupExpired)
+	tasks.Every(time.Hour, "cleaning up password resets", authService.CleanupExpiredPasswordResets)
+	tasks.Every(time.Hour, "cleaning up invitations", authService.CleanupExpiredInvitations)
+	if oidcProvider != nil {
+		tasks.Every(time.Hour, "cleaning up OIDC login requests", oidcProvider.CleanupExpiredRequests)
 	}
+
+	// Open campaigns and send their reminders
+	tasks.Every(cfg.Notify.CampaignInterval, "processing campaigns", campaignService.ProcessCampaigns)
+
+	tasks.Run(ctx)
 }
 
-// createDefaultAdmin creates a default admin user if none exists
-func createDefaultAdmin(userService *models.UserService, teamService *models.TeamService, roleService *models.RoleService) error {
-	// Check if any users exist
-	users, _, err := userService.ListUsers(0, 1, false)
+// createDefaultAdmin creates a default admin user if none exists. It is a
+// super admin and an admin of the default organization.
+func createDefaultAdmin(
+	userService *models.UserService,
+	teamService *models.TeamService,
+	roleService *models.RoleService,
+	organizationService *models.OrganizationService,
+) error {
+	// Check if any users exist, in any organization
+	users, _, err := userService.ListUsers(0, 0, 1, false)
 	if err != nil {
 		return err
 	}
@@ -289,13 +443,21 @@ func createDefaultAdmin(userService *models.UserService, teamService *models.Tea
 		adminPassword = "changeme123"
 	}
 
+	organization := &models.Organization{}
+	if err := organizationService.GetOrganizationBySlug(models.DefaultOrganizationSlug, organization); err != nil {
+		return fmt.Errorf("failed to get default organization: %w", err)
+	}
+
 	// Create default admin
 	log.Println("Creating default admin user...")
 	admin := &models.User{
-		Email:     adminEmail,
-		FirstName: "Admin",
-		LastName:  "User",
-		IsActive:  true,
+		OrganizationID: organization.ID,
+		Email:          adminEmail,
+		FirstName:      "Admin",
+		LastName:       "User",
+		IsActive:       true,
+		IsSuperAdmin:   true,
+		IsOrgAdmin:     true,
 	}
 
 	if err := userService.CreateUser(admin, adminPassword); err != nil {
@@ -304,8 +466,9 @@ func createDefaultAdmin(userService *models.UserService, teamService *models.Tea
 
 	// Create a default team
 	defaultTeam := &models.Team{
-		Name:        "Admin Team",
-		Description: "Default administrative team",
+		OrganizationID: organization.ID,
+		Name:           "Admin Team",
+		Description:    "Default administrative team",
 	}
 
 	if err := teamService.CreateTeam(defaultTeam); err != nil {
@@ -329,18 +492,167 @@ func createDefaultAdmin(userService *models.UserService, teamService *models.Tea
 	return nil
 }
 
+// grantSuperAdmins makes the users with the given emails super admins.
+// Super admins are only ever granted here, by the default admin and by other
+// super admins; rights are revoked through the users API.
+func grantSuperAdmins(userService *models.UserService, emails []string) {
+	for _, email := range emails {
+		user := &models.User{}
+		if err := userService.GetUserByEmail(email, user); err != nil {
+			log.Printf("Warning: Failed to grant super admin rights to %s: %v", email, err)
+			continue
+		}
+		if user.IsSuperAdmin {
+			continue
+		}
+
+		user.IsSuperAdmin = true
+		if err := userService.UpdateUser(user); err != nil {
+			log.Printf("Warning: Failed to grant super admin rights to %s: %v", email, err)
+			continue
+		}
+		log.Printf("Granted super admin rights to %s", email)
+	}
+}
+
+// credentialVerifiers builds the credential verifiers of the configured
+// authentication backends, in order
+func credentialVerifiers(cfg *config.Config, db *database.DB, userService *models.UserService) ([]auth.CredentialVerifier, error) {
+	var verifiers []auth.CredentialVerifier
+
+	for _, backend := range cfg.Security.AuthBackends {
+		switch backend {
+		case "local":
+			verifiers = append(verifiers, auth.NewLocalVerifier(userService))
+
+		case "ldap":
+			ldapCfg := cfg.Security.LDAP
+			mappings, err := auth.ParseGroupMappings(ldapCfg.GroupMappings)
+			if err != nil {
+				return nil, fmt.Errorf("invalid LDAP group mappings: %w", err)
+			}
+
+			verifiers = append(verifiers, auth.NewLDAPVerifier(db, auth.LDAPConfig{
+				URL:                ldapCfg.URL,
+				StartTLS:           ldapCfg.StartTLS,
+				InsecureSkipVerify: ldapCfg.InsecureSkipVerify,
+				BindDN:             ldapCfg.BindDN,
+				BindPassword:       ldapCfg.BindPassword,
+				BaseDN:             ldapCfg.BaseDN,
+				UserFilter:         ldapCfg.UserFilter,
+				SubjectAttribute:   ldapCfg.SubjectAttribute,
+				EmailAttribute:     ldapCfg.EmailAttribute,
+				FirstNameAttribute: ldapCfg.FirstNameAttribute,
+				LastNameAttribute:  ldapCfg.LastNameAttribute,
+				GroupAttribute:     ldapCfg.GroupAttribute,
+				GroupMappings:      mappings,
+				Organization:       ldapCfg.Organization,
+				Timeout:            ldapCfg.Timeout,
+				TrustEmail:         ldapCfg.TrustEmail,
+			}))
+
+		default:
+			return nil, fmt.Errorf("unknown authentication backend: %s", backend)
+		}
+	}
+
+	return verifiers, nil
+}
+
+// newPasswordPolicy builds the configured password policy
+func newPasswordPolicy(cfg *config.Config) (*auth.PasswordPolicy, error) {
+	policyCfg := cfg.Security.PasswordPolicy
+	policy := &auth.PasswordPolicy{
+		MinLength:        policyCfg.MinLength,
+		RequireUppercase: policyCfg.RequireUppercase,
+		RequireLowercase: policyCfg.RequireLowercase,
+		RequireDigit:     policyCfg.RequireDigit,
+		RequireSymbol:    policyCfg.RequireSymbol,
+		HistorySize:      policyCfg.HistorySize,
+	}
+
+	if policyCfg.BreachedListPath != "" {
+		if err := policy.LoadBreachedPasswords(policyCfg.BreachedListPath); err != nil {
+			return nil, err
+		}
+		log.Printf("Loaded %d breached passwords", policy.BreachedCount())
+	}
+
+	return policy, nil
+}
+
+// newMailer builds the configured mailer
+func newMailer(cfg *config.Config) mail.Mailer {
+	if cfg.Mail.Backend == "smtp" {
+		return mail.NewSMTPMailer(mail.SMTPConfig{
+			Host:     cfg.Mail.SMTPHost,
+			Port:     cfg.Mail.SMTPPort,
+			Username: cfg.Mail.SMTPUsername,
+			Password: cfg.Mail.SMTPPassword,
+			TLSMode:  cfg.Mail.SMTPTLS,
+			From:     cfg.Mail.From,
+		})
+	}
+	return mail.NewLogMailer(cfg.Mail.From, cfg.Mail.LogFile)
+}
+
+// newNotifier builds the configured campaign notifiers
+func newNotifier(cfg *config.Config, mailer mail.Mailer) notify.Notifier {
+	var notifiers notify.MultiNotifier
+	for _, name := range cfg.Notify.Notifiers {
+		switch name {
+		case "mail":
+			notifiers = append(notifiers, notify.NewMailNotifier(mailer))
+		case "webhook":
+			notifiers = append(notifiers, notify.NewWebhookNotifier(cfg.Notify.WebhookURL))
+		}
+	}
+	return notifiers
+}
+
+// hasAuthBackend reports whether an authentication backend is enabled
+func hasAuthBackend(cfg *config.Config, name string) bool {
+	for _, backend := range cfg.Security.AuthBackends {
+		if backend == name {
+			return true
+		}
+	}
+	return false
+}
+
 // Page rendering functions
 
-func renderLogin(c *gin.Context) {
-	c.HTML(http.StatusOK, "login.html", gin.H{
-		"Title": "Login - DevOps Assessment",
-	})
+func renderLogin(ssoEnabled, usernameLogin, passwordReset bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.HTML(http.StatusOK, "login.html", gin.H{
+			"Title":         "Login - DevOps Assessment",
+			"SSOEnabled":    ssoEnabled,
+			"UsernameLogin": usernameLogin,
+			"PasswordReset": passwordReset,
+			"CSRFToken":     auth.GetCSRFToken(c),
+		})
+	}
+}
+
+// renderAccountPage renders a password reset or invitation page, which
+// reads its token from the query string
+func renderAccountPage(name, title string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Keep the token out of Referer headers sent to script CDNs
+		c.Header("Referrer-Policy", "no-referrer")
+		c.HTML(http.StatusOK, name, gin.H{
+			"Title":     title + " - DevOps Assessment",
+			"Token":     c.Query("token"),
+			"CSRFToken": auth.GetCSRFToken(c),
+		})
+	}
 }
 
 func renderAbout(c *gin.Context) {
 	c.HTML(http.StatusOK, "about.html", gin.H{
 		"Title":      "About - DevOps Assessment",
 		"ActivePage": "About",
+		"CSRFToken":  auth.GetCSRFToken(c),
 	})
 }
 
@@ -361,5 +673,6 @@ func renderSurvey(c *gin.Context) {
 		"ActivePage": "Questionnaire",
 		"User":       user,
 		"Section":    section,
+		"CSRFToken":  auth.GetCSRFToken(c),
 	})
 }
@@ -7,6 +7,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"log"
 	"time"
 
 	"devops-assessment/internal/database"
@@ -19,6 +20,11 @@ import (
 type AuthService struct {
 	db          *database.DB
 	userService *models.UserService
+	verifiers   []CredentialVerifier
+	mfa         *MFAService
+	tokens      *APITokenService
+	throttle    *LoginThrottle
+	policy      *PasswordPolicy
 }
 
 // Session represents a user session
@@ -36,12 +42,50 @@ type Session struct {
 
 // NewAuthService creates a new authentication service
 func NewAuthService(db *database.DB) *AuthService {
+	userService := models.NewUserService(db)
+
 	return &AuthService{
 		db:          db,
-		userService: models.NewUserService(db),
+		userService: userService,
+		verifiers:   []CredentialVerifier{NewLocalVerifier(userService)},
+		mfa:         NewMFAService(db),
+		tokens:      NewAPITokenService(db),
+		throttle:    NewLoginThrottle(db, DefaultThrottleConfig()),
+		policy:      DefaultPasswordPolicy(),
 	}
 }
 
+// Tokens returns the API token service
+func (s *AuthService) Tokens() *APITokenService {
+	return s.tokens
+}
+
+// MFA returns the multi-factor authentication service
+func (s *AuthService) MFA() *MFAService {
+	return s.mfa
+}
+
+// Throttle returns the login throttle
+func (s *AuthService) Throttle() *LoginThrottle {
+	return s.throttle
+}
+
+// SetLoginThrottle replaces the login throttle
+func (s *AuthService) SetLoginThrottle(throttle *LoginThrottle) {
+	s.throttle = throttle
+}
+
+// SetPasswordPolicy replaces the password policy
+func (s *AuthService) SetPasswordPolicy(policy *PasswordPolicy) {
+	s.policy = policy
+}
+
+// SetCredentialVerifiers replaces the credential verifiers used by Login.
+// They are tried in order until one accepts the credentials.
+func (s *AuthService) SetCredentialVerifiers(verifiers ...CredentialVerifier) {
+	s.verifiers = verifiers
+}
+
 // Common errors
 var (
 	ErrInvalidCredentials = errors.New("invalid email or password")
@@ -56,22 +100,143 @@ const (
 	TokenLength     = 32                 // bytes
 )
 
-// Login authenticates a user and creates a session
-func (s *AuthService) Login(email, password string) (*Session, error) {
+// Login authenticates a user and creates a session. Users who have to pass
+// a second factor get a challenge instead, which is completed with
+// CompleteMFALogin, and their failures are only cleared once they pass it.
+// Logins are throttled per username and client IP; a refused login returns
+// a *ThrottleError.
+func (s *AuthService) Login(username, password, clientIP string) (*Session, *MFAChallenge, error) {
+	if err := s.throttle.Check(username, clientIP); err != nil {
+		return nil, nil, err
+	}
+
 	// Validate credentials
-	user, err := s.userService.ValidateCredentials(email, password)
+	user, err := s.VerifyCredentials(username, password)
+	if err == ErrInvalidCredentials {
+		if recordErr := s.throttle.RecordFailure(username, clientIP); recordErr != nil {
+			return nil, nil, recordErr
+		}
+		return nil, nil, err
+	}
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	challenge, err := s.mfa.ChallengeFor(user.ID, username)
+	if err != nil {
+		return nil, nil, err
+	}
+	if challenge != nil {
+		return nil, challenge, nil
+	}
+
+	if err := s.throttle.RecordSuccess(username); err != nil {
+		return nil, nil, err
 	}
 
 	// Create session
 	session, err := s.CreateSession(user.ID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create session: %w", err)
+		return nil, nil, fmt.Errorf("failed to create session: %w", err)
 	}
 
 	session.User = user
-	return session, nil
+	return session, nil, nil
+}
+
+// MFALoginResult is the outcome of a completed second factor
+type MFALoginResult struct {
+	Session *Session
+	Method  string // MFAMethodTOTP or MFAMethodRecoveryCode
+
+	// New recovery codes, when the login completed a required enrollment
+	RecoveryCodes []string
+}
+
+// CompleteMFALogin checks the second factor of a challenge and creates the
+// session. Wrong codes count against the challenge, and against the login
+// name and client IP like wrong passwords, so that new challenges can't be
+// used to guess codes; a refused attempt returns a *ThrottleError.
+func (s *AuthService) CompleteMFALogin(challenge *MFAChallenge, code, clientIP string) (*MFALoginResult, error) {
+	if err := s.throttle.Check(challenge.LoginName, clientIP); err != nil {
+		return nil, err
+	}
+
+	result := &MFALoginResult{Method: MFAMethodTOTP}
+
+	var err error
+	if challenge.EnrollmentRequired {
+		result.RecoveryCodes, err = s.mfa.ConfirmEnrollment(challenge.UserID, code)
+	} else {
+		result.Method, err = s.mfa.Verify(challenge.UserID, code)
+	}
+	if err == ErrMFACodeInvalid {
+		if recordErr := s.mfa.RecordFailedAttempt(challenge); recordErr != nil {
+			return nil, recordErr
+		}
+		if recordErr := s.throttle.RecordFailure(challenge.LoginName, clientIP); recordErr != nil {
+			return nil, recordErr
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.mfa.consumeChallenge(challenge); err != nil {
+		return nil, err
+	}
+
+	// The account may have been deactivated since the password was checked
+	user := &models.User{}
+	if err := s.userService.GetUserByID(challenge.UserID, user); err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if !user.IsActive {
+		return nil, ErrUserInactive
+	}
+
+	if err := s.throttle.RecordSuccess(challenge.LoginName); err != nil {
+		return nil, err
+	}
+
+	result.Session, err = s.CreateSession(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	result.Session.User = user
+
+	return result, nil
+}
+
+// VerifyCredentials tries each credential verifier in turn. Wrong
+// credentials fall through to the next verifier; an inactive account stops
+// the login. When no verifier accepts the credentials, the first backend
+// failure is returned, or ErrInvalidCredentials if there was none.
+func (s *AuthService) VerifyCredentials(username, password string) (*models.User, error) {
+	var backendErr error
+
+	for _, verifier := range s.verifiers {
+		user, err := verifier.Verify(username, password)
+		switch {
+		case err == nil:
+			return user, nil
+		case errors.Is(err, ErrInvalidCredentials):
+			continue
+		case errors.Is(err, ErrUserInactive):
+			return nil, ErrUserInactive
+		default:
+			log.Printf("Credential verifier %s failed: %v", verifier.Name(), err)
+			if backendErr == nil {
+				backendErr = err
+			}
+		}
+	}
+
+	if backendErr != nil {
+		return nil, backendErr
+	}
+	return nil, ErrInvalidCredentials
 }
 
 // CreateSession creates a new session for a user
@@ -273,6 +438,10 @@ func (s *AuthService) ChangePassword(userID int, oldPassword, newPassword string
 		return ErrInvalidCredentials
 	}
 
+	if err := s.CheckPassword(userID, newPassword); err != nil {
+		return err
+	}
+
 	// Update password
 	if err := s.userService.UpdatePassword(userID, newPassword); err != nil {
 		return fmt.Errorf("failed to update password: %w", err)
@@ -288,6 +457,10 @@ func (s *AuthService) ChangePassword(userID int, oldPassword, newPassword string
 
 // ResetPassword resets a user's password (admin action)
 func (s *AuthService) ResetPassword(userID int, newPassword string) error {
+	if err := s.CheckPassword(userID, newPassword); err != nil {
+		return err
+	}
+
 	// Update password
 	if err := s.userService.UpdatePassword(userID, newPassword); err != nil {
 		return fmt.Errorf("failed to reset password: %w", err)
@@ -301,8 +474,42 @@ func (s *AuthService) ResetPassword(userID int, newPassword string) error {
 	return nil
 }
 
+// CreateUser creates a user with a password chosen by a person, which has
+// to meet the password policy
+func (s *AuthService) CreateUser(user *models.User, password string) error {
+	if err := s.CheckPassword(0, password); err != nil {
+		return err
+	}
+	return s.userService.CreateUser(user, password)
+}
+
+// CheckPassword checks a new password against the password policy. For
+// existing users (userID > 0) it also rejects recently used passwords.
+// Policy violations wrap ErrPasswordPolicy.
+func (s *AuthService) CheckPassword(userID int, password string) error {
+	if err := s.policy.Check(password); err != nil {
+		return err
+	}
+
+	if userID == 0 || s.policy.HistorySize == 0 {
+		return nil
+	}
+
+	hashes, err := s.userService.GetPasswordHashes(userID, s.policy.HistorySize)
+	if err != nil {
+		return err
+	}
+	return s.policy.CheckReuse(password, hashes)
+}
+
 // Helper functions
 
+// GenerateRandomPassword returns a random password for accounts that never
+// log in with a password, such as service accounts
+func GenerateRandomPassword() (string, error) {
+	return generateSecureToken(TokenLength)
+}
+
 // generateSecureToken generates a cryptographically secure random token
 func generateSecureToken(length int) (string, error) {
 	bytes := make([]byte, length)
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"devops-assessment/internal/models"
+)
+
+// CredentialVerifier verifies a username and password and returns the
+// matching user. Implementations return ErrInvalidCredentials when the
+// credentials are wrong or unknown to them, so the next verifier is tried.
+type CredentialVerifier interface {
+	// Name identifies the verifier in logs and configuration
+	Name() string
+	Verify(username, password string) (*models.User, error)
+}
+
+// LocalVerifier verifies passwords against the bcrypt hashes in the users table
+type LocalVerifier struct {
+	userService *models.UserService
+}
+
+// NewLocalVerifier creates a new local password verifier
+func NewLocalVerifier(userService *models.UserService) *LocalVerifier {
+	return &LocalVerifier{userService: userService}
+}
+
+// Name returns the verifier name
+func (v *LocalVerifier) Name() string {
+	return "local"
+}
+
+// Verify validates an email and password
+func (v *LocalVerifier) Verify(email, password string) (*models.User, error) {
+	user, err := v.userService.ValidateCredentials(email, password)
+	switch err {
+	case nil:
+		// Service accounts have no usable password, but never let them
+		// log in interactively even if one was set
+		if user.IsServiceAccount {
+			return nil, ErrInvalidCredentials
+		}
+		return user, nil
+	case models.ErrInvalidCredentials:
+		return nil, ErrInvalidCredentials
+	case models.ErrUserInactive:
+		return nil, ErrUserInactive
+	default:
+		return nil, err
+	}
+}
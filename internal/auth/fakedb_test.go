@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"devops-assessment/internal/database"
+)
+
+// fakeAnswer is the answer to a query: the rows it selects, or for other
+// statements the rows it affects and the ID it inserts
+type fakeAnswer struct {
+	rows         [][]driver.Value
+	rowsAffected int64
+	lastInsertID int64
+}
+
+// fakeHandler answers a query. It returns ok = false for queries it doesn't
+// know, which fail the test.
+type fakeHandler func(query string, args []driver.Value) (answer fakeAnswer, ok bool)
+
+// fakeDB stands in for MySQL in tests: every query is answered by a handler,
+// so tests describe the rows the code under test reads rather than a schema.
+// Executed statements are recorded.
+type fakeDB struct {
+	t       testing.TB
+	handler fakeHandler
+
+	mu       sync.Mutex
+	executed []string
+}
+
+// newFakeDB opens a database whose queries are answered by handler
+func newFakeDB(t testing.TB, handler fakeHandler) (*database.DB, *fakeDB) {
+	t.Helper()
+
+	fake := &fakeDB{t: t, handler: handler}
+	db := sql.OpenDB(fakeConnector{fake})
+	t.Cleanup(func() { db.Close() })
+
+	return &database.DB{DB: db}, fake
+}
+
+// rows builds the rows of an answer. Ints are converted to the int64 that
+// drivers return.
+func rows(values ...[]interface{}) [][]driver.Value {
+	result := make([][]driver.Value, 0, len(values))
+	for _, row := range values {
+		converted := make([]driver.Value, len(row))
+		for i, value := range row {
+			if n, ok := value.(int); ok {
+				value = int64(n)
+			}
+			converted[i] = value
+		}
+		result = append(result, converted)
+	}
+	return result
+}
+
+// row is a row of values for rows
+func row(values ...interface{}) []interface{} {
+	return values
+}
+
+// Executed returns the statements other than queries run so far
+func (f *fakeDB) Executed() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.executed...)
+}
+
+func (f *fakeDB) answer(query string, args []driver.NamedValue, exec bool) (fakeAnswer, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+
+	if exec {
+		f.mu.Lock()
+		f.executed = append(f.executed, query)
+		f.mu.Unlock()
+	}
+
+	answer, ok := f.handler(query, values)
+	if !ok {
+		f.t.Errorf("unexpected query: %s %v", query, values)
+		return answer, errors.New("unexpected query")
+	}
+	return answer, nil
+}
+
+type fakeConnector struct {
+	db *fakeDB
+}
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{db: c.db}, nil
+}
+
+func (c fakeConnector) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("open fake databases with newFakeDB")
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	answer, err := c.db.answer(query, args, false)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{rows: answer.rows}, nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	answer, err := c.db.answer(query, args, true)
+	if err != nil {
+		return nil, err
+	}
+	return fakeResult(answer), nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, namedValues(args))
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, namedValues(args))
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
+
+type fakeResult fakeAnswer
+
+func (r fakeResult) LastInsertId() (int64, error) { return r.lastInsertID, nil }
+func (r fakeResult) RowsAffected() (int64, error) { return r.rowsAffected, nil }
+
+type fakeRows struct {
+	rows [][]driver.Value
+	next int
+}
+
+// Columns are unnamed; only their number matters to Scan
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	return make([]string, len(r.rows[0]))
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
@@ -0,0 +1,269 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"devops-assessment/internal/models"
+)
+
+// Invitation errors
+var (
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrInvitationInvalid  = errors.New("invalid, expired or already accepted invitation")
+)
+
+// InvitationDuration is how long an invitation can be accepted
+const InvitationDuration = 7 * 24 * time.Hour
+
+// Invitation invites someone to create an account. Accepting it creates
+// the user in the team's organization, as a member of the chosen team with
+// the chosen role.
+type Invitation struct {
+	ID             int        `json:"id"`
+	OrganizationID int        `json:"organization_id"` // The team's organization
+	Email          string     `json:"email"`
+	FirstName      string     `json:"first_name"`
+	LastName       string     `json:"last_name"`
+	TeamID         int        `json:"team_id"`
+	TeamName       string     `json:"team_name"`
+	RoleID         int        `json:"role_id"`
+	RoleName       string     `json:"role_name"`
+	InvitedBy      int        `json:"invited_by,omitempty"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	AcceptedAt     *time.Time `json:"accepted_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+const invitationColumns = `
+	i.id, t.organization_id, i.email, i.first_name, i.last_name, i.team_id, t.name, i.role_id,
+	r.name, i.invited_by, i.expires_at, i.accepted_at, i.created_at
+`
+
+const invitationJoins = `
+	JOIN teams t ON i.team_id = t.id
+	JOIN roles r ON i.role_id = r.id
+`
+
+// CreateInvitation stores an invitation and returns its token. It replaces
+// pending invitations for the same email.
+func (s *AuthService) CreateInvitation(invitation *Invitation) (string, error) {
+	exists, err := s.db.Exists("SELECT 1 FROM users WHERE email = ?", invitation.Email)
+	if err != nil {
+		return "", fmt.Errorf("failed to check email existence: %w", err)
+	}
+	if exists {
+		return "", models.ErrEmailAlreadyExists
+	}
+
+	token, err := generateSecureToken(TokenLength)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	now := time.Now()
+	invitation.CreatedAt = now
+	invitation.ExpiresAt = now.Add(InvitationDuration)
+
+	var invitedBy interface{}
+	if invitation.InvitedBy > 0 {
+		invitedBy = invitation.InvitedBy
+	}
+
+	err = s.db.Transaction(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(
+			"DELETE FROM user_invitations WHERE email = ? AND accepted_at IS NULL",
+			invitation.Email,
+		); err != nil {
+			return err
+		}
+
+		result, err := tx.Exec(`
+			INSERT INTO user_invitations
+				(email, first_name, last_name, team_id, role_id, token_hash, invited_by, expires_at, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`,
+			invitation.Email,
+			invitation.FirstName,
+			invitation.LastName,
+			invitation.TeamID,
+			invitation.RoleID,
+			hashToken(token),
+			invitedBy,
+			invitation.ExpiresAt,
+			invitation.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		invitation.ID = int(id)
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create invitation: %w", err)
+	}
+
+	return token, nil
+}
+
+// GetInvitation returns the pending invitation for a token
+func (s *AuthService) GetInvitation(token string) (*Invitation, error) {
+	query := `SELECT ` + invitationColumns + `
+		FROM user_invitations i ` + invitationJoins + `
+		WHERE i.token_hash = ? AND i.accepted_at IS NULL AND i.expires_at > ?
+	`
+
+	invitation := &Invitation{}
+	err := scanInvitation(s.db.QueryRowContext(context.Background(), query, hashToken(token), time.Now()), invitation)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvitationInvalid
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invitation: %w", err)
+	}
+
+	return invitation, nil
+}
+
+// ListInvitations returns the invitations to teams of an organization that
+// haven't been accepted, including expired ones
+func (s *AuthService) ListInvitations(organizationID int) ([]Invitation, error) {
+	query := `SELECT ` + invitationColumns + `
+		FROM user_invitations i ` + invitationJoins + `
+		WHERE i.accepted_at IS NULL AND t.organization_id = ?
+		ORDER BY i.created_at DESC
+	`
+
+	rows, err := s.db.GetMany(query, organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+	defer rows.Close()
+
+	invitations := []Invitation{}
+	for rows.Next() {
+		var invitation Invitation
+		if err := scanInvitation(rows, &invitation); err != nil {
+			return nil, fmt.Errorf("failed to scan invitation: %w", err)
+		}
+		invitations = append(invitations, invitation)
+	}
+
+	return invitations, nil
+}
+
+// RevokeInvitation deletes an invitation to a team of an organization that
+// hasn't been accepted
+func (s *AuthService) RevokeInvitation(id, organizationID int) error {
+	affected, err := s.db.Delete(`
+		DELETE i FROM user_invitations i
+		JOIN teams t ON i.team_id = t.id
+		WHERE i.id = ? AND i.accepted_at IS NULL AND t.organization_id = ?
+	`, id, organizationID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke invitation: %w", err)
+	}
+
+	if affected == 0 {
+		return ErrInvitationNotFound
+	}
+
+	return nil
+}
+
+// AcceptInvitation creates the invited user with a password that meets the
+// password policy and adds them to the invitation's team. Empty names fall
+// back to those the inviter entered.
+func (s *AuthService) AcceptInvitation(token, password, firstName, lastName string) (*models.User, error) {
+	invitation, err := s.GetInvitation(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if firstName == "" {
+		firstName = invitation.FirstName
+	}
+	if lastName == "" {
+		lastName = invitation.LastName
+	}
+
+	user := &models.User{
+		OrganizationID: invitation.OrganizationID,
+		Email:          invitation.Email,
+		FirstName:      firstName,
+		LastName:       lastName,
+		IsActive:       true,
+	}
+
+	// The email is unique, so an invitation can't create two users
+	if err := s.CreateUser(user, password); err != nil {
+		return nil, err
+	}
+
+	if err := s.userService.AddUserToTeam(user.ID, invitation.TeamID, invitation.RoleID); err != nil {
+		return nil, fmt.Errorf("failed to add user to team: %w", err)
+	}
+
+	if _, err := s.db.Update(
+		"UPDATE user_invitations SET accepted_at = CURRENT_TIMESTAMP WHERE id = ?",
+		invitation.ID,
+	); err != nil {
+		return nil, fmt.Errorf("failed to accept invitation: %w", err)
+	}
+
+	return user, nil
+}
+
+// CleanupExpiredInvitations removes invitations that expired a while ago
+func (s *AuthService) CleanupExpiredInvitations() error {
+	query := `DELETE FROM user_invitations WHERE accepted_at IS NULL AND expires_at < ?`
+
+	if _, err := s.db.Delete(query, time.Now().Add(-InvitationDuration)); err != nil {
+		return fmt.Errorf("failed to cleanup invitations: %w", err)
+	}
+
+	return nil
+}
+
+// scanInvitation scans an invitation row
+func scanInvitation(row interface{ Scan(...interface{}) error }, invitation *Invitation) error {
+	var firstName, lastName sql.NullString
+	var invitedBy sql.NullInt64
+	var acceptedAt sql.NullTime
+
+	err := row.Scan(
+		&invitation.ID,
+		&invitation.OrganizationID,
+		&invitation.Email,
+		&firstName,
+		&lastName,
+		&invitation.TeamID,
+		&invitation.TeamName,
+		&invitation.RoleID,
+		&invitation.RoleName,
+		&invitedBy,
+		&invitation.ExpiresAt,
+		&acceptedAt,
+		&invitation.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	invitation.FirstName = firstName.String
+	invitation.LastName = lastName.String
+	invitation.InvitedBy = int(invitedBy.Int64)
+	if acceptedAt.Valid {
+		invitation.AcceptedAt = &acceptedAt.Time
+	}
+
+	return nil
+}
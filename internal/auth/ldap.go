@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"time"
+
+	"devops-assessment/internal/database"
+	"devops-assessment/internal/models"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LDAPProviderName identifies LDAP identities in user_identities
+const LDAPProviderName = "ldap"
+
+// LDAPConfig configures the LDAP / Active Directory credential verifier
+type LDAPConfig struct {
+	URL                string // e.g. ldaps://ldap.example.com:636
+	StartTLS           bool
+	InsecureSkipVerify bool
+	BindDN             string // Service account used to search for users
+	BindPassword       string
+	BaseDN             string
+	UserFilter         string // {username} is replaced by the escaped username
+	SubjectAttribute   string // Stable user ID, e.g. entryUUID or objectGUID; the DN if empty
+	EmailAttribute     string
+	FirstNameAttribute string
+	LastNameAttribute  string
+	GroupAttribute     string // Attribute listing the user's group DNs, e.g. memberOf
+	GroupMappings      []GroupMapping
+	Organization       string // Slug of the organization new users are created in
+	Timeout            time.Duration
+
+	// TrustEmail links users to existing accounts with the email of their
+	// EmailAttribute. Otherwise accounts are only linked explicitly.
+	TrustEmail bool
+}
+
+// LDAPVerifier verifies credentials by binding to an LDAP directory as the
+// user. Users are provisioned just in time on their first login.
+type LDAPVerifier struct {
+	config      LDAPConfig
+	provisioner *Provisioner
+	dial        func() (ldapConn, error) // connect, unless a test stands in for the directory
+}
+
+// ldapConn is the part of an LDAP connection the verifier uses
+type ldapConn interface {
+	Bind(username, password string) error
+	Search(request *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close() error
+}
+
+// NewLDAPVerifier creates a new LDAP credential verifier
+func NewLDAPVerifier(db *database.DB, config LDAPConfig) *LDAPVerifier {
+	if config.UserFilter == "" {
+		config.UserFilter = "(&(objectClass=person)(|(uid={username})(mail={username})))"
+	}
+	if config.EmailAttribute == "" {
+		config.EmailAttribute = "mail"
+	}
+	if config.FirstNameAttribute == "" {
+		config.FirstNameAttribute = "givenName"
+	}
+	if config.LastNameAttribute == "" {
+		config.LastNameAttribute = "sn"
+	}
+	if config.GroupAttribute == "" {
+		config.GroupAttribute = "memberOf"
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	verifier := &LDAPVerifier{
+		config:      config,
+		provisioner: NewProvisioner(db),
+	}
+	verifier.dial = verifier.connect
+
+	return verifier
+}
+
+// Name returns the verifier name
+func (v *LDAPVerifier) Name() string {
+	return LDAPProviderName
+}
+
+// Verify looks the user up with the service account, binds as the user to
+// check the password and provisions the user
+func (v *LDAPVerifier) Verify(username, password string) (*models.User, error) {
+	// An empty password would be an unauthenticated bind, which most
+	// directories accept for any DN
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := v.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if v.config.BindDN != "" {
+		if err := conn.Bind(v.config.BindDN, v.config.BindPassword); err != nil {
+			return nil, fmt.Errorf("failed to bind LDAP service account: %w", err)
+		}
+	}
+
+	entry, err := v.findUser(conn, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("failed to bind LDAP user: %w", err)
+	}
+
+	identity := &ExternalIdentity{
+		Provider:      LDAPProviderName,
+		Subject:       entry.DN,
+		Email:         entry.GetAttributeValue(v.config.EmailAttribute),
+		EmailVerified: v.config.TrustEmail,
+		FirstName:     entry.GetAttributeValue(v.config.FirstNameAttribute),
+		LastName:      entry.GetAttributeValue(v.config.LastNameAttribute),
+		Groups:        entry.GetAttributeValues(v.config.GroupAttribute),
+	}
+	if v.config.SubjectAttribute != "" {
+		identity.Subject = string(entry.GetRawAttributeValue(v.config.SubjectAttribute))
+	}
+
+	return v.provisioner.Provision(identity, v.config.Organization, v.config.GroupMappings)
+}
+
+// connect dials the directory and upgrades the connection if configured
+func (v *LDAPVerifier) connect() (ldapConn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: v.config.InsecureSkipVerify}
+
+	conn, err := ldap.DialURL(v.config.URL, ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to LDAP server: %w", err)
+	}
+	conn.SetTimeout(v.config.Timeout)
+
+	if v.config.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+
+	return conn, nil
+}
+
+// findUser searches for the single entry matching the username
+func (v *LDAPVerifier) findUser(conn ldapConn, username string) (*ldap.Entry, error) {
+	attributes := []string{
+		v.config.EmailAttribute,
+		v.config.FirstNameAttribute,
+		v.config.LastNameAttribute,
+		v.config.GroupAttribute,
+	}
+	if v.config.SubjectAttribute != "" {
+		attributes = append(attributes, v.config.SubjectAttribute)
+	}
+
+	request := ldap.NewSearchRequest(
+		v.config.BaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		2, // Size limit, more than one match is an error
+		int(v.config.Timeout.Seconds()),
+		false,
+		strings.ReplaceAll(v.config.UserFilter, "{username}", ldap.EscapeFilter(username)),
+		attributes,
+		nil,
+	)
+
+	result, err := conn.Search(request)
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("failed to search LDAP user: %w", err)
+	}
+
+	if result == nil || len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+
+	return result.Entries[0], nil
+}
@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	ldapServiceDN = "cn=service,dc=example,dc=com"
+	ldapAliceDN   = "uid=alice,ou=people,dc=example,dc=com"
+)
+
+// fakeDirectory stands in for an LDAP directory: binds succeed with the
+// passwords of its DNs, and searches return the entries stored for their
+// filter. Binds and filters are recorded.
+type fakeDirectory struct {
+	passwords map[string]string        // DN to password
+	entries   map[string][]*ldap.Entry // Filter to the entries it matches
+
+	mu      sync.Mutex
+	binds   []string
+	filters []string
+}
+
+func newFakeDirectory() *fakeDirectory {
+	alice := ldap.NewEntry(ldapAliceDN, map[string][]string{
+		"mail":      {"alice@example.com"},
+		"givenName": {"Alice"},
+		"sn":        {"Liddell"},
+		"entryUUID": {"5f3c1a2e-alice"},
+		"memberOf":  {"cn=devops admins,ou=groups,dc=example,dc=com", "cn=staff,ou=groups,dc=example,dc=com"},
+	})
+	member := ldap.NewEntry("uid=member,ou=people,dc=example,dc=com", map[string][]string{
+		"mail": {"member@example.com"},
+	})
+	twin := ldap.NewEntry("uid=twin,ou=other,dc=example,dc=com", nil)
+
+	return &fakeDirectory{
+		passwords: map[string]string{
+			ldapServiceDN:                            "service-secret",
+			ldapAliceDN:                              "alice-secret",
+			"uid=member,ou=people,dc=example,dc=com": "member-secret",
+		},
+		entries: map[string][]*ldap.Entry{
+			"(uid=alice)":  {alice},
+			"(uid=member)": {member},
+			"(uid=twin)":   {twin, twin},
+		},
+	}
+}
+
+func (d *fakeDirectory) dial() (ldapConn, error) {
+	return &fakeLDAPConn{directory: d}, nil
+}
+
+type fakeLDAPConn struct {
+	directory *fakeDirectory
+}
+
+func (c *fakeLDAPConn) Bind(username, password string) error {
+	d := c.directory
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.binds = append(d.binds, username)
+	if want, exists := d.passwords[username]; !exists || password != want {
+		return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+	}
+	return nil
+}
+
+func (c *fakeLDAPConn) Search(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	d := c.directory
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.filters = append(d.filters, request.Filter)
+	if _, err := ldap.CompileFilter(request.Filter); err != nil {
+		return nil, err
+	}
+	return &ldap.SearchResult{Entries: d.entries[request.Filter]}, nil
+}
+
+func (c *fakeLDAPConn) Close() error {
+	return nil
+}
+
+// newTestLDAPVerifier creates a verifier against a fake directory, with
+// provisioning against directoryDB
+func newTestLDAPVerifier(t *testing.T, directory *fakeDirectory, directoryDB *provisioningDB, config LDAPConfig) *LDAPVerifier {
+	t.Helper()
+
+	db, _ := newFakeDB(t, directoryDB.answer)
+
+	config.BindDN = ldapServiceDN
+	config.BindPassword = "service-secret"
+	config.BaseDN = "dc=example,dc=com"
+	if config.UserFilter == "" {
+		config.UserFilter = "(uid={username})"
+	}
+	config.Organization = "default"
+
+	verifier := NewLDAPVerifier(db, config)
+	verifier.dial = directory.dial
+	return verifier
+}
+
+func TestLDAPVerify(t *testing.T) {
+	mappings, err := ParseGroupMappings("CN=DevOps Admins,OU=Groups,DC=example,DC=com|team:Platform|admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		config     LDAPConfig
+		username   string
+		password   string
+		wantErr    error
+		wantBinds  []string
+		wantLinked string // Subject the user is linked with, or would have been
+		wantGrants []string
+	}{
+		{
+			name:       "valid password",
+			config:     LDAPConfig{GroupMappings: mappings},
+			username:   "alice",
+			password:   "alice-secret",
+			wantBinds:  []string{ldapServiceDN, ldapAliceDN},
+			wantLinked: ldapAliceDN,
+			wantGrants: []string{"team 200 1"},
+		},
+		{
+			name:       "subject attribute",
+			config:     LDAPConfig{SubjectAttribute: "entryUUID"},
+			username:   "alice",
+			password:   "alice-secret",
+			wantBinds:  []string{ldapServiceDN, ldapAliceDN},
+			wantLinked: "5f3c1a2e-alice",
+		},
+		{
+			name:      "wrong password",
+			username:  "alice",
+			password:  "guess",
+			wantErr:   ErrInvalidCredentials,
+			wantBinds: []string{ldapServiceDN, ldapAliceDN},
+		},
+		{
+			name:      "unknown user",
+			username:  "mallory",
+			password:  "guess",
+			wantErr:   ErrInvalidCredentials,
+			wantBinds: []string{ldapServiceDN},
+		},
+		{
+			name:      "ambiguous user",
+			username:  "twin",
+			password:  "guess",
+			wantErr:   ErrInvalidCredentials,
+			wantBinds: []string{ldapServiceDN},
+		},
+		{
+			name:     "empty password",
+			username: "alice",
+			wantErr:  ErrInvalidCredentials,
+		},
+		{
+			name:       "email of an existing user",
+			username:   "member",
+			password:   "member-secret",
+			wantErr:    ErrIdentityNotLinkable,
+			wantBinds:  []string{ldapServiceDN, "uid=member,ou=people,dc=example,dc=com"},
+			wantLinked: "uid=member,ou=people,dc=example,dc=com",
+		},
+		{
+			name:       "trusted email of an existing user",
+			config:     LDAPConfig{TrustEmail: true},
+			username:   "member",
+			password:   "member-secret",
+			wantBinds:  []string{ldapServiceDN, "uid=member,ou=people,dc=example,dc=com"},
+			wantLinked: "uid=member,ou=people,dc=example,dc=com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			directory := newFakeDirectory()
+			directoryDB := newProvisioningDB(directoryUser{id: 2101, email: "member@example.com"})
+			verifier := newTestLDAPVerifier(t, directory, directoryDB, tt.config)
+
+			user, err := verifier.Verify(tt.username, tt.password)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(directory.binds, tt.wantBinds) {
+				t.Errorf("binds = %v, want %v", directory.binds, tt.wantBinds)
+			}
+			if tt.wantErr != nil {
+				if linked := directoryDB.Linked(LDAPProviderName, tt.wantLinked); tt.wantLinked != "" && linked != 0 {
+					t.Errorf("identity was linked")
+				}
+				return
+			}
+
+			if linked := directoryDB.Linked(LDAPProviderName, tt.wantLinked); linked != user.ID {
+				t.Errorf("identity %s linked to %d, want %d", tt.wantLinked, linked, user.ID)
+			}
+			if grants := directoryDB.Grants(); !reflect.DeepEqual(grants, tt.wantGrants) {
+				t.Errorf("grants = %v, want %v", grants, tt.wantGrants)
+			}
+		})
+	}
+}
+
+func TestLDAPVerifyEscapesFilter(t *testing.T) {
+	tests := []struct {
+		username   string
+		wantFilter string
+	}{
+		{username: "alice", wantFilter: "(&(objectClass=person)(uid=alice))"},
+		{username: "*", wantFilter: `(&(objectClass=person)(uid=\2a))`},
+		{username: "alice)(uid=*", wantFilter: `(&(objectClass=person)(uid=alice\29\28uid=\2a))`},
+		{username: `a\b`, wantFilter: `(&(objectClass=person)(uid=a\5cb))`},
+		{username: "nul\x00", wantFilter: `(&(objectClass=person)(uid=nul\00))`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.username, func(t *testing.T) {
+			directory := newFakeDirectory()
+			verifier := newTestLDAPVerifier(t, directory, newProvisioningDB(),
+				LDAPConfig{UserFilter: "(&(objectClass=person)(uid={username}))"})
+
+			if _, err := verifier.Verify(tt.username, "guess"); !errors.Is(err, ErrInvalidCredentials) {
+				t.Fatalf("err = %v, want %v", err, ErrInvalidCredentials)
+			}
+			if want := []string{tt.wantFilter}; !reflect.DeepEqual(directory.filters, want) {
+				t.Errorf("filters = %v, want %v", directory.filters, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,474 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"devops-assessment/internal/database"
+	"devops-assessment/internal/models"
+)
+
+// MFA errors
+var (
+	ErrMFANotEnabled       = errors.New("multi-factor authentication is not enabled")
+	ErrMFAAlreadyEnabled   = errors.New("multi-factor authentication is already enabled")
+	ErrMFANotEnrolling     = errors.New("no multi-factor enrollment in progress")
+	ErrMFACodeInvalid      = errors.New("invalid verification code")
+	ErrMFAChallengeInvalid = errors.New("invalid or expired verification request")
+	ErrMFARequired         = errors.New("multi-factor authentication is required for your role")
+)
+
+const (
+	// MFAIssuer is shown as the account issuer in authenticator apps
+	MFAIssuer = "DevOps Assessment"
+
+	// MFAChallengeDuration is how long a user has to enter the second factor
+	// after entering their password
+	MFAChallengeDuration = 5 * time.Minute
+
+	// MFAMaxAttempts is the number of wrong codes after which a challenge is
+	// discarded and the user has to log in again
+	MFAMaxAttempts = 5
+
+	// RecoveryCodeCount is the number of recovery codes issued at a time
+	RecoveryCodeCount = 10
+)
+
+// Second factor methods
+const (
+	MFAMethodTOTP         = "totp"
+	MFAMethodRecoveryCode = "recovery_code"
+)
+
+// MFAStatus describes a user's multi-factor authentication setup
+type MFAStatus struct {
+	Enabled                bool       `json:"enabled"`
+	Required               bool       `json:"required"`
+	EnabledAt              *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodesRemaining int        `json:"recovery_codes_remaining"`
+}
+
+// MFAEnrollment holds the secret of a pending enrollment
+type MFAEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// MFAChallenge is a login waiting for its second factor. When
+// EnrollmentRequired is set, the user has no second factor yet but must
+// enroll one to complete the login.
+type MFAChallenge struct {
+	Token              string    `json:"mfa_token"`
+	UserID             int       `json:"-"`
+	LoginName          string    `json:"-"` // Wrong codes are throttled like wrong passwords for it
+	EnrollmentRequired bool      `json:"enrollment_required"`
+	Attempts           int       `json:"-"`
+	ExpiresAt          time.Time `json:"expires_at"`
+}
+
+// MFAService handles TOTP enrollment, verification and recovery codes
+type MFAService struct {
+	db             *database.DB
+	rbacService    *models.RBACService
+	settingService *models.SettingService
+}
+
+// NewMFAService creates a new MFA service
+func NewMFAService(db *database.DB) *MFAService {
+	return &MFAService{
+		db:             db,
+		rbacService:    models.NewRBACService(db),
+		settingService: models.NewSettingService(db),
+	}
+}
+
+// IsRequired reports whether a user must use multi-factor authentication
+func (s *MFAService) IsRequired(userID int) (bool, error) {
+	required, err := s.settingService.GetBool(models.SettingMFARequiredForAdmins, false)
+	if err != nil || !required {
+		return false, err
+	}
+
+	return s.rbacService.IsUserAdmin(userID)
+}
+
+// GetStatus returns a user's multi-factor authentication status
+func (s *MFAService) GetStatus(userID int) (*MFAStatus, error) {
+	status := &MFAStatus{}
+
+	var enabledAt sql.NullTime
+	err := s.db.QueryRowContext(context.Background(),
+		"SELECT enabled, enabled_at FROM user_mfa WHERE user_id = ?",
+		userID,
+	).Scan(&status.Enabled, &enabledAt)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get MFA status: %w", err)
+	}
+	if enabledAt.Valid && status.Enabled {
+		status.EnabledAt = &enabledAt.Time
+	}
+
+	err = s.db.QueryRowContext(context.Background(),
+		"SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = ? AND used_at IS NULL",
+		userID,
+	).Scan(&status.RecoveryCodesRemaining)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+
+	if status.Required, err = s.IsRequired(userID); err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// BeginEnrollment generates a new secret for a user. The secret is only
+// used once the user confirms a code generated from it; starting again
+// replaces a pending secret.
+func (s *MFAService) BeginEnrollment(user *models.User) (*MFAEnrollment, error) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate TOTP secret: %w", err)
+	}
+
+	// An enabled secret is never replaced here, see Disable
+	query := `
+		INSERT INTO user_mfa (user_id, secret, enabled)
+		VALUES (?, ?, false)
+		ON DUPLICATE KEY UPDATE
+			secret = IF(enabled, secret, VALUES(secret)),
+			last_used_step = IF(enabled, last_used_step, NULL)
+	`
+
+	if _, err := s.db.Insert(query, user.ID, secret); err != nil {
+		return nil, fmt.Errorf("failed to store TOTP secret: %w", err)
+	}
+
+	// Report a concurrent or earlier enrollment instead of a secret that
+	// was not stored
+	var storedSecret string
+	var enabled bool
+	if _, _, err := s.getSecret(user.ID, &storedSecret, &enabled); err != nil {
+		return nil, err
+	}
+	if enabled || storedSecret != secret {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	return &MFAEnrollment{
+		Secret:          secret,
+		ProvisioningURI: TOTPProvisioningURI(MFAIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmEnrollment enables multi-factor authentication once the user
+// proves they set up their authenticator, and returns the recovery codes
+func (s *MFAService) ConfirmEnrollment(userID int, code string) ([]string, error) {
+	var secret string
+	var enabled bool
+	found, lastStep, err := s.getSecret(userID, &secret, &enabled)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrMFANotEnrolling
+	}
+	if enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	step, ok := ValidateTOTP(secret, code, time.Now())
+	if !ok || step <= lastStep {
+		return nil, ErrMFACodeInvalid
+	}
+
+	query := `
+		UPDATE user_mfa
+		SET enabled = true, enabled_at = CURRENT_TIMESTAMP, last_used_step = ?
+		WHERE user_id = ? AND enabled = false AND secret = ?
+	`
+
+	affected, err := s.db.Update(query, step, userID, secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enable MFA: %w", err)
+	}
+	if affected == 0 {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	return s.RegenerateRecoveryCodes(userID)
+}
+
+// Verify checks a TOTP code or recovery code and returns the method used.
+// Each TOTP code and each recovery code is accepted only once.
+func (s *MFAService) Verify(userID int, code string) (string, error) {
+	var secret string
+	var enabled bool
+	found, lastStep, err := s.getSecret(userID, &secret, &enabled)
+	if err != nil {
+		return "", err
+	}
+	if !found || !enabled {
+		return "", ErrMFANotEnabled
+	}
+
+	if step, ok := ValidateTOTP(secret, code, time.Now()); ok && step > lastStep {
+		// The conditional update makes concurrent use of one code fail
+		query := `
+			UPDATE user_mfa SET last_used_step = ?
+			WHERE user_id = ? AND (last_used_step IS NULL OR last_used_step < ?)
+		`
+		affected, err := s.db.Update(query, step, userID, step)
+		if err != nil {
+			return "", fmt.Errorf("failed to record TOTP use: %w", err)
+		}
+		if affected == 1 {
+			return MFAMethodTOTP, nil
+		}
+		return "", ErrMFACodeInvalid
+	}
+
+	query := `
+		UPDATE user_recovery_codes SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+	`
+	affected, err := s.db.Update(query, userID, hashRecoveryCode(code))
+	if err != nil {
+		return "", fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	if affected > 0 {
+		return MFAMethodRecoveryCode, nil
+	}
+
+	return "", ErrMFACodeInvalid
+}
+
+// RegenerateRecoveryCodes replaces a user's recovery codes. The codes are
+// only returned here; the database keeps hashes.
+func (s *MFAService) RegenerateRecoveryCodes(userID int) ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		codes[i] = code
+	}
+
+	err := s.db.Transaction(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM user_recovery_codes WHERE user_id = ?", userID); err != nil {
+			return err
+		}
+
+		for _, code := range codes {
+			if _, err := tx.Exec(
+				"INSERT INTO user_recovery_codes (user_id, code_hash) VALUES (?, ?)",
+				userID, hashRecoveryCode(code),
+			); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store recovery codes: %w", err)
+	}
+
+	return codes, nil
+}
+
+// Disable removes a user's secret and recovery codes. It is used both when
+// users turn multi-factor authentication off and when an administrator
+// resets it for a user who lost their device.
+func (s *MFAService) Disable(userID int) error {
+	return s.db.Transaction(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM user_recovery_codes WHERE user_id = ?", userID); err != nil {
+			return fmt.Errorf("failed to delete recovery codes: %w", err)
+		}
+		if _, err := tx.Exec("DELETE FROM user_mfa WHERE user_id = ?", userID); err != nil {
+			return fmt.Errorf("failed to delete TOTP secret: %w", err)
+		}
+		return nil
+	})
+}
+
+// ChallengeFor returns a challenge if a user who logged in with a login name
+// has to pass a second factor before a session is created, or nil if the
+// first factor is enough
+func (s *MFAService) ChallengeFor(userID int, loginName string) (*MFAChallenge, error) {
+	var secret string
+	var enabled bool
+	if _, _, err := s.getSecret(userID, &secret, &enabled); err != nil {
+		return nil, err
+	}
+
+	if !enabled {
+		required, err := s.IsRequired(userID)
+		if err != nil {
+			return nil, err
+		}
+		if !required {
+			return nil, nil
+		}
+	}
+
+	token, err := generateSecureToken(TokenLength)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate MFA token: %w", err)
+	}
+
+	challenge := &MFAChallenge{
+		Token:              token,
+		UserID:             userID,
+		LoginName:          loginName,
+		EnrollmentRequired: !enabled,
+		ExpiresAt:          time.Now().Add(MFAChallengeDuration),
+	}
+
+	query := `
+		INSERT INTO mfa_challenges (token, user_id, login_name, expires_at)
+		VALUES (?, ?, ?, ?)
+	`
+
+	if _, err := s.db.Insert(query, challenge.Token, challenge.UserID, challenge.LoginName, challenge.ExpiresAt); err != nil {
+		return nil, fmt.Errorf("failed to create MFA challenge: %w", err)
+	}
+
+	return challenge, nil
+}
+
+// GetChallenge returns a pending challenge
+func (s *MFAService) GetChallenge(token string) (*MFAChallenge, error) {
+	if token == "" {
+		return nil, ErrMFAChallengeInvalid
+	}
+
+	challenge := &MFAChallenge{Token: token}
+	err := s.db.QueryRowContext(context.Background(),
+		"SELECT user_id, login_name, attempts, expires_at FROM mfa_challenges WHERE token = ?",
+		token,
+	).Scan(&challenge.UserID, &challenge.LoginName, &challenge.Attempts, &challenge.ExpiresAt)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrMFAChallengeInvalid
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get MFA challenge: %w", err)
+	}
+
+	if time.Now().After(challenge.ExpiresAt) || challenge.Attempts >= MFAMaxAttempts {
+		s.db.Delete("DELETE FROM mfa_challenges WHERE token = ?", token)
+		return nil, ErrMFAChallengeInvalid
+	}
+
+	// Whether enrollment is required is decided now rather than at login,
+	// so an enrollment finished elsewhere is honoured
+	var secret string
+	var enabled bool
+	if _, _, err := s.getSecret(challenge.UserID, &secret, &enabled); err != nil {
+		return nil, err
+	}
+	challenge.EnrollmentRequired = !enabled
+
+	return challenge, nil
+}
+
+// RecordFailedAttempt counts a wrong code against a challenge
+func (s *MFAService) RecordFailedAttempt(challenge *MFAChallenge) error {
+	_, err := s.db.Update(
+		"UPDATE mfa_challenges SET attempts = attempts + 1 WHERE token = ?",
+		challenge.Token,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record MFA attempt: %w", err)
+	}
+
+	return nil
+}
+
+// consumeChallenge deletes a challenge, failing if it was already used
+func (s *MFAService) consumeChallenge(challenge *MFAChallenge) error {
+	affected, err := s.db.Delete("DELETE FROM mfa_challenges WHERE token = ?", challenge.Token)
+	if err != nil {
+		return fmt.Errorf("failed to delete MFA challenge: %w", err)
+	}
+	if affected == 0 {
+		return ErrMFAChallengeInvalid
+	}
+
+	return nil
+}
+
+// CleanupExpiredChallenges removes challenges that were never completed
+func (s *MFAService) CleanupExpiredChallenges() error {
+	affected, err := s.db.Delete("DELETE FROM mfa_challenges WHERE expires_at < NOW()")
+	if err != nil {
+		return fmt.Errorf("failed to cleanup expired MFA challenges: %w", err)
+	}
+
+	if affected > 0 {
+		log.Printf("Cleaned up %d expired MFA challenges", affected)
+	}
+
+	return nil
+}
+
+// getSecret loads a user's secret. It reports whether the user has a secret
+// and the last accepted time step.
+func (s *MFAService) getSecret(userID int, secret *string, enabled *bool) (bool, int64, error) {
+	var lastStep sql.NullInt64
+	err := s.db.QueryRowContext(context.Background(),
+		"SELECT secret, enabled, last_used_step FROM user_mfa WHERE user_id = ?",
+		userID,
+	).Scan(secret, enabled, &lastStep)
+
+	if err == sql.ErrNoRows {
+		*enabled = false
+		return false, 0, nil
+	}
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to get TOTP secret: %w", err)
+	}
+
+	return true, lastStep.Int64, nil
+}
+
+// generateRecoveryCode returns a code like "k7wq-3mxp-ta9c". The alphabet
+// leaves out characters that are easily confused and has 32 characters, so
+// every character carries five unbiased bits.
+func generateRecoveryCode() (string, error) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz123456789"
+
+	raw := make([]byte, 12)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	var code strings.Builder
+	for i, b := range raw {
+		if i > 0 && i%4 == 0 {
+			code.WriteByte('-')
+		}
+		code.WriteByte(alphabet[b&31])
+	}
+
+	return code.String(), nil
+}
+
+// hashRecoveryCode normalises a recovery code as typed by the user and
+// hashes it. Recovery codes are random, so an unsalted hash is sufficient.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,9 +1,10 @@
 package auth
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"devops-assessment/internal/models"
@@ -19,23 +20,34 @@ const (
 	UserContextKey ContextKey = "user"
 	// SessionContextKey is the key for storing session in context
 	SessionContextKey ContextKey = "session"
+	// APITokenContextKey is the key for storing the API token in context
+	// when a request is authenticated with one instead of a session
+	APITokenContextKey ContextKey = "apiToken"
 )
 
 // Middleware handles authentication and authorization
 type Middleware struct {
-	authService *AuthService
-	rbacService *models.RBACService
+	authService         *AuthService
+	rbacService         *models.RBACService
+	auditService        *models.AuditService
+	organizationService *models.OrganizationService
+	tenantDomain        string // Organizations are resolved from its subdomains
 }
 
-// NewMiddleware creates a new authentication middleware
-func NewMiddleware(authService *AuthService, rbacService *models.RBACService) *Middleware {
+// NewMiddleware creates a new authentication middleware. The tenant domain
+// is optional.
+func NewMiddleware(authService *AuthService, rbacService *models.RBACService, tenantDomain string) *Middleware {
 	return &Middleware{
-		authService: authService,
-		rbacService: rbacService,
+		authService:         authService,
+		rbacService:         rbacService,
+		auditService:        models.NewAuditService(authService.db),
+		organizationService: models.NewOrganizationService(authService.db),
+		tenantDomain:        strings.ToLower(tenantDomain),
 	}
 }
 
-// RequireAuth ensures the user is authenticated
+// RequireAuth ensures the user is authenticated with a session or an API
+// token
 func (m *Middleware) RequireAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get token from cookie or header
@@ -46,17 +58,43 @@ func (m *Middleware) RequireAuth() gin.HandlerFunc {
 			return
 		}
 
-		// Validate session
-		session, err := m.authService.ValidateSession(token)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired session"})
+		if err := m.authenticate(c, token); err != nil {
+			if organizationError(c, err) {
+				return
+			}
+			if strings.HasPrefix(token, APITokenPrefix) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid, expired or revoked API token"})
+			} else {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired session"})
+			}
 			c.Abort()
 			return
 		}
 
-		// Store user and session in context
-		c.Set(string(UserContextKey), session.User)
-		c.Set(string(SessionContextKey), session)
+		c.Next()
+	}
+}
+
+// RequireSession ensures the user is authenticated with an interactive
+// session. It guards account security endpoints, such as API token and MFA
+// management, that a leaked API token must not reach.
+func (m *Middleware) RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := m.getToken(c)
+		if token == "" || strings.HasPrefix(token, APITokenPrefix) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Interactive login required"})
+			c.Abort()
+			return
+		}
+
+		if err := m.authenticate(c, token); err != nil {
+			if organizationError(c, err) {
+				return
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired session"})
+			c.Abort()
+			return
+		}
 
 		c.Next()
 	}
@@ -75,6 +113,13 @@ func (m *Middleware) RequirePermission(resource, action string) gin.HandlerFunc
 
 		userModel := user.(*models.User)
 
+		// API tokens are limited to their scopes
+		if !TokenAllows(c, resource, action) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API token lacks the required scope"})
+			c.Abort()
+			return
+		}
+
 		// Check permission
 		hasPermission, err := m.rbacService.CheckUserPermission(userModel.ID, resource, action)
 		if err != nil {
@@ -106,6 +151,19 @@ func (m *Middleware) RequireRole(roleName string) gin.HandlerFunc {
 
 		userModel := user.(*models.User)
 
+		// Roles are not scopes, so they can't be granted to API tokens
+		if _, isToken := c.Get(string(APITokenContextKey)); isToken {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API tokens can't access this endpoint"})
+			c.Abort()
+			return
+		}
+
+		// Super admins sit above every role
+		if userModel.IsSuperAdmin {
+			c.Next()
+			return
+		}
+
 		// Get user roles
 		roles, err := m.rbacService.GetUserRoles(userModel.ID)
 		if err != nil {
@@ -138,8 +196,37 @@ func (m *Middleware) RequireAdmin() gin.HandlerFunc {
 	return m.RequireRole(models.RoleAdmin)
 }
 
+// Errors returned by resource resolvers
+var (
+	ErrResourceNotFound  = errors.New("resource not found")
+	ErrInvalidResourceID = errors.New("invalid resource ID")
+)
+
+// TeamResolver returns the team that owns the resource of a request. It
+// returns ErrInvalidResourceID or ErrResourceNotFound for bad requests.
+type TeamResolver func(c *gin.Context) (int, error)
+
+// TeamParam resolves the team from a URL parameter holding its ID
+func TeamParam(name string) TeamResolver {
+	return func(c *gin.Context) (int, error) {
+		teamID, err := strconv.Atoi(c.Param(name))
+		if err != nil {
+			return 0, ErrInvalidResourceID
+		}
+		return teamID, nil
+	}
+}
+
 // RequireTeamAccess ensures the user has access to a specific team
 func (m *Middleware) RequireTeamAccess(teamParamName string, requiredPermission string) gin.HandlerFunc {
+	return m.RequireResourceAccess(TeamParam(teamParamName), requiredPermission)
+}
+
+// RequireResourceAccess ensures the user has a permission, given as
+// "resource:action", in the team that owns the resource of the request
+func (m *Middleware) RequireResourceAccess(resolve TeamResolver, requiredPermission string) gin.HandlerFunc {
+	resource, action := splitPermission(requiredPermission)
+
 	return func(c *gin.Context) {
 		// First ensure user is authenticated
 		user, exists := c.Get(string(UserContextKey))
@@ -151,26 +238,13 @@ func (m *Middleware) RequireTeamAccess(teamParamName string, requiredPermission
 
 		userModel := user.(*models.User)
 
-		// Get team ID from URL parameter
-		teamIDStr := c.Param(teamParamName)
-		var teamID int
-		if _, err := fmt.Sscanf(teamIDStr, "%d", &teamID); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
-			c.Abort()
-			return
-		}
-
-		// Parse the required permission
-		parts := strings.Split(requiredPermission, ":")
-		if len(parts) != 2 {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid permission format"})
-			c.Abort()
+		teamID, err := resolve(c)
+		if !resolveOK(c, err) {
 			return
 		}
-		resource, action := parts[0], parts[1]
 
 		// Check if user has permission for this team
-		hasPermission, err := m.rbacService.CheckTeamPermission(userModel.ID, teamID, resource, action)
+		hasPermission, err := CheckTeamPermission(c, m.rbacService, userModel.ID, teamID, resource, action)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check team permissions"})
 			c.Abort()
@@ -190,32 +264,114 @@ func (m *Middleware) RequireTeamAccess(teamParamName string, requiredPermission
 	}
 }
 
+// RequireGroupAccess ensures the user has a permission, given as
+// "resource:action", in the group of a URL parameter
+func (m *Middleware) RequireGroupAccess(groupParamName string, requiredPermission string) gin.HandlerFunc {
+	resource, action := splitPermission(requiredPermission)
+
+	return func(c *gin.Context) {
+		// First ensure user is authenticated
+		user, exists := c.Get(string(UserContextKey))
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			c.Abort()
+			return
+		}
+
+		userModel := user.(*models.User)
+
+		groupID, err := strconv.Atoi(c.Param(groupParamName))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+			c.Abort()
+			return
+		}
+
+		hasPermission, err := CheckGroupPermission(c, m.rbacService, userModel.ID, groupID, resource, action)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check group permissions"})
+			c.Abort()
+			return
+		}
+
+		if !hasPermission {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions for this group"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// splitPermission splits a "resource:action" permission. Permissions are
+// given in code, so a malformed one is a programming error.
+func splitPermission(permission string) (string, string) {
+	resource, action, ok := strings.Cut(permission, ":")
+	if !ok {
+		panic(fmt.Sprintf("invalid permission format: %q", permission))
+	}
+	return resource, action
+}
+
+// resolveOK writes the response for a resolver error and reports whether
+// there was none
+func resolveOK(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrInvalidResourceID):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid resource ID"})
+	case errors.Is(err, ErrResourceNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Resource not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve resource"})
+	}
+	c.Abort()
+	return false
+}
+
 // OptionalAuth checks for authentication but doesn't require it
 func (m *Middleware) OptionalAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get token from cookie or header
 		token := m.getToken(c)
 		if token != "" {
-			// Validate session
-			session, err := m.authService.ValidateSession(token)
-			if err == nil {
-				// Store user and session in context
-				c.Set(string(UserContextKey), session.User)
-				c.Set(string(SessionContextKey), session)
-			}
+			m.authenticate(c, token)
 		}
 
 		c.Next()
 	}
 }
 
-// CORS middleware for handling Cross-Origin Resource Sharing
-func (m *Middleware) CORS() gin.HandlerFunc {
+// CORS middleware for handling Cross-Origin Resource Sharing. Only the
+// allowed origins may make credentialed requests; "*" allows any origin to
+// make requests without cookies. Same-origin requests need no entry.
+func (m *Middleware) CORS(allowedOrigins []string) gin.HandlerFunc {
+	allowed := make(map[string]bool, len(allowedOrigins))
+	wildcard := false
+	for _, origin := range allowedOrigins {
+		if origin == "*" {
+			wildcard = true
+			continue
+		}
+		allowed[strings.ToLower(strings.TrimRight(origin, "/"))] = true
+	}
+
 	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		origin := c.GetHeader("Origin")
+		header := c.Writer.Header()
+		header.Add("Vary", "Origin")
+
+		switch {
+		case origin != "" && allowed[strings.ToLower(origin)]:
+			header.Set("Access-Control-Allow-Origin", origin)
+			header.Set("Access-Control-Allow-Credentials", "true")
+		case wildcard:
+			header.Set("Access-Control-Allow-Origin", "*")
+		}
+		header.Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, X-Organization, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		header.Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -228,23 +384,66 @@ func (m *Middleware) CORS() gin.HandlerFunc {
 
 // Helper functions
 
-// getToken retrieves the session token from cookie or Authorization header
+// authenticate validates a session or API token, resolves the organization
+// of the request and stores the user, the organization and the session or
+// token in the context
+func (m *Middleware) authenticate(c *gin.Context, token string) error {
+	if strings.HasPrefix(token, APITokenPrefix) {
+		apiToken, user, err := m.authService.tokens.ValidateToken(token)
+		if err != nil {
+			return err
+		}
+
+		organization, err := m.resolveOrganization(c, user)
+		if err != nil {
+			return err
+		}
+
+		c.Set(string(UserContextKey), user)
+		c.Set(string(OrganizationContextKey), organization)
+		c.Set(string(APITokenContextKey), apiToken)
+		return nil
+	}
+
+	// Validate session
+	session, err := m.authService.ValidateSession(token)
+	if err != nil {
+		return err
+	}
+
+	organization, err := m.resolveOrganization(c, session.User)
+	if err != nil {
+		return err
+	}
+
+	// Store user, organization and session in context
+	c.Set(string(UserContextKey), session.User)
+	c.Set(string(OrganizationContextKey), organization)
+	c.Set(string(SessionContextKey), session)
+	return nil
+}
+
+// getToken retrieves the session or API token from the Authorization
+// header or the session cookie. An explicit header wins, so requests that
+// carry one never act on the cookie and need no CSRF token.
 func (m *Middleware) getToken(c *gin.Context) string {
-	// Try to get token from cookie first
+	if token := bearerToken(c); token != "" {
+		return token
+	}
+
 	if cookie, err := c.Cookie("session_token"); err == nil {
 		return cookie
 	}
 
-	// Try Authorization header
-	authHeader := c.GetHeader("Authorization")
-	if authHeader != "" {
-		// Expected format: "Bearer <token>"
-		parts := strings.Split(authHeader, " ")
-		if len(parts) == 2 && parts[0] == "Bearer" {
-			return parts[1]
-		}
-	}
+	return ""
+}
 
+// bearerToken returns the token of an "Authorization: Bearer" header
+func bearerToken(c *gin.Context) string {
+	parts := strings.Split(c.GetHeader("Authorization"), " ")
+	if len(parts) == 2 && parts[0] == "Bearer" {
+		return parts[1]
+	}
 	return ""
 }
 
@@ -278,7 +477,48 @@ func GetCurrentSession(c *gin.Context) (*Session, error) {
 	return sessionModel, nil
 }
 
-// AuditLog logs user actions for audit trail
+// GetCurrentAPIToken retrieves the API token the request was authenticated
+// with, or nil for session requests
+func GetCurrentAPIToken(c *gin.Context) *APIToken {
+	token, exists := c.Get(string(APITokenContextKey))
+	if !exists {
+		return nil
+	}
+
+	apiToken, _ := token.(*APIToken)
+	return apiToken
+}
+
+// TokenAllows checks that the request's API token, if any, has the scope for
+// a permission. Session requests are not restricted.
+func TokenAllows(c *gin.Context, resource, action string) bool {
+	token := GetCurrentAPIToken(c)
+	return token == nil || token.HasScope(resource, action)
+}
+
+// CheckTeamPermission checks a user's permission for a team, limited to the
+// scopes of the request's API token. Handlers use it instead of
+// RBACService.CheckTeamPermission so that tokens can't exceed their scopes.
+func CheckTeamPermission(c *gin.Context, rbacService *models.RBACService, userID, teamID int, resource, action string) (bool, error) {
+	if !TokenAllows(c, resource, action) {
+		return false, nil
+	}
+
+	return rbacService.CheckTeamPermission(userID, teamID, resource, action)
+}
+
+// CheckGroupPermission checks a user's permission for a group, limited to
+// the scopes of the request's API token
+func CheckGroupPermission(c *gin.Context, rbacService *models.RBACService, userID, groupID int, resource, action string) (bool, error) {
+	if !TokenAllows(c, resource, action) {
+		return false, nil
+	}
+
+	return rbacService.CheckGroupPermission(userID, groupID, resource, action)
+}
+
+// AuditLog logs user actions for audit trail. Handlers can add details
+// to the entry by setting "auditDetails" to a map[string]interface{}.
 func (m *Middleware) AuditLog(action string, resourceType string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Execute the handler first
@@ -294,30 +534,34 @@ func (m *Middleware) AuditLog(action string, resourceType string) gin.HandlerFun
 					resourceID = id.(int)
 				}
 
-				// Create audit log entry
-				details := gin.H{
-					"method":     c.Request.Method,
-					"path":       c.Request.URL.Path,
-					"status":     c.Writer.Status(),
-					"user_agent": c.Request.UserAgent(),
+				details := RequestDetails(c)
+				if extra, exists := c.Get("auditDetails"); exists {
+					for key, value := range extra.(map[string]interface{}) {
+						details[key] = value
+					}
 				}
 
-				detailsJSON, _ := json.Marshal(details)
-
-				query := `
-					INSERT INTO audit_logs (user_id, action, resource_type, resource_id, details, ip_address)
-					VALUES (?, ?, ?, ?, ?, ?)
-				`
-
-				m.authService.db.Insert(query,
-					user.ID,
-					action,
-					resourceType,
-					resourceID,
-					string(detailsJSON),
-					c.ClientIP(),
-				)
+				// Create audit log entry
+				m.auditService.Log(&models.AuditEntry{
+					OrganizationID: GetOrganizationID(c),
+					UserID:         user.ID,
+					Action:         action,
+					ResourceType:   resourceType,
+					ResourceID:     resourceID,
+					Details:        details,
+					IPAddress:      c.ClientIP(),
+				})
 			}
 		}
 	}
 }
+
+// RequestDetails returns the request details recorded with audit log entries
+func RequestDetails(c *gin.Context) map[string]interface{} {
+	return map[string]interface{}{
+		"method":     c.Request.Method,
+		"path":       c.Request.URL.Path,
+		"status":     c.Writer.Status(),
+		"user_agent": c.Request.UserAgent(),
+	}
+}
@@ -0,0 +1,335 @@
+package auth
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"devops-assessment/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The organization the access tests run in. Group 11 sits below group 10,
+// where the members hold their roles, and group 12 is unrelated.
+const (
+	accessOrganization = 1
+
+	ownGroup       = 10
+	inheritedGroup = 11
+	unrelatedGroup = 12
+
+	ownTeam       = 100 // Where the members hold their roles, in no group
+	inheritedTeam = 101 // In the inherited group
+	unrelatedTeam = 102 // In the unrelated group
+)
+
+// accessGroupParents maps the groups of the organization to their parent
+var accessGroupParents = map[int]int{
+	ownGroup:       0,
+	inheritedGroup: ownGroup,
+	unrelatedGroup: 0,
+}
+
+// accessTeamGroups maps the teams of the organization to their group
+var accessTeamGroups = map[int]int{
+	ownTeam:       0,
+	inheritedTeam: inheritedGroup,
+	unrelatedTeam: unrelatedGroup,
+}
+
+// accessRoles are the permissions of the roles, with the built-in roles as
+// migrated and a custom one
+var accessRoles = map[string][]string{
+	models.RoleAdmin: {
+		"assessment:create", "assessment:read", "assessment:update", "assessment:delete",
+		"group:read", "group:update", "report:read", "report:export", "team:read", "team:update",
+	},
+	models.RoleEditor: {
+		"assessment:create", "assessment:read", "assessment:update",
+		"group:read", "report:read", "report:export", "team:read", "user:read",
+	},
+	models.RoleViewer: {"assessment:read", "report:read", "team:read"},
+	"reporter":        {"report:read", "report:export"},
+}
+
+// accessMember is a user holding a role in ownTeam and ownGroup. User IDs
+// are kept apart from those of other tests, as permissions are cached.
+type accessMember struct {
+	userID int
+	role   string
+}
+
+var accessMembers = []accessMember{
+	{userID: 1001, role: models.RoleAdmin},
+	{userID: 1002, role: models.RoleEditor},
+	{userID: 1003, role: models.RoleViewer},
+	{userID: 1004, role: "reporter"},
+}
+
+// accessOrgAdmin is an organization admin without memberships
+const accessOrgAdmin = 1005
+
+// accessDBHandler answers the permission queries of the access tests
+func accessDBHandler(query string, args []driver.Value) (fakeAnswer, bool) {
+	id := func() int { return int(args[0].(int64)) }
+
+	switch {
+	case strings.Contains(query, "SELECT organization_id, is_super_admin, is_org_admin FROM users"):
+		return fakeAnswer{rows: rows(row(accessOrganization, false, id() == accessOrgAdmin))}, true
+
+	case strings.Contains(query, "SELECT 'team', ut.team_id, r.name, p.resource, p.action"):
+		var memberships [][]interface{}
+		for _, member := range accessMembers {
+			if member.userID != id() {
+				continue
+			}
+			for _, permission := range accessRoles[member.role] {
+				resource, action, _ := strings.Cut(permission, ":")
+				memberships = append(memberships,
+					row("team", ownTeam, member.role, resource, action),
+					row("group", ownGroup, member.role, resource, action),
+				)
+			}
+		}
+		return fakeAnswer{rows: rows(memberships...)}, true
+
+	case strings.Contains(query, "SELECT group_id, organization_id FROM teams WHERE id = ?"):
+		groupID, exists := accessTeamGroups[id()]
+		if !exists {
+			return fakeAnswer{}, true
+		}
+		var group interface{}
+		if groupID != 0 {
+			group = groupID
+		}
+		return fakeAnswer{rows: rows(row(group, accessOrganization))}, true
+
+	case strings.Contains(query, "WITH RECURSIVE ancestors"):
+		var ancestors [][]interface{}
+		for groupID := id(); groupID != 0; groupID = accessGroupParents[groupID] {
+			ancestors = append(ancestors, row(groupID, accessOrganization))
+		}
+		return fakeAnswer{rows: rows(ancestors...)}, true
+	}
+
+	return fakeAnswer{}, false
+}
+
+// accessCaller is how a request is authenticated: with a session, or with
+// an API token with or without the scope for the checked permission
+type accessCaller struct {
+	name   string
+	token  bool
+	scoped bool
+}
+
+var accessCallers = []accessCaller{
+	{name: "session"},
+	{name: "scoped token", token: true, scoped: true},
+	{name: "unscoped token", token: true},
+}
+
+// accessTarget is a team or group an access check is made for, and whether
+// the members' memberships reach it
+type accessTarget struct {
+	name      string
+	id        int
+	reachable bool
+}
+
+var teamTargets = []accessTarget{
+	{name: "own team", id: ownTeam, reachable: true},
+	{name: "group-inherited team", id: inheritedTeam, reachable: true},
+	{name: "unrelated team", id: unrelatedTeam},
+}
+
+var groupTargets = []accessTarget{
+	{name: "own group", id: ownGroup, reachable: true},
+	{name: "inherited subgroup", id: inheritedGroup, reachable: true},
+	{name: "unrelated group", id: unrelatedGroup},
+}
+
+// newAccessRouter routes GET /check/:id through an access check, as the
+// given user and caller. The handler reports the team the check stored.
+func newAccessRouter(t *testing.T, userID int, caller accessCaller, permission string, check gin.HandlerFunc) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.GET("/check/:id", func(c *gin.Context) {
+		c.Set(string(UserContextKey), &models.User{ID: userID, OrganizationID: accessOrganization, IsActive: true})
+		if caller.token {
+			token := &APIToken{UserID: userID, Scopes: []string{"user:read"}}
+			if caller.scoped {
+				token.Scopes = append(token.Scopes, permission)
+			}
+			c.Set(string(APITokenContextKey), token)
+		}
+	}, check, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"team_id": c.GetInt("teamID")})
+	})
+
+	return router
+}
+
+// checkAccess requests GET /check/:id and compares the outcome with the
+// expected one
+func checkAccess(t *testing.T, router *gin.Engine, id int, want bool) {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/check/%d", id), nil))
+
+	wantStatus := http.StatusForbidden
+	if want {
+		wantStatus = http.StatusOK
+	}
+	if recorder.Code != wantStatus {
+		t.Errorf("status = %d, want %d (%s)", recorder.Code, wantStatus, recorder.Body.String())
+	}
+}
+
+// hasPermission reports whether a role grants a permission
+func hasPermission(role, permission string) bool {
+	for _, held := range accessRoles[role] {
+		if held == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func newAccessMiddleware(t *testing.T) *Middleware {
+	db, _ := newFakeDB(t, accessDBHandler)
+	return &Middleware{rbacService: models.NewRBACService(db)}
+}
+
+func TestRequireTeamAccess(t *testing.T) {
+	middleware := newAccessMiddleware(t)
+
+	for _, permission := range []string{"assessment:update", "team:read"} {
+		for _, member := range accessMembers {
+			for _, target := range teamTargets {
+				for _, caller := range accessCallers {
+					name := fmt.Sprintf("%s/%s/%s/%s", permission, member.role, target.name, caller.name)
+					t.Run(name, func(t *testing.T) {
+						router := newAccessRouter(t, member.userID, caller, permission,
+							middleware.RequireTeamAccess("id", permission))
+
+						want := hasPermission(member.role, permission) && target.reachable &&
+							(!caller.token || caller.scoped)
+						checkAccess(t, router, target.id, want)
+					})
+				}
+			}
+		}
+	}
+}
+
+func TestRequireResourceAccess(t *testing.T) {
+	middleware := newAccessMiddleware(t)
+
+	// Reports are resolved to the team that owns them
+	reportTeams := map[int]int{1: ownTeam, 2: inheritedTeam, 3: unrelatedTeam}
+	resolve := func(c *gin.Context) (int, error) {
+		reportID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return 0, ErrInvalidResourceID
+		}
+		teamID, exists := reportTeams[reportID]
+		if !exists {
+			return 0, ErrResourceNotFound
+		}
+		return teamID, nil
+	}
+
+	reportTargets := []accessTarget{
+		{name: "report of own team", id: 1, reachable: true},
+		{name: "report of group-inherited team", id: 2, reachable: true},
+		{name: "report of unrelated team", id: 3},
+	}
+
+	for _, member := range accessMembers {
+		for _, target := range reportTargets {
+			for _, caller := range accessCallers {
+				t.Run(member.role+"/"+target.name+"/"+caller.name, func(t *testing.T) {
+					router := newAccessRouter(t, member.userID, caller, "report:export",
+						middleware.RequireResourceAccess(resolve, "report:export"))
+
+					want := hasPermission(member.role, "report:export") && target.reachable &&
+						(!caller.token || caller.scoped)
+					checkAccess(t, router, target.id, want)
+				})
+			}
+		}
+	}
+
+	t.Run("stores the resolved team", func(t *testing.T) {
+		router := newAccessRouter(t, accessMembers[0].userID, accessCallers[0], "report:export",
+			middleware.RequireResourceAccess(resolve, "report:export"))
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/check/2", nil))
+		if want := fmt.Sprintf(`{"team_id":%d}`, inheritedTeam); recorder.Body.String() != want {
+			t.Errorf("body = %s, want %s", recorder.Body.String(), want)
+		}
+	})
+
+	t.Run("unknown resource", func(t *testing.T) {
+		router := newAccessRouter(t, accessMembers[0].userID, accessCallers[0], "report:export",
+			middleware.RequireResourceAccess(resolve, "report:export"))
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/check/4", nil))
+		if recorder.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want %d", recorder.Code, http.StatusNotFound)
+		}
+	})
+}
+
+func TestRequireGroupAccess(t *testing.T) {
+	middleware := newAccessMiddleware(t)
+
+	for _, member := range accessMembers {
+		for _, target := range groupTargets {
+			for _, caller := range accessCallers {
+				t.Run(member.role+"/"+target.name+"/"+caller.name, func(t *testing.T) {
+					router := newAccessRouter(t, member.userID, caller, "group:read",
+						middleware.RequireGroupAccess("id", "group:read"))
+
+					want := hasPermission(member.role, "group:read") && target.reachable &&
+						(!caller.token || caller.scoped)
+					checkAccess(t, router, target.id, want)
+				})
+			}
+		}
+	}
+}
+
+// Organization admins hold an explicit organization-level role, which
+// reaches every team and group of their organization
+func TestOrgAdminAccess(t *testing.T) {
+	middleware := newAccessMiddleware(t)
+
+	for _, caller := range accessCallers {
+		for _, target := range teamTargets {
+			t.Run("team/"+target.name+"/"+caller.name, func(t *testing.T) {
+				router := newAccessRouter(t, accessOrgAdmin, caller, "assessment:delete",
+					middleware.RequireTeamAccess("id", "assessment:delete"))
+				checkAccess(t, router, target.id, !caller.token || caller.scoped)
+			})
+		}
+		for _, target := range groupTargets {
+			t.Run("group/"+target.name+"/"+caller.name, func(t *testing.T) {
+				router := newAccessRouter(t, accessOrgAdmin, caller, "group:update",
+					middleware.RequireGroupAccess("id", "group:update"))
+				checkAccess(t, router, target.id, !caller.token || caller.scoped)
+			})
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"devops-assessment/internal/database"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// OIDC errors
+var (
+	ErrOIDCStateInvalid = errors.New("invalid or expired login request")
+	ErrOIDCNonceInvalid = errors.New("ID token nonce does not match login request")
+)
+
+const (
+	// OIDCProviderName identifies OIDC identities in user_identities
+	OIDCProviderName = "oidc"
+
+	// OIDCRequestDuration is how long a user has to complete a login at the
+	// identity provider
+	OIDCRequestDuration = 10 * time.Minute
+
+	// OIDCStateCookie holds the state binding of a login, which ties the
+	// callback to the browser that started the login
+	OIDCStateCookie = "oidc_state"
+)
+
+// OIDCConfig configures the OpenID Connect login
+type OIDCConfig struct {
+	IssuerURL     string
+	ClientID      string
+	ClientSecret  string
+	RedirectURL   string
+	Scopes        []string
+	GroupsClaim   string
+	GroupMappings []GroupMapping
+	Organization  string // Slug of the organization new users are created in
+
+	// TrustProviderMFA skips the second factor of local MFA for OIDC logins,
+	// relying on the identity provider to enforce its own
+	TrustProviderMFA bool
+}
+
+// OIDCProvider implements the OpenID Connect authorization code flow with
+// PKCE. Logins create a regular session through AuthService, after the same
+// second factor as password logins unless the provider's MFA is trusted.
+type OIDCProvider struct {
+	db          *database.DB
+	authService *AuthService
+	provisioner *Provisioner
+	config      OIDCConfig
+	oauth2      oauth2.Config
+	verifier    *oidc.IDTokenVerifier
+}
+
+// NewOIDCProvider creates a new OIDC provider. The issuer's discovery
+// document is fetched, so the issuer must be reachable.
+func NewOIDCProvider(ctx context.Context, db *database.DB, authService *AuthService, config OIDCConfig) (*OIDCProvider, error) {
+	provider, err := oidc.NewProvider(ctx, config.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC issuer %s: %w", config.IssuerURL, err)
+	}
+
+	scopes := config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "profile", "email"}
+	}
+
+	return &OIDCProvider{
+		db:          db,
+		authService: authService,
+		provisioner: NewProvisioner(db),
+		config:      config,
+		oauth2: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  config.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       scopes,
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: config.ClientID}),
+	}, nil
+}
+
+// AuthCodeURL starts a login and returns the identity provider URL to
+// redirect the user to, and the state binding to store in the browser's
+// OIDCStateCookie. redirectTo is where the user lands after login.
+func (p *OIDCProvider) AuthCodeURL(redirectTo string) (authURL, binding string, err error) {
+	state, err := generateSecureToken(TokenLength)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate state: %w", err)
+	}
+
+	nonce, err := generateSecureToken(TokenLength)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	verifier := oauth2.GenerateVerifier()
+
+	query := `
+		INSERT INTO oidc_auth_requests (state, nonce, code_verifier, redirect_to, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+	`
+
+	if _, err := p.db.Insert(query, state, nonce, verifier, redirectTo, time.Now().Add(OIDCRequestDuration)); err != nil {
+		return "", "", fmt.Errorf("failed to store login request: %w", err)
+	}
+
+	authURL = p.oauth2.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+	return authURL, hashToken(state), nil
+}
+
+// HandleCallback completes a login: it exchanges the authorization code,
+// verifies the ID token, provisions the user and creates a session. Like
+// Login, it returns a challenge instead of a session for users who have to
+// pass a second factor, which is completed with CompleteMFALogin. It also
+// returns where the user should land.
+//
+// binding is the browser's OIDCStateCookie. A callback from another browser
+// than the one that started the login is rejected without consuming the
+// request, so a callback URL of someone else's login can't log a user in as
+// them.
+func (p *OIDCProvider) HandleCallback(ctx context.Context, state, binding, code string) (*Session, *MFAChallenge, string, error) {
+	if subtle.ConstantTimeCompare([]byte(binding), []byte(hashToken(state))) != 1 {
+		return nil, nil, "", ErrOIDCStateInvalid
+	}
+
+	nonce, verifier, redirectTo, err := p.consumeRequest(state)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	token, err := p.oauth2.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, nil, "", fmt.Errorf("token response has no ID token")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to verify ID token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, nil, "", ErrOIDCNonceInvalid
+	}
+
+	identity, err := p.identityFromToken(idToken)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	user, err := p.provisioner.Provision(identity, p.config.Organization, p.config.GroupMappings)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	if !p.config.TrustProviderMFA {
+		challenge, err := p.authService.MFA().ChallengeFor(user.ID, user.Email)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		if challenge != nil {
+			return nil, challenge, redirectTo, nil
+		}
+	}
+
+	session, err := p.authService.CreateSession(user.ID)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to create session: %w", err)
+	}
+	session.User = user
+
+	return session, nil, redirectTo, nil
+}
+
+// consumeRequest loads and deletes a pending login request, so every state
+// can be used only once
+func (p *OIDCProvider) consumeRequest(state string) (nonce, verifier, redirectTo string, err error) {
+	if state == "" {
+		return "", "", "", ErrOIDCStateInvalid
+	}
+
+	var storedRedirect sql.NullString
+	var expiresAt time.Time
+	err = p.db.QueryRowContext(context.Background(),
+		"SELECT nonce, code_verifier, redirect_to, expires_at FROM oidc_auth_requests WHERE state = ?",
+		state,
+	).Scan(&nonce, &verifier, &storedRedirect, &expiresAt)
+
+	if err == sql.ErrNoRows {
+		return "", "", "", ErrOIDCStateInvalid
+	}
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to get login request: %w", err)
+	}
+
+	affected, err := p.db.Delete("DELETE FROM oidc_auth_requests WHERE state = ?", state)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to delete login request: %w", err)
+	}
+
+	// A concurrent callback already consumed the request
+	if affected == 0 || time.Now().After(expiresAt) {
+		return "", "", "", ErrOIDCStateInvalid
+	}
+
+	return nonce, verifier, storedRedirect.String, nil
+}
+
+// identityFromToken extracts the identity from verified ID token claims
+func (p *OIDCProvider) identityFromToken(idToken *oidc.IDToken) (*ExternalIdentity, error) {
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to parse ID token claims: %w", err)
+	}
+
+	identity := &ExternalIdentity{
+		Provider:      OIDCProviderName,
+		Subject:       idToken.Subject,
+		Email:         stringClaim(claims, "email"),
+		EmailVerified: boolClaim(claims, "email_verified"),
+		FirstName:     stringClaim(claims, "given_name"),
+		LastName:      stringClaim(claims, "family_name"),
+	}
+
+	// Fall back to the full name when the provider has no name parts
+	if identity.FirstName == "" && identity.LastName == "" {
+		name := strings.Fields(stringClaim(claims, "name"))
+		if len(name) > 0 {
+			identity.FirstName = name[0]
+			identity.LastName = strings.Join(name[1:], " ")
+		}
+	}
+
+	groupsClaim := p.config.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+
+	switch groups := claims[groupsClaim].(type) {
+	case []interface{}:
+		for _, group := range groups {
+			if name, ok := group.(string); ok {
+				identity.Groups = append(identity.Groups, name)
+			}
+		}
+	case string:
+		identity.Groups = []string{groups}
+	}
+
+	return identity, nil
+}
+
+// CleanupExpiredRequests removes login requests that were never completed
+func (p *OIDCProvider) CleanupExpiredRequests() error {
+	affected, err := p.db.Delete("DELETE FROM oidc_auth_requests WHERE expires_at < NOW()")
+	if err != nil {
+		return fmt.Errorf("failed to cleanup expired login requests: %w", err)
+	}
+
+	if affected > 0 {
+		log.Printf("Cleaned up %d expired OIDC login requests", affected)
+	}
+
+	return nil
+}
+
+func stringClaim(claims map[string]interface{}, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+func boolClaim(claims map[string]interface{}, name string) bool {
+	switch value := claims[name].(type) {
+	case bool:
+		return value
+	case string:
+		// Some providers send booleans as strings
+		return value == "true"
+	}
+	return false
+}
@@ -0,0 +1,460 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	oidcClientID    = "assessment"
+	oidcRedirectURL = "http://app.example.com/api/v1/auth/oidc/callback"
+	oidcCode        = "authorization-code"
+)
+
+// fakeIdP is an OpenID Connect identity provider: it serves discovery, its
+// signing keys and a token endpoint that checks the PKCE verifier of the
+// authorization code it issued
+type fakeIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu        sync.Mutex
+	challenge string                 // PKCE challenge of the authorization request
+	nonce     string                 // Nonce of ID tokens
+	claims    map[string]interface{} // Claims of ID tokens besides the registered ones
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &fakeIdP{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/keys", idp.keys)
+	mux.HandleFunc("/token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+func (idp *fakeIdP) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                idp.server.URL,
+		"authorization_endpoint":                idp.server.URL + "/authorize",
+		"token_endpoint":                        idp.server.URL + "/token",
+		"jwks_uri":                              idp.server.URL + "/keys",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (idp *fakeIdP) keys(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (idp *fakeIdP) token(w http.ResponseWriter, r *http.Request) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("code") != oidcCode ||
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != idp.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := map[string]interface{}{
+		"iss":   idp.server.URL,
+		"aud":   oidcClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": idp.nonce,
+	}
+	for name, value := range idp.claims {
+		claims[name] = value
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idp.sign(claims),
+	})
+}
+
+// sign returns claims as an RS256-signed JWT
+func (idp *fakeIdP) sign(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// authorize plays the user logging in at the identity provider: it checks
+// the authorization request and returns its state. ID tokens carry the
+// request's nonce and claims.
+func (idp *fakeIdP) authorize(t *testing.T, authURL string, claims map[string]interface{}) string {
+	t.Helper()
+
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if endpoint := idp.server.URL + "/authorize"; !strings.HasPrefix(authURL, endpoint+"?") {
+		t.Fatalf("authorization URL %s, want endpoint %s", authURL, endpoint)
+	}
+
+	query := parsed.Query()
+	want := map[string]string{
+		"client_id":             oidcClientID,
+		"redirect_uri":          oidcRedirectURL,
+		"response_type":         "code",
+		"scope":                 "openid profile email",
+		"code_challenge_method": "S256",
+	}
+	for name, value := range want {
+		if query.Get(name) != value {
+			t.Errorf("authorization request %s = %q, want %q", name, query.Get(name), value)
+		}
+	}
+	for _, name := range []string{"state", "nonce", "code_challenge"} {
+		if query.Get(name) == "" {
+			t.Errorf("authorization request has no %s", name)
+		}
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.challenge = query.Get("code_challenge")
+	idp.nonce = query.Get("nonce")
+	idp.claims = claims
+
+	return query.Get("state")
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// oidcRequest is a stored login request
+type oidcRequest struct {
+	nonce, verifier, redirectTo string
+	expiresAt                   time.Time
+}
+
+// oidcDB answers the queries of OIDC logins: login requests, sessions and
+// MFA, and provisioning through provisioningDB
+type oidcDB struct {
+	*provisioningDB
+
+	mu       sync.Mutex
+	requests map[string]*oidcRequest // By state
+	mfaUsers map[int]bool            // Users with MFA enabled
+	sessions []int                   // Users sessions were created for
+}
+
+func (d *oidcDB) answer(query string, args []driver.Value) (fakeAnswer, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch {
+	case strings.Contains(query, "INSERT INTO oidc_auth_requests"):
+		d.requests[args[0].(string)] = &oidcRequest{
+			nonce:      args[1].(string),
+			verifier:   args[2].(string),
+			redirectTo: args[3].(string),
+			expiresAt:  args[4].(time.Time),
+		}
+		return fakeAnswer{rowsAffected: 1, lastInsertID: 1}, true
+
+	case strings.Contains(query, "FROM oidc_auth_requests WHERE state = ?") && strings.HasPrefix(query, "SELECT"):
+		request, exists := d.requests[args[0].(string)]
+		if !exists {
+			return fakeAnswer{}, true
+		}
+		return fakeAnswer{rows: rows(row(request.nonce, request.verifier, request.redirectTo, request.expiresAt))}, true
+
+	case strings.Contains(query, "DELETE FROM oidc_auth_requests WHERE state = ?"):
+		if _, exists := d.requests[args[0].(string)]; !exists {
+			return fakeAnswer{}, true
+		}
+		delete(d.requests, args[0].(string))
+		return fakeAnswer{rowsAffected: 1}, true
+
+	case strings.Contains(query, "SELECT secret, enabled, last_used_step FROM user_mfa WHERE user_id = ?"):
+		if !d.mfaUsers[int(args[0].(int64))] {
+			return fakeAnswer{}, true
+		}
+		return fakeAnswer{rows: rows(row("JBSWY3DPEHPK3PXP", true, nil))}, true
+
+	case strings.Contains(query, "SELECT value FROM system_settings WHERE name = ?"):
+		return fakeAnswer{}, true
+
+	case strings.Contains(query, "INSERT INTO mfa_challenges"):
+		return fakeAnswer{rowsAffected: 1, lastInsertID: 1}, true
+
+	case strings.Contains(query, "INSERT INTO user_sessions"):
+		d.sessions = append(d.sessions, int(args[0].(int64)))
+		return fakeAnswer{rowsAffected: 1, lastInsertID: int64(len(d.sessions))}, true
+	}
+
+	return d.provisioningDB.answer(query, args)
+}
+
+// newTestOIDCProvider discovers the fake identity provider
+func newTestOIDCProvider(t *testing.T, idp *fakeIdP, directoryDB *oidcDB, config OIDCConfig) *OIDCProvider {
+	t.Helper()
+
+	db, _ := newFakeDB(t, directoryDB.answer)
+
+	config.IssuerURL = idp.server.URL
+	config.ClientID = oidcClientID
+	config.ClientSecret = "client-secret"
+	config.RedirectURL = oidcRedirectURL
+	config.Organization = "default"
+
+	provider, err := NewOIDCProvider(context.Background(), db, NewAuthService(db), config)
+	if err != nil {
+		t.Fatalf("NewOIDCProvider() error = %v", err)
+	}
+	return provider
+}
+
+func TestOIDCDiscovery(t *testing.T) {
+	idp := newFakeIdP(t)
+
+	t.Run("issuer", func(t *testing.T) {
+		provider := newTestOIDCProvider(t, idp, &oidcDB{provisioningDB: newProvisioningDB(), requests: map[string]*oidcRequest{}}, OIDCConfig{})
+		if endpoint := provider.oauth2.Endpoint; endpoint.AuthURL != idp.server.URL+"/authorize" || endpoint.TokenURL != idp.server.URL+"/token" {
+			t.Errorf("endpoint = %+v, want the discovered endpoints", endpoint)
+		}
+	})
+
+	t.Run("issuer mismatch", func(t *testing.T) {
+		db, _ := newFakeDB(t, newProvisioningDB().answer)
+		// The discovery document names the issuer without the trailing slash
+		_, err := NewOIDCProvider(context.Background(), db, NewAuthService(db), OIDCConfig{IssuerURL: idp.server.URL + "/"})
+		if err == nil {
+			t.Error("NewOIDCProvider() succeeded for an issuer that doesn't match its discovery document")
+		}
+	})
+}
+
+func TestOIDCLogin(t *testing.T) {
+	mappings, err := ParseGroupMappings("platform-admins|team:Platform|admin;auditors|group:Engineering|viewer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A user with MFA enabled, linked to the subject "mfa-subject"
+	const mfaUser = 2201
+
+	tests := []struct {
+		name   string
+		config OIDCConfig
+		claims map[string]interface{}
+		// tamper changes the login request or the identity provider between
+		// the authorization request and the callback
+		tamper func(idp *fakeIdP, directoryDB *oidcDB, state string)
+		// browser returns the state cookie the callback is sent with, given
+		// the one of the login
+		browser func(binding string) string
+
+		wantErr    error
+		wantFail   string // Part of the error, for errors without a sentinel
+		wantUser   int    // The user logged in or challenged
+		wantMFA    bool
+		wantGrants []string
+	}{
+		{
+			name:     "new user",
+			claims:   map[string]interface{}{"sub": "new-subject", "email": "new@example.com", "email_verified": true, "name": "Ada Lovelace"},
+			wantUser: firstProvisionedUserID + 1,
+		},
+		{
+			name:       "groups claim",
+			config:     OIDCConfig{GroupMappings: mappings},
+			claims:     map[string]interface{}{"sub": "new-subject", "email": "new@example.com", "groups": []string{"Platform-Admins", "auditors", "staff"}},
+			wantUser:   firstProvisionedUserID + 1,
+			wantGrants: []string{"team 200 1", "group 20 3"},
+		},
+		{
+			name:       "custom groups claim with a single group",
+			config:     OIDCConfig{GroupsClaim: "roles", GroupMappings: mappings},
+			claims:     map[string]interface{}{"sub": "new-subject", "email": "new@example.com", "groups": "platform-admins", "roles": "auditors"},
+			wantUser:   firstProvisionedUserID + 1,
+			wantGrants: []string{"group 20 3"},
+		},
+		{
+			name:     "local MFA",
+			claims:   map[string]interface{}{"sub": "mfa-subject"},
+			wantUser: mfaUser,
+			wantMFA:  true,
+		},
+		{
+			name:     "trusted provider MFA",
+			config:   OIDCConfig{TrustProviderMFA: true},
+			claims:   map[string]interface{}{"sub": "mfa-subject"},
+			wantUser: mfaUser,
+		},
+		{
+			name:   "nonce mismatch",
+			claims: map[string]interface{}{"sub": "new-subject", "email": "new@example.com"},
+			tamper: func(idp *fakeIdP, directoryDB *oidcDB, state string) {
+				idp.nonce = "replayed-nonce"
+			},
+			wantErr: ErrOIDCNonceInvalid,
+		},
+		{
+			name:   "PKCE verifier mismatch",
+			claims: map[string]interface{}{"sub": "new-subject", "email": "new@example.com"},
+			tamper: func(idp *fakeIdP, directoryDB *oidcDB, state string) {
+				directoryDB.requests[state].verifier = strings.Repeat("x", 43)
+			},
+			wantFail: "failed to exchange authorization code",
+		},
+		{
+			name:   "expired login request",
+			claims: map[string]interface{}{"sub": "new-subject", "email": "new@example.com"},
+			tamper: func(idp *fakeIdP, directoryDB *oidcDB, state string) {
+				directoryDB.requests[state].expiresAt = time.Now().Add(-time.Minute)
+			},
+			wantErr: ErrOIDCStateInvalid,
+		},
+		{
+			name:   "unknown state",
+			claims: map[string]interface{}{"sub": "new-subject", "email": "new@example.com"},
+			tamper: func(idp *fakeIdP, directoryDB *oidcDB, state string) {
+				delete(directoryDB.requests, state)
+			},
+			wantErr: ErrOIDCStateInvalid,
+		},
+		{
+			// An attacker sends their callback URL to someone else
+			name:    "callback in another browser",
+			claims:  map[string]interface{}{"sub": "new-subject", "email": "new@example.com"},
+			browser: func(binding string) string { return "" },
+			wantErr: ErrOIDCStateInvalid,
+		},
+		{
+			name:    "state cookie of another login",
+			claims:  map[string]interface{}{"sub": "new-subject", "email": "new@example.com"},
+			browser: func(binding string) string { return hashToken("other-state") },
+			wantErr: ErrOIDCStateInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newFakeIdP(t)
+			directoryDB := &oidcDB{
+				provisioningDB: newProvisioningDB(directoryUser{id: mfaUser, email: "mfa@example.com", identities: []string{"oidc mfa-subject"}}),
+				requests:       make(map[string]*oidcRequest),
+				mfaUsers:       map[int]bool{mfaUser: true},
+			}
+			provider := newTestOIDCProvider(t, idp, directoryDB, tt.config)
+
+			authURL, binding, err := provider.AuthCodeURL("/dashboard")
+			if err != nil {
+				t.Fatalf("AuthCodeURL() error = %v", err)
+			}
+			state := idp.authorize(t, authURL, tt.claims)
+			if tt.tamper != nil {
+				tt.tamper(idp, directoryDB, state)
+			}
+			if tt.browser != nil {
+				binding = tt.browser(binding)
+			}
+
+			session, challenge, redirectTo, err := provider.HandleCallback(context.Background(), state, binding, oidcCode)
+
+			if tt.wantErr != nil || tt.wantFail != "" {
+				if err == nil || (tt.wantErr != nil && err != tt.wantErr) || !strings.Contains(err.Error(), tt.wantFail) {
+					t.Fatalf("err = %v, want %v%s", err, tt.wantErr, tt.wantFail)
+				}
+				if len(directoryDB.sessions) != 0 {
+					t.Errorf("sessions were created for %v", directoryDB.sessions)
+				}
+				// A callback from another browser leaves the login to the
+				// browser that started it
+				if _, exists := directoryDB.requests[state]; tt.browser != nil && !exists {
+					t.Error("login request was consumed")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("HandleCallback() error = %v", err)
+			}
+
+			if redirectTo != "/dashboard" {
+				t.Errorf("redirect = %q, want /dashboard", redirectTo)
+			}
+			if _, exists := directoryDB.requests[state]; exists {
+				t.Error("login request was not consumed")
+			}
+
+			if tt.wantMFA {
+				if session != nil || challenge == nil || challenge.UserID != tt.wantUser {
+					t.Errorf("session = %+v, challenge = %+v, want a challenge for user %d", session, challenge, tt.wantUser)
+				}
+				if len(directoryDB.sessions) != 0 {
+					t.Errorf("sessions were created for %v", directoryDB.sessions)
+				}
+			} else {
+				if challenge != nil || session == nil || session.User.ID != tt.wantUser {
+					t.Errorf("session = %+v, challenge = %+v, want a session of user %d", session, challenge, tt.wantUser)
+				}
+				if want := []int{tt.wantUser}; !reflect.DeepEqual(directoryDB.sessions, want) {
+					t.Errorf("sessions created for %v, want %v", directoryDB.sessions, want)
+				}
+			}
+
+			if grants := directoryDB.Grants(); !reflect.DeepEqual(grants, tt.wantGrants) {
+				t.Errorf("grants = %v, want %v", grants, tt.wantGrants)
+			}
+		})
+	}
+}
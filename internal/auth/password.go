@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrPasswordPolicy is wrapped by errors for passwords the policy rejects;
+// the wrapping error says why
+var ErrPasswordPolicy = errors.New("password does not meet the password policy")
+
+// MaxPasswordLength is the longest password bcrypt can hash, in bytes
+const MaxPasswordLength = 72
+
+// PasswordPolicy describes the passwords users may choose. Generated
+// passwords, such as those of service accounts, are not checked.
+type PasswordPolicy struct {
+	MinLength        int // In characters
+	RequireUppercase bool
+	RequireLowercase bool
+	RequireDigit     bool
+	RequireSymbol    bool
+
+	// HistorySize is the number of most recent passwords, including the
+	// current one, that can't be chosen again. 0 allows any reuse.
+	HistorySize int
+
+	// SHA-1 hashes of known breached passwords
+	breached map[[sha1.Size]byte]struct{}
+}
+
+// DefaultPasswordPolicy returns the policy used unless one is configured
+func DefaultPasswordPolicy() *PasswordPolicy {
+	return &PasswordPolicy{MinLength: 8}
+}
+
+// LoadBreachedPasswords loads a list of passwords that can't be used. Each
+// line holds either a password or, as in the Have I Been Pwned downloads, a
+// hex SHA-1 hash optionally followed by ":count". Blank lines and lines
+// starting with # are skipped.
+func (p *PasswordPolicy) LoadBreachedPasswords(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open breached password list: %w", err)
+	}
+	defer file.Close()
+
+	breached := make(map[[sha1.Size]byte]struct{})
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if sum, ok := parseSHA1Line(line); ok {
+			breached[sum] = struct{}{}
+			continue
+		}
+		breached[sha1.Sum([]byte(line))] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read breached password list: %w", err)
+	}
+
+	p.breached = breached
+	return nil
+}
+
+// BreachedCount returns the number of loaded breached passwords
+func (p *PasswordPolicy) BreachedCount() int {
+	return len(p.breached)
+}
+
+// Check checks a password against the policy, except for reuse, which needs
+// the user's password history
+func (p *PasswordPolicy) Check(password string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("%w: it must be at least %d characters long", ErrPasswordPolicy, p.MinLength)
+	}
+	if len(password) > MaxPasswordLength {
+		return fmt.Errorf("%w: it must be at most %d bytes long", ErrPasswordPolicy, MaxPasswordLength)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			symbol = true
+		}
+	}
+
+	if p.RequireUppercase && !upper {
+		return fmt.Errorf("%w: it must contain an uppercase letter", ErrPasswordPolicy)
+	}
+	if p.RequireLowercase && !lower {
+		return fmt.Errorf("%w: it must contain a lowercase letter", ErrPasswordPolicy)
+	}
+	if p.RequireDigit && !digit {
+		return fmt.Errorf("%w: it must contain a digit", ErrPasswordPolicy)
+	}
+	if p.RequireSymbol && !symbol {
+		return fmt.Errorf("%w: it must contain a symbol", ErrPasswordPolicy)
+	}
+
+	if _, ok := p.breached[sha1.Sum([]byte(password))]; ok {
+		return fmt.Errorf("%w: it appears in a list of breached passwords", ErrPasswordPolicy)
+	}
+
+	return nil
+}
+
+// CheckReuse rejects a password that matches one of the given hashes
+func (p *PasswordPolicy) CheckReuse(password string, hashes []string) error {
+	for _, hash := range hashes {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+			return fmt.Errorf("%w: it must differ from the last %d passwords", ErrPasswordPolicy, p.HistorySize)
+		}
+	}
+	return nil
+}
+
+// parseSHA1Line parses a "HASH" or "HASH:count" line
+func parseSHA1Line(line string) ([sha1.Size]byte, bool) {
+	var sum [sha1.Size]byte
+
+	hash, _, _ := strings.Cut(line, ":")
+	if len(hash) != hex.EncodedLen(sha1.Size) {
+		return sum, false
+	}
+	if _, err := hex.Decode(sum[:], []byte(hash)); err != nil {
+		return sum, false
+	}
+	return sum, true
+}
@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"devops-assessment/internal/database"
+	"devops-assessment/internal/models"
+)
+
+// ErrIdentityNotLinkable is returned for external identities whose email
+// matches a user they can't be linked to automatically. Admins link such
+// identities explicitly.
+var ErrIdentityNotLinkable = errors.New("identity can't be linked to an existing user")
+
+// ExternalIdentity is a user identity asserted by an external identity
+// provider such as an OIDC provider or an LDAP directory
+type ExternalIdentity struct {
+	Provider      string // e.g. "oidc" or "ldap"
+	Subject       string // Stable user identifier at the provider
+	Email         string
+	EmailVerified bool // Only verified emails are linked to existing users, admins never
+	FirstName     string
+	LastName      string
+	Groups        []string
+}
+
+// GroupMapping maps an identity provider group onto a team or group and role
+type GroupMapping struct {
+	ExternalGroup string
+	TargetType    string // "team" or "group"
+	TargetName    string
+	RoleName      string
+}
+
+// Mapping target types
+const (
+	MappingTargetTeam  = "team"
+	MappingTargetGroup = "group"
+)
+
+// ParseGroupMappings parses group mappings of the form
+// "<external group>|<team|group>:<name>|<role>", separated by semicolons or
+// newlines, e.g. "platform-admins|team:Platform|admin;auditors|group:Engineering|viewer".
+// The pipe separator allows LDAP group DNs, which contain commas and equals
+// signs, to be used as external groups.
+func ParseGroupMappings(spec string) ([]GroupMapping, error) {
+	var mappings []GroupMapping
+
+	entries := strings.FieldsFunc(spec, func(r rune) bool { return r == ';' || r == '\n' })
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.Split(entry, "|")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid group mapping %q: expected <external group>|<team|group>:<name>|<role>", entry)
+		}
+
+		target := strings.SplitN(strings.TrimSpace(parts[1]), ":", 2)
+		if len(target) != 2 || (target[0] != MappingTargetTeam && target[0] != MappingTargetGroup) || target[1] == "" {
+			return nil, fmt.Errorf("invalid group mapping target %q: expected team:<name> or group:<name>", parts[1])
+		}
+
+		mapping := GroupMapping{
+			ExternalGroup: strings.TrimSpace(parts[0]),
+			TargetType:    target[0],
+			TargetName:    strings.TrimSpace(target[1]),
+			RoleName:      strings.TrimSpace(parts[2]),
+		}
+		if mapping.ExternalGroup == "" || mapping.RoleName == "" {
+			return nil, fmt.Errorf("invalid group mapping %q: external group and role are required", entry)
+		}
+
+		mappings = append(mappings, mapping)
+	}
+
+	return mappings, nil
+}
+
+// Provisioner creates and links users for external identities on first login
+// (just-in-time provisioning) and applies group mappings on every login
+type Provisioner struct {
+	userService         *models.UserService
+	teamService         *models.TeamService
+	groupService        *models.GroupService
+	roleService         *models.RoleService
+	rbacService         *models.RBACService
+	organizationService *models.OrganizationService
+}
+
+// NewProvisioner creates a new provisioner
+func NewProvisioner(db *database.DB) *Provisioner {
+	return &Provisioner{
+		userService:         models.NewUserService(db),
+		teamService:         models.NewTeamService(db),
+		groupService:        models.NewGroupService(db),
+		roleService:         models.NewRoleService(db),
+		rbacService:         models.NewRBACService(db),
+		organizationService: models.NewOrganizationService(db),
+	}
+}
+
+// Provision returns the user linked to an external identity. A user that is
+// not linked yet is linked by verified email to a user of the organization
+// with the given slug, or created in it; admins are never linked
+// automatically. Memberships from matching group mappings, which name
+// teams and groups of the user's organization, are then granted, and those
+// the provider's mappings granted before are revoked once they no longer
+// match. Access granted by hand is left alone.
+func (p *Provisioner) Provision(identity *ExternalIdentity, organization string, mappings []GroupMapping) (*models.User, error) {
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("identity from %s has no subject", identity.Provider)
+	}
+
+	user := &models.User{}
+	err := p.userService.GetUserByIdentity(identity.Provider, identity.Subject, user)
+	if err == models.ErrUserNotFound {
+		user, err = p.linkOrCreateUser(identity, organization)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.IsActive {
+		return nil, ErrUserInactive
+	}
+
+	if err := p.userService.TouchIdentity(identity.Provider, identity.Subject); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	p.applyGroupMappings(user, identity.Provider, identity.Groups, mappings)
+
+	return user, nil
+}
+
+// linkOrCreateUser links an identity to the user of an organization with the
+// same verified email, or creates a new user for it there. Users of other
+// organizations are never linked, and their emails can't be provisioned.
+func (p *Provisioner) linkOrCreateUser(identity *ExternalIdentity, organization string) (*models.User, error) {
+	if identity.Email == "" {
+		return nil, fmt.Errorf("identity from %s has no email", identity.Provider)
+	}
+
+	org := &models.Organization{}
+	if err := p.organizationService.GetOrganizationBySlug(organization, org); err != nil {
+		return nil, fmt.Errorf("failed to get organization %s: %w", organization, err)
+	}
+
+	user := &models.User{}
+	err := p.userService.GetOrganizationUserByEmail(org.ID, identity.Email, user)
+	switch {
+	case err == nil:
+		// Never take over an account on the strength of an unverified email
+		if !identity.EmailVerified {
+			return nil, fmt.Errorf("%w: email %s of %s identity is not verified", ErrIdentityNotLinkable, identity.Email, identity.Provider)
+		}
+
+		// Nor an admin account, whose takeover would reach beyond the user:
+		// super admins act in every organization
+		isAdmin, err := p.rbacService.IsUserAdmin(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if user.IsSuperAdmin || isAdmin {
+			return nil, fmt.Errorf("%w: %s is an admin", ErrIdentityNotLinkable, identity.Email)
+		}
+
+	case err == models.ErrUserNotFound:
+		user = &models.User{
+			OrganizationID: org.ID,
+			Email:          identity.Email,
+			FirstName:      identity.FirstName,
+			LastName:       identity.LastName,
+			IsActive:       true,
+		}
+
+		// Externally authenticated users get an unusable random password
+		password, err := generateSecureToken(TokenLength)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate password: %w", err)
+		}
+
+		if err := p.userService.CreateUser(user, password); err != nil {
+			if err == models.ErrEmailAlreadyExists {
+				return nil, fmt.Errorf("%w: %s belongs to another organization", ErrIdentityNotLinkable, identity.Email)
+			}
+			return nil, fmt.Errorf("failed to provision user: %w", err)
+		}
+		log.Printf("Provisioned user %s from %s", user.Email, identity.Provider)
+
+	default:
+		return nil, err
+	}
+
+	if err := p.userService.LinkIdentity(user.ID, identity.Provider, identity.Subject); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// applyGroupMappings grants the memberships of all mappings matching the
+// identity's groups, and revokes those the provider's mappings granted
+// before that no longer match. Memberships granted by hand are neither
+// changed nor revoked. Unknown teams, groups or roles are logged and
+// skipped.
+func (p *Provisioner) applyGroupMappings(user *models.User, provider string, groups []string, mappings []GroupMapping) {
+	memberOf := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		memberOf[strings.ToLower(group)] = true
+	}
+
+	var teams, groupIDs []int
+	complete := true // Whether every matching mapping was applied
+	for _, mapping := range mappings {
+		if !memberOf[strings.ToLower(mapping.ExternalGroup)] {
+			continue
+		}
+
+		role, err := p.roleService.GetRoleByName(mapping.RoleName)
+		if err != nil {
+			log.Printf("Warning: group mapping for %s: role %s: %v", mapping.ExternalGroup, mapping.RoleName, err)
+			complete = complete && err == models.ErrRoleNotFound
+			continue
+		}
+
+		switch mapping.TargetType {
+		case MappingTargetTeam:
+			team := &models.Team{}
+			if err := p.teamService.GetTeamByName(user.OrganizationID, mapping.TargetName, team); err != nil {
+				log.Printf("Warning: group mapping for %s: team %s: %v", mapping.ExternalGroup, mapping.TargetName, err)
+				complete = complete && err == models.ErrTeamNotFound
+				continue
+			}
+			teams = append(teams, team.ID)
+			err = p.userService.GrantMappedTeamMembership(user.ID, team.ID, role.ID, provider)
+
+		case MappingTargetGroup:
+			group := &models.Group{}
+			if err := p.groupService.GetGroupByName(user.OrganizationID, mapping.TargetName, group); err != nil {
+				log.Printf("Warning: group mapping for %s: group %s: %v", mapping.ExternalGroup, mapping.TargetName, err)
+				complete = complete && err == models.ErrGroupNotFound
+				continue
+			}
+			groupIDs = append(groupIDs, group.ID)
+			err = p.userService.GrantMappedGroupMembership(user.ID, group.ID, role.ID, provider)
+		}
+
+		if err != nil {
+			log.Printf("Warning: group mapping for %s: %v", mapping.ExternalGroup, err)
+		}
+	}
+
+	// A failed lookup doesn't mean the user left the provider group
+	if !complete {
+		return
+	}
+
+	if err := p.userService.RevokeMappedMemberships(user.ID, provider, teams, groupIDs); err != nil {
+		log.Printf("Warning: group mappings of %s: %v", provider, err)
+	}
+}
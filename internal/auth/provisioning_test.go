@@ -0,0 +1,489 @@
+package auth
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The organization users are provisioned in, with a team and a group that
+// group mappings name, and an organization of other users
+const (
+	provisioningOrganization = 1
+	otherOrganization        = 2
+
+	platformTeam     = 200
+	engineeringGroup = 20
+
+	// Users created by provisioning get IDs from here on
+	firstProvisionedUserID = 3000
+)
+
+// provisioningRoles maps the built-in roles to their IDs
+var provisioningRoles = map[string]int{"admin": 1, "editor": 2, "viewer": 3}
+
+// directoryUser is an existing user of a provisioning test. User IDs are
+// kept apart from those of other tests, as permissions are cached.
+type directoryUser struct {
+	id           int
+	organization int // provisioningOrganization if 0
+	email        string
+	superAdmin   bool
+	orgAdmin     bool
+	adminRole    bool // Holds the admin role in the Platform team
+	inactive     bool
+	identities   []string // Linked identities as "<provider> <subject>"
+	// Memberships as "<team|group> <ID> <role ID>", followed by the source
+	// for memberships granted by group mappings
+	memberships []string
+}
+
+// membership is a team or group membership of a provisioning test
+type membership struct {
+	userID int
+	kind   string // team or group
+	id     int
+	roleID int
+	source string // Empty for memberships granted by hand
+}
+
+// provisioningDB answers the queries of provisioning, for its users and the
+// users and identities provisioning adds
+type provisioningDB struct {
+	mu          sync.Mutex
+	users       []*directoryUser
+	identities  map[string]int // "<provider> <subject>" to user ID
+	memberships []*membership
+}
+
+func newProvisioningDB(users ...directoryUser) *provisioningDB {
+	d := &provisioningDB{identities: make(map[string]int)}
+	for i := range users {
+		user := users[i]
+		if user.organization == 0 {
+			user.organization = provisioningOrganization
+		}
+		for _, identity := range user.identities {
+			d.identities[identity] = user.id
+		}
+		for _, granted := range user.memberships {
+			m := &membership{userID: user.id}
+			fmt.Sscan(granted, &m.kind, &m.id, &m.roleID, &m.source)
+			d.memberships = append(d.memberships, m)
+		}
+		d.users = append(d.users, &user)
+	}
+	return d
+}
+
+// Grants returns the memberships, as "<team|group> <ID> <role ID>", in the
+// order they were granted
+func (d *provisioningDB) Grants() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var grants []string
+	for _, m := range d.memberships {
+		grants = append(grants, fmt.Sprintf("%s %d %d", m.kind, m.id, m.roleID))
+	}
+	return grants
+}
+
+// Sources returns the sources of the memberships, in the order of Grants
+func (d *provisioningDB) Sources() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var sources []string
+	for _, m := range d.memberships {
+		sources = append(sources, m.source)
+	}
+	return sources
+}
+
+func (d *provisioningDB) membership(userID int, kind string, id int) (int, *membership) {
+	for i, m := range d.memberships {
+		if m.userID == userID && m.kind == kind && m.id == id {
+			return i, m
+		}
+	}
+	return -1, nil
+}
+
+// grant answers the membership inserts: mapped ones leave memberships of
+// other sources alone, others take them over
+func (d *provisioningDB) grant(kind string, args []driver.Value) fakeAnswer {
+	granted := &membership{kind: kind}
+	granted.userID, granted.id, granted.roleID = int(args[0].(int64)), int(args[1].(int64)), int(args[2].(int64))
+	if len(args) > 3 {
+		granted.source = args[3].(string)
+	}
+
+	_, existing := d.membership(granted.userID, kind, granted.id)
+	switch {
+	case existing == nil:
+		d.memberships = append(d.memberships, granted)
+	case granted.source == "":
+		existing.roleID, existing.source = granted.roleID, ""
+	case existing.source == granted.source:
+		existing.roleID = granted.roleID
+	}
+	return fakeAnswer{rowsAffected: 1}
+}
+
+// mapped answers the selection of the memberships a source granted
+func (d *provisioningDB) mapped(kind string, args []driver.Value) fakeAnswer {
+	var ids [][]interface{}
+	for _, m := range d.memberships {
+		if int64(m.userID) == args[0].(int64) && m.kind == kind && m.source == args[1] {
+			ids = append(ids, row(m.id))
+		}
+	}
+	return fakeAnswer{rows: rows(ids...)}
+}
+
+// revoke answers the deletion of a membership a source granted
+func (d *provisioningDB) revoke(kind string, args []driver.Value) fakeAnswer {
+	i, m := d.membership(int(args[0].(int64)), kind, int(args[1].(int64)))
+	if m == nil || m.source != args[2] {
+		return fakeAnswer{}
+	}
+	d.memberships = append(d.memberships[:i], d.memberships[i+1:]...)
+	return fakeAnswer{rowsAffected: 1}
+}
+
+// Linked returns the user an identity is linked to, or 0
+func (d *provisioningDB) Linked(provider, subject string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.identities[provider+" "+subject]
+}
+
+func (d *provisioningDB) user(match func(*directoryUser) bool) *directoryUser {
+	for _, user := range d.users {
+		if match(user) {
+			return user
+		}
+	}
+	return nil
+}
+
+func (d *provisioningDB) userByID(id driver.Value) *directoryUser {
+	return d.user(func(user *directoryUser) bool { return int64(user.id) == id.(int64) })
+}
+
+// userRow is a user as selected with the user columns
+func userRow(user *directoryUser) [][]driver.Value {
+	if user == nil {
+		return nil
+	}
+	return rows(row(user.id, user.organization, user.email, "", "", "",
+		!user.inactive, false, user.superAdmin, user.orgAdmin, time.Time{}, time.Time{}))
+}
+
+func (d *provisioningDB) answer(query string, args []driver.Value) (fakeAnswer, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	id := func(i int) int { return int(args[i].(int64)) }
+
+	switch {
+	case strings.Contains(query, "FROM organizations WHERE slug = ?"):
+		if args[0] != "default" {
+			return fakeAnswer{}, true
+		}
+		return fakeAnswer{rows: rows(row(provisioningOrganization, "Default", "default", true, time.Time{}, time.Time{}))}, true
+
+	// Identities
+	case strings.Contains(query, "SELECT user_id FROM user_identities WHERE provider = ? AND subject = ?"):
+		userID, exists := d.identities[fmt.Sprintf("%s %s", args[0], args[1])]
+		if !exists {
+			return fakeAnswer{}, true
+		}
+		return fakeAnswer{rows: rows(row(userID))}, true
+
+	case strings.Contains(query, "SELECT EXISTS(SELECT 1 FROM user_identities WHERE provider = ? AND subject = ?)"):
+		_, exists := d.identities[fmt.Sprintf("%s %s", args[0], args[1])]
+		return fakeAnswer{rows: rows(row(exists))}, true
+
+	case strings.Contains(query, "INSERT INTO user_identities"):
+		d.identities[fmt.Sprintf("%s %s", args[1], args[2])] = id(0)
+		return fakeAnswer{rowsAffected: 1, lastInsertID: 1}, true
+
+	case strings.Contains(query, "UPDATE user_identities"):
+		return fakeAnswer{rowsAffected: 1}, true
+
+	// Users
+	case strings.Contains(query, "SELECT id, organization_id, email, password_hash") && strings.Contains(query, "WHERE id = ?"):
+		return fakeAnswer{rows: userRow(d.userByID(args[0]))}, true
+
+	case strings.Contains(query, "WHERE organization_id = ? AND email = ?"):
+		return fakeAnswer{rows: userRow(d.user(func(user *directoryUser) bool {
+			return user.organization == id(0) && user.email == args[1]
+		}))}, true
+
+	case strings.Contains(query, "SELECT EXISTS(SELECT 1 FROM users WHERE email = ?)"):
+		exists := d.user(func(user *directoryUser) bool { return user.email == args[0] }) != nil
+		return fakeAnswer{rows: rows(row(exists))}, true
+
+	case strings.Contains(query, "INSERT INTO users"):
+		user := &directoryUser{id: firstProvisionedUserID + len(d.users), organization: id(0), email: args[1].(string)}
+		d.users = append(d.users, user)
+		return fakeAnswer{rowsAffected: 1, lastInsertID: int64(user.id)}, true
+
+	case strings.Contains(query, "SELECT organization_id FROM users WHERE id = ?"):
+		user := d.userByID(args[0])
+		if user == nil {
+			return fakeAnswer{}, true
+		}
+		return fakeAnswer{rows: rows(row(user.organization))}, true
+
+	// Permissions
+	case strings.Contains(query, "SELECT organization_id, is_super_admin, is_org_admin FROM users"):
+		user := d.userByID(args[0])
+		if user == nil {
+			return fakeAnswer{}, true
+		}
+		return fakeAnswer{rows: rows(row(user.organization, user.superAdmin, user.orgAdmin))}, true
+
+	case strings.Contains(query, "SELECT 'team', ut.team_id, r.name, p.resource, p.action"):
+		if user := d.userByID(args[0]); user != nil && user.adminRole {
+			return fakeAnswer{rows: rows(row("team", platformTeam, "admin", "team", "update"))}, true
+		}
+		return fakeAnswer{}, true
+
+	// Group mappings
+	case strings.Contains(query, "FROM roles") && strings.Contains(query, "WHERE name = ?"):
+		roleID, exists := provisioningRoles[args[0].(string)]
+		if !exists {
+			return fakeAnswer{}, true
+		}
+		return fakeAnswer{rows: rows(row(roleID, args[0], "", true, time.Time{}))}, true
+
+	case strings.Contains(query, "JOIN role_permissions rp ON p.id = rp.permission_id"):
+		return fakeAnswer{}, true
+
+	case strings.Contains(query, "SELECT id FROM teams WHERE organization_id = ? AND name = ?"):
+		if id(0) != provisioningOrganization || args[1] != "Platform" {
+			return fakeAnswer{}, true
+		}
+		return fakeAnswer{rows: rows(row(platformTeam))}, true
+
+	case strings.Contains(query, "SELECT id, organization_id, name, description, group_id"):
+		return fakeAnswer{rows: rows(row(platformTeam, provisioningOrganization, "Platform", "", nil, time.Time{}, time.Time{}))}, true
+
+	case strings.Contains(query, "SELECT id FROM groups WHERE organization_id = ? AND name = ?"):
+		if id(0) != provisioningOrganization || args[1] != "Engineering" {
+			return fakeAnswer{}, true
+		}
+		return fakeAnswer{rows: rows(row(engineeringGroup))}, true
+
+	case strings.Contains(query, "SELECT id, organization_id, name, description, parent_id"):
+		return fakeAnswer{rows: rows(row(engineeringGroup, provisioningOrganization, "Engineering", "", nil, time.Time{}, time.Time{}))}, true
+
+	case strings.Contains(query, "SELECT EXISTS(SELECT 1 FROM teams WHERE id = ? AND organization_id = ?)"):
+		return fakeAnswer{rows: rows(row(id(0) == platformTeam && id(1) == provisioningOrganization))}, true
+
+	case strings.Contains(query, "SELECT EXISTS(SELECT 1 FROM groups WHERE id = ? AND organization_id = ?)"):
+		return fakeAnswer{rows: rows(row(id(0) == engineeringGroup && id(1) == provisioningOrganization))}, true
+
+	case strings.Contains(query, "INSERT INTO user_teams"):
+		return d.grant("team", args), true
+
+	case strings.Contains(query, "INSERT INTO user_groups"):
+		return d.grant("group", args), true
+
+	case strings.Contains(query, "SELECT team_id FROM user_teams WHERE user_id = ? AND source = ?"):
+		return d.mapped("team", args), true
+
+	case strings.Contains(query, "SELECT group_id FROM user_groups WHERE user_id = ? AND source = ?"):
+		return d.mapped("group", args), true
+
+	case strings.Contains(query, "DELETE FROM user_teams WHERE user_id = ? AND team_id = ? AND source = ?"):
+		return d.revoke("team", args), true
+
+	case strings.Contains(query, "DELETE FROM user_groups WHERE user_id = ? AND group_id = ? AND source = ?"):
+		return d.revoke("group", args), true
+	}
+
+	return fakeAnswer{}, false
+}
+
+func TestProvision(t *testing.T) {
+	users := []directoryUser{
+		{id: 2001, email: "linked@example.com", identities: []string{"oidc linked-subject"}},
+		{id: 2002, email: "member@example.com"},
+		{id: 2003, email: "super@example.com", superAdmin: true},
+		{id: 2004, email: "orgadmin@example.com", orgAdmin: true},
+		{id: 2005, email: "teamadmin@example.com", adminRole: true},
+		{id: 2006, email: "other@example.com", organization: otherOrganization},
+		{id: 2007, email: "inactive@example.com", inactive: true, identities: []string{"oidc inactive-subject"}},
+	}
+
+	tests := []struct {
+		name     string
+		identity ExternalIdentity
+		wantUser int // The user returned and linked
+		wantErr  error
+	}{
+		{
+			name:     "linked identity",
+			identity: ExternalIdentity{Subject: "linked-subject", Email: "changed@example.com"},
+			wantUser: 2001,
+		},
+		{
+			name:     "new user",
+			identity: ExternalIdentity{Subject: "new-subject", Email: "new@example.com"},
+			wantUser: firstProvisionedUserID + len(users),
+		},
+		{
+			name:     "verified email of a member",
+			identity: ExternalIdentity{Subject: "member-subject", Email: "member@example.com", EmailVerified: true},
+			wantUser: 2002,
+		},
+		{
+			name:     "unverified email of a member",
+			identity: ExternalIdentity{Subject: "member-subject", Email: "member@example.com"},
+			wantErr:  ErrIdentityNotLinkable,
+		},
+		{
+			name:     "email of a super admin",
+			identity: ExternalIdentity{Subject: "super-subject", Email: "super@example.com", EmailVerified: true},
+			wantErr:  ErrIdentityNotLinkable,
+		},
+		{
+			name:     "email of an organization admin",
+			identity: ExternalIdentity{Subject: "orgadmin-subject", Email: "orgadmin@example.com", EmailVerified: true},
+			wantErr:  ErrIdentityNotLinkable,
+		},
+		{
+			name:     "email of a team admin",
+			identity: ExternalIdentity{Subject: "teamadmin-subject", Email: "teamadmin@example.com", EmailVerified: true},
+			wantErr:  ErrIdentityNotLinkable,
+		},
+		{
+			name:     "email of another organization",
+			identity: ExternalIdentity{Subject: "other-subject", Email: "other@example.com", EmailVerified: true},
+			wantErr:  ErrIdentityNotLinkable,
+		},
+		{
+			name:     "inactive user",
+			identity: ExternalIdentity{Subject: "inactive-subject", Email: "inactive@example.com"},
+			wantErr:  ErrUserInactive,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			directory := newProvisioningDB(users...)
+			db, _ := newFakeDB(t, directory.answer)
+
+			identity := tt.identity
+			identity.Provider = OIDCProviderName
+			user, err := NewProvisioner(db).Provision(&identity, "default", nil)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if tt.wantErr == ErrIdentityNotLinkable && directory.Linked(identity.Provider, identity.Subject) != 0 {
+					t.Errorf("identity was linked")
+				}
+				return
+			}
+
+			if user.ID != tt.wantUser {
+				t.Errorf("user = %d, want %d", user.ID, tt.wantUser)
+			}
+			if linked := directory.Linked(identity.Provider, identity.Subject); linked != tt.wantUser {
+				t.Errorf("identity linked to %d, want %d", linked, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestProvisionGroupMappings(t *testing.T) {
+	mappings := []GroupMapping{
+		{ExternalGroup: "platform-admins", TargetType: MappingTargetTeam, TargetName: "Platform", RoleName: "admin"},
+		{ExternalGroup: "auditors", TargetType: MappingTargetGroup, TargetName: "Engineering", RoleName: "viewer"},
+		{ExternalGroup: "auditors", TargetType: MappingTargetTeam, TargetName: "Unknown", RoleName: "viewer"},
+		{ExternalGroup: "auditors", TargetType: MappingTargetGroup, TargetName: "Engineering", RoleName: "unknown"},
+	}
+
+	tests := []struct {
+		name        string
+		memberships []string // Memberships before the login
+		groups      []string
+		wantGrants  []string
+		wantSources []string
+	}{
+		{name: "no groups"},
+		{name: "unmapped group", groups: []string{"developers"}},
+		{name: "team mapping", groups: []string{"platform-admins"}, wantGrants: []string{"team 200 1"}, wantSources: []string{"oidc"}},
+		{
+			name:        "mappings match case-insensitively, unknown targets and roles are skipped",
+			groups:      []string{"Platform-Admins", "AUDITORS"},
+			wantGrants:  []string{"team 200 1", "group 20 3"},
+			wantSources: []string{"oidc", "oidc"},
+		},
+		{
+			name:        "membership granted by hand keeps its role",
+			memberships: []string{"team 200 2", "group 20 1"},
+			groups:      []string{"platform-admins", "auditors"},
+			wantGrants:  []string{"team 200 2", "group 20 1"},
+			wantSources: []string{"", ""},
+		},
+		{
+			name:        "membership granted by hand is not revoked",
+			memberships: []string{"team 200 3"},
+			wantGrants:  []string{"team 200 3"},
+			wantSources: []string{""},
+		},
+		{
+			name:        "mapped membership follows the mapped role",
+			memberships: []string{"team 200 3 oidc"},
+			groups:      []string{"platform-admins"},
+			wantGrants:  []string{"team 200 1"},
+			wantSources: []string{"oidc"},
+		},
+		{
+			name:        "mapped memberships are revoked when the group is gone",
+			memberships: []string{"team 200 1 oidc", "group 20 3 oidc"},
+			groups:      []string{"auditors"},
+			wantGrants:  []string{"group 20 3"},
+			wantSources: []string{"oidc"},
+		},
+		{
+			name:        "memberships mapped by another provider are kept",
+			memberships: []string{"team 200 1 ldap"},
+			wantGrants:  []string{"team 200 1"},
+			wantSources: []string{"ldap"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			directory := newProvisioningDB(directoryUser{
+				id: 2010, email: "mapped@example.com", identities: []string{"oidc mapped"}, memberships: tt.memberships,
+			})
+			db, _ := newFakeDB(t, directory.answer)
+
+			identity := &ExternalIdentity{Provider: OIDCProviderName, Subject: "mapped", Groups: tt.groups}
+			if _, err := NewProvisioner(db).Provision(identity, "default", mappings); err != nil {
+				t.Fatalf("Provision() error = %v", err)
+			}
+
+			if grants := directory.Grants(); !reflect.DeepEqual(grants, tt.wantGrants) {
+				t.Errorf("grants = %v, want %v", grants, tt.wantGrants)
+			}
+			if sources := directory.Sources(); !reflect.DeepEqual(sources, tt.wantSources) {
+				t.Errorf("sources = %q, want %q", sources, tt.wantSources)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"devops-assessment/internal/models"
+)
+
+// ErrResetTokenInvalid is returned for unknown, used or expired reset links
+var ErrResetTokenInvalid = errors.New("invalid or expired password reset link")
+
+const (
+	// PasswordResetDuration is how long a password reset link is valid
+	PasswordResetDuration = time.Hour
+
+	// passwordResetInterval limits how often a user is sent a reset link
+	passwordResetInterval = time.Minute
+)
+
+// RequestPasswordReset creates a password reset token for the user with
+// an email. It returns no user when no link should be sent: the email is
+// unknown, the account is inactive, a service account or managed by a
+// directory or identity provider, or a link was sent very recently. Callers
+// must not reveal which.
+func (s *AuthService) RequestPasswordReset(email string) (*models.User, string, error) {
+	user := &models.User{}
+	if err := s.userService.GetUserByEmail(email, user); err != nil {
+		if err == models.ErrUserNotFound {
+			return nil, "", nil
+		}
+		return nil, "", err
+	}
+
+	if !user.IsActive || user.IsServiceAccount {
+		return nil, "", nil
+	}
+
+	// Directory and SSO users change their password there
+	external, err := s.db.Exists("SELECT 1 FROM user_identities WHERE user_id = ?", user.ID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to check external identities: %w", err)
+	}
+	if external {
+		return nil, "", nil
+	}
+
+	recent, err := s.db.Exists(
+		"SELECT 1 FROM password_resets WHERE user_id = ? AND created_at > ?",
+		user.ID, time.Now().Add(-passwordResetInterval),
+	)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to check password resets: %w", err)
+	}
+	if recent {
+		return nil, "", nil
+	}
+
+	token, err := generateSecureToken(TokenLength)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	// A new link replaces older ones
+	err = s.db.Transaction(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM password_resets WHERE user_id = ?", user.ID); err != nil {
+			return err
+		}
+		now := time.Now()
+		_, err := tx.Exec(
+			"INSERT INTO password_resets (token_hash, user_id, expires_at, created_at) VALUES (?, ?, ?, ?)",
+			hashToken(token), user.ID, now.Add(PasswordResetDuration), now,
+		)
+		return err
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create password reset: %w", err)
+	}
+
+	return user, token, nil
+}
+
+// ResetPasswordWithToken sets a new password with a reset token, which is
+// then used up. It ends the user's sessions and lifts a login lockout, and
+// returns the user.
+func (s *AuthService) ResetPasswordWithToken(token, newPassword string) (*models.User, error) {
+	var userID int
+	err := s.db.QueryRowContext(context.Background(), `
+		SELECT user_id FROM password_resets
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?
+	`, hashToken(token), time.Now()).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return nil, ErrResetTokenInvalid
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get password reset: %w", err)
+	}
+
+	user := &models.User{}
+	if err := s.userService.GetUserByID(userID, user); err != nil {
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, ErrResetTokenInvalid
+	}
+
+	if err := s.CheckPassword(userID, newPassword); err != nil {
+		return nil, err
+	}
+
+	// Use up the token before changing anything
+	affected, err := s.db.Update(
+		"UPDATE password_resets SET used_at = CURRENT_TIMESTAMP WHERE token_hash = ? AND used_at IS NULL",
+		hashToken(token),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use password reset: %w", err)
+	}
+	if affected == 0 {
+		return nil, ErrResetTokenInvalid
+	}
+
+	if err := s.userService.UpdatePassword(userID, newPassword); err != nil {
+		return nil, fmt.Errorf("failed to reset password: %w", err)
+	}
+
+	if err := s.DeleteUserSessions(userID); err != nil {
+		return nil, fmt.Errorf("failed to invalidate sessions: %w", err)
+	}
+
+	if err := s.throttle.Unlock(ThrottleScopeAccount, user.Email); err != nil && err != ErrLockoutNotFound {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// CleanupExpiredPasswordResets removes expired reset tokens
+func (s *AuthService) CleanupExpiredPasswordResets() error {
+	query := `DELETE FROM password_resets WHERE expires_at < ?`
+
+	if _, err := s.db.Delete(query, time.Now()); err != nil {
+		return fmt.Errorf("failed to cleanup password resets: %w", err)
+	}
+
+	return nil
+}
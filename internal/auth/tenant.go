@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"devops-assessment/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// OrganizationHeader selects the organization of a request by slug, for
+	// API clients that don't use the organization's subdomain
+	OrganizationHeader = "X-Organization"
+
+	// OrganizationContextKey is the key for storing the organization of the
+	// request in context
+	OrganizationContextKey ContextKey = "organization"
+)
+
+// Tenant errors
+var (
+	ErrOrganizationAccess   = errors.New("user is not a member of this organization")
+	ErrOrganizationInactive = errors.New("organization is deactivated")
+)
+
+// resolveOrganization returns the organization a request acts in: the one
+// named by the X-Organization header or the subdomain of the tenant domain,
+// or else the user's own. Only super admins can act in other organizations
+// and in deactivated ones.
+func (m *Middleware) resolveOrganization(c *gin.Context, user *models.User) (*models.Organization, error) {
+	organization := &models.Organization{}
+
+	var err error
+	if slug := m.organizationSlug(c); slug != "" {
+		err = m.organizationService.GetOrganizationBySlug(slug, organization)
+	} else {
+		err = m.organizationService.GetOrganizationByID(user.OrganizationID, organization)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if user.IsSuperAdmin {
+		return organization, nil
+	}
+	if organization.ID != user.OrganizationID {
+		return nil, ErrOrganizationAccess
+	}
+	if !organization.IsActive {
+		return nil, ErrOrganizationInactive
+	}
+
+	return organization, nil
+}
+
+// organizationSlug returns the organization slug of a request, from the
+// X-Organization header or the subdomain of the tenant domain, or ""
+func (m *Middleware) organizationSlug(c *gin.Context) string {
+	if slug := strings.TrimSpace(c.GetHeader(OrganizationHeader)); slug != "" {
+		return strings.ToLower(slug)
+	}
+
+	if m.tenantDomain == "" {
+		return ""
+	}
+
+	host := c.Request.Host
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+
+	// Only direct subdomains name an organization
+	slug, ok := strings.CutSuffix(strings.ToLower(host), "."+m.tenantDomain)
+	if !ok || strings.Contains(slug, ".") {
+		return ""
+	}
+
+	return slug
+}
+
+// organizationError writes the response for an organization resolution
+// error and reports whether err was one
+func organizationError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, models.ErrOrganizationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+	case errors.Is(err, ErrOrganizationAccess):
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this organization"})
+	case errors.Is(err, ErrOrganizationInactive):
+		c.JSON(http.StatusForbidden, gin.H{"error": "This organization is deactivated"})
+	default:
+		return false
+	}
+
+	c.Abort()
+	return true
+}
+
+// RequireSuperAdmin ensures the user is a super admin. Like roles, super
+// admin rights can't be exercised with API tokens.
+func (m *Middleware) RequireSuperAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := GetCurrentUser(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			c.Abort()
+			return
+		}
+
+		if _, isToken := c.Get(string(APITokenContextKey)); isToken {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API tokens can't access this endpoint"})
+			c.Abort()
+			return
+		}
+
+		if !user.IsSuperAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireOrganizationUser ensures the user of a URL parameter belongs to the
+// organization of the request. Users of other organizations are reported
+// as not found.
+func (m *Middleware) RequireOrganizationUser(userParamName string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := strconv.Atoi(c.Param(userParamName))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			c.Abort()
+			return
+		}
+
+		user := &models.User{}
+		if err := m.authService.userService.GetUserByID(userID, user); err != nil {
+			if err == models.ErrUserNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+			}
+			c.Abort()
+			return
+		}
+
+		if user.OrganizationID != GetOrganizationID(c) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireAdminTarget ensures that only super admins change super admins, and
+// only organization or super admins change organization admins: changes to
+// such a user of a URL parameter are refused for everyone else, whatever
+// their permissions in the organization. Like other admin rights, it can't
+// be exercised with API tokens.
+func (m *Middleware) RequireAdminTarget(userParamName string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := strconv.Atoi(c.Param(userParamName))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			c.Abort()
+			return
+		}
+
+		target := &models.User{}
+		if err := m.authService.userService.GetUserByID(userID, target); err != nil {
+			if err == models.ErrUserNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+			}
+			c.Abort()
+			return
+		}
+
+		if !target.IsSuperAdmin && !target.IsOrgAdmin {
+			c.Next()
+			return
+		}
+
+		user, err := GetCurrentUser(c)
+		_, isToken := c.Get(string(APITokenContextKey))
+		if err != nil || isToken {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can change admins"})
+			c.Abort()
+			return
+		}
+
+		if target.IsSuperAdmin && !user.IsSuperAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only super admins can change super admins"})
+			c.Abort()
+			return
+		}
+		if target.IsOrgAdmin && !user.IsSuperAdmin && !user.IsOrgAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only organization admins can change organization admins"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// GetCurrentOrganization retrieves the organization of the request from
+// context, or nil for unauthenticated requests
+func GetCurrentOrganization(c *gin.Context) *models.Organization {
+	organization, exists := c.Get(string(OrganizationContextKey))
+	if !exists {
+		return nil
+	}
+
+	organizationModel, _ := organization.(*models.Organization)
+	return organizationModel
+}
+
+// GetOrganizationID returns the ID of the organization of the request, or 0
+// for unauthenticated requests
+func GetOrganizationID(c *gin.Context) int {
+	if organization := GetCurrentOrganization(c); organization != nil {
+		return organization.ID
+	}
+	return 0
+}
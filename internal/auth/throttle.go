@@ -0,0 +1,337 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"devops-assessment/internal/database"
+	"devops-assessment/internal/models"
+)
+
+// Login throttling errors
+var (
+	ErrLoginThrottled      = errors.New("too many failed login attempts, try again later")
+	ErrAccountLocked       = errors.New("account is temporarily locked after too many failed login attempts")
+	ErrLockoutNotFound     = errors.New("lockout not found")
+	ErrLockoutScopeInvalid = errors.New("invalid lockout scope")
+)
+
+// Throttle scopes: failures are counted per login name and per client IP
+const (
+	ThrottleScopeAccount = "account"
+	ThrottleScopeIP      = "ip"
+)
+
+// ThrottleError is returned for logins that are refused without checking
+// the password. It wraps ErrAccountLocked or ErrLoginThrottled.
+type ThrottleError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *ThrottleError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ThrottleError) Unwrap() error {
+	return e.Err
+}
+
+// ThrottleConfig holds login throttling configuration
+type ThrottleConfig struct {
+	AccountMaxFailures int           // Failures before a login name is locked
+	IPMaxFailures      int           // Failures before a client IP is locked
+	BackoffBase        time.Duration // Delay after the first failure, doubled for each further one
+	LockoutDuration    time.Duration // How long a lock lasts, and how long failures are remembered
+}
+
+// DefaultThrottleConfig returns the throttling used unless configured
+func DefaultThrottleConfig() ThrottleConfig {
+	return ThrottleConfig{
+		AccountMaxFailures: 5,
+		IPMaxFailures:      50,
+		BackoffBase:        time.Second,
+		LockoutDuration:    15 * time.Minute,
+	}
+}
+
+// LoginLockout is a login name or client IP locked after too many failures
+type LoginLockout struct {
+	Scope       string    `json:"scope"`
+	Subject     string    `json:"subject"`
+	Failures    int       `json:"failures"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// LoginThrottle tracks failed logins. After each failure the login name and
+// client IP have to wait before the next attempt, twice as long each time,
+// and once they reach their failure limit they are locked.
+type LoginThrottle struct {
+	db           *database.DB
+	config       ThrottleConfig
+	userService  *models.UserService
+	auditService *models.AuditService
+}
+
+// NewLoginThrottle creates a new login throttle
+func NewLoginThrottle(db *database.DB, config ThrottleConfig) *LoginThrottle {
+	return &LoginThrottle{
+		db:           db,
+		config:       config,
+		userService:  models.NewUserService(db),
+		auditService: models.NewAuditService(db),
+	}
+}
+
+// Check returns a ThrottleError if the login name or client IP has to wait
+func (t *LoginThrottle) Check(username, clientIP string) error {
+	query := `
+		SELECT blocked_until, locked
+		FROM login_throttles
+		WHERE ((scope = ? AND subject = ?) OR (scope = ? AND subject = ?))
+		  AND blocked_until > ?
+	`
+
+	now := time.Now()
+	rows, err := t.db.GetMany(query,
+		ThrottleScopeAccount, accountSubject(username),
+		ThrottleScopeIP, clientIP,
+		now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to check login throttle: %w", err)
+	}
+	defer rows.Close()
+
+	var throttleErr *ThrottleError
+	for rows.Next() {
+		var blockedUntil time.Time
+		var locked bool
+		if err := rows.Scan(&blockedUntil, &locked); err != nil {
+			return fmt.Errorf("failed to scan login throttle: %w", err)
+		}
+
+		// Report the longest wait
+		retryAfter := blockedUntil.Sub(now)
+		if throttleErr != nil && throttleErr.RetryAfter >= retryAfter {
+			continue
+		}
+		throttleErr = &ThrottleError{Err: ErrLoginThrottled, RetryAfter: retryAfter}
+		if locked {
+			throttleErr.Err = ErrAccountLocked
+		}
+	}
+
+	if throttleErr != nil {
+		return throttleErr
+	}
+	return nil
+}
+
+// RecordFailure counts a failed login against the login name and client
+// IP, and audits the ones it locks
+func (t *LoginThrottle) RecordFailure(username, clientIP string) error {
+	subject := accountSubject(username)
+
+	lockedUntil, err := t.recordFailure(ThrottleScopeAccount, subject, t.config.AccountMaxFailures)
+	if err != nil {
+		return err
+	}
+	if lockedUntil != nil {
+		t.auditLockout(ThrottleScopeAccount, subject, clientIP, *lockedUntil)
+	}
+
+	if clientIP == "" {
+		return nil
+	}
+
+	lockedUntil, err = t.recordFailure(ThrottleScopeIP, clientIP, t.config.IPMaxFailures)
+	if err != nil {
+		return err
+	}
+	if lockedUntil != nil {
+		t.auditLockout(ThrottleScopeIP, clientIP, clientIP, *lockedUntil)
+	}
+
+	return nil
+}
+
+// RecordSuccess clears the failures of a login name
+func (t *LoginThrottle) RecordSuccess(username string) error {
+	if _, err := t.db.Delete(
+		"DELETE FROM login_throttles WHERE scope = ? AND subject = ?",
+		ThrottleScopeAccount, accountSubject(username),
+	); err != nil {
+		return fmt.Errorf("failed to reset login throttle: %w", err)
+	}
+	return nil
+}
+
+// ListLockouts returns the current lockouts
+func (t *LoginThrottle) ListLockouts() ([]LoginLockout, error) {
+	query := `
+		SELECT scope, subject, failures, blocked_until
+		FROM login_throttles
+		WHERE locked = true AND blocked_until > ?
+		ORDER BY blocked_until DESC
+	`
+
+	rows, err := t.db.GetMany(query, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list lockouts: %w", err)
+	}
+	defer rows.Close()
+
+	lockouts := []LoginLockout{}
+	for rows.Next() {
+		var lockout LoginLockout
+		if err := rows.Scan(&lockout.Scope, &lockout.Subject, &lockout.Failures, &lockout.LockedUntil); err != nil {
+			return nil, fmt.Errorf("failed to scan lockout: %w", err)
+		}
+		lockouts = append(lockouts, lockout)
+	}
+
+	return lockouts, nil
+}
+
+// Unlock clears the failures and any lock of a login name or client IP
+func (t *LoginThrottle) Unlock(scope, subject string) error {
+	switch scope {
+	case ThrottleScopeAccount:
+		subject = accountSubject(subject)
+	case ThrottleScopeIP:
+	default:
+		return ErrLockoutScopeInvalid
+	}
+
+	affected, err := t.db.Delete(
+		"DELETE FROM login_throttles WHERE scope = ? AND subject = ?",
+		scope, subject,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to unlock: %w", err)
+	}
+
+	if affected == 0 {
+		return ErrLockoutNotFound
+	}
+
+	return nil
+}
+
+// CleanupExpired removes failures that are no longer remembered
+func (t *LoginThrottle) CleanupExpired() error {
+	now := time.Now()
+	query := `
+		DELETE FROM login_throttles
+		WHERE last_failure_at < ? AND (blocked_until IS NULL OR blocked_until < ?)
+	`
+
+	if _, err := t.db.Delete(query, now.Add(-t.config.LockoutDuration), now); err != nil {
+		return fmt.Errorf("failed to cleanup login throttles: %w", err)
+	}
+
+	return nil
+}
+
+// recordFailure counts a failure and sets the wait before the next attempt.
+// It returns the end of the lock if this failure locked the subject.
+func (t *LoginThrottle) recordFailure(scope, subject string, maxFailures int) (*time.Time, error) {
+	now := time.Now()
+	var lockedUntil *time.Time
+
+	err := t.db.Transaction(func(tx *sql.Tx) error {
+		var failures int
+		var lastFailureAt sql.NullTime
+		err := tx.QueryRow(`
+			SELECT failures, last_failure_at FROM login_throttles
+			WHERE scope = ? AND subject = ?
+			FOR UPDATE
+		`, scope, subject).Scan(&failures, &lastFailureAt)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		// Failures older than the lockout duration are forgotten
+		if !lastFailureAt.Valid || now.Sub(lastFailureAt.Time) > t.config.LockoutDuration {
+			failures = 0
+		}
+		failures++
+
+		locked := maxFailures > 0 && failures >= maxFailures
+		blockedUntil := now.Add(t.backoff(failures))
+		if locked {
+			blockedUntil = now.Add(t.config.LockoutDuration)
+			lockedUntil = &blockedUntil
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO login_throttles (scope, subject, failures, last_failure_at, blocked_until, locked)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE
+				failures = VALUES(failures),
+				last_failure_at = VALUES(last_failure_at),
+				blocked_until = VALUES(blocked_until),
+				locked = VALUES(locked)
+		`, scope, subject, failures, now, blockedUntil, locked)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	return lockedUntil, nil
+}
+
+// backoff returns the wait after a number of failures
+func (t *LoginThrottle) backoff(failures int) time.Duration {
+	delay := t.config.BackoffBase
+	for i := 1; i < failures && delay < t.config.LockoutDuration; i++ {
+		delay *= 2
+	}
+	if delay > t.config.LockoutDuration {
+		delay = t.config.LockoutDuration
+	}
+	return delay
+}
+
+// auditLockout writes a lockout to the audit log
+func (t *LoginThrottle) auditLockout(scope, subject, clientIP string, lockedUntil time.Time) {
+	entry := &models.AuditEntry{
+		Action:       "ip_locked",
+		ResourceType: "ip",
+		Details: map[string]interface{}{
+			"subject":      subject,
+			"locked_until": lockedUntil,
+		},
+		IPAddress: clientIP,
+	}
+
+	if scope == ThrottleScopeAccount {
+		entry.Action = "account_locked"
+		entry.ResourceType = "user"
+
+		user := &models.User{}
+		if err := t.userService.GetUserByEmail(subject, user); err == nil {
+			entry.OrganizationID = user.OrganizationID
+			entry.ResourceID = user.ID
+		}
+	}
+
+	if err := t.auditService.Log(entry); err != nil {
+		log.Printf("Failed to audit lockout of %s %s: %v", scope, subject, err)
+	}
+}
+
+// accountSubject normalises a login name, which is matched case-insensitively
+func accountSubject(username string) string {
+	subject := strings.ToLower(strings.TrimSpace(username))
+	if len(subject) > 255 {
+		subject = subject[:255]
+	}
+	return subject
+}
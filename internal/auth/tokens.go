@@ -0,0 +1,357 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"devops-assessment/internal/database"
+	"devops-assessment/internal/models"
+)
+
+// API token errors
+var (
+	ErrTokenNotFound     = errors.New("API token not found")
+	ErrTokenInvalid      = errors.New("invalid, expired or revoked API token")
+	ErrTokenScopeInvalid = errors.New("invalid token scope")
+)
+
+const (
+	// APITokenPrefix marks API tokens, so they can be told apart from
+	// session tokens and found by secret scanners
+	APITokenPrefix = "dat_"
+
+	// apiTokenDisplayLength is the number of characters kept to recognise
+	// a token in listings
+	apiTokenDisplayLength = 12
+
+	// apiTokenTouchInterval limits how often last_used_at is written
+	apiTokenTouchInterval = time.Minute
+)
+
+// APIToken represents a personal access token. The token itself is only
+// returned when it is created; the database keeps its hash.
+type APIToken struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedBy  int        `json:"created_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// HasScope checks if the token grants a permission
+func (t *APIToken) HasScope(resource, action string) bool {
+	scope := resource + ":" + action
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APITokenService handles API token operations
+type APITokenService struct {
+	db          *database.DB
+	userService *models.UserService
+	roleService *models.RoleService
+	rbacService *models.RBACService
+}
+
+// NewAPITokenService creates a new API token service
+func NewAPITokenService(db *database.DB) *APITokenService {
+	return &APITokenService{
+		db:          db,
+		userService: models.NewUserService(db),
+		roleService: models.NewRoleService(db),
+		rbacService: models.NewRBACService(db),
+	}
+}
+
+// CreateToken creates a token for a user and returns it with the plain
+// token. Scopes have the form "resource:action" and must be permissions the
+// user holds; they are checked again on every request.
+func (s *APITokenService) CreateToken(userID, createdBy int, name string, scopes []string, expiresAt *time.Time) (*APIToken, string, error) {
+	permissionIDs, scopes, err := s.resolveScopes(userID, scopes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	secret, err := generateSecureToken(TokenLength)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	plain := APITokenPrefix + secret
+
+	token := &APIToken{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    plain[:apiTokenDisplayLength],
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+	}
+
+	var creator interface{}
+	if createdBy > 0 {
+		creator = createdBy
+	}
+
+	err = s.db.Transaction(func(tx *sql.Tx) error {
+		result, err := tx.Exec(`
+			INSERT INTO api_tokens (user_id, name, token_prefix, token_hash, expires_at, created_by)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, userID, name, token.Prefix, hashToken(plain), expiresAt, creator)
+		if err != nil {
+			return err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		token.ID = int(id)
+
+		for _, permissionID := range permissionIDs {
+			if _, err := tx.Exec(
+				"INSERT INTO api_token_permissions (token_id, permission_id) VALUES (?, ?)",
+				token.ID, permissionID,
+			); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create API token: %w", err)
+	}
+
+	return token, plain, nil
+}
+
+// ListTokens returns a user's tokens, including revoked and expired ones
+func (s *APITokenService) ListTokens(userID int) ([]APIToken, error) {
+	query := `
+		SELECT id, user_id, name, token_prefix, expires_at, last_used_at,
+		       revoked_at, created_by, created_at
+		FROM api_tokens
+		WHERE user_id = ?
+		ORDER BY created_at DESC
+	`
+
+	rows, err := s.db.GetMany(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		var token APIToken
+		if err := scanAPIToken(rows, &token); err != nil {
+			return nil, fmt.Errorf("failed to scan API token: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	for i := range tokens {
+		if tokens[i].Scopes, err = s.getScopes(tokens[i].ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return tokens, nil
+}
+
+// RevokeToken revokes one of a user's tokens
+func (s *APITokenService) RevokeToken(userID, tokenID int) error {
+	query := `
+		UPDATE api_tokens SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND user_id = ? AND revoked_at IS NULL
+	`
+
+	affected, err := s.db.Update(query, tokenID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API token: %w", err)
+	}
+
+	if affected == 0 {
+		return ErrTokenNotFound
+	}
+
+	return nil
+}
+
+// ValidateToken returns the token and its active owner for a plain token
+func (s *APITokenService) ValidateToken(plain string) (*APIToken, *models.User, error) {
+	if !strings.HasPrefix(plain, APITokenPrefix) {
+		return nil, nil, ErrTokenInvalid
+	}
+
+	query := `
+		SELECT id, user_id, name, token_prefix, expires_at, last_used_at,
+		       revoked_at, created_by, created_at
+		FROM api_tokens
+		WHERE token_hash = ?
+	`
+
+	token := &APIToken{}
+	err := scanAPIToken(s.db.QueryRowContext(context.Background(), query, hashToken(plain)), token)
+	if err == sql.ErrNoRows {
+		return nil, nil, ErrTokenInvalid
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get API token: %w", err)
+	}
+
+	if token.RevokedAt != nil || (token.ExpiresAt != nil && time.Now().After(*token.ExpiresAt)) {
+		return nil, nil, ErrTokenInvalid
+	}
+
+	user := &models.User{}
+	if err := s.userService.GetUserByID(token.UserID, user); err != nil {
+		return nil, nil, fmt.Errorf("failed to get token owner: %w", err)
+	}
+	if !user.IsActive {
+		return nil, nil, ErrTokenInvalid
+	}
+
+	if token.Scopes, err = s.getScopes(token.ID); err != nil {
+		return nil, nil, err
+	}
+
+	if token.LastUsedAt == nil || time.Since(*token.LastUsedAt) > apiTokenTouchInterval {
+		s.db.Update("UPDATE api_tokens SET last_used_at = CURRENT_TIMESTAMP WHERE id = ?", token.ID)
+	}
+
+	return token, user, nil
+}
+
+// resolveScopes maps scopes to permission IDs, rejecting scopes that are
+// not permissions of the user. Permissions are checked like RequirePermission
+// checks them, so organization and super admins can grant any scope. It
+// also returns the scopes without duplicates.
+func (s *APITokenService) resolveScopes(userID int, scopes []string) ([]int, []string, error) {
+	if len(scopes) == 0 {
+		return nil, nil, fmt.Errorf("%w: at least one scope is required", ErrTokenScopeInvalid)
+	}
+
+	permissions, err := s.roleService.ListPermissions()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	permissionIDs := make(map[string]int, len(permissions))
+	for _, permission := range permissions {
+		permissionIDs[permission.Resource+":"+permission.Action] = permission.ID
+	}
+
+	seen := make(map[string]bool, len(scopes))
+	var ids []int
+	var unique []string
+	for _, scope := range scopes {
+		if seen[scope] {
+			continue
+		}
+		seen[scope] = true
+
+		id, exists := permissionIDs[scope]
+		if !exists {
+			return nil, nil, fmt.Errorf("%w: %s is not a permission", ErrTokenScopeInvalid, scope)
+		}
+
+		resource, action, _ := strings.Cut(scope, ":")
+		held, err := s.rbacService.CheckUserPermission(userID, resource, action)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !held {
+			return nil, nil, fmt.Errorf("%w: %s is not a permission of the token owner", ErrTokenScopeInvalid, scope)
+		}
+		ids = append(ids, id)
+		unique = append(unique, scope)
+	}
+
+	return ids, unique, nil
+}
+
+// getScopes loads the scopes of a token
+func (s *APITokenService) getScopes(tokenID int) ([]string, error) {
+	query := `
+		SELECT p.resource, p.action
+		FROM api_token_permissions tp
+		JOIN permissions p ON tp.permission_id = p.id
+		WHERE tp.token_id = ?
+		ORDER BY p.resource, p.action
+	`
+
+	rows, err := s.db.GetMany(query, tokenID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token scopes: %w", err)
+	}
+	defer rows.Close()
+
+	scopes := []string{}
+	for rows.Next() {
+		var resource, action string
+		if err := rows.Scan(&resource, &action); err != nil {
+			return nil, fmt.Errorf("failed to scan token scope: %w", err)
+		}
+		scopes = append(scopes, resource+":"+action)
+	}
+
+	return scopes, nil
+}
+
+// scanAPIToken scans a token row without its scopes
+func scanAPIToken(row interface{ Scan(...interface{}) error }, token *APIToken) error {
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	var createdBy sql.NullInt64
+
+	err := row.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Name,
+		&token.Prefix,
+		&expiresAt,
+		&lastUsedAt,
+		&revokedAt,
+		&createdBy,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	token.CreatedBy = int(createdBy.Int64)
+
+	return nil
+}
+
+// hashToken hashes a random token for storage. Tokens are random, so an
+// unsalted hash is sufficient and allows looking them up.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"devops-assessment/internal/models"
+)
+
+// tokenPermissions are the permissions of the token tests, with their IDs
+var tokenPermissions = []string{
+	"assessment:create", "assessment:delete", "assessment:read", "assessment:update",
+	"group:read", "group:update", "report:export", "report:read",
+	"team:read", "team:update", "user:read",
+}
+
+// tokenDBHandler answers the permission queries of the access tests, and
+// lists tokenPermissions
+func tokenDBHandler(query string, args []driver.Value) (fakeAnswer, bool) {
+	if strings.Contains(query, "SELECT id, resource, action, description, created_at") &&
+		strings.Contains(query, "FROM permissions") {
+		var permissions [][]interface{}
+		for i, permission := range tokenPermissions {
+			resource, action, _ := strings.Cut(permission, ":")
+			permissions = append(permissions, row(i+1, resource, action, "", time.Time{}))
+		}
+		return fakeAnswer{rows: rows(permissions...)}, true
+	}
+
+	return accessDBHandler(query, args)
+}
+
+// permissionID returns the ID tokenDBHandler lists a permission with
+func permissionID(permission string) int {
+	return sort.SearchStrings(tokenPermissions, permission) + 1
+}
+
+func TestResolveScopes(t *testing.T) {
+	db, _ := newFakeDB(t, tokenDBHandler)
+	service := NewAPITokenService(db)
+
+	editor, viewer := accessMembers[1], accessMembers[2]
+	if editor.role != models.RoleEditor || viewer.role != models.RoleViewer {
+		t.Fatal("access members changed")
+	}
+
+	tests := []struct {
+		name       string
+		userID     int
+		scopes     []string
+		wantScopes []string
+		wantErr    bool
+	}{
+		{
+			name:       "scopes of a member",
+			userID:     editor.userID,
+			scopes:     []string{"assessment:read", "report:export"},
+			wantScopes: []string{"assessment:read", "report:export"},
+		},
+		{
+			name:       "duplicate scopes",
+			userID:     viewer.userID,
+			scopes:     []string{"team:read", "report:read", "team:read"},
+			wantScopes: []string{"team:read", "report:read"},
+		},
+		{
+			name:    "scope the member doesn't hold",
+			userID:  viewer.userID,
+			scopes:  []string{"assessment:read", "assessment:update"},
+			wantErr: true,
+		},
+		{
+			// Organization admins hold every permission without memberships,
+			// as RequirePermission checks them
+			name:       "scopes of an organization admin",
+			userID:     accessOrgAdmin,
+			scopes:     []string{"assessment:delete", "group:update"},
+			wantScopes: []string{"assessment:delete", "group:update"},
+		},
+		{
+			name:    "unknown scope",
+			userID:  accessOrgAdmin,
+			scopes:  []string{"assessment:read", "assessment:approve"},
+			wantErr: true,
+		},
+		{
+			name:    "no scopes",
+			userID:  accessOrgAdmin,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids, scopes, err := service.resolveScopes(tt.userID, tt.scopes)
+
+			if tt.wantErr {
+				if !errors.Is(err, ErrTokenScopeInvalid) {
+					t.Errorf("err = %v, want %v", err, ErrTokenScopeInvalid)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveScopes() error = %v", err)
+			}
+
+			var wantIDs []int
+			for _, scope := range tt.wantScopes {
+				wantIDs = append(wantIDs, permissionID(scope))
+			}
+			if !reflect.DeepEqual(scopes, tt.wantScopes) || !reflect.DeepEqual(ids, wantIDs) {
+				t.Errorf("resolveScopes() = %v, %v, want %v, %v", ids, scopes, wantIDs, tt.wantScopes)
+			}
+		})
+	}
+}
@@ -17,6 +17,9 @@ type Config struct {
 	Session  SessionConfig
 	Files    FileConfig
 	Security SecurityConfig
+	OIDC     OIDCConfig
+	Mail     MailConfig
+	Notify   NotifyConfig
 }
 
 // ServerConfig holds server configuration
@@ -24,6 +27,8 @@ type ServerConfig struct {
 	Host         string
 	Port         int
 	Mode         string // "debug", "release", "test"
+	PublicURL    string // Base URL of links in emails, e.g. https://assessment.example.com
+	TenantDomain string // Organizations are served from its subdomains, e.g. acme.assessment.example.com
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
 }
@@ -48,11 +53,13 @@ type SessionConfig struct {
 
 // FileConfig holds file paths configuration
 type FileConfig struct {
-	QuestionsPath  string
-	AdvicePath     string
-	TemplatesPath  string
-	StaticPath     string
-	UploadsPath    string
+	QuestionsPath              string
+	AdvicePath                 string
+	QuestionnaireTemplatesPath string // Optional, defaults to a single DevOps template
+	MaturityPath               string // Optional, maturity levels of the default template
+	TemplatesPath              string
+	StaticPath                 string
+	UploadsPath                string
 }
 
 // SecurityConfig holds security configuration
@@ -61,6 +68,85 @@ type SecurityConfig struct {
 	CSRFSecret     string
 	AllowedOrigins []string
 	TrustedProxies []string
+	AuthBackends   []string // Credential verifiers tried in order: "local", "ldap"
+	SuperAdmins    []string // Emails of the users made super admins on startup
+	LDAP           LDAPConfig
+	PasswordPolicy PasswordPolicyConfig
+	LoginThrottle  LoginThrottleConfig
+}
+
+// PasswordPolicyConfig holds the rules for passwords chosen by users
+type PasswordPolicyConfig struct {
+	MinLength        int
+	RequireUppercase bool
+	RequireLowercase bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	BreachedListPath string // Optional, one password or SHA-1 hash per line
+	HistorySize      int    // Recent passwords that can't be reused, including the current one
+}
+
+// LoginThrottleConfig holds failed login throttling configuration
+type LoginThrottleConfig struct {
+	AccountMaxFailures int // Failures before a login name is locked, 0 to never lock
+	IPMaxFailures      int // Failures before a client IP is locked, 0 to never lock
+	BackoffBase        time.Duration
+	LockoutDuration    time.Duration
+}
+
+// LDAPConfig holds LDAP / Active Directory authentication configuration
+type LDAPConfig struct {
+	URL                string // e.g. ldaps://ldap.example.com:636
+	StartTLS           bool
+	InsecureSkipVerify bool
+	BindDN             string
+	BindPassword       string
+	BaseDN             string
+	UserFilter         string // {username} is replaced by the login name
+	SubjectAttribute   string
+	EmailAttribute     string
+	FirstNameAttribute string
+	LastNameAttribute  string
+	GroupAttribute     string
+	GroupMappings      string // See auth.ParseGroupMappings
+	Organization       string // Slug of the organization new users are created in
+	Timeout            time.Duration
+	TrustEmail         bool // Link existing accounts by the directory's email attribute
+}
+
+// OIDCConfig holds OpenID Connect single sign-on configuration
+type OIDCConfig struct {
+	Enabled       bool
+	IssuerURL     string
+	ClientID      string
+	ClientSecret  string
+	RedirectURL   string // e.g. https://assessment.example.com/api/v1/auth/oidc/callback
+	Scopes        []string
+	GroupsClaim   string
+	GroupMappings string // See auth.ParseGroupMappings
+	Organization  string // Slug of the organization new users are created in
+
+	// Skip local MFA for SSO logins, relying on the identity provider's
+	TrustProviderMFA bool
+}
+
+// MailConfig holds outgoing email configuration
+type MailConfig struct {
+	Backend      string // "log" writes messages to LogFile or the log, "smtp" sends them
+	From         string
+	LogFile      string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPTLS      string // "starttls", "tls" or "none"
+}
+
+// NotifyConfig holds campaign notification configuration
+type NotifyConfig struct {
+	Notifiers        []string // Notification channels: "mail", "webhook"
+	WebhookURL       string
+	CampaignInterval time.Duration // How often campaigns are opened and reminders sent
 }
 
 // Load loads configuration from environment variables
@@ -80,6 +166,8 @@ func Load() (*Config, error) {
 			Mode:         getEnvString("SERVER_MODE", "release"),
 			ReadTimeout:  getEnvDuration("SERVER_READ_TIMEOUT", 10*time.Second),
 			WriteTimeout: getEnvDuration("SERVER_WRITE_TIMEOUT", 10*time.Second),
+			PublicURL:    strings.TrimRight(getEnvString("PUBLIC_URL", "http://localhost:8080"), "/"),
+			TenantDomain: strings.ToLower(getEnvString("TENANT_DOMAIN", "")),
 		},
 		Database: DatabaseConfig{
 			Host:         getEnvString("DB_HOST", "localhost"),
@@ -96,17 +184,82 @@ func Load() (*Config, error) {
 			Duration: getEnvDuration("SESSION_DURATION", 7*24*time.Hour),
 		},
 		Files: FileConfig{
-			QuestionsPath: getEnvString("QUESTIONS_FILE", "configs/questions.json"),
-			AdvicePath:    getEnvString("ADVICE_FILE", "configs/advice.json"),
-			TemplatesPath: getEnvString("TEMPLATES_PATH", "web/templates"),
-			StaticPath:    getEnvString("STATIC_PATH", "web/static"),
-			UploadsPath:   getEnvString("UPLOADS_PATH", "uploads"),
+			QuestionsPath:              getEnvString("QUESTIONS_FILE", "configs/questions.json"),
+			AdvicePath:                 getEnvString("ADVICE_FILE", "configs/advice.json"),
+			QuestionnaireTemplatesPath: getEnvString("QUESTIONNAIRE_TEMPLATES_FILE", "configs/questionnaire-templates.json"),
+			MaturityPath:               getEnvString("MATURITY_FILE", "configs/maturity.json"),
+			TemplatesPath:              getEnvString("TEMPLATES_PATH", "web/templates"),
+			StaticPath:                 getEnvString("STATIC_PATH", "web/static"),
+			UploadsPath:                getEnvString("UPLOADS_PATH", "uploads"),
 		},
 		Security: SecurityConfig{
 			BCryptCost:     getEnvInt("BCRYPT_COST", 10),
 			CSRFSecret:     getEnvString("CSRF_SECRET", generateDefaultSecret()),
-			AllowedOrigins: getEnvStringSlice("ALLOWED_ORIGINS", []string{"*"}),
+			AllowedOrigins: getEnvStringSlice("ALLOWED_ORIGINS", nil),
 			TrustedProxies: getEnvStringSlice("TRUSTED_PROXIES", []string{}),
+			AuthBackends:   getEnvStringSlice("AUTH_BACKENDS", []string{"local"}),
+			SuperAdmins:    getEnvStringSlice("SUPER_ADMIN_EMAILS", nil),
+			LDAP: LDAPConfig{
+				URL:                getEnvString("LDAP_URL", ""),
+				StartTLS:           getEnvBool("LDAP_START_TLS", false),
+				InsecureSkipVerify: getEnvBool("LDAP_INSECURE_SKIP_VERIFY", false),
+				BindDN:             getEnvString("LDAP_BIND_DN", ""),
+				BindPassword:       getEnvString("LDAP_BIND_PASSWORD", ""),
+				BaseDN:             getEnvString("LDAP_BASE_DN", ""),
+				UserFilter:         getEnvString("LDAP_USER_FILTER", "(&(objectClass=person)(|(uid={username})(mail={username})))"),
+				SubjectAttribute:   getEnvString("LDAP_SUBJECT_ATTRIBUTE", ""),
+				EmailAttribute:     getEnvString("LDAP_EMAIL_ATTRIBUTE", "mail"),
+				FirstNameAttribute: getEnvString("LDAP_FIRST_NAME_ATTRIBUTE", "givenName"),
+				LastNameAttribute:  getEnvString("LDAP_LAST_NAME_ATTRIBUTE", "sn"),
+				GroupAttribute:     getEnvString("LDAP_GROUP_ATTRIBUTE", "memberOf"),
+				GroupMappings:      getEnvString("LDAP_GROUP_MAPPINGS", ""),
+				Organization:       getEnvString("LDAP_ORGANIZATION", "default"),
+				Timeout:            getEnvDuration("LDAP_TIMEOUT", 10*time.Second),
+				TrustEmail:         getEnvBool("LDAP_TRUST_EMAIL", false),
+			},
+			PasswordPolicy: PasswordPolicyConfig{
+				MinLength:        getEnvInt("PASSWORD_MIN_LENGTH", 8),
+				RequireUppercase: getEnvBool("PASSWORD_REQUIRE_UPPERCASE", false),
+				RequireLowercase: getEnvBool("PASSWORD_REQUIRE_LOWERCASE", false),
+				RequireDigit:     getEnvBool("PASSWORD_REQUIRE_DIGIT", false),
+				RequireSymbol:    getEnvBool("PASSWORD_REQUIRE_SYMBOL", false),
+				BreachedListPath: getEnvString("PASSWORD_BREACHED_LIST_FILE", ""),
+				HistorySize:      getEnvInt("PASSWORD_HISTORY", 5),
+			},
+			LoginThrottle: LoginThrottleConfig{
+				AccountMaxFailures: getEnvInt("LOGIN_ACCOUNT_MAX_FAILURES", 5),
+				IPMaxFailures:      getEnvInt("LOGIN_IP_MAX_FAILURES", 50),
+				BackoffBase:        getEnvDuration("LOGIN_BACKOFF_BASE", time.Second),
+				LockoutDuration:    getEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+			},
+		},
+		OIDC: OIDCConfig{
+			Enabled:       getEnvBool("OIDC_ENABLED", false),
+			IssuerURL:     getEnvString("OIDC_ISSUER_URL", ""),
+			ClientID:      getEnvString("OIDC_CLIENT_ID", ""),
+			ClientSecret:  getEnvString("OIDC_CLIENT_SECRET", ""),
+			RedirectURL:   getEnvString("OIDC_REDIRECT_URL", ""),
+			Scopes:        getEnvStringSlice("OIDC_SCOPES", []string{"openid", "profile", "email"}),
+			GroupsClaim:   getEnvString("OIDC_GROUPS_CLAIM", "groups"),
+			GroupMappings: getEnvString("OIDC_GROUP_MAPPINGS", ""),
+			Organization:  getEnvString("OIDC_ORGANIZATION", "default"),
+
+			TrustProviderMFA: getEnvBool("OIDC_TRUST_PROVIDER_MFA", false),
+		},
+		Mail: MailConfig{
+			Backend:      getEnvString("MAIL_BACKEND", "log"),
+			From:         getEnvString("MAIL_FROM", "DevOps Assessment <noreply@localhost>"),
+			LogFile:      getEnvString("MAIL_LOG_FILE", ""),
+			SMTPHost:     getEnvString("SMTP_HOST", ""),
+			SMTPPort:     getEnvInt("SMTP_PORT", 587),
+			SMTPUsername: getEnvString("SMTP_USERNAME", ""),
+			SMTPPassword: getEnvString("SMTP_PASSWORD", ""),
+			SMTPTLS:      getEnvString("SMTP_TLS", "starttls"),
+		},
+		Notify: NotifyConfig{
+			Notifiers:        getEnvStringSlice("NOTIFIERS", []string{"mail"}),
+			WebhookURL:       getEnvString("NOTIFY_WEBHOOK_URL", ""),
+			CampaignInterval: getEnvDuration("CAMPAIGN_CHECK_INTERVAL", 15*time.Minute),
 		},
 	}
 
@@ -160,6 +313,90 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("advice file not found: %s", c.Files.AdvicePath)
 	}
 
+	// OIDC validation
+	if c.OIDC.Enabled {
+		if c.OIDC.IssuerURL == "" || c.OIDC.ClientID == "" || c.OIDC.RedirectURL == "" {
+			return fmt.Errorf("OIDC issuer URL, client ID and redirect URL are required when OIDC is enabled")
+		}
+	}
+
+	// Authentication backend validation
+	if len(c.Security.AuthBackends) == 0 {
+		return fmt.Errorf("at least one authentication backend is required")
+	}
+	for _, backend := range c.Security.AuthBackends {
+		switch backend {
+		case "local":
+		case "ldap":
+			if c.Security.LDAP.URL == "" || c.Security.LDAP.BaseDN == "" {
+				return fmt.Errorf("LDAP URL and base DN are required when the ldap backend is enabled")
+			}
+			if !strings.Contains(c.Security.LDAP.UserFilter, "{username}") {
+				return fmt.Errorf("LDAP user filter must contain {username}")
+			}
+		default:
+			return fmt.Errorf("unknown authentication backend: %s", backend)
+		}
+	}
+
+	// Mail validation
+	if !strings.HasPrefix(c.Server.PublicURL, "http://") && !strings.HasPrefix(c.Server.PublicURL, "https://") {
+		return fmt.Errorf("public URL must start with http:// or https://")
+	}
+	switch c.Mail.Backend {
+	case "log":
+	case "smtp":
+		if c.Mail.SMTPHost == "" {
+			return fmt.Errorf("SMTP host is required when the smtp mail backend is enabled")
+		}
+		switch c.Mail.SMTPTLS {
+		case "starttls", "tls", "none":
+		default:
+			return fmt.Errorf("invalid SMTP TLS mode: %s", c.Mail.SMTPTLS)
+		}
+	default:
+		return fmt.Errorf("unknown mail backend: %s", c.Mail.Backend)
+	}
+
+	// Notification validation
+	for _, notifier := range c.Notify.Notifiers {
+		switch notifier {
+		case "mail":
+		case "webhook":
+			if c.Notify.WebhookURL == "" {
+				return fmt.Errorf("notification webhook URL is required when the webhook notifier is enabled")
+			}
+		default:
+			return fmt.Errorf("unknown notifier: %s", notifier)
+		}
+	}
+	if c.Notify.CampaignInterval < time.Minute {
+		return fmt.Errorf("campaign check interval must be at least a minute")
+	}
+
+	// Password policy validation
+	policy := c.Security.PasswordPolicy
+	if policy.MinLength < 1 || policy.MinLength > 72 {
+		return fmt.Errorf("password minimum length must be between 1 and 72")
+	}
+	if policy.HistorySize < 0 || policy.HistorySize > 25 {
+		return fmt.Errorf("password history must be between 0 and 25")
+	}
+	if policy.BreachedListPath != "" {
+		if _, err := os.Stat(policy.BreachedListPath); os.IsNotExist(err) {
+			return fmt.Errorf("breached password list not found: %s", policy.BreachedListPath)
+		}
+	}
+
+	// Login throttle validation
+	throttle := c.Security.LoginThrottle
+	if throttle.AccountMaxFailures < 0 || throttle.IPMaxFailures < 0 {
+		return fmt.Errorf("login failure limits can't be negative")
+	}
+	if throttle.BackoffBase < 0 || throttle.LockoutDuration <= 0 {
+		return fmt.Errorf("login backoff must not be negative and lockout duration must be positive")
+	}
+
 	// Create directories if they don't exist
 	dirs := []string{c.Files.TemplatesPath, c.Files.StaticPath, c.Files.UploadsPath}
 	for _, dir := range dirs {
@@ -14,7 +14,9 @@ type Migration struct {
 	Down        func(*sql.Tx) error
 }
 
-// GetMigrations returns all database migrations
+// GetMigrations returns all database migrations.
+// Version 2 is reserved for the response ID rewrite, which needs the
+// questionnaire and is therefore applied from main via ApplyMigration.
 func GetMigrations() []Migration {
 	return []Migration{
 		{
@@ -23,6 +25,144 @@ func GetMigrations() []Migration {
 			Up:          migration001Up,
 			Down:        migration001Down,
 		},
+		{
+			Version:     3,
+			Description: "Add questionnaire versions pinned per assessment",
+			Up:          migration003Up,
+			Down:        migration003Down,
+		},
+		{
+			Version:     4,
+			Description: "Add questionnaire templates to questionnaire versions",
+			Up:          migration004Up,
+			Down:        migration004Down,
+		},
+		{
+			Version:     5,
+			Description: "Add external identities for single sign-on",
+			Up:          migration005Up,
+			Down:        migration005Down,
+		},
+		{
+			Version:     6,
+			Description: "Add TOTP multi-factor authentication",
+			Up:          migration006Up,
+			Down:        migration006Down,
+		},
+		{
+			Version:     7,
+			Description: "Add API tokens and service accounts",
+			Up:          migration007Up,
+			Down:        migration007Down,
+		},
+		{
+			Version:     8,
+			Description: "Add login throttling and password history",
+			Up:          migration008Up,
+			Down:        migration008Down,
+		},
+		{
+			Version:     9,
+			Description: "Add password resets and user invitations",
+			Up:          migration009Up,
+			Down:        migration009Down,
+		},
+		{
+			Version:     10,
+			Description: "Add custom roles",
+			Up:          migration010Up,
+			Down:        migration010Down,
+		},
+		{
+			Version:     11,
+			Description: "Add nested groups",
+			Up:          migration011Up,
+			Down:        migration011Down,
+		},
+		{
+			Version:     12,
+			Description: "Add organizations for multi-tenant hosting",
+			Up:          migration012Up,
+			Down:        migration012Down,
+		},
+		{
+			Version:     13,
+			Description: "Add assessment respondents",
+			Up:          migration013Up,
+			Down:        migration013Down,
+		},
+		{
+			Version:     14,
+			Description: "Add agreed answers",
+			Up:          migration014Up,
+			Down:        migration014Down,
+		},
+		{
+			Version:     15,
+			Description: "Add assessment campaigns",
+			Up:          migration015Up,
+			Down:        migration015Down,
+		},
+		{
+			Version:     16,
+			Description: "Add cloned assessments",
+			Up:          migration016Up,
+			Down:        migration016Down,
+		},
+		{
+			Version:     17,
+			Description: "Add assessment states and revisions",
+			Up:          migration017Up,
+			Down:        migration017Down,
+		},
+		{
+			Version:     18,
+			Description: "Add action items",
+			Up:          migration018Up,
+			Down:        migration018Down,
+		},
+		{
+			Version:     19,
+			Description: "Add team targets",
+			Up:          migration019Up,
+			Down:        migration019Down,
+		},
+		{
+			Version:     20,
+			Description: "Add maturity levels",
+			Up:          migration020Up,
+			Down:        migration020Down,
+		},
+		{
+			Version:     21,
+			Description: "Add weighted scoring",
+			Up:          migration021Up,
+			Down:        migration021Down,
+		},
+		{
+			Version:     22,
+			Description: "Revoke super admin rights granted to admins",
+			Up:          migration022Up,
+			Down:        migration022Down,
+		},
+		{
+			Version:     23,
+			Description: "Throttle MFA codes per login name",
+			Up:          migration023Up,
+			Down:        migration023Down,
+		},
+		{
+			Version:     24,
+			Description: "Add organization admins",
+			Up:          migration024Up,
+			Down:        migration024Down,
+		},
+		{
+			Version:     25,
+			Description: "Track memberships granted by group mappings",
+			Up:          migration025Up,
+			Down:        migration025Down,
+		},
 	}
 }
 
@@ -335,40 +475,1394 @@ func migration001Down(tx *sql.Tx) error {
 	return nil
 }
 
-// RunMigrations executes all pending migrations
-func RunMigrations(db *sql.DB) error {
-	// Create migrations table if it doesn't exist
-	if err := createMigrationsTable(db); err != nil {
-		return fmt.Errorf("failed to create migrations table: %w", err)
+func migration003Up(tx *sql.Tx) error {
+	queries := []string{
+		// Imported questionnaire versions, content is the processed survey JSON
+		`CREATE TABLE IF NOT EXISTS questionnaire_versions (
+			id INT PRIMARY KEY AUTO_INCREMENT,
+			checksum CHAR(64) NOT NULL UNIQUE,
+			source_file VARCHAR(255),
+			content LONGTEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+
+		// Pin each assessment to the questionnaire it was taken with
+		`ALTER TABLE assessments
+			ADD COLUMN questionnaire_version_id INT NULL AFTER status,
+			ADD INDEX idx_assessments_questionnaire_version (questionnaire_version_id),
+			ADD CONSTRAINT fk_assessments_questionnaire_version
+				FOREIGN KEY (questionnaire_version_id) REFERENCES questionnaire_versions(id)`,
 	}
 
-	migrations := GetMigrations()
-	
-	for _, migration := range migrations {
-		applied, err := isMigrationApplied(db, migration.Version)
-		if err != nil {
-			return fmt.Errorf("failed to check migration status: %w", err)
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
 		}
-		
-		if !applied {
-			log.Printf("Running migration %d: %s", migration.Version, migration.Description)
-			
-			tx, err := db.Begin()
-			if err != nil {
-				return fmt.Errorf("failed to begin transaction: %w", err)
-			}
-			
-			if err := migration.Up(tx); err != nil {
-				tx.Rollback()
-				return fmt.Errorf("migration %d failed: %w", migration.Version, err)
-			}
-			
-			if err := tx.Commit(); err != nil {
-				return fmt.Errorf("failed to commit migration %d: %w", migration.Version, err)
-			}
+	}
+
+	// Record migration
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, description) VALUES (?, ?)",
+		3, "Add questionnaire versions pinned per assessment",
+	); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	log.Println("Migration 003: Questionnaire versions created successfully")
+	return nil
+}
+
+func migration003Down(tx *sql.Tx) error {
+	queries := []string{
+		"ALTER TABLE assessments DROP FOREIGN KEY fk_assessments_questionnaire_version",
+		"ALTER TABLE assessments DROP COLUMN questionnaire_version_id",
+		"DROP TABLE IF EXISTS questionnaire_versions",
+		"DELETE FROM schema_migrations WHERE version = 3",
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
 		}
 	}
-	
+
+	log.Println("Migration 003: Rolled back successfully")
+	return nil
+}
+
+func migration004Up(tx *sql.Tx) error {
+	// Versions imported before templates existed keep a NULL template_id and
+	// belong to the default template
+	query := `ALTER TABLE questionnaire_versions
+		ADD COLUMN template_id VARCHAR(64) NULL AFTER id,
+		ADD INDEX idx_questionnaire_versions_template (template_id)`
+
+	if _, err := tx.Exec(query); err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	// Record migration
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, description) VALUES (?, ?)",
+		4, "Add questionnaire templates to questionnaire versions",
+	); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	log.Println("Migration 004: Questionnaire templates added successfully")
+	return nil
+}
+
+func migration004Down(tx *sql.Tx) error {
+	queries := []string{
+		"ALTER TABLE questionnaire_versions DROP COLUMN template_id",
+		"DELETE FROM schema_migrations WHERE version = 4",
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	log.Println("Migration 004: Rolled back successfully")
+	return nil
+}
+
+func migration005Up(tx *sql.Tx) error {
+	queries := []string{
+		// Links users to their accounts at external identity providers
+		`CREATE TABLE IF NOT EXISTS user_identities (
+			id INT PRIMARY KEY AUTO_INCREMENT,
+			user_id INT NOT NULL,
+			provider VARCHAR(50) NOT NULL,
+			subject VARCHAR(255) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			last_login_at TIMESTAMP NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			UNIQUE KEY unique_provider_subject (provider, subject),
+			INDEX idx_user_identities_user (user_id)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+
+		// Pending OIDC authorization requests, consumed by the callback
+		`CREATE TABLE IF NOT EXISTS oidc_auth_requests (
+			state VARCHAR(64) PRIMARY KEY,
+			nonce VARCHAR(64) NOT NULL,
+			code_verifier VARCHAR(128) NOT NULL,
+			redirect_to VARCHAR(255),
+			expires_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			INDEX idx_oidc_auth_requests_expires (expires_at)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	// Record migration
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, description) VALUES (?, ?)",
+		5, "Add external identities for single sign-on",
+	); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	log.Println("Migration 005: External identities created successfully")
+	return nil
+}
+
+func migration005Down(tx *sql.Tx) error {
+	queries := []string{
+		"DROP TABLE IF EXISTS oidc_auth_requests",
+		"DROP TABLE IF EXISTS user_identities",
+		"DELETE FROM schema_migrations WHERE version = 5",
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	log.Println("Migration 005: Rolled back successfully")
+	return nil
+}
+
+func migration006Up(tx *sql.Tx) error {
+	queries := []string{
+		// TOTP secrets, enabled once the user confirmed a first code
+		`CREATE TABLE IF NOT EXISTS user_mfa (
+			user_id INT PRIMARY KEY,
+			secret VARCHAR(64) NOT NULL,
+			enabled BOOLEAN DEFAULT false,
+			last_used_step BIGINT NULL,
+			enabled_at TIMESTAMP NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+
+		// Single-use recovery codes, stored as SHA-256 hashes
+		`CREATE TABLE IF NOT EXISTS user_recovery_codes (
+			id INT PRIMARY KEY AUTO_INCREMENT,
+			user_id INT NOT NULL,
+			code_hash CHAR(64) NOT NULL,
+			used_at TIMESTAMP NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			INDEX idx_recovery_codes_user (user_id)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+
+		// Logins waiting for a second factor
+		`CREATE TABLE IF NOT EXISTS mfa_challenges (
+			token VARCHAR(64) PRIMARY KEY,
+			user_id INT NOT NULL,
+			attempts INT NOT NULL DEFAULT 0,
+			expires_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			INDEX idx_mfa_challenges_expires (expires_at)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+
+		// Settings administrators can change at runtime
+		`CREATE TABLE IF NOT EXISTS system_settings (
+			name VARCHAR(100) PRIMARY KEY,
+			value VARCHAR(255) NOT NULL,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	// Record migration
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, description) VALUES (?, ?)",
+		6, "Add TOTP multi-factor authentication",
+	); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	log.Println("Migration 006: Multi-factor authentication tables created successfully")
+	return nil
+}
+
+func migration006Down(tx *sql.Tx) error {
+	queries := []string{
+		"DROP TABLE IF EXISTS system_settings",
+		"DROP TABLE IF EXISTS mfa_challenges",
+		"DROP TABLE IF EXISTS user_recovery_codes",
+		"DROP TABLE IF EXISTS user_mfa",
+		"DELETE FROM schema_migrations WHERE version = 6",
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	log.Println("Migration 006: Rolled back successfully")
+	return nil
+}
+
+func migration007Up(tx *sql.Tx) error {
+	queries := []string{
+		// Service accounts are users that can't log in interactively
+		`ALTER TABLE users
+			ADD COLUMN is_service_account BOOLEAN NOT NULL DEFAULT false AFTER is_active`,
+
+		// Personal access tokens, stored as SHA-256 hashes
+		`CREATE TABLE IF NOT EXISTS api_tokens (
+			id INT PRIMARY KEY AUTO_INCREMENT,
+			user_id INT NOT NULL,
+			name VARCHAR(100) NOT NULL,
+			token_prefix VARCHAR(16) NOT NULL,
+			token_hash CHAR(64) NOT NULL,
+			expires_at TIMESTAMP NULL,
+			last_used_at TIMESTAMP NULL,
+			revoked_at TIMESTAMP NULL,
+			created_by INT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL,
+			UNIQUE KEY unique_token_hash (token_hash),
+			INDEX idx_api_tokens_user (user_id)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+
+		// Token scopes, a subset of the owner's permissions
+		`CREATE TABLE IF NOT EXISTS api_token_permissions (
+			token_id INT NOT NULL,
+			permission_id INT NOT NULL,
+			PRIMARY KEY (token_id, permission_id),
+			FOREIGN KEY (token_id) REFERENCES api_tokens(id) ON DELETE CASCADE,
+			FOREIGN KEY (permission_id) REFERENCES permissions(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	// Record migration
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, description) VALUES (?, ?)",
+		7, "Add API tokens and service accounts",
+	); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	log.Println("Migration 007: API tokens created successfully")
+	return nil
+}
+
+func migration007Down(tx *sql.Tx) error {
+	queries := []string{
+		"DROP TABLE IF EXISTS api_token_permissions",
+		"DROP TABLE IF EXISTS api_tokens",
+		"ALTER TABLE users DROP COLUMN is_service_account",
+		"DELETE FROM schema_migrations WHERE version = 7",
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	log.Println("Migration 007: Rolled back successfully")
+	return nil
+}
+
+func migration008Up(tx *sql.Tx) error {
+	queries := []string{
+		// Failed login attempts per account name and per client IP
+		`CREATE TABLE IF NOT EXISTS login_throttles (
+			scope VARCHAR(20) NOT NULL,
+			subject VARCHAR(255) NOT NULL,
+			failures INT NOT NULL DEFAULT 0,
+			last_failure_at TIMESTAMP NULL,
+			blocked_until TIMESTAMP NULL,
+			locked BOOLEAN NOT NULL DEFAULT false,
+			PRIMARY KEY (scope, subject),
+			INDEX idx_login_throttles_blocked (blocked_until)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+
+		// Previous password hashes, to prevent reuse
+		`CREATE TABLE IF NOT EXISTS password_history (
+			id INT PRIMARY KEY AUTO_INCREMENT,
+			user_id INT NOT NULL,
+			password_hash VARCHAR(255) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			INDEX idx_password_history_user (user_id, id)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	// Record migration
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, description) VALUES (?, ?)",
+		8, "Add login throttling and password history",
+	); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	log.Println("Migration 008: Login throttling tables created successfully")
+	return nil
+}
+
+func migration008Down(tx *sql.Tx) error {
+	queries := []string{
+		"DROP TABLE IF EXISTS password_history",
+		"DROP TABLE IF EXISTS login_throttles",
+		"DELETE FROM schema_migrations WHERE version = 8",
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	log.Println("Migration 008: Rolled back successfully")
+	return nil
+}
+
+func migration009Up(tx *sql.Tx) error {
+	queries := []string{
+		// Single-use password reset links, stored as SHA-256 hashes
+		`CREATE TABLE IF NOT EXISTS password_resets (
+			token_hash CHAR(64) PRIMARY KEY,
+			user_id INT NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			INDEX idx_password_resets_user (user_id),
+			INDEX idx_password_resets_expires (expires_at)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+
+		// Invitations create the user, in the chosen team, when accepted
+		`CREATE TABLE IF NOT EXISTS user_invitations (
+			id INT PRIMARY KEY AUTO_INCREMENT,
+			email VARCHAR(255) NOT NULL,
+			first_name VARCHAR(100),
+			last_name VARCHAR(100),
+			team_id INT NOT NULL,
+			role_id INT NOT NULL,
+			token_hash CHAR(64) NOT NULL,
+			invited_by INT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			accepted_at TIMESTAMP NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (team_id) REFERENCES teams(id) ON DELETE CASCADE,
+			FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE,
+			FOREIGN KEY (invited_by) REFERENCES users(id) ON DELETE SET NULL,
+			UNIQUE KEY unique_invitation_token (token_hash),
+			INDEX idx_user_invitations_email (email)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	// Record migration
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, description) VALUES (?, ?)",
+		9, "Add password resets and user invitations",
+	); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	log.Println("Migration 009: Password reset and invitation tables created successfully")
+	return nil
+}
+
+func migration009Down(tx *sql.Tx) error {
+	queries := []string{
+		"DROP TABLE IF EXISTS user_invitations",
+		"DROP TABLE IF EXISTS password_resets",
+		"DELETE FROM schema_migrations WHERE version = 9",
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	log.Println("Migration 009: Rolled back successfully")
+	return nil
+}
+
+func migration010Up(tx *sql.Tx) error {
+	queries := []string{
+		// Built-in roles are seeded by migration 001 and can't be changed
+		`ALTER TABLE roles
+			ADD COLUMN is_builtin BOOLEAN NOT NULL DEFAULT FALSE AFTER description`,
+
+		`UPDATE roles SET is_builtin = TRUE WHERE name IN ('admin', 'editor', 'viewer')`,
+
+		`INSERT INTO permissions (resource, action, description) VALUES
+			('role', 'create', 'Create custom roles'),
+			('role', 'read', 'View roles and their permissions'),
+			('role', 'update', 'Update custom roles and their permissions'),
+			('role', 'delete', 'Delete custom roles')`,
+
+		// Admin gets all permissions
+		`INSERT INTO role_permissions (role_id, permission_id)
+			SELECT r.id, p.id FROM roles r, permissions p
+			WHERE r.name = 'admin' AND p.resource = 'role'`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	// Record migration
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, description) VALUES (?, ?)",
+		10, "Add custom roles",
+	); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	log.Println("Migration 010: Custom roles added successfully")
+	return nil
+}
+
+func migration010Down(tx *sql.Tx) error {
+	queries := []string{
+		"DELETE FROM permissions WHERE resource = 'role'",
+		"ALTER TABLE roles DROP COLUMN is_builtin",
+		"DELETE FROM schema_migrations WHERE version = 10",
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	log.Println("Migration 010: Rolled back successfully")
+	return nil
+}
+
+func migration011Up(tx *sql.Tx) error {
+	queries := []string{
+		// Groups can be nested, e.g. division, department and tribe
+		`ALTER TABLE groups
+			ADD COLUMN parent_id INT NULL AFTER description,
+			ADD INDEX idx_parent (parent_id),
+			ADD CONSTRAINT fk_groups_parent FOREIGN KEY (parent_id) REFERENCES groups(id)`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	// Record migration
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, description) VALUES (?, ?)",
+		11, "Add nested groups",
+	); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	log.Println("Migration 011: Nested groups added successfully")
+	return nil
+}
+
+func migration011Down(tx *sql.Tx) error {
+	queries := []string{
+		"ALTER TABLE groups DROP FOREIGN KEY fk_groups_parent",
+		"ALTER TABLE groups DROP INDEX idx_parent, DROP COLUMN parent_id",
+		"DELETE FROM schema_migrations WHERE version = 11",
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	log.Println("Migration 011: Rolled back successfully")
+	return nil
+}
+
+// tenantTables are the tables scoped to an organization by migration 012
+var tenantTables = []string{"users", "groups", "teams", "assessments"}
+
+func migration012Up(tx *sql.Tx) error {
+	queries := []string{
+		`CREATE TABLE IF NOT EXISTS organizations (
+			id INT PRIMARY KEY AUTO_INCREMENT,
+			name VARCHAR(100) NOT NULL,
+			slug VARCHAR(63) NOT NULL,
+			is_active BOOLEAN DEFAULT TRUE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+			UNIQUE KEY unique_organization_slug (slug)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+
+		// Existing data belongs to the default organization
+		`INSERT INTO organizations (name, slug) VALUES ('Default', 'default')`,
+	}
+
+	for _, table := range tenantTables {
+		queries = append(queries,
+			fmt.Sprintf("ALTER TABLE %s ADD COLUMN organization_id INT NULL AFTER id", table),
+			fmt.Sprintf("UPDATE %s SET organization_id = (SELECT id FROM organizations WHERE slug = 'default')", table),
+			fmt.Sprintf(`ALTER TABLE %[1]s
+				MODIFY organization_id INT NOT NULL,
+				ADD INDEX idx_%[1]s_organization (organization_id),
+				ADD CONSTRAINT fk_%[1]s_organization FOREIGN KEY (organization_id) REFERENCES organizations(id)`, table),
+		)
+	}
+
+	queries = append(queries,
+		// Audit entries keep the organization they were made in; entries
+		// without a user may have none
+		`ALTER TABLE audit_logs
+			ADD COLUMN organization_id INT NULL AFTER id,
+			ADD INDEX idx_audit_organization (organization_id),
+			ADD CONSTRAINT fk_audit_logs_organization FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE SET NULL`,
+
+		`UPDATE audit_logs a
+			JOIN users u ON a.user_id = u.id
+			SET a.organization_id = u.organization_id`,
+
+		// Super admins manage organizations and act in all of them. Existing
+		// admins stay admins of the default organization; super admins are
+		// only granted explicitly.
+		`ALTER TABLE users
+			ADD COLUMN is_super_admin BOOLEAN NOT NULL DEFAULT FALSE AFTER is_service_account`,
+	)
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	// Record migration
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, description) VALUES (?, ?)",
+		12, "Add organizations for multi-tenant hosting",
+	); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	log.Println("Migration 012: Organizations added successfully")
+	return nil
+}
+
+func migration012Down(tx *sql.Tx) error {
+	queries := []string{
+		"ALTER TABLE users DROP COLUMN is_super_admin",
+		"ALTER TABLE audit_logs DROP FOREIGN KEY fk_audit_logs_organization",
+		"ALTER TABLE audit_logs DROP INDEX idx_audit_organization, DROP COLUMN organization_id",
+	}
+
+	for _, table := range tenantTables {
+		queries = append(queries,
+			fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY fk_%s_organization", table, table),
+			fmt.Sprintf("ALTER TABLE %[1]s DROP INDEX idx_%[1]s_organization, DROP COLUMN organization_id", table),
+		)
+	}
+
+	queries = append(queries,
+		"DROP TABLE IF EXISTS organizations",
+		"DELETE FROM schema_migrations WHERE version = 12",
+	)
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	log.Println("Migration 012: Rolled back successfully")
+	return nil
+}
+func migration013Up(tx *sql.Tx) error {
+	queries := []string{
+		// How the answers of several respondents are combined per question
+		`ALTER TABLE assessments
+			ADD COLUMN aggregation ENUM('mean', 'median', 'consensus') NOT NULL DEFAULT 'mean' AFTER status`,
+
+		// Team members invited to answer an assessment separately
+		`CREATE TABLE IF NOT EXISTS assessment_respondents (
+			id INT PRIMARY KEY AUTO_INCREMENT,
+			assessment_id INT NOT NULL,
+			user_id INT NOT NULL,
+			invited_by INT NULL,
+			submitted_at TIMESTAMP NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (assessment_id) REFERENCES assessments(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (invited_by) REFERENCES users(id) ON DELETE SET NULL,
+			UNIQUE KEY unique_assessment_respondent (assessment_id, user_id),
+			INDEX idx_respondents_user (user_id)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+
+		// Answers of each respondent, aggregated when the round is closed
+		`CREATE TABLE IF NOT EXISTS respondent_responses (
+			id INT PRIMARY KEY AUTO_INCREMENT,
+			respondent_id INT NOT NULL,
+			question_id VARCHAR(20) NOT NULL,
+			answer_ids TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+			FOREIGN KEY (respondent_id) REFERENCES assessment_respondents(id) ON DELETE CASCADE,
+			UNIQUE KEY unique_respondent_question (respondent_id, question_id)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	// Record migration
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, description) VALUES (?, ?)",
+		13, "Add assessment respondents",
+	); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	log.Println("Migration 013: Assessment respondents added successfully")
+	return nil
+}
+
+func migration013Down(tx *sql.Tx) error {
+	queries := []string{
+		"DROP TABLE IF EXISTS respondent_responses",
+		"DROP TABLE IF EXISTS assessment_respondents",
+		"ALTER TABLE assessments DROP COLUMN aggregation",
+		"DELETE FROM schema_migrations WHERE version = 13",
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	log.Println("Migration 013: Rolled back successfully")
+	return nil
+}
+
+func migration014Up(tx *sql.Tx) error {
+	queries := []string{
+		// Responses of assessments with respondents are the answers agreed on
+		// in a workshop, recorded with a note and the facilitator
+		`ALTER TABLE responses
+			ADD COLUMN note TEXT NULL AFTER answer_ids,
+			ADD COLUMN agreed_by INT NULL AFTER note,
+			ADD CONSTRAINT fk_responses_agreed_by FOREIGN KEY (agreed_by) REFERENCES users(id) ON DELETE SET NULL`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	// Record migration
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, description) VALUES (?, ?)",
+		14, "Add agreed answers",
+	); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	log.Println("Migration 014: Agreed answers added successfully")
+	return nil
+}
+
+func migration014Down(tx *sql.Tx) error {
+	queries := []string{
+		"ALTER TABLE responses DROP FOREIGN KEY fk_responses_agreed_by",
+		"ALTER TABLE responses DROP COLUMN agreed_by, DROP COLUMN note",
+		"DELETE FROM schema_migrations WHERE version = 14",
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	log.Println("Migration 014: Rolled back successfully")
+	return nil
+}
+
+func migration015Up(tx *sql.Tx) error {
+	queries := []string{
+		// Assessments started for many teams at once, due by a deadline
+		`CREATE TABLE IF NOT EXISTS campaigns (
+			id INT PRIMARY KEY AUTO_INCREMENT,
+			organization_id INT NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			template_id VARCHAR(64) NOT NULL,
+			opens_at TIMESTAMP NOT NULL,
+			due_at TIMESTAMP NOT NULL,
+			reminder_days VARCHAR(255) NOT NULL DEFAULT '[]',
+			opened_at TIMESTAMP NULL,
+			created_by INT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+			FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+			FOREIGN KEY (created_by) REFERENCES users(id),
+			INDEX idx_campaigns_organization (organization_id),
+			INDEX idx_campaigns_opened (opened_at, opens_at)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+
+		// Teams of a campaign with the assessment created for them when the
+		// campaign opened
+		`CREATE TABLE IF NOT EXISTS campaign_teams (
+			campaign_id INT NOT NULL,
+			team_id INT NOT NULL,
+			assessment_id INT NULL,
+			reminders_sent INT NOT NULL DEFAULT 0,
+			PRIMARY KEY (campaign_id, team_id),
+			FOREIGN KEY (campaign_id) REFERENCES campaigns(id) ON DELETE CASCADE,
+			FOREIGN KEY (team_id) REFERENCES teams(id) ON DELETE CASCADE,
+			FOREIGN KEY (assessment_id) REFERENCES assessments(id) ON DELETE SET NULL
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	// Record migration
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, description) VALUES (?, ?)",
+		15, "Add assessment campaigns",
+	); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	log.Println("Migration 015: Assessment campaigns added successfully")
+	return nil
+}
+
+func migration015Down(tx *sql.Tx) error {
+	queries := []string{
+		"DROP TABLE IF EXISTS campaign_teams",
+		"DROP TABLE IF EXISTS campaigns",
+		"DELETE FROM schema_migrations WHERE version = 15",
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	log.Println("Migration 015: Rolled back successfully")
+	return nil
+}
+
+func migration016Up(tx *sql.Tx) error {
+	queries := []string{
+		// Assessments pre-filled with the responses of a previous assessment
+		`ALTER TABLE assessments
+			ADD COLUMN cloned_from INT NULL AFTER questionnaire_version_id,
+			ADD CONSTRAINT fk_assessments_cloned_from FOREIGN KEY (cloned_from) REFERENCES assessments(id) ON DELETE SET NULL`,
+
+		// Copied responses stay flagged until the team confirms them
+		`ALTER TABLE responses
+			ADD COLUMN needs_confirmation BOOLEAN NOT NULL DEFAULT FALSE AFTER agreed_by`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	// Record migration
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, description) VALUES (?, ?)",
+		16, "Add cloned assessments",
+	); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	log.Println("Migration 016: Cloned assessments added successfully")
+	return nil
+}
+
+func migration016Down(tx *sql.Tx) error {
+	queries := []string{
+		"ALTER TABLE responses DROP COLUMN needs_confirmation",
+		"ALTER TABLE assessments DROP FOREIGN KEY fk_assessments_cloned_from",
+		"ALTER TABLE assessments DROP COLUMN cloned_from",
+		"DELETE FROM schema_migrations WHERE version = 16",
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	log.Println("Migration 016: Rolled back successfully")
+	return nil
+}
+
+func migration017Up(tx *sql.Tx) error {
+	queries := []string{
+		// Assessments are submitted for completion, reopened to amend them
+		// and archived
+		`ALTER TABLE assessments
+			MODIFY COLUMN status ENUM('in_progress', 'submitted', 'reopened', 'completed', 'archived') DEFAULT 'in_progress'`,
+
+		// Snapshots of an assessment's responses and scores, taken when it is
+		// reopened and completed again
+		`CREATE TABLE IF NOT EXISTS assessment_revisions (
+			id INT PRIMARY KEY AUTO_INCREMENT,
+			assessment_id INT NOT NULL,
+			revision INT NOT NULL,
+			action VARCHAR(32) NOT NULL,
+			reason TEXT NULL,
+			responses JSON NOT NULL,
+			section_scores JSON NOT NULL,
+			created_by INT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (assessment_id) REFERENCES assessments(id) ON DELETE CASCADE,
+			FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL,
+			UNIQUE KEY unique_assessment_revision (assessment_id, revision)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	// Record migration
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, description) VALUES (?, ?)",
+		17, "Add assessment states and revisions",
+	); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	log.Println("Migration 017: Assessment states and revisions added successfully")
+	return nil
+}
+
+func migration017Down(tx *sql.Tx) error {
+	queries := []string{
+		"DROP TABLE IF EXISTS assessment_revisions",
+		"UPDATE assessments SET status = 'completed' WHERE status = 'archived'",
+		"UPDATE assessments SET status = 'in_progress' WHERE status IN ('submitted', 'reopened')",
+		"ALTER TABLE assessments MODIFY COLUMN status ENUM('in_progress', 'completed') DEFAULT 'in_progress'",
+		"DELETE FROM schema_migrations WHERE version = 17",
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	log.Println("Migration 017: Rolled back successfully")
+	return nil
+}
+
+func migration018Up(tx *sql.Tx) error {
+	queries := []string{
+		// Improvements teams commit to, created from a question or section
+		// of a completed assessment, and flagged once a later assessment
+		// scores higher
+		`CREATE TABLE IF NOT EXISTS action_items (
+			id INT PRIMARY KEY AUTO_INCREMENT,
+			organization_id INT NOT NULL,
+			team_id INT NOT NULL,
+			assessment_id INT NOT NULL,
+			question_id VARCHAR(20) NULL,
+			section_name VARCHAR(100) NULL,
+			title VARCHAR(255) NOT NULL,
+			notes TEXT NULL,
+			owner_id INT NULL,
+			due_date DATE NULL,
+			status ENUM('open', 'in_progress', 'done', 'dropped') NOT NULL DEFAULT 'open',
+			baseline_score DECIMAL(6,2) NOT NULL DEFAULT 0,
+			improved_assessment_id INT NULL,
+			improved_score DECIMAL(6,2) NULL,
+			improved_at TIMESTAMP NULL,
+			created_by INT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+			FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+			FOREIGN KEY (team_id) REFERENCES teams(id) ON DELETE CASCADE,
+			FOREIGN KEY (assessment_id) REFERENCES assessments(id) ON DELETE CASCADE,
+			FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE SET NULL,
+			FOREIGN KEY (improved_assessment_id) REFERENCES assessments(id) ON DELETE SET NULL,
+			FOREIGN KEY (created_by) REFERENCES users(id),
+			INDEX idx_action_items_team (team_id, status),
+			INDEX idx_action_items_assessment (assessment_id)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	// Record migration
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, description) VALUES (?, ?)",
+		18, "Add action items",
+	); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	log.Println("Migration 018: Action items added successfully")
+	return nil
+}
+
+func migration018Down(tx *sql.Tx) error {
+	queries := []string{
+		"DROP TABLE IF EXISTS action_items",
+		"DELETE FROM schema_migrations WHERE version = 18",
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	log.Println("Migration 018: Rolled back successfully")
+	return nil
+}
+
+func migration019Up(tx *sql.Tx) error {
+	queries := []string{
+		// The section percentages teams intend to reach
+		`CREATE TABLE IF NOT EXISTS team_targets (
+			id INT PRIMARY KEY AUTO_INCREMENT,
+			team_id INT NOT NULL,
+			section_name VARCHAR(100) NOT NULL,
+			percentage DECIMAL(5,2) NOT NULL,
+			due_date DATE NULL,
+			created_by INT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+			FOREIGN KEY (team_id) REFERENCES teams(id) ON DELETE CASCADE,
+			FOREIGN KEY (created_by) REFERENCES users(id),
+			UNIQUE KEY unique_team_section (team_id, section_name)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	// Record migration
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, description) VALUES (?, ?)",
+		19, "Add team targets",
+	); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	log.Println("Migration 019: Team targets added successfully")
+	return nil
+}
+
+func migration019Down(tx *sql.Tx) error {
+	queries := []string{
+		"DROP TABLE IF EXISTS team_targets",
+		"DELETE FROM schema_migrations WHERE version = 19",
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	log.Println("Migration 019: Rolled back successfully")
+	return nil
+}
+
+func migration020Up(tx *sql.Tx) error {
+	queries := []string{
+		// The maturity level each section score falls in
+		`ALTER TABLE section_scores
+			ADD COLUMN maturity_level TINYINT NULL AFTER percentage,
+			ADD COLUMN maturity_name VARCHAR(50) NULL AFTER maturity_level`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	// Record migration
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, description) VALUES (?, ?)",
+		20, "Add maturity levels",
+	); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	log.Println("Migration 020: Maturity levels added successfully")
+	return nil
+}
+
+func migration020Down(tx *sql.Tx) error {
+	queries := []string{
+		"ALTER TABLE section_scores DROP COLUMN maturity_name",
+		"ALTER TABLE section_scores DROP COLUMN maturity_level",
+		"DELETE FROM schema_migrations WHERE version = 20",
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	log.Println("Migration 020: Rolled back successfully")
+	return nil
+}
+
+func migration021Up(tx *sql.Tx) error {
+	queries := []string{
+		// How the section scores of an assessment are combined, NULL for
+		// assessments that were summed before scoring methods existed
+		`ALTER TABLE assessments
+			ADD COLUMN scoring VARCHAR(20) NULL AFTER aggregation`,
+
+		// The weight of each section in the weighted overall score
+		`ALTER TABLE section_scores
+			ADD COLUMN weight DECIMAL(6,2) NULL AFTER percentage`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	// Record migration
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, description) VALUES (?, ?)",
+		21, "Add weighted scoring",
+	); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	log.Println("Migration 021: Weighted scoring added successfully")
+	return nil
+}
+
+func migration021Down(tx *sql.Tx) error {
+	queries := []string{
+		"ALTER TABLE section_scores DROP COLUMN weight",
+		"ALTER TABLE assessments DROP COLUMN scoring",
+		"DELETE FROM schema_migrations WHERE version = 21",
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	log.Println("Migration 021: Rolled back successfully")
+	return nil
+}
+
+func migration022Up(tx *sql.Tx) error {
+	// Migration 12 made every admin a super admin, which let the admins of
+	// one organization act in all of them. They go back to being admins of
+	// their own organization; super admins are named with SUPER_ADMIN_EMAILS.
+	result, err := tx.Exec(`UPDATE users SET is_super_admin = FALSE WHERE is_super_admin AND id IN (
+		SELECT ut.user_id FROM user_teams ut JOIN roles r ON ut.role_id = r.id WHERE r.name = 'admin'
+		UNION
+		SELECT ug.user_id FROM user_groups ug JOIN roles r ON ug.role_id = r.id WHERE r.name = 'admin'
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	// Record migration
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, description) VALUES (?, ?)",
+		22, "Revoke super admin rights granted to admins",
+	); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	if revoked, err := result.RowsAffected(); err == nil && revoked > 0 {
+		log.Printf("Migration 022: Revoked super admin rights of %d admins, grant them again with SUPER_ADMIN_EMAILS", revoked)
+	}
+
+	log.Println("Migration 022: Super admin rights revoked successfully")
+	return nil
+}
+
+func migration022Down(tx *sql.Tx) error {
+	// Revoked rights aren't restored, super admins are granted explicitly
+	if _, err := tx.Exec("DELETE FROM schema_migrations WHERE version = 22"); err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	log.Println("Migration 022: Rolled back successfully")
+	return nil
+}
+
+func migration023Up(tx *sql.Tx) error {
+	queries := []string{
+		// Wrong codes count against the login name the challenge was
+		// created for, like wrong passwords
+		`ALTER TABLE mfa_challenges
+			ADD COLUMN login_name VARCHAR(255) NOT NULL DEFAULT '' AFTER user_id`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	// Record migration
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, description) VALUES (?, ?)",
+		23, "Throttle MFA codes per login name",
+	); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	log.Println("Migration 023: MFA code throttling added successfully")
+	return nil
+}
+
+func migration023Down(tx *sql.Tx) error {
+	queries := []string{
+		"ALTER TABLE mfa_challenges DROP COLUMN login_name",
+		"DELETE FROM schema_migrations WHERE version = 23",
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	log.Println("Migration 023: Rolled back successfully")
+	return nil
+}
+
+func migration024Up(tx *sql.Tx) error {
+	queries := []string{
+		// Organization admins have every permission in their organization.
+		// The admin role only applies where it is held.
+		`ALTER TABLE users
+			ADD COLUMN is_org_admin BOOLEAN NOT NULL DEFAULT FALSE AFTER is_super_admin`,
+
+		// Holders of the admin role had every permission in their
+		// organization, so they keep it explicitly
+		`UPDATE users SET is_org_admin = TRUE WHERE id IN (
+			SELECT ut.user_id FROM user_teams ut JOIN roles r ON ut.role_id = r.id WHERE r.name = 'admin'
+			UNION
+			SELECT ug.user_id FROM user_groups ug JOIN roles r ON ug.role_id = r.id WHERE r.name = 'admin'
+		)`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	// Record migration
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, description) VALUES (?, ?)",
+		24, "Add organization admins",
+	); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	log.Println("Migration 024: Organization admins added successfully")
+	return nil
+}
+
+func migration024Down(tx *sql.Tx) error {
+	queries := []string{
+		"ALTER TABLE users DROP COLUMN is_org_admin",
+		"DELETE FROM schema_migrations WHERE version = 24",
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	log.Println("Migration 024: Rolled back successfully")
+	return nil
+}
+
+func migration025Up(tx *sql.Tx) error {
+	queries := []string{
+		// Memberships granted by the group mappings of an identity provider
+		// record it, so they can be revoked when the user leaves the
+		// provider group. Memberships granted by hand have no source.
+		`ALTER TABLE user_teams
+			ADD COLUMN source VARCHAR(20) NULL AFTER role_id`,
+		`ALTER TABLE user_groups
+			ADD COLUMN source VARCHAR(20) NULL AFTER role_id`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	// Record migration
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, description) VALUES (?, ?)",
+		25, "Track memberships granted by group mappings",
+	); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	log.Println("Migration 025: Membership sources added successfully")
+	return nil
+}
+
+func migration025Down(tx *sql.Tx) error {
+	queries := []string{
+		"ALTER TABLE user_teams DROP COLUMN source",
+		"ALTER TABLE user_groups DROP COLUMN source",
+		"DELETE FROM schema_migrations WHERE version = 25",
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %w", err)
+		}
+	}
+
+	log.Println("Migration 025: Rolled back successfully")
+	return nil
+}
+
+// RunMigrations executes all pending migrations
+func RunMigrations(db *sql.DB) error {
+	// Create migrations table if it doesn't exist
+	if err := createMigrationsTable(db); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	migrations := GetMigrations()
+	
+	for _, migration := range migrations {
+		applied, err := isMigrationApplied(db, migration.Version)
+		if err != nil {
+			return fmt.Errorf("failed to check migration status: %w", err)
+		}
+		
+		if !applied {
+			log.Printf("Running migration %d: %s", migration.Version, migration.Description)
+			
+			tx, err := db.Begin()
+			if err != nil {
+				return fmt.Errorf("failed to begin transaction: %w", err)
+			}
+			
+			if err := migration.Up(tx); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("migration %d failed: %w", migration.Version, err)
+			}
+			
+			if err := tx.Commit(); err != nil {
+				return fmt.Errorf("failed to commit migration %d: %w", migration.Version, err)
+			}
+		}
+	}
+	
+	return nil
+}
+
+// ApplyMigration runs a single migration if it has not been applied yet and
+// records it in schema_migrations. It is meant for data migrations that depend
+// on application state and therefore can't be part of GetMigrations.
+func ApplyMigration(db *sql.DB, migration Migration) error {
+	applied, err := isMigrationApplied(db, migration.Version)
+	if err != nil {
+		return fmt.Errorf("failed to check migration status: %w", err)
+	}
+
+	if applied {
+		return nil
+	}
+
+	log.Printf("Running migration %d: %s", migration.Version, migration.Description)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err := migration.Up(tx); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("migration %d failed: %w", migration.Version, err)
+	}
+
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, description) VALUES (?, ?)",
+		migration.Version, migration.Description,
+	); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %d: %w", migration.Version, err)
+	}
+
 	return nil
 }
 
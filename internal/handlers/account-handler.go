@@ -0,0 +1,390 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"devops-assessment/internal/auth"
+	"devops-assessment/internal/mail"
+	"devops-assessment/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccountHandler handles self-service password reset and invitation endpoints
+type AccountHandler struct {
+	authService  *auth.AuthService
+	teamService  *models.TeamService
+	roleService  *models.RoleService
+	rbacService  *models.RBACService
+	auditService *models.AuditService
+	mailer       mail.Mailer
+	publicURL    string // Base URL of links in emails
+}
+
+// NewAccountHandler creates a new account handler
+func NewAccountHandler(
+	authService *auth.AuthService,
+	teamService *models.TeamService,
+	roleService *models.RoleService,
+	rbacService *models.RBACService,
+	auditService *models.AuditService,
+	mailer mail.Mailer,
+	publicURL string,
+) *AccountHandler {
+	return &AccountHandler{
+		authService:  authService,
+		teamService:  teamService,
+		roleService:  roleService,
+		rbacService:  rbacService,
+		auditService: auditService,
+		mailer:       mailer,
+		publicURL:    strings.TrimRight(publicURL, "/"),
+	}
+}
+
+// ForgotPasswordRequest represents a request for a password reset link
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordWithTokenRequest sets a new password with a reset link
+type ResetPasswordWithTokenRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"` // Checked against the password policy
+}
+
+// CreateInvitationRequest represents a request to invite a user
+type CreateInvitationRequest struct {
+	Email     string `json:"email" binding:"required,email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	TeamID    int    `json:"team_id" binding:"required"`
+	RoleID    int    `json:"role_id" binding:"required"`
+}
+
+// AcceptInvitationRequest represents a request to accept an invitation
+type AcceptInvitationRequest struct {
+	Password  string `json:"password" binding:"required"` // Checked against the password policy
+	FirstName string `json:"first_name"`                  // Defaults to the name the inviter entered
+	LastName  string `json:"last_name"`
+}
+
+// ForgotPassword emails a password reset link. The response is the same
+// whether or not a link was sent, so it can't be used to find accounts.
+func (h *AccountHandler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, token, err := h.authService.RequestPasswordReset(req.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request password reset"})
+		return
+	}
+
+	if user != nil {
+		h.audit(c, user.ID, "request_password_reset")
+
+		// Send in the background, so the response time doesn't reveal
+		// whether the account exists
+		msg := passwordResetMessage(user, h.link("/reset-password", token))
+		go func() {
+			if err := h.mailer.Send(msg); err != nil {
+				log.Printf("Failed to send password reset email: %v", err)
+			}
+		}()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "If an account with this email exists, a password reset link has been sent",
+	})
+}
+
+// ResetPassword sets a new password with a reset link
+func (h *AccountHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordWithTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.authService.ResetPasswordWithToken(req.Token, req.NewPassword)
+	if err != nil {
+		if err == auth.ErrResetTokenInvalid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "This password reset link is invalid or has expired"})
+			return
+		}
+		if errors.Is(err, auth.ErrPasswordPolicy) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	h.audit(c, user.ID, "complete_password_reset")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully. Please login."})
+}
+
+// GetInvitation returns a pending invitation, to show who is invited where
+func (h *AccountHandler) GetInvitation(c *gin.Context) {
+	invitation, err := h.authService.GetInvitation(c.Param("token"))
+	if err != nil {
+		if err == auth.ErrInvitationInvalid {
+			c.JSON(http.StatusNotFound, gin.H{"error": "This invitation is invalid, has expired or was already accepted"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get invitation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, invitation)
+}
+
+// AcceptInvitation creates the invited user
+func (h *AccountHandler) AcceptInvitation(c *gin.Context) {
+	var req AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.authService.AcceptInvitation(c.Param("token"), req.Password, req.FirstName, req.LastName)
+	if err != nil {
+		if err == auth.ErrInvitationInvalid {
+			c.JSON(http.StatusNotFound, gin.H{"error": "This invitation is invalid, has expired or was already accepted"})
+			return
+		}
+		if errors.Is(err, auth.ErrPasswordPolicy) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err == models.ErrEmailAlreadyExists {
+			c.JSON(http.StatusConflict, gin.H{"error": "An account with this email already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation"})
+		return
+	}
+
+	h.audit(c, user.ID, "accept_invitation")
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Account created successfully. Please login.",
+		"user":    user,
+	})
+}
+
+// ListInvitations lists invitations of the organization that haven't been
+// accepted
+func (h *AccountHandler) ListInvitations(c *gin.Context) {
+	invitations, err := h.authService.ListInvitations(auth.GetOrganizationID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list invitations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, invitations)
+}
+
+// CreateInvitation invites a user to a team and emails the invitation
+func (h *AccountHandler) CreateInvitation(c *gin.Context) {
+	user, err := auth.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	var req CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Inviting members is a change to the team
+	if !checkTeamPermission(c, h.rbacService, req.TeamID, models.ResourceTeam, models.ActionUpdate) {
+		return
+	}
+
+	team := &models.Team{}
+	if err := h.teamService.GetTeamByID(req.TeamID, team); err != nil {
+		if err == models.ErrTeamNotFound {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Team not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get team"})
+		return
+	}
+	if team.OrganizationID != auth.GetOrganizationID(c) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Team not found"})
+		return
+	}
+
+	role, err := h.roleService.GetRoleByID(req.RoleID)
+	if err != nil {
+		if err == models.ErrRoleNotFound {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Role not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get role"})
+		return
+	}
+
+	if !checkRoleAssignable(c, h.rbacService, role) {
+		return
+	}
+
+	invitation := &auth.Invitation{
+		Email:     req.Email,
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		TeamID:    team.ID,
+		TeamName:  team.Name,
+		RoleID:    role.ID,
+		RoleName:  role.Name,
+		InvitedBy: user.ID,
+	}
+
+	token, err := h.authService.CreateInvitation(invitation)
+	if err != nil {
+		if err == models.ErrEmailAlreadyExists {
+			c.JSON(http.StatusConflict, gin.H{"error": "A user with this email already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation"})
+		return
+	}
+
+	// An invitation nobody received is useless, so drop it if sending fails
+	msg := invitationMessage(user, invitation, h.link("/accept-invitation", token))
+	if err := h.mailer.Send(msg); err != nil {
+		log.Printf("Failed to send invitation email: %v", err)
+		h.authService.RevokeInvitation(invitation.ID, team.OrganizationID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send invitation email"})
+		return
+	}
+
+	// Store invitation ID for audit logging
+	c.Set("resourceID", invitation.ID)
+
+	c.JSON(http.StatusCreated, invitation)
+}
+
+// RevokeInvitation revokes an invitation that hasn't been accepted
+func (h *AccountHandler) RevokeInvitation(c *gin.Context) {
+	invitationID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation ID"})
+		return
+	}
+
+	if err := h.authService.RevokeInvitation(invitationID, auth.GetOrganizationID(c)); err != nil {
+		if err == auth.ErrInvitationNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invitation"})
+		return
+	}
+
+	// Store invitation ID for audit logging
+	c.Set("resourceID", invitationID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation revoked successfully"})
+}
+
+// RegisterRoutes registers password reset and invitation routes
+func (h *AccountHandler) RegisterRoutes(router *gin.RouterGroup, middleware *auth.Middleware) {
+	// Public routes, authorized by the token from the email
+	public := router.Group("/auth")
+	{
+		public.POST("/forgot-password", h.ForgotPassword)
+		public.POST("/reset-password", h.ResetPassword)
+		public.GET("/invitations/:token", h.GetInvitation)
+		public.POST("/invitations/:token/accept", h.AcceptInvitation)
+	}
+
+	invitations := router.Group("/invitations")
+	invitations.Use(middleware.RequireAuth())
+	{
+		invitations.GET("", middleware.RequirePermission(models.ResourceUser, models.ActionRead), h.ListInvitations)
+		invitations.POST("", middleware.RequirePermission(models.ResourceUser, models.ActionCreate),
+			middleware.AuditLog("create_invitation", "invitation"), h.CreateInvitation)
+		invitations.DELETE("/:id", middleware.RequirePermission(models.ResourceUser, models.ActionCreate),
+			middleware.AuditLog("revoke_invitation", "invitation"), h.RevokeInvitation)
+	}
+}
+
+// link returns an absolute link to a page with a token
+func (h *AccountHandler) link(path, token string) string {
+	return h.publicURL + path + "?token=" + url.QueryEscape(token)
+}
+
+// audit writes an account event to the audit log. These requests have no
+// session, so AuditLog middleware can't record them.
+func (h *AccountHandler) audit(c *gin.Context, userID int, action string) {
+	if err := h.auditService.Log(&models.AuditEntry{
+		UserID:       userID,
+		Action:       action,
+		ResourceType: "user",
+		ResourceID:   userID,
+		Details:      auth.RequestDetails(c),
+		IPAddress:    c.ClientIP(),
+	}); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
+
+// passwordResetMessage is the email with a password reset link
+func passwordResetMessage(user *models.User, link string) *mail.Message {
+	return &mail.Message{
+		To:      user.Email,
+		Subject: "Reset your DevOps Assessment password",
+		Body: fmt.Sprintf(`Hello %s,
+
+Someone asked to reset the password of your DevOps Assessment account. To choose a new password, open this link within %d minutes:
+
+%s
+
+If you didn't ask for this, you can ignore this email; your password stays unchanged.
+`, displayName(user.FirstName, user.Email), int(auth.PasswordResetDuration.Minutes()), link),
+	}
+}
+
+// invitationMessage is the email with an invitation link
+func invitationMessage(inviter *models.User, invitation *auth.Invitation, link string) *mail.Message {
+	return &mail.Message{
+		To:      invitation.Email,
+		Subject: "You're invited to DevOps Assessment",
+		Body: fmt.Sprintf(`Hello %s,
+
+%s has invited you to join the team %s in DevOps Assessment as %s. To create your account, open this link within %d days:
+
+%s
+`,
+			displayName(invitation.FirstName, invitation.Email),
+			displayName(strings.TrimSpace(inviter.FirstName+" "+inviter.LastName), inviter.Email),
+			invitation.TeamName,
+			invitation.RoleName,
+			int(auth.InvitationDuration.Hours()/24),
+			link,
+		),
+	}
+}
+
+// displayName returns a name, or the email when the name is empty
+func displayName(name, email string) string {
+	if name != "" {
+		return name
+	}
+	return email
+}
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"devops-assessment/internal/auth"
+	"devops-assessment/internal/models"
+	"devops-assessment/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dueDateLayout is the format of due dates in requests
+const dueDateLayout = "2006-01-02"
+
+// ActionItemHandler handles improvement action item endpoints
+type ActionItemHandler struct {
+	surveyService     *services.SurveyService
+	assessmentService *models.AssessmentService
+	actionItems       *models.ActionItemService
+}
+
+// NewActionItemHandler creates a new action item handler
+func NewActionItemHandler(
+	surveyService *services.SurveyService,
+	assessmentService *models.AssessmentService,
+	actionItems *models.ActionItemService,
+) *ActionItemHandler {
+	return &ActionItemHandler{
+		surveyService:     surveyService,
+		assessmentService: assessmentService,
+		actionItems:       actionItems,
+	}
+}
+
+// CreateActionItemRequest represents a request to create an action item from
+// a question or a section of a completed assessment
+type CreateActionItemRequest struct {
+	QuestionID  string `json:"question_id"`
+	SectionName string `json:"section_name"` // Instead of a question
+	Title       string `json:"title" binding:"required,max=255"`
+	Notes       string `json:"notes" binding:"max=5000"`
+	OwnerID     int    `json:"owner_id"`
+	DueDate     string `json:"due_date"` // YYYY-MM-DD
+	Status      string `json:"status"`   // Defaults to open
+}
+
+// UpdateActionItemRequest represents a request to update an action item.
+// Omitted fields are kept; an empty due date or an owner ID of 0 clears them.
+type UpdateActionItemRequest struct {
+	Title   string  `json:"title" binding:"omitempty,max=255"`
+	Notes   *string `json:"notes" binding:"omitempty,max=5000"`
+	OwnerID *int    `json:"owner_id"`
+	DueDate *string `json:"due_date"`
+	Status  string  `json:"status"`
+}
+
+// ListAssessmentActionItems lists the action items created from an
+// assessment
+func (h *ActionItemHandler) ListAssessmentActionItems(c *gin.Context) {
+	items, err := h.actionItems.ListAssessmentActionItems(requestAssessment(c).ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list action items"})
+		return
+	}
+
+	c.JSON(http.StatusOK, items)
+}
+
+// ListTeamActionItems lists the action items of a team
+func (h *ActionItemHandler) ListTeamActionItems(c *gin.Context) {
+	teamID, ok := teamParam(c)
+	if !ok {
+		return
+	}
+
+	items, err := h.actionItems.ListTeamActionItems(teamID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list action items"})
+		return
+	}
+
+	c.JSON(http.StatusOK, items)
+}
+
+// CreateActionItem creates an action item from a question or a section of
+// a completed assessment
+func (h *ActionItemHandler) CreateActionItem(c *gin.Context) {
+	assessment := requestAssessment(c)
+
+	var req CreateActionItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	dueDate, ok := parseDueDate(c, req.DueDate)
+	if !ok {
+		return
+	}
+
+	user, err := auth.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	item := &models.ActionItem{
+		QuestionID:  req.QuestionID,
+		SectionName: req.SectionName,
+		Title:       strings.TrimSpace(req.Title),
+		Notes:       req.Notes,
+		OwnerID:     req.OwnerID,
+		DueDate:     dueDate,
+		Status:      req.Status,
+		CreatedBy:   user.ID,
+	}
+
+	if err := h.surveyService.CreateActionItem(assessment, item); err != nil {
+		actionItemError(c, err, "Failed to create action item")
+		return
+	}
+
+	// Store action item ID for audit logging
+	c.Set("resourceID", item.ID)
+	c.Set("auditDetails", map[string]interface{}{
+		"assessment_id": assessment.ID,
+		"question_id":   item.QuestionID,
+		"section_name":  item.SectionName,
+	})
+
+	c.JSON(http.StatusCreated, item)
+}
+
+// UpdateActionItem updates the title, notes, owner, due date and status of
+// an action item
+func (h *ActionItemHandler) UpdateActionItem(c *gin.Context) {
+	item := requestActionItem(c)
+
+	var req UpdateActionItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Update fields
+	previousStatus := item.Status
+	if title := strings.TrimSpace(req.Title); title != "" {
+		item.Title = title
+	}
+	if req.Notes != nil {
+		item.Notes = *req.Notes
+	}
+	if req.OwnerID != nil {
+		item.OwnerID = *req.OwnerID
+	}
+	if req.DueDate != nil {
+		dueDate, ok := parseDueDate(c, *req.DueDate)
+		if !ok {
+			return
+		}
+		item.DueDate = dueDate
+	}
+	if req.Status != "" {
+		item.Status = req.Status
+	}
+
+	if err := h.surveyService.UpdateActionItem(item); err != nil {
+		actionItemError(c, err, "Failed to update action item")
+		return
+	}
+
+	// Store action item ID for audit logging
+	c.Set("resourceID", item.ID)
+	if item.Status != previousStatus {
+		c.Set("auditDetails", map[string]interface{}{
+			"status": item.Status,
+		})
+	}
+
+	c.JSON(http.StatusOK, item)
+}
+
+// DeleteActionItem deletes an action item
+func (h *ActionItemHandler) DeleteActionItem(c *gin.Context) {
+	item := requestActionItem(c)
+
+	if err := h.actionItems.DeleteActionItem(item.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete action item"})
+		return
+	}
+
+	// Store action item ID for audit logging
+	c.Set("resourceID", item.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Action item deleted successfully"})
+}
+
+// assessmentTeam resolves the team of the assessment in the id parameter
+func (h *ActionItemHandler) assessmentTeam(c *gin.Context) (int, error) {
+	return resolveAssessmentTeam(c, h.assessmentService)
+}
+
+// actionItemTeam resolves the team of the action item in the id parameter,
+// and keeps the item for the handler
+func (h *ActionItemHandler) actionItemTeam(c *gin.Context) (int, error) {
+	itemID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return 0, auth.ErrInvalidResourceID
+	}
+
+	item := &models.ActionItem{}
+	if err := h.actionItems.GetActionItemByID(itemID, item); err != nil {
+		if err == models.ErrActionItemNotFound {
+			return 0, auth.ErrResourceNotFound
+		}
+		return 0, err
+	}
+
+	c.Set("actionItem", item)
+	return item.TeamID, nil
+}
+
+// requestActionItem returns the action item resolved by actionItemTeam
+func requestActionItem(c *gin.Context) *models.ActionItem {
+	return c.MustGet("actionItem").(*models.ActionItem)
+}
+
+// parseDueDate parses a due date in a request, where an empty string means
+// no due date, and writes the error response if it is invalid
+func parseDueDate(c *gin.Context, value string) (*time.Time, bool) {
+	if value == "" {
+		return nil, true
+	}
+
+	dueDate, err := time.Parse(dueDateLayout, value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Due dates must be formatted as YYYY-MM-DD"})
+		return nil, false
+	}
+	return &dueDate, true
+}
+
+// actionItemError writes the error response for creating or updating an
+// action item
+func actionItemError(c *gin.Context, err error, message string) {
+	switch err {
+	case models.ErrActionItemNoResults:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Action items can only be created from completed assessments"})
+	case models.ErrActionItemTarget:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Choose one question or section of the assessment"})
+	case models.ErrInvalidActionItem:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Status must be open, in_progress, done or dropped"})
+	case models.ErrUserNotFound, models.ErrOrganizationMismatch:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Owner not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// RegisterRoutes registers action item routes
+func (h *ActionItemHandler) RegisterRoutes(router *gin.RouterGroup, middleware *auth.Middleware) {
+	assessments := router.Group("/assessments")
+	assessments.Use(middleware.RequireAuth())
+	{
+		read := middleware.RequireResourceAccess(h.assessmentTeam, "assessment:read")
+		update := middleware.RequireResourceAccess(h.assessmentTeam, "assessment:update")
+
+		assessments.GET("/:id/action-items", read, h.ListAssessmentActionItems)
+		assessments.POST("/:id/action-items", update, middleware.AuditLog("create_action_item", "action_item"), h.CreateActionItem)
+	}
+
+	teams := router.Group("/teams")
+	teams.Use(middleware.RequireAuth())
+	{
+		teams.GET("/:id/action-items", middleware.RequireTeamAccess("id", "assessment:read"), h.ListTeamActionItems)
+	}
+
+	items := router.Group("/action-items")
+	items.Use(middleware.RequireAuth())
+	{
+		update := middleware.RequireResourceAccess(h.actionItemTeam, "assessment:update")
+
+		items.PUT("/:id", update, middleware.AuditLog("update_action_item", "action_item"), h.UpdateActionItem)
+		items.DELETE("/:id", update, middleware.AuditLog("delete_action_item", "action_item"), h.DeleteActionItem)
+	}
+}
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"devops-assessment/internal/auth"
@@ -26,22 +28,28 @@ func NewAuthHandler(authService *auth.AuthService, userService *models.UserServi
 
 // LoginRequest represents a login request
 type LoginRequest struct {
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	Email    string `json:"email" binding:"required"` // Email, or directory username with LDAP
+	Password string `json:"password" binding:"required"`
 }
 
 // RegisterRequest represents a registration request
 type RegisterRequest struct {
 	Email     string `json:"email" binding:"required,email"`
-	Password  string `json:"password" binding:"required,min=8"`
+	Password  string `json:"password" binding:"required"` // Checked against the password policy
 	FirstName string `json:"first_name" binding:"required"`
 	LastName  string `json:"last_name" binding:"required"`
 }
 
+// UnlockRequest represents a request to clear a login lockout
+type UnlockRequest struct {
+	Scope   string `json:"scope" binding:"required,oneof=account ip"`
+	Subject string `json:"subject" binding:"required"` // Login name or client IP
+}
+
 // ChangePasswordRequest represents a password change request
 type ChangePasswordRequest struct {
 	OldPassword string `json:"old_password" binding:"required"`
-	NewPassword string `json:"new_password" binding:"required,min=8"`
+	NewPassword string `json:"new_password" binding:"required"` // Checked against the password policy
 }
 
 // Login handles user login
@@ -53,8 +61,11 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	// Authenticate user
-	session, err := h.authService.Login(req.Email, req.Password)
+	session, challenge, err := h.authService.Login(req.Email, req.Password, c.ClientIP())
 	if err != nil {
+		if throttled(c, err) {
+			return
+		}
 		if err == auth.ErrInvalidCredentials {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 			return
@@ -63,10 +74,53 @@ func (h *AuthHandler) Login(c *gin.Context) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "User account is inactive"})
 			return
 		}
+		if errors.Is(err, auth.ErrIdentityNotLinkable) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Your directory account must be linked to your user by an administrator"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
 		return
 	}
 
+	// The password was right, but a second factor is needed
+	if challenge != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message":             "Verification code required",
+			"mfa_required":        true,
+			"mfa_token":           challenge.Token,
+			"enrollment_required": challenge.EnrollmentRequired,
+			"expires_at":          challenge.ExpiresAt,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, startSession(c, h.userService, session))
+}
+
+// throttled writes the response for a login refused by the login throttle
+// and reports whether err was a *auth.ThrottleError
+func throttled(c *gin.Context, err error) bool {
+	var throttleErr *auth.ThrottleError
+	if !errors.As(err, &throttleErr) {
+		return false
+	}
+
+	retryAfter := int(throttleErr.RetryAfter.Round(time.Second).Seconds())
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+
+	status := http.StatusTooManyRequests
+	if errors.Is(err, auth.ErrAccountLocked) {
+		status = http.StatusLocked
+	}
+	c.JSON(status, gin.H{"error": err.Error(), "retry_after": retryAfter})
+	return true
+}
+
+// startSession sets the session cookie and returns the login response body
+func startSession(c *gin.Context, userService *models.UserService, session *auth.Session) gin.H {
 	// Set session cookie
 	c.SetCookie(
 		"session_token",
@@ -79,21 +133,21 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	)
 
 	// Load user teams
-	teams, _ := h.userService.GetUserTeams(session.User.ID)
+	teams, _ := userService.GetUserTeams(session.User.ID)
 	session.User.Teams = teams
 
 	// Load user groups
-	groups, _ := h.userService.GetUserGroups(session.User.ID)
+	groups, _ := userService.GetUserGroups(session.User.ID)
 	session.User.Groups = groups
 
-	c.JSON(http.StatusOK, gin.H{
+	return gin.H{
 		"message": "Login successful",
 		"user":    session.User,
 		"session": gin.H{
 			"token":      session.SessionToken,
 			"expires_at": session.ExpiresAt,
 		},
-	})
+	}
 }
 
 // Logout handles user logout
@@ -135,13 +189,18 @@ func (h *AuthHandler) Register(c *gin.Context) {
 
 	// Create user
 	user := &models.User{
-		Email:     req.Email,
-		FirstName: req.FirstName,
-		LastName:  req.LastName,
-		IsActive:  true,
+		OrganizationID: auth.GetOrganizationID(c),
+		Email:          req.Email,
+		FirstName:      req.FirstName,
+		LastName:       req.LastName,
+		IsActive:       true,
 	}
 
-	if err := h.userService.CreateUser(user, req.Password); err != nil {
+	if err := h.authService.CreateUser(user, req.Password); err != nil {
+		if errors.Is(err, auth.ErrPasswordPolicy) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		if err == models.ErrEmailAlreadyExists {
 			c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
 			return
@@ -196,6 +255,10 @@ func (h *AuthHandler) ChangePassword(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid old password"})
 			return
 		}
+		if errors.Is(err, auth.ErrPasswordPolicy) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
 		return
 	}
@@ -294,6 +357,42 @@ func (h *AuthHandler) RevokeAllSessions(c *gin.Context) {
 	})
 }
 
+// ListLockouts lists the login names and client IPs that are locked out
+func (h *AuthHandler) ListLockouts(c *gin.Context) {
+	lockouts, err := h.authService.Throttle().ListLockouts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list lockouts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, lockouts)
+}
+
+// Unlock clears the failed logins and any lockout of a login name or
+// client IP
+func (h *AuthHandler) Unlock(c *gin.Context) {
+	var req UnlockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.authService.Throttle().Unlock(req.Scope, req.Subject); err != nil {
+		if err == auth.ErrLockoutNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Lockout not found"})
+			return
+		}
+		if err == auth.ErrLockoutScopeInvalid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid lockout scope"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Unlocked successfully"})
+}
+
 // RegisterRoutes registers authentication routes
 func (h *AuthHandler) RegisterRoutes(router *gin.RouterGroup, middleware *auth.Middleware) {
 	auth := router.Group("/auth")
@@ -302,11 +401,12 @@ func (h *AuthHandler) RegisterRoutes(router *gin.RouterGroup, middleware *auth.M
 		auth.POST("/login", h.Login)
 		auth.POST("/logout", h.Logout)
 
-		// Protected routes
+		auth.GET("/me", middleware.RequireAuth(), h.GetCurrentUser)
+
+		// Account routes, not available to API tokens
 		protected := auth.Group("")
-		protected.Use(middleware.RequireAuth())
+		protected.Use(middleware.RequireSession())
 		{
-			protected.GET("/me", h.GetCurrentUser)
 			protected.POST("/change-password", h.ChangePassword)
 			protected.POST("/refresh", h.RefreshSession)
 			protected.GET("/sessions", h.GetSessions)
@@ -319,5 +419,13 @@ func (h *AuthHandler) RegisterRoutes(router *gin.RouterGroup, middleware *auth.M
 		{
 			admin.POST("/register", h.Register)
 		}
+
+		// Lockouts span organizations (super admin only)
+		lockouts := auth.Group("/lockouts")
+		lockouts.Use(middleware.RequireAuth(), middleware.RequireSuperAdmin())
+		{
+			lockouts.GET("", h.ListLockouts)
+			lockouts.POST("/unlock", middleware.AuditLog("unlock_login", "login_throttle"), h.Unlock)
+		}
 	}
 }
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"devops-assessment/internal/auth"
+	"devops-assessment/internal/models"
+	"devops-assessment/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultReminderDays are the days before the deadline reminders are sent
+// on, for campaigns created without reminder days
+var defaultReminderDays = []int{7, 1}
+
+// CampaignHandler handles assessment campaign endpoints
+type CampaignHandler struct {
+	campaignService *services.CampaignService
+	campaigns       *models.CampaignService
+	rbacService     *models.RBACService
+}
+
+// NewCampaignHandler creates a new campaign handler
+func NewCampaignHandler(
+	campaignService *services.CampaignService,
+	campaigns *models.CampaignService,
+	rbacService *models.RBACService,
+) *CampaignHandler {
+	return &CampaignHandler{
+		campaignService: campaignService,
+		campaigns:       campaigns,
+		rbacService:     rbacService,
+	}
+}
+
+// CreateCampaignRequest represents a request to create a campaign
+type CreateCampaignRequest struct {
+	Name         string    `json:"name" binding:"required,max=255"`
+	TemplateID   string    `json:"template_id"` // Defaults to the default template
+	TeamIDs      []int     `json:"team_ids"`
+	GroupIDs     []int     `json:"group_ids"` // Their teams and the teams of their subgroups
+	OpensAt      time.Time `json:"opens_at" binding:"required"`
+	DueAt        time.Time `json:"due_at" binding:"required"`
+	ReminderDays []int     `json:"reminder_days"` // Defaults to 7 and 1 days before the deadline
+}
+
+// UpdateCampaignRequest represents a request to update a campaign
+type UpdateCampaignRequest struct {
+	Name         string     `json:"name" binding:"omitempty,max=255"`
+	OpensAt      *time.Time `json:"opens_at"` // Only before the campaign opens
+	DueAt        *time.Time `json:"due_at"`
+	ReminderDays []int      `json:"reminder_days"`
+}
+
+// ListCampaigns lists the campaigns of the organization
+func (h *CampaignHandler) ListCampaigns(c *gin.Context) {
+	campaigns, err := h.campaigns.ListCampaigns(auth.GetOrganizationID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list campaigns"})
+		return
+	}
+
+	c.JSON(http.StatusOK, campaigns)
+}
+
+// GetCampaign retrieves a campaign
+func (h *CampaignHandler) GetCampaign(c *gin.Context) {
+	campaign, ok := h.requestCampaign(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, campaign)
+}
+
+// GetCampaignProgress shows whether each team of a campaign has not started,
+// is working on or has completed its assessment. Only teams whose
+// assessments the user can read are listed.
+func (h *CampaignHandler) GetCampaignProgress(c *gin.Context) {
+	campaign, ok := h.requestCampaign(c)
+	if !ok {
+		return
+	}
+
+	user, err := auth.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	teamIDs, err := h.rbacService.GetPermittedTeamIDs(user.ID, models.ResourceAssessment, models.ActionRead)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return
+	}
+
+	progress, err := h.campaignService.GetProgress(campaign.ID, teamIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get campaign progress"})
+		return
+	}
+
+	c.JSON(http.StatusOK, progress)
+}
+
+// CreateCampaign creates a campaign. Assessments are started for its teams
+// when it opens, which requires assessment:create for every team and group.
+func (h *CampaignHandler) CreateCampaign(c *gin.Context) {
+	var req CreateCampaignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(req.TeamIDs) == 0 && len(req.GroupIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Choose at least one team or group"})
+		return
+	}
+
+	user, err := auth.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	for _, teamID := range req.TeamIDs {
+		if !checkTeamPermission(c, h.rbacService, teamID, models.ResourceAssessment, models.ActionCreate) {
+			return
+		}
+	}
+	for _, groupID := range req.GroupIDs {
+		hasPermission, err := auth.CheckGroupPermission(
+			c, h.rbacService, user.ID, groupID, models.ResourceAssessment, models.ActionCreate,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+			return
+		}
+		if !hasPermission {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions for this group"})
+			return
+		}
+	}
+
+	reminderDays := req.ReminderDays
+	if reminderDays == nil {
+		reminderDays = defaultReminderDays
+	}
+
+	campaign := &models.Campaign{
+		OrganizationID: auth.GetOrganizationID(c),
+		Name:           strings.TrimSpace(req.Name),
+		TemplateID:     req.TemplateID,
+		OpensAt:        req.OpensAt,
+		DueAt:          req.DueAt,
+		ReminderDays:   reminderDays,
+		CreatedBy:      user.ID,
+	}
+
+	if err := h.campaignService.CreateCampaign(campaign, req.TeamIDs, req.GroupIDs); err != nil {
+		switch err {
+		case models.ErrTemplateNotFound:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown questionnaire template"})
+		case models.ErrGroupNotFound, models.ErrOrganizationMismatch:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Team or group not found"})
+		case models.ErrCampaignNoTeams:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The groups have no teams"})
+		case models.ErrCampaignDates:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The due date must be after the opening date"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create campaign"})
+		}
+		return
+	}
+
+	// Store campaign ID for audit logging
+	c.Set("resourceID", campaign.ID)
+	c.Set("auditDetails", map[string]interface{}{
+		"team_ids":  req.TeamIDs,
+		"group_ids": req.GroupIDs,
+	})
+
+	c.JSON(http.StatusCreated, campaign)
+}
+
+// UpdateCampaign updates the name, dates and reminders of a campaign
+func (h *CampaignHandler) UpdateCampaign(c *gin.Context) {
+	campaign, ok := h.requestCampaign(c)
+	if !ok || !h.checkManageCampaign(c, campaign) {
+		return
+	}
+
+	var req UpdateCampaignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Update fields
+	if name := strings.TrimSpace(req.Name); name != "" {
+		campaign.Name = name
+	}
+	if req.OpensAt != nil {
+		if campaign.OpenedAt != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Campaign is already open"})
+			return
+		}
+		campaign.OpensAt = *req.OpensAt
+	}
+	if req.DueAt != nil {
+		campaign.DueAt = *req.DueAt
+	}
+	if req.ReminderDays != nil {
+		campaign.ReminderDays = req.ReminderDays
+	}
+
+	if err := h.campaignService.UpdateCampaign(campaign); err != nil {
+		if err == models.ErrCampaignDates {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The due date must be after the opening date"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update campaign"})
+		return
+	}
+
+	// Store campaign ID for audit logging
+	c.Set("resourceID", campaign.ID)
+
+	c.JSON(http.StatusOK, campaign)
+}
+
+// DeleteCampaign deletes a campaign. Assessments it started are kept.
+func (h *CampaignHandler) DeleteCampaign(c *gin.Context) {
+	campaign, ok := h.requestCampaign(c)
+	if !ok || !h.checkManageCampaign(c, campaign) {
+		return
+	}
+
+	if err := h.campaigns.DeleteCampaign(campaign.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete campaign"})
+		return
+	}
+
+	// Store campaign ID for audit logging
+	c.Set("resourceID", campaign.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Campaign deleted successfully"})
+}
+
+// requestCampaign loads the campaign in the id parameter. Campaigns of
+// other organizations are reported as not found.
+func (h *CampaignHandler) requestCampaign(c *gin.Context) (*models.Campaign, bool) {
+	campaignID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign ID"})
+		return nil, false
+	}
+
+	campaign := &models.Campaign{}
+	if err := h.campaigns.GetCampaignByID(campaignID, campaign); err != nil {
+		if err == models.ErrCampaignNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Campaign not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get campaign"})
+		return nil, false
+	}
+
+	if campaign.OrganizationID != auth.GetOrganizationID(c) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Campaign not found"})
+		return nil, false
+	}
+
+	return campaign, true
+}
+
+// checkManageCampaign checks that the current user created the campaign or
+// is an organization admin, and writes the error response if not
+func (h *CampaignHandler) checkManageCampaign(c *gin.Context, campaign *models.Campaign) bool {
+	user, err := auth.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return false
+	}
+
+	if user.ID == campaign.CreatedBy {
+		return true
+	}
+
+	isAdmin, err := h.rbacService.IsOrgAdmin(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return false
+	}
+	if !isAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the creator of a campaign and organization admins can change it"})
+		return false
+	}
+
+	return true
+}
+
+// RegisterRoutes registers campaign routes
+func (h *CampaignHandler) RegisterRoutes(router *gin.RouterGroup, middleware *auth.Middleware) {
+	campaigns := router.Group("/campaigns")
+	campaigns.Use(middleware.RequireAuth())
+	{
+		read := campaigns.Group("")
+		read.Use(middleware.RequirePermission(models.ResourceAssessment, models.ActionRead))
+		{
+			read.GET("", h.ListCampaigns)
+			read.GET("/:id", h.GetCampaign)
+			read.GET("/:id/progress", h.GetCampaignProgress)
+		}
+
+		write := campaigns.Group("")
+		write.Use(middleware.RequirePermission(models.ResourceAssessment, models.ActionCreate))
+		{
+			write.POST("", middleware.AuditLog("create_campaign", "campaign"), h.CreateCampaign)
+			write.PUT("/:id", middleware.AuditLog("update_campaign", "campaign"), h.UpdateCampaign)
+			write.DELETE("/:id", middleware.AuditLog("delete_campaign", "campaign"), h.DeleteCampaign)
+		}
+	}
+}
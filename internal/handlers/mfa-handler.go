@@ -0,0 +1,416 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"devops-assessment/internal/auth"
+	"devops-assessment/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MFAHandler handles multi-factor authentication endpoints
+type MFAHandler struct {
+	authService    *auth.AuthService
+	mfaService     *auth.MFAService
+	userService    *models.UserService
+	settingService *models.SettingService
+	auditService   *models.AuditService
+}
+
+// NewMFAHandler creates a new MFA handler
+func NewMFAHandler(
+	authService *auth.AuthService,
+	userService *models.UserService,
+	settingService *models.SettingService,
+	auditService *models.AuditService,
+) *MFAHandler {
+	return &MFAHandler{
+		authService:    authService,
+		mfaService:     authService.MFA(),
+		userService:    userService,
+		settingService: settingService,
+		auditService:   auditService,
+	}
+}
+
+// MFAChallengeRequest identifies a login waiting for its second factor
+type MFAChallengeRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+// MFAVerifyRequest completes a login with a TOTP or recovery code
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// MFACodeRequest represents a request confirmed with a TOTP or recovery code
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// SecuritySettingsRequest represents a security settings update
+type SecuritySettingsRequest struct {
+	MFARequiredForAdmins *bool `json:"mfa_required_for_admins" binding:"required"`
+}
+
+// Verify completes a login with the second factor
+func (h *MFAHandler) Verify(c *gin.Context) {
+	var req MFAVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	challenge, err := h.mfaService.GetChallenge(req.MFAToken)
+	if err != nil {
+		if err == auth.ErrMFAChallengeInvalid {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Verification expired, please log in again"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Verification failed"})
+		return
+	}
+
+	result, err := h.authService.CompleteMFALogin(challenge, req.Code, c.ClientIP())
+	if err != nil {
+		if throttled(c, err) {
+			return
+		}
+		switch err {
+		case auth.ErrMFACodeInvalid:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+			h.audit(c, challenge.UserID, "mfa_verification_failed", nil)
+		case auth.ErrMFAChallengeInvalid:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Verification expired, please log in again"})
+		case auth.ErrMFANotEnrolling:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Set up an authenticator app first"})
+		case auth.ErrUserInactive:
+			c.JSON(http.StatusForbidden, gin.H{"error": "User account is inactive"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Verification failed"})
+		}
+		return
+	}
+
+	response := startSession(c, h.userService, result.Session)
+	if result.RecoveryCodes != nil {
+		response["recovery_codes"] = result.RecoveryCodes
+	}
+	c.JSON(http.StatusOK, response)
+
+	if result.RecoveryCodes != nil {
+		h.audit(c, challenge.UserID, "mfa_enrolled", nil)
+	}
+	h.audit(c, challenge.UserID, "mfa_verified", gin.H{"mfa_method": result.Method})
+}
+
+// Setup starts the enrollment of a user who must enroll to complete a login
+func (h *MFAHandler) Setup(c *gin.Context) {
+	var req MFAChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	challenge, err := h.mfaService.GetChallenge(req.MFAToken)
+	if err != nil {
+		if err == auth.ErrMFAChallengeInvalid {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Verification expired, please log in again"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start enrollment"})
+		return
+	}
+
+	if !challenge.EnrollmentRequired {
+		c.JSON(http.StatusConflict, gin.H{"error": "Multi-factor authentication is already enabled"})
+		return
+	}
+
+	user := &models.User{}
+	if err := h.userService.GetUserByID(challenge.UserID, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start enrollment"})
+		return
+	}
+
+	h.beginEnrollment(c, user)
+}
+
+// GetStatus returns the current user's MFA status
+func (h *MFAHandler) GetStatus(c *gin.Context) {
+	user, err := auth.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	status, err := h.mfaService.GetStatus(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get MFA status"})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// Enroll starts the enrollment of the current user
+func (h *MFAHandler) Enroll(c *gin.Context) {
+	user, err := auth.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	h.beginEnrollment(c, user)
+}
+
+// Confirm enables MFA for the current user and returns the recovery codes
+func (h *MFAHandler) Confirm(c *gin.Context) {
+	user, err := auth.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := h.mfaService.ConfirmEnrollment(user.ID, req.Code)
+	if err != nil {
+		switch err {
+		case auth.ErrMFACodeInvalid:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid verification code"})
+		case auth.ErrMFANotEnrolling:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No enrollment in progress"})
+		case auth.ErrMFAAlreadyEnabled:
+			c.JSON(http.StatusConflict, gin.H{"error": "Multi-factor authentication is already enabled"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable multi-factor authentication"})
+		}
+		return
+	}
+
+	// Store user ID for audit logging
+	c.Set("resourceID", user.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Multi-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// RegenerateRecoveryCodes replaces the current user's recovery codes
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	user, ok := h.verifyCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	codes, err := h.mfaService.RegenerateRecoveryCodes(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	// Store user ID for audit logging
+	c.Set("resourceID", user.ID)
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// Disable turns MFA off for the current user
+func (h *MFAHandler) Disable(c *gin.Context) {
+	user, ok := h.verifyCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	required, err := h.mfaService.IsRequired(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable multi-factor authentication"})
+		return
+	}
+	if required {
+		c.JSON(http.StatusForbidden, gin.H{"error": auth.ErrMFARequired.Error()})
+		return
+	}
+
+	if err := h.mfaService.Disable(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable multi-factor authentication"})
+		return
+	}
+
+	// Store user ID for audit logging
+	c.Set("resourceID", user.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Multi-factor authentication disabled"})
+}
+
+// ResetUserMFA removes a user's second factor, e.g. after a lost device.
+// If MFA is required for the user, they enroll again on their next login.
+func (h *MFAHandler) ResetUserMFA(c *gin.Context) {
+	// Get user ID from URL
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	user := &models.User{}
+	if err := h.userService.GetUserByID(userID, user); err != nil {
+		if err == models.ErrUserNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	if err := h.mfaService.Disable(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset multi-factor authentication"})
+		return
+	}
+
+	// Store user ID for audit logging
+	c.Set("resourceID", userID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Multi-factor authentication reset successfully"})
+}
+
+// GetSecuritySettings returns the security settings
+func (h *MFAHandler) GetSecuritySettings(c *gin.Context) {
+	required, err := h.settingService.GetBool(models.SettingMFARequiredForAdmins, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get security settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mfa_required_for_admins": required})
+}
+
+// UpdateSecuritySettings updates the security settings
+func (h *MFAHandler) UpdateSecuritySettings(c *gin.Context) {
+	var req SecuritySettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.settingService.SetBool(models.SettingMFARequiredForAdmins, *req.MFARequiredForAdmins); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update security settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mfa_required_for_admins": *req.MFARequiredForAdmins})
+}
+
+// RegisterRoutes registers MFA routes
+func (h *MFAHandler) RegisterRoutes(router *gin.RouterGroup, middleware *auth.Middleware) {
+	mfa := router.Group("/auth/mfa")
+	{
+		// Login challenge routes, used before a session exists
+		mfa.POST("/verify", h.Verify)
+		mfa.POST("/setup", h.Setup)
+
+		// Account routes, not available to API tokens
+		protected := mfa.Group("")
+		protected.Use(middleware.RequireSession())
+		{
+			protected.GET("", h.GetStatus)
+			protected.POST("/enroll", h.Enroll)
+			protected.POST("/confirm", middleware.AuditLog("mfa_enrolled", "user"), h.Confirm)
+			protected.POST("/recovery-codes", middleware.AuditLog("mfa_recovery_codes_regenerated", "user"), h.RegenerateRecoveryCodes)
+			protected.POST("/disable", middleware.AuditLog("mfa_disabled", "user"), h.Disable)
+		}
+	}
+
+	// Reset (admin only)
+	users := router.Group("/users")
+	users.Use(middleware.RequireAuth(), middleware.RequirePermission(models.ResourceUser, models.ActionUpdate))
+	{
+		users.DELETE("/:id/mfa", middleware.RequireOrganizationUser("id"), middleware.RequireAdminTarget("id"), middleware.AuditLog("reset_mfa", "user"), h.ResetUserMFA)
+	}
+
+	// Settings apply to every organization (super admin only)
+	settings := router.Group("/settings")
+	settings.Use(middleware.RequireAuth(), middleware.RequireSuperAdmin())
+	{
+		settings.GET("/security", h.GetSecuritySettings)
+		settings.PUT("/security", middleware.AuditLog("update_security_settings", "settings"), h.UpdateSecuritySettings)
+	}
+}
+
+// beginEnrollment generates a secret for a user and returns it
+func (h *MFAHandler) beginEnrollment(c *gin.Context, user *models.User) {
+	enrollment, err := h.mfaService.BeginEnrollment(user)
+	if err != nil {
+		if err == auth.ErrMFAAlreadyEnabled {
+			c.JSON(http.StatusConflict, gin.H{"error": "Multi-factor authentication is already enabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// verifyCurrentUser checks the code in the request body against the current
+// user's second factor, so a stolen session alone can't change it
+func (h *MFAHandler) verifyCurrentUser(c *gin.Context) (*models.User, bool) {
+	user, err := auth.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return nil, false
+	}
+
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	method, err := h.mfaService.Verify(user.ID, req.Code)
+	if err != nil {
+		switch err {
+		case auth.ErrMFACodeInvalid:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid verification code"})
+			h.audit(c, user.ID, "mfa_verification_failed", nil)
+		case auth.ErrMFANotEnabled:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Multi-factor authentication is not enabled"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Verification failed"})
+		}
+		return nil, false
+	}
+
+	h.audit(c, user.ID, "mfa_verified", gin.H{"mfa_method": method})
+	return user, true
+}
+
+// audit writes an MFA event to the audit log. Login challenges have no
+// session yet, so AuditLog middleware can't record them.
+func (h *MFAHandler) audit(c *gin.Context, userID int, action string, extra gin.H) {
+	details := auth.RequestDetails(c)
+	for key, value := range extra {
+		details[key] = value
+	}
+
+	if err := h.auditService.Log(&models.AuditEntry{
+		UserID:       userID,
+		Action:       action,
+		ResourceType: "user",
+		ResourceID:   userID,
+		Details:      details,
+		IPAddress:    c.ClientIP(),
+	}); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"devops-assessment/internal/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OIDCHandler handles OpenID Connect single sign-on endpoints
+type OIDCHandler struct {
+	provider *auth.OIDCProvider
+}
+
+// NewOIDCHandler creates a new OIDC handler
+func NewOIDCHandler(provider *auth.OIDCProvider) *OIDCHandler {
+	return &OIDCHandler{provider: provider}
+}
+
+// Login redirects the user to the identity provider
+func (h *OIDCHandler) Login(c *gin.Context) {
+	authURL, binding, err := h.provider.AuthCodeURL(safeRedirect(c.Query("redirect")))
+	if err != nil {
+		log.Printf("OIDC login failed: %v", err)
+		c.HTML(http.StatusInternalServerError, "error.html", gin.H{"error": "Single sign-on is unavailable"})
+		return
+	}
+
+	// The callback is only accepted in this browser. Lax cookies are sent
+	// with the top-level redirect back from the identity provider.
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     auth.OIDCStateCookie,
+		Value:    binding,
+		Path:     "/",
+		MaxAge:   int(auth.OIDCRequestDuration.Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback completes the login when the identity provider redirects back
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	// The state cookie is used once, whatever the outcome
+	binding, _ := c.Cookie(auth.OIDCStateCookie)
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     auth.OIDCStateCookie,
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	// The identity provider reports errors such as a denied consent here
+	if errCode := c.Query("error"); errCode != "" {
+		log.Printf("OIDC login rejected by identity provider: %s: %s", errCode, c.Query("error_description"))
+		c.HTML(http.StatusUnauthorized, "error.html", gin.H{"error": "Single sign-on was cancelled or rejected"})
+		return
+	}
+
+	session, challenge, redirectTo, err := h.provider.HandleCallback(c.Request.Context(), c.Query("state"), binding, c.Query("code"))
+	if err != nil {
+		if err == auth.ErrUserInactive {
+			c.HTML(http.StatusForbidden, "error.html", gin.H{"error": "User account is inactive"})
+			return
+		}
+		if errors.Is(err, auth.ErrIdentityNotLinkable) {
+			log.Printf("OIDC login refused: %v", err)
+			c.HTML(http.StatusForbidden, "error.html", gin.H{"error": "Your account can't be used with single sign-on, please contact your administrator"})
+			return
+		}
+		log.Printf("OIDC login failed: %v", err)
+		c.HTML(http.StatusUnauthorized, "error.html", gin.H{"error": "Single sign-on failed, please try again"})
+		return
+	}
+
+	// The login page asks for the second factor. The challenge is passed in
+	// the fragment, which never reaches servers or Referer headers.
+	if challenge != nil {
+		fragment := url.Values{}
+		fragment.Set("mfa_token", challenge.Token)
+		fragment.Set("enrollment_required", strconv.FormatBool(challenge.EnrollmentRequired))
+		c.Redirect(http.StatusFound, "/login#"+fragment.Encode())
+		return
+	}
+
+	// Set session cookie
+	c.SetCookie(
+		"session_token",
+		session.SessionToken,
+		int(auth.SessionDuration.Seconds()),
+		"/",
+		"",   // domain
+		true, // secure (HTTPS only)
+		true, // httpOnly
+	)
+
+	c.Redirect(http.StatusFound, safeRedirect(redirectTo))
+}
+
+// RegisterRoutes registers OIDC routes
+func (h *OIDCHandler) RegisterRoutes(router *gin.RouterGroup, middleware *auth.Middleware) {
+	oidc := router.Group("/auth/oidc")
+	{
+		oidc.GET("/login", h.Login)
+		oidc.GET("/callback", h.Callback)
+	}
+}
+
+// safeRedirect only allows local paths as post-login destinations, so the
+// login can't be abused as an open redirect
+func safeRedirect(target string) string {
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+		return "/dashboard"
+	}
+	return target
+}
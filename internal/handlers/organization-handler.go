@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"devops-assessment/internal/auth"
+	"devops-assessment/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// organizationSlugPattern matches slugs that are valid DNS labels, as slugs
+// are used as subdomains
+var organizationSlugPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// OrganizationHandler handles organization management endpoints
+type OrganizationHandler struct {
+	organizationService *models.OrganizationService
+}
+
+// NewOrganizationHandler creates a new organization handler
+func NewOrganizationHandler(organizationService *models.OrganizationService) *OrganizationHandler {
+	return &OrganizationHandler{
+		organizationService: organizationService,
+	}
+}
+
+// CreateOrganizationRequest represents a request to create an organization
+type CreateOrganizationRequest struct {
+	Name string `json:"name" binding:"required,max=255"`
+	Slug string `json:"slug" binding:"required"` // Lowercase letters, digits and dashes
+}
+
+// UpdateOrganizationRequest represents a request to update an organization
+type UpdateOrganizationRequest struct {
+	Name     string `json:"name" binding:"omitempty,max=255"`
+	IsActive *bool  `json:"is_active"`
+}
+
+// GetCurrentOrganization returns the organization of the request
+func (h *OrganizationHandler) GetCurrentOrganization(c *gin.Context) {
+	organization := auth.GetCurrentOrganization(c)
+	if organization == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	c.JSON(http.StatusOK, organization)
+}
+
+// ListOrganizations lists all organizations
+func (h *OrganizationHandler) ListOrganizations(c *gin.Context) {
+	organizations, err := h.organizationService.ListOrganizations()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list organizations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, organizations)
+}
+
+// GetOrganization retrieves a specific organization
+func (h *OrganizationHandler) GetOrganization(c *gin.Context) {
+	organizationID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID"})
+		return
+	}
+
+	organization := &models.Organization{}
+	if err := h.organizationService.GetOrganizationByID(organizationID, organization); err != nil {
+		if err == models.ErrOrganizationNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get organization"})
+		return
+	}
+
+	c.JSON(http.StatusOK, organization)
+}
+
+// CreateOrganization creates a new, active organization
+func (h *OrganizationHandler) CreateOrganization(c *gin.Context) {
+	var req CreateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !organizationSlugPattern.MatchString(req.Slug) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Slug must consist of lowercase letters, digits and dashes, and can't start or end with a dash"})
+		return
+	}
+
+	organization := &models.Organization{
+		Name:     strings.TrimSpace(req.Name),
+		Slug:     req.Slug,
+		IsActive: true,
+	}
+
+	if err := h.organizationService.CreateOrganization(organization); err != nil {
+		if err == models.ErrOrganizationSlugExists {
+			c.JSON(http.StatusConflict, gin.H{"error": "Organization slug already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create organization"})
+		return
+	}
+
+	// Store organization ID for audit logging
+	c.Set("resourceID", organization.ID)
+	c.Set("auditDetails", map[string]interface{}{"slug": organization.Slug})
+
+	c.JSON(http.StatusCreated, organization)
+}
+
+// UpdateOrganization updates the name of an organization, or deactivates
+// it. Users of a deactivated organization can't sign in to it.
+func (h *OrganizationHandler) UpdateOrganization(c *gin.Context) {
+	organizationID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID"})
+		return
+	}
+
+	var req UpdateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	organization := &models.Organization{}
+	if err := h.organizationService.GetOrganizationByID(organizationID, organization); err != nil {
+		if err == models.ErrOrganizationNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get organization"})
+		return
+	}
+
+	// Update fields
+	if name := strings.TrimSpace(req.Name); name != "" {
+		organization.Name = name
+	}
+	if req.IsActive != nil {
+		organization.IsActive = *req.IsActive
+	}
+
+	if err := h.organizationService.UpdateOrganization(organization); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update organization"})
+		return
+	}
+
+	// Store organization ID for audit logging
+	c.Set("resourceID", organization.ID)
+	c.Set("auditDetails", map[string]interface{}{
+		"name":      organization.Name,
+		"is_active": organization.IsActive,
+	})
+
+	c.JSON(http.StatusOK, organization)
+}
+
+// RegisterRoutes registers organization management routes
+func (h *OrganizationHandler) RegisterRoutes(router *gin.RouterGroup, middleware *auth.Middleware) {
+	organizations := router.Group("/organizations")
+	organizations.Use(middleware.RequireAuth())
+	{
+		organizations.GET("/current", h.GetCurrentOrganization)
+
+		// Organization management (super admin only)
+		admin := organizations.Group("")
+		admin.Use(middleware.RequireSuperAdmin())
+		{
+			admin.GET("", h.ListOrganizations)
+			admin.POST("", middleware.AuditLog("create_organization", "organization"), h.CreateOrganization)
+			admin.GET("/:id", h.GetOrganization)
+			admin.PUT("/:id", middleware.AuditLog("update_organization", "organization"), h.UpdateOrganization)
+		}
+	}
+}
@@ -15,8 +15,9 @@ import (
 // ResultsHandler handles results viewing and resources pages
 type ResultsHandler struct {
 	surveyService     *services.SurveyService
-	questionService   *models.QuestionService
 	assessmentService *models.AssessmentService
+	actionItemService *models.ActionItemService
+	targetService     *models.TargetService
 	rbacService       *models.RBACService
 	templates         *template.Template
 }
@@ -24,15 +25,17 @@ type ResultsHandler struct {
 // NewResultsHandler creates a new results handler
 func NewResultsHandler(
 	surveyService *services.SurveyService,
-	questionService *models.QuestionService,
 	assessmentService *models.AssessmentService,
+	actionItemService *models.ActionItemService,
+	targetService *models.TargetService,
 	rbacService *models.RBACService,
 	templates *template.Template,
 ) *ResultsHandler {
 	return &ResultsHandler{
 		surveyService:     surveyService,
-		questionService:   questionService,
 		assessmentService: assessmentService,
+		actionItemService: actionItemService,
+		targetService:     targetService,
 		rbacService:       rbacService,
 		templates:         templates,
 	}
@@ -45,6 +48,7 @@ type PageData struct {
 	ActivePage string
 	Survey     *models.Survey
 	NavBar     map[string]NavItem
+	CSRFToken  string
 }
 
 // NavItem represents a navigation menu item
@@ -61,13 +65,31 @@ type ResultsPageData struct {
 	Results    *services.AssessmentResults
 	Advice     map[string]models.Advice
 	ChartData  ChartData
+
+	// The weakest sections with their advice, set with results
+	ImprovementAreas []services.ImprovementArea
+
+	// Action items created from the assessment
+	ActionItems []models.ActionItem
 }
 
 // ChartData represents data for the chart visualization
 type ChartData struct {
 	Labels []string
 	Data   []float64
+	Levels []string // Maturity level of each label, like "3 - Defined"
 	Title  string
+
+	// Target percentage of each label, nil for labels without a target. Empty
+	// when the team has no targets.
+	Targets []*float64
+}
+
+// WorkshopPageData represents data for the consensus workshop page
+type WorkshopPageData struct {
+	PageData
+	Assessment *models.Assessment
+	Questions  []services.WorkshopQuestion
 }
 
 // ResourcesPageData represents data for the resources page
@@ -80,8 +102,13 @@ type ResourcesPageData struct {
 type DashboardPageData struct {
 	PageData
 	Teams       []models.Team
+	Templates   []models.QuestionnaireTemplate
 	Assessments []AssessmentSummary
 	Statistics  DashboardStats
+
+	// Open and in progress action items of the user's teams
+	ActionItems      []models.ActionItem
+	ActionItemCounts models.ActionItemCounts
 }
 
 // AssessmentSummary represents a summary of an assessment for display
@@ -103,9 +130,6 @@ type DashboardStats struct {
 func (h *ResultsHandler) Dashboard(c *gin.Context) {
 	user, _ := auth.GetCurrentUser(c)
 
-	// Get user teams
-	teams, _ := user.Teams, user.Groups
-
 	// Get recent assessments
 	var assessments []AssessmentSummary
 	for _, team := range user.Teams {
@@ -116,7 +140,7 @@ func (h *ResultsHandler) Dashboard(c *gin.Context) {
 				summary := AssessmentSummary{
 					Assessment:   assessment,
 					TeamName:     team.Team.Name,
-					OverallScore: calculateOverallScore(scores),
+					OverallScore: models.OverallScore(assessment.Scoring, scores),
 				}
 				assessments = append(assessments, summary)
 			}
@@ -126,11 +150,23 @@ func (h *ResultsHandler) Dashboard(c *gin.Context) {
 	// Calculate statistics
 	stats := h.calculateDashboardStats(assessments)
 
+	// Load the progress of the teams' action items
+	teamIDs := make([]int, len(user.Teams))
+	for i, membership := range user.Teams {
+		teamIDs[i] = membership.Team.ID
+	}
+	actionItems, _ := h.actionItemService.ListPendingActionItems(teamIDs)
+	actionItemCounts, _ := h.actionItemService.CountActionItems(teamIDs)
+
 	data := DashboardPageData{
-		PageData:    h.getPageData("Dashboard", user, "Dashboard"),
+		PageData:    h.getPageData(c, "Dashboard", user, "Dashboard", nil),
 		Teams:       extractTeams(user.Teams),
+		Templates:   h.surveyService.Templates(),
 		Assessments: assessments,
 		Statistics:  stats,
+
+		ActionItems:      actionItems,
+		ActionItemCounts: actionItemCounts,
 	}
 
 	c.HTML(http.StatusOK, "dashboard.html", data)
@@ -146,6 +182,7 @@ func (h *ResultsHandler) ViewResults(c *gin.Context) {
 
 	var assessment *models.Assessment
 	var results *services.AssessmentResults
+	var actionItems []models.ActionItem
 
 	if assessmentIDStr != "" {
 		// Load specific assessment
@@ -161,16 +198,9 @@ func (h *ResultsHandler) ViewResults(c *gin.Context) {
 			return
 		}
 
-		// Check permissions
-		user, _ := auth.GetCurrentUser(c)
-		if user != nil {
-			hasPermission, _ := h.rbacService.CheckTeamPermission(
-				user.ID, assessment.TeamID, models.ResourceAssessment, models.ActionRead,
-			)
-			if !hasPermission {
-				c.HTML(http.StatusForbidden, "error.html", gin.H{"error": "Access denied"})
-				return
-			}
+		// Results of an assessment are only shown to those who can read it
+		if !h.canReadAssessment(c, assessment) {
+			return
 		}
 
 		// Get results
@@ -179,23 +209,39 @@ func (h *ResultsHandler) ViewResults(c *gin.Context) {
 			c.HTML(http.StatusInternalServerError, "error.html", gin.H{"error": err.Error()})
 			return
 		}
+
+		actionItems, _ = h.actionItemService.ListAssessmentActionItems(assessmentID)
 	}
 
-	// Load advice
-	advice, _ := h.questionService.LoadAdvice()
+	// Load advice of the assessment's template for the levels reached
+	var advice map[string]models.Advice
+	var improvementAreas []services.ImprovementArea
+	if results != nil {
+		advice, _ = h.surveyService.ResultsAdvice(results)
+		improvementAreas = services.ImprovementAreas(results, advice)
+	} else {
+		advice, _ = h.surveyService.LoadAdvice(c.Query("template"))
+	}
 
 	// Prepare chart data
 	chartData := h.prepareChartData(results)
+	if assessment != nil {
+		targets, _ := h.targetService.ListTeamTargets(assessment.TeamID)
+		chartData.Targets = chartTargets(chartData.Labels, targets)
+	}
 
 	// Get current user
 	user, _ := auth.GetCurrentUser(c)
 
 	data := ResultsPageData{
-		PageData:   h.getPageData("Results", user, "Results"),
+		PageData:   h.getPageData(c, "Results", user, "Results", resultsSurvey(results)),
 		Assessment: assessment,
 		Results:    results,
 		Advice:     advice,
 		ChartData:  chartData,
+
+		ImprovementAreas: improvementAreas,
+		ActionItems:      actionItems,
 	}
 
 	c.HTML(http.StatusOK, "results.html", data)
@@ -230,16 +276,9 @@ func (h *ResultsHandler) ViewDetailedResults(c *gin.Context) {
 		return
 	}
 
-	// Check permissions
-	user, _ := auth.GetCurrentUser(c)
-	if user != nil {
-		hasPermission, _ := h.rbacService.CheckTeamPermission(
-			user.ID, assessment.TeamID, models.ResourceAssessment, models.ActionRead,
-		)
-		if !hasPermission {
-			c.HTML(http.StatusForbidden, "error.html", gin.H{"error": "Access denied"})
-			return
-		}
+	// Results of an assessment are only shown to those who can read it
+	if !h.canReadAssessment(c, assessment) {
+		return
 	}
 
 	// Get results
@@ -249,27 +288,74 @@ func (h *ResultsHandler) ViewDetailedResults(c *gin.Context) {
 		return
 	}
 
-	// Load advice
-	advice, _ := h.questionService.LoadAdvice()
+	// Load advice of the assessment's template for the levels reached
+	advice, _ := h.surveyService.ResultsAdvice(results)
+	improvementAreas := services.ImprovementAreas(results, advice)
 
 	// Prepare chart data for subcategories
 	chartData := h.prepareSubCategoryChartData(results, sectionName)
 
+	// Get current user
+	user, _ := auth.GetCurrentUser(c)
+
 	data := ResultsPageData{
-		PageData:   h.getPageData("Detailed Results - "+sectionName, user, "Detailed Reports"),
+		PageData:   h.getPageData(c, "Detailed Results - "+sectionName, user, "Detailed Reports", results.Survey),
 		Assessment: assessment,
 		Results:    results,
 		Advice:     advice,
 		ChartData:  chartData,
+
+		ImprovementAreas: improvementAreas,
 	}
 
 	c.HTML(http.StatusOK, "detailed-results.html", data)
 }
 
+// ViewWorkshop shows the facilitator's view of a collaborative assessment:
+// the questions respondents disagree on most first, where the agreed
+// answers are recorded
+func (h *ResultsHandler) ViewWorkshop(c *gin.Context) {
+	assessmentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "error.html", gin.H{"error": "Invalid assessment ID"})
+		return
+	}
+
+	assessment := &models.Assessment{}
+	if err := h.assessmentService.GetAssessmentByID(assessmentID, assessment); err != nil {
+		c.HTML(http.StatusNotFound, "error.html", gin.H{"error": "Assessment not found"})
+		return
+	}
+
+	if !h.canReadAssessment(c, assessment) {
+		return
+	}
+
+	questions, err := h.surveyService.GetWorkshop(assessment)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.html", gin.H{"error": "Failed to load workshop"})
+		return
+	}
+
+	user, _ := auth.GetCurrentUser(c)
+
+	data := WorkshopPageData{
+		PageData:   h.getPageData(c, "Workshop", user, "Dashboard", nil),
+		Assessment: assessment,
+		Questions:  questions,
+	}
+
+	c.HTML(http.StatusOK, "workshop.html", data)
+}
+
 // ViewResources shows the resources page
 func (h *ResultsHandler) ViewResources(c *gin.Context) {
-	// Load advice
-	advice, err := h.questionService.LoadAdvice()
+	// Load advice of the requested template
+	advice, err := h.surveyService.LoadAdvice(c.Query("template"))
+	if err == models.ErrTemplateNotFound {
+		c.HTML(http.StatusNotFound, "error.html", gin.H{"error": "Questionnaire template not found"})
+		return
+	}
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error.html", gin.H{"error": "Failed to load resources"})
 		return
@@ -279,7 +365,7 @@ func (h *ResultsHandler) ViewResources(c *gin.Context) {
 	user, _ := auth.GetCurrentUser(c)
 
 	data := ResourcesPageData{
-		PageData: h.getPageData("Resources", user, "Resources"),
+		PageData: h.getPageData(c, "Resources", user, "Resources", nil),
 		Advice:   advice,
 	}
 
@@ -288,10 +374,37 @@ func (h *ResultsHandler) ViewResources(c *gin.Context) {
 
 // Helper methods
 
-// getPageData returns common page data
-func (h *ResultsHandler) getPageData(title string, user *models.User, activePage string) PageData {
+// canReadAssessment checks that the current user may read an assessment.
+// Anonymous visitors are sent to the login page.
+func (h *ResultsHandler) canReadAssessment(c *gin.Context, assessment *models.Assessment) bool {
+	user, _ := auth.GetCurrentUser(c)
+	if user == nil {
+		c.Redirect(http.StatusFound, "/login")
+		return false
+	}
+
+	hasPermission, err := auth.CheckTeamPermission(
+		c, h.rbacService, user.ID, assessment.TeamID, models.ResourceAssessment, models.ActionRead,
+	)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.html", gin.H{"error": "Failed to check permissions"})
+		return false
+	}
+	if !hasPermission {
+		c.HTML(http.StatusForbidden, "error.html", gin.H{"error": "Access denied"})
+		return false
+	}
+
+	return true
+}
+
+// getPageData returns common page data. Navigation is built from the given
+// survey, or from the default template when survey is nil.
+func (h *ResultsHandler) getPageData(c *gin.Context, title string, user *models.User, activePage string, survey *models.Survey) PageData {
 	// Load survey for navigation
-	survey, _ := h.questionService.LoadQuestions()
+	if survey == nil {
+		survey, _ = h.surveyService.CurrentSurvey("")
+	}
 
 	// Build navigation
 	navBar := h.buildNavigation(survey)
@@ -302,6 +415,7 @@ func (h *ResultsHandler) getPageData(title string, user *models.User, activePage
 		ActivePage: activePage,
 		Survey:     survey,
 		NavBar:     navBar,
+		CSRFToken:  auth.GetCSRFToken(c),
 	}
 }
 
@@ -383,20 +497,43 @@ func (h *ResultsHandler) prepareChartData(results *services.AssessmentResults) C
 
 	var labels []string
 	var data []float64
+	var levels []string
 
 	// Sort by spider position for consistent display
 	for _, score := range results.SectionScores {
 		labels = append(labels, score.SectionName)
 		data = append(data, score.Percentage)
+		levels = append(levels, score.MaturityLevel().String())
 	}
 
 	return ChartData{
 		Labels: labels,
 		Data:   data,
+		Levels: levels,
 		Title:  "DevOps Maturity by Area",
 	}
 }
 
+// chartTargets lines up the targets of a team with the sections of a chart
+func chartTargets(labels []string, targets []models.TeamTarget) []*float64 {
+	if len(targets) == 0 {
+		return nil
+	}
+
+	percentages := make(map[string]float64, len(targets))
+	for _, target := range targets {
+		percentages[target.SectionName] = target.Percentage
+	}
+
+	chartTargets := make([]*float64, len(labels))
+	for i, label := range labels {
+		if percentage, ok := percentages[label]; ok {
+			chartTargets[i] = &percentage
+		}
+	}
+	return chartTargets
+}
+
 // prepareSubCategoryChartData prepares data for subcategory chart
 func (h *ResultsHandler) prepareSubCategoryChartData(results *services.AssessmentResults, sectionName string) ChartData {
 	if results == nil || results.SubCategoryScores == nil {
@@ -405,17 +542,20 @@ func (h *ResultsHandler) prepareSubCategoryChartData(results *services.Assessmen
 
 	var labels []string
 	var data []float64
+	var levels []string
 
 	if scores, exists := results.SubCategoryScores[sectionName]; exists {
 		for _, score := range scores {
 			labels = append(labels, score.SectionName)
 			data = append(data, score.Percentage)
+			levels = append(levels, score.MaturityLevel().String())
 		}
 	}
 
 	return ChartData{
 		Labels: labels,
 		Data:   data,
+		Levels: levels,
 		Title:  "Breakdown for " + sectionName,
 	}
 }
@@ -451,24 +591,11 @@ func (h *ResultsHandler) calculateDashboardStats(assessments []AssessmentSummary
 
 // Helper functions
 
-func calculateOverallScore(scores []models.SectionScore) float64 {
-	if len(scores) == 0 {
-		return 0
-	}
-
-	totalScore := 0.0
-	totalMaxScore := 0.0
-
-	for _, score := range scores {
-		totalScore += score.Score
-		totalMaxScore += score.MaxScore
-	}
-
-	if totalMaxScore == 0 {
-		return 0
+func resultsSurvey(results *services.AssessmentResults) *models.Survey {
+	if results == nil {
+		return nil
 	}
-
-	return (totalScore / totalMaxScore) * 100
+	return results.Survey
 }
 
 func extractTeams(memberships []models.TeamMembership) []models.Team {
@@ -495,5 +622,6 @@ func (h *ResultsHandler) RegisterRoutes(router *gin.RouterGroup, middleware *aut
 	protected.Use(middleware.RequireAuth())
 	{
 		protected.GET("/dashboard", h.Dashboard)
+		protected.GET("/assessments/:id/workshop", h.ViewWorkshop)
 	}
 }
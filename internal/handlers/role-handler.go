@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"devops-assessment/internal/auth"
+	"devops-assessment/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RoleHandler handles role and permission management endpoints
+type RoleHandler struct {
+	roleService *models.RoleService
+	rbacService *models.RBACService
+}
+
+// NewRoleHandler creates a new role handler
+func NewRoleHandler(roleService *models.RoleService, rbacService *models.RBACService) *RoleHandler {
+	return &RoleHandler{
+		roleService: roleService,
+		rbacService: rbacService,
+	}
+}
+
+// CreateRoleRequest represents a request to create a custom role
+type CreateRoleRequest struct {
+	Name        string   `json:"name" binding:"required,max=50"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"` // "resource:action" permissions
+}
+
+// UpdateRoleRequest represents a request to update a custom role
+type UpdateRoleRequest struct {
+	Name        string  `json:"name" binding:"omitempty,max=50"`
+	Description *string `json:"description"`
+}
+
+// GrantPermissionRequest represents a request to grant a permission to a role
+type GrantPermissionRequest struct {
+	Permission string `json:"permission" binding:"required"` // "resource:action"
+}
+
+// ListRoles lists all roles with their permissions
+func (h *RoleHandler) ListRoles(c *gin.Context) {
+	roles, err := h.roleService.ListRoles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+// ListPermissions lists the permissions that can be granted to roles
+func (h *RoleHandler) ListPermissions(c *gin.Context) {
+	permissions, err := h.roleService.ListPermissions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list permissions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, permissions)
+}
+
+// GetRole retrieves a role with its permissions
+func (h *RoleHandler) GetRole(c *gin.Context) {
+	roleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+		return
+	}
+
+	role, err := h.roleService.GetRoleByID(roleID)
+	if err != nil {
+		if err == models.ErrRoleNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get role"})
+		return
+	}
+
+	c.JSON(http.StatusOK, role)
+}
+
+// CreateRole creates a custom role
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+	var req CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !checkGrantable(c, h.rbacService, req.Permissions) {
+		return
+	}
+
+	role := &models.Role{
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+	}
+
+	if err := h.roleService.CreateRole(role, req.Permissions); err != nil {
+		h.roleError(c, err, "Failed to create role")
+		return
+	}
+
+	// Store role ID for audit logging
+	c.Set("resourceID", role.ID)
+	c.Set("auditDetails", map[string]interface{}{
+		"role":        role.Name,
+		"permissions": req.Permissions,
+	})
+
+	c.JSON(http.StatusCreated, role)
+}
+
+// UpdateRole updates the name and description of a custom role
+func (h *RoleHandler) UpdateRole(c *gin.Context) {
+	roleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+		return
+	}
+
+	var req UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, err := h.roleService.GetRoleByID(roleID)
+	if err != nil {
+		h.roleError(c, err, "Failed to get role")
+		return
+	}
+
+	previousName := role.Name
+
+	// Update fields
+	if name := strings.TrimSpace(req.Name); name != "" {
+		role.Name = name
+	}
+	if req.Description != nil {
+		role.Description = *req.Description
+	}
+
+	if err := h.roleService.UpdateRole(role); err != nil {
+		h.roleError(c, err, "Failed to update role")
+		return
+	}
+
+	// Store role ID for audit logging
+	c.Set("resourceID", role.ID)
+	c.Set("auditDetails", map[string]interface{}{
+		"role":          role.Name,
+		"previous_name": previousName,
+	})
+
+	c.JSON(http.StatusOK, role)
+}
+
+// DeleteRole deletes a custom role that isn't assigned to anyone
+func (h *RoleHandler) DeleteRole(c *gin.Context) {
+	roleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+		return
+	}
+
+	role, err := h.roleService.GetRoleByID(roleID)
+	if err != nil {
+		h.roleError(c, err, "Failed to get role")
+		return
+	}
+
+	if err := h.roleService.DeleteRole(roleID); err != nil {
+		h.roleError(c, err, "Failed to delete role")
+		return
+	}
+
+	// Store role ID for audit logging
+	c.Set("resourceID", roleID)
+	c.Set("auditDetails", map[string]interface{}{"role": role.Name})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted successfully"})
+}
+
+// GrantPermission grants a permission to a custom role
+func (h *RoleHandler) GrantPermission(c *gin.Context) {
+	roleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+		return
+	}
+
+	var req GrantPermissionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resource, action, ok := strings.Cut(req.Permission, ":")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Permission must have the form resource:action"})
+		return
+	}
+
+	if !checkGrantable(c, h.rbacService, []string{req.Permission}) {
+		return
+	}
+
+	if err := h.roleService.GrantPermission(roleID, resource, action); err != nil {
+		h.roleError(c, err, "Failed to grant permission")
+		return
+	}
+
+	// Store role ID for audit logging
+	c.Set("resourceID", roleID)
+	c.Set("auditDetails", map[string]interface{}{"permission": req.Permission})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Permission granted successfully"})
+}
+
+// RevokePermission revokes a permission from a custom role
+func (h *RoleHandler) RevokePermission(c *gin.Context) {
+	roleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+		return
+	}
+
+	permission := c.Param("permission")
+	resource, action, ok := strings.Cut(permission, ":")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Permission must have the form resource:action"})
+		return
+	}
+
+	if err := h.roleService.RevokePermission(roleID, resource, action); err != nil {
+		if err == models.ErrPermissionNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role doesn't have this permission"})
+			return
+		}
+		h.roleError(c, err, "Failed to revoke permission")
+		return
+	}
+
+	// Store role ID for audit logging
+	c.Set("resourceID", roleID)
+	c.Set("auditDetails", map[string]interface{}{"permission": permission})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Permission revoked successfully"})
+}
+
+// checkGrantable checks that the current user holds every permission they
+// grant, so that role management and role assignment can't be used to
+// escalate privileges. Organization and super admins hold every permission.
+func checkGrantable(c *gin.Context, rbacService *models.RBACService, permissions []string) bool {
+	if len(permissions) == 0 {
+		return true
+	}
+
+	user, err := auth.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return false
+	}
+	if user.IsSuperAdmin || user.IsOrgAdmin {
+		return true
+	}
+
+	held, err := rbacService.GetUserPermissions(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return false
+	}
+
+	heldNames := make(map[string]bool, len(held))
+	for _, permission := range held {
+		heldNames[permission.Resource+":"+permission.Action] = true
+	}
+
+	for _, permission := range permissions {
+		if !heldNames[permission] {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only grant permissions you have: " + permission})
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkRoleAssignable checks that the current user holds every permission
+// of a role they assign to someone
+func checkRoleAssignable(c *gin.Context, rbacService *models.RBACService, role *models.Role) bool {
+	permissions := make([]string, len(role.Permissions))
+	for i, permission := range role.Permissions {
+		permissions[i] = permission.Resource + ":" + permission.Action
+	}
+
+	return checkGrantable(c, rbacService, permissions)
+}
+
+// roleError writes the response for a role service error
+func (h *RoleHandler) roleError(c *gin.Context, err error, message string) {
+	switch {
+	case err == models.ErrRoleNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+	case err == models.ErrRoleBuiltin:
+		c.JSON(http.StatusForbidden, gin.H{"error": "Built-in roles cannot be modified"})
+	case err == models.ErrRoleNameExists:
+		c.JSON(http.StatusConflict, gin.H{"error": "Role name already exists"})
+	case err == models.ErrRoleInUse:
+		c.JSON(http.StatusConflict, gin.H{"error": "Role is still assigned to team or group members"})
+	case errors.Is(err, models.ErrPermissionNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// RegisterRoutes registers role management routes
+func (h *RoleHandler) RegisterRoutes(router *gin.RouterGroup, middleware *auth.Middleware) {
+	roles := router.Group("/roles")
+	roles.Use(middleware.RequireAuth())
+	{
+		read := roles.Group("")
+		read.Use(middleware.RequirePermission(models.ResourceRole, models.ActionRead))
+		{
+			read.GET("", h.ListRoles)
+			read.GET("/permissions", h.ListPermissions)
+			read.GET("/:id", h.GetRole)
+		}
+
+		// Roles are shared by all organizations, so only super admins
+		// can change them
+		create := roles.Group("")
+		create.Use(middleware.RequireSuperAdmin(), middleware.RequirePermission(models.ResourceRole, models.ActionCreate))
+		{
+			create.POST("", middleware.AuditLog("create_role", "role"), h.CreateRole)
+		}
+
+		update := roles.Group("")
+		update.Use(middleware.RequireSuperAdmin(), middleware.RequirePermission(models.ResourceRole, models.ActionUpdate))
+		{
+			update.PUT("/:id", middleware.AuditLog("update_role", "role"), h.UpdateRole)
+			update.POST("/:id/permissions", middleware.AuditLog("grant_role_permission", "role"), h.GrantPermission)
+			update.DELETE("/:id/permissions/:permission", middleware.AuditLog("revoke_role_permission", "role"), h.RevokePermission)
+		}
+
+		remove := roles.Group("")
+		remove.Use(middleware.RequireSuperAdmin(), middleware.RequirePermission(models.ResourceRole, models.ActionDelete))
+		{
+			remove.DELETE("/:id", middleware.AuditLog("delete_role", "role"), h.DeleteRole)
+		}
+	}
+}
@@ -2,9 +2,12 @@ package handlers
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"devops-assessment/internal/auth"
 	"devops-assessment/internal/models"
@@ -16,29 +19,56 @@ import (
 // SurveyHandler handles survey-related endpoints
 type SurveyHandler struct {
 	surveyService     *services.SurveyService
-	questionService   *models.QuestionService
 	assessmentService *models.AssessmentService
+	respondentService *models.RespondentService
+	revisionService   *models.RevisionService
 	rbacService       *models.RBACService
 }
 
 // NewSurveyHandler creates a new survey handler
 func NewSurveyHandler(
 	surveyService *services.SurveyService,
-	questionService *models.QuestionService,
 	assessmentService *models.AssessmentService,
+	respondentService *models.RespondentService,
+	revisionService *models.RevisionService,
 	rbacService *models.RBACService,
 ) *SurveyHandler {
 	return &SurveyHandler{
 		surveyService:     surveyService,
-		questionService:   questionService,
 		assessmentService: assessmentService,
+		respondentService: respondentService,
+		revisionService:   revisionService,
 		rbacService:       rbacService,
 	}
 }
 
 // StartAssessmentRequest represents a request to start a new assessment
 type StartAssessmentRequest struct {
-	TeamID int `json:"team_id" binding:"required"`
+	TeamID      int    `json:"team_id" binding:"required"`
+	TemplateID  string `json:"template_id"` // Defaults to the default template
+	Aggregation string `json:"aggregation"` // mean (default), median or consensus
+
+	// Pre-fill the assessment with the responses of a previous assessment of
+	// the team, by default the latest completed one
+	Clone       bool `json:"clone"`
+	CloneFromID int  `json:"clone_from_id"` // Implies clone
+}
+
+// ReopenAssessmentRequest represents a request to reopen a completed
+// assessment
+type ReopenAssessmentRequest struct {
+	Reason string `json:"reason" binding:"max=2000"`
+}
+
+// SetAggregationRequest represents a request to change how the answers of
+// respondents are combined
+type SetAggregationRequest struct {
+	Aggregation string `json:"aggregation" binding:"required"`
+}
+
+// AddRespondentRequest represents a request to invite a respondent
+type AddRespondentRequest struct {
+	UserID int `json:"user_id" binding:"required"`
 }
 
 // SaveResponsesRequest represents a request to save responses
@@ -46,6 +76,21 @@ type SaveResponsesRequest struct {
 	Responses map[string][]string `json:"responses"`
 }
 
+// AgreeAnswerRequest represents a request to record the answer respondents
+// agreed on
+type AgreeAnswerRequest struct {
+	AnswerIDs []string `json:"answer_ids"` // Exactly one for option questions
+	Note      string   `json:"note" binding:"max=2000"`
+}
+
+// TemplateResponse represents a questionnaire template in API responses
+type TemplateResponse struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Default     bool   `json:"default"`
+}
+
 // StartAssessment starts a new assessment
 func (h *SurveyHandler) StartAssessment(c *gin.Context) {
 	var req StartAssessmentRequest
@@ -62,8 +107,8 @@ func (h *SurveyHandler) StartAssessment(c *gin.Context) {
 	}
 
 	// Check if user has permission to create assessments for this team
-	hasPermission, err := h.rbacService.CheckTeamPermission(
-		user.ID, req.TeamID, models.ResourceAssessment, models.ActionCreate,
+	hasPermission, err := auth.CheckTeamPermission(
+		c, h.rbacService, user.ID, req.TeamID, models.ResourceAssessment, models.ActionCreate,
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
@@ -74,8 +119,32 @@ func (h *SurveyHandler) StartAssessment(c *gin.Context) {
 		return
 	}
 
-	// Start assessment
-	assessment, survey, err := h.surveyService.StartAssessment(req.TeamID, user.ID)
+	// Start assessment, cloning copies the previous responses, which needs
+	// access to them
+	var assessment *models.Assessment
+	var survey *models.Survey
+	if req.Clone || req.CloneFromID != 0 {
+		if !checkTeamPermission(c, h.rbacService, req.TeamID, models.ResourceAssessment, models.ActionRead) {
+			return
+		}
+		assessment, survey, err = h.surveyService.CloneAssessment(
+			req.TeamID, user.ID, req.TemplateID, req.Aggregation, req.CloneFromID,
+		)
+	} else {
+		assessment, survey, err = h.surveyService.StartAssessment(req.TeamID, user.ID, req.TemplateID, req.Aggregation)
+	}
+	if err == models.ErrAssessmentNotFound || err == models.ErrCloneOtherTeam {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Can only clone an assessment of the same team"})
+		return
+	}
+	if err == models.ErrTemplateNotFound {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown questionnaire template"})
+		return
+	}
+	if err == models.ErrInvalidAggregation {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Aggregation must be mean, median or consensus"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -83,6 +152,11 @@ func (h *SurveyHandler) StartAssessment(c *gin.Context) {
 
 	// Store assessment ID for audit logging
 	c.Set("resourceID", assessment.ID)
+	if assessment.ClonedFromID != 0 {
+		c.Set("auditDetails", map[string]interface{}{
+			"cloned_from_id": assessment.ClonedFromID,
+		})
+	}
 
 	c.JSON(http.StatusCreated, gin.H{
 		"assessment": assessment,
@@ -92,193 +166,419 @@ func (h *SurveyHandler) StartAssessment(c *gin.Context) {
 
 // GetAssessment retrieves an assessment with its current state
 func (h *SurveyHandler) GetAssessment(c *gin.Context) {
-	// Get assessment ID from URL
-	assessmentID, err := strconv.Atoi(c.Param("id"))
+	assessmentID := requestAssessment(c).ID
+
+	// Continue assessment
+	assessment, survey, err := h.surveyService.ContinueAssessment(assessmentID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assessment ID"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Get current user
-	user, err := auth.GetCurrentUser(c)
+	// Include respondents, so the facilitator can follow their progress
+	assessment.Respondents, err = h.respondentService.ListRespondents(assessmentID)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list respondents"})
 		return
 	}
 
-	// Load assessment
-	assessment := &models.Assessment{}
-	if err := h.assessmentService.GetAssessmentByID(assessmentID, assessment); err != nil {
-		if err == models.ErrAssessmentNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Assessment not found"})
+	c.JSON(http.StatusOK, gin.H{
+		"assessment": assessment,
+		"survey":     survey,
+		"editable":   assessment.Editable(),
+	})
+}
+
+// SaveResponses saves responses for a section
+func (h *SurveyHandler) SaveResponses(c *gin.Context) {
+	assessment := requestAssessment(c)
+
+	// Get section name from URL
+	sectionName := c.Param("section")
+	if sectionName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Section name required"})
+		return
+	}
+
+	// Check if assessment can be edited
+	if !assessment.Editable() {
+		notEditable(c, assessment)
+		return
+	}
+
+	// Parse form data
+	var req SaveResponsesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Save responses
+	if err := h.surveyService.SaveResponses(assessment.ID, sectionName, req.Responses); err != nil {
+		if err == models.ErrAnsweredByRespondents {
+			c.JSON(http.StatusConflict, gin.H{"error": "This assessment is answered by its respondents"})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load assessment"})
+		if err == models.ErrNotEditable {
+			notEditable(c, assessment)
+			return
+		}
+		invalidResponses(c, err)
 		return
 	}
 
-	// Check if user has permission to view this assessment
-	hasPermission, err := h.rbacService.CheckTeamPermission(
-		user.ID, assessment.TeamID, models.ResourceAssessment, models.ActionRead,
-	)
+	c.JSON(http.StatusOK, gin.H{"message": "Responses saved successfully"})
+}
+
+// CompleteAssessment completes an assessment and calculates results. A
+// reopened assessment is re-scored.
+func (h *SurveyHandler) CompleteAssessment(c *gin.Context) {
+	assessment := requestAssessment(c)
+
+	user, err := auth.GetCurrentUser(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
 		return
 	}
-	if !hasPermission {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+
+	// Calculate and save results
+	results, err := h.surveyService.CalculateResults(assessment.ID, user.ID)
+	if err == models.ErrNoSubmittedResponses {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No respondent has submitted answers yet"})
+		return
+	}
+	if err == models.ErrInvalidTransition {
+		invalidTransition(c, assessment, models.StatusCompleted)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Continue assessment
-	assessment, survey, err := h.surveyService.ContinueAssessment(assessmentID)
+	// Load advice of the assessment's template for the levels reached
+	advice, err := h.surveyService.ResultsAdvice(results)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load advice"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Assessment completed successfully",
+		"results": results,
+		"advice":  advice,
+	})
+}
+
+// GetResults retrieves results for a completed assessment
+func (h *SurveyHandler) GetResults(c *gin.Context) {
+	assessment := requestAssessment(c)
+
+	// Get results
+	results, err := h.surveyService.GetAssessmentResults(assessment.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	// Load advice of the assessment's template for the levels reached
+	advice, err := h.surveyService.ResultsAdvice(results)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load advice"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"assessment": assessment,
-		"survey":     survey,
+		"results":    results,
+		"advice":     advice,
 	})
 }
 
-// SaveResponses saves responses for a section
-func (h *SurveyHandler) SaveResponses(c *gin.Context) {
-	// Get assessment ID from URL
-	assessmentID, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assessment ID"})
+// ExportCSV exports assessment results as CSV
+func (h *SurveyHandler) ExportCSV(c *gin.Context) {
+	assessmentID := requestAssessment(c).ID
+
+	// Create CSV buffer
+	var buf bytes.Buffer
+	if err := h.surveyService.ExportAssessmentCSV(assessmentID, &buf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Get section name from URL
-	sectionName := c.Param("section")
-	if sectionName == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Section name required"})
+	// Set headers for CSV download
+	filename := fmt.Sprintf("devops-assessment-%d.csv", assessmentID)
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	c.Data(http.StatusOK, "text/csv", buf.Bytes())
+}
+
+// GetTeamAssessments gets all assessments for a team
+func (h *SurveyHandler) GetTeamAssessments(c *gin.Context) {
+	// Get team ID from URL
+	teamID, err := strconv.Atoi(c.Param("teamId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
 		return
 	}
 
-	// Get current user
-	user, err := auth.GetCurrentUser(c)
+	// Get assessment history
+	history, err := h.surveyService.GetTeamAssessmentHistory(teamID)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Load assessment
-	assessment := &models.Assessment{}
-	if err := h.assessmentService.GetAssessmentByID(assessmentID, assessment); err != nil {
-		if err == models.ErrAssessmentNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Assessment not found"})
+	c.JSON(http.StatusOK, history)
+}
+
+// SetAggregation changes how the answers of respondents are combined
+func (h *SurveyHandler) SetAggregation(c *gin.Context) {
+	assessment := requestAssessment(c)
+
+	if !assessment.Editable() {
+		notEditable(c, assessment)
+		return
+	}
+
+	var req SetAggregationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.assessmentService.SetAggregation(assessment.ID, req.Aggregation); err != nil {
+		if err == models.ErrInvalidAggregation {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Aggregation must be mean, median or consensus"})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load assessment"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set aggregation"})
 		return
 	}
 
-	// Check if user has permission to update this assessment
-	hasPermission, err := h.rbacService.CheckTeamPermission(
-		user.ID, assessment.TeamID, models.ResourceAssessment, models.ActionUpdate,
-	)
+	// Store assessment ID for audit logging
+	c.Set("resourceID", assessment.ID)
+	c.Set("auditDetails", map[string]interface{}{"aggregation": req.Aggregation})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Aggregation updated successfully"})
+}
+
+// ListRespondents lists the respondents of an assessment
+func (h *SurveyHandler) ListRespondents(c *gin.Context) {
+	respondents, err := h.respondentService.ListRespondents(requestAssessment(c).ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
-		return
-	}
-	if !hasPermission {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list respondents"})
 		return
 	}
 
-	// Check if assessment is still in progress
-	if assessment.Status != models.StatusInProgress {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Assessment is already completed"})
+	c.JSON(http.StatusOK, respondents)
+}
+
+// AddRespondent invites a member of the organization to answer an
+// assessment separately
+func (h *SurveyHandler) AddRespondent(c *gin.Context) {
+	assessment := requestAssessment(c)
+
+	if !assessment.Editable() {
+		notEditable(c, assessment)
 		return
 	}
 
-	// Parse form data
-	var req SaveResponsesRequest
+	var req AddRespondentRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Save responses
-	if err := h.surveyService.SaveResponses(assessmentID, sectionName, req.Responses); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	// Get current user
+	user, err := auth.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Responses saved successfully"})
+	respondent := &models.Respondent{
+		AssessmentID: assessment.ID,
+		UserID:       req.UserID,
+		InvitedBy:    user.ID,
+	}
+
+	if err := h.respondentService.AddRespondent(respondent); err != nil {
+		switch err {
+		case models.ErrOrganizationMismatch:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "User not found"})
+		case models.ErrRespondentExists:
+			c.JSON(http.StatusConflict, gin.H{"error": "User is already a respondent"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add respondent"})
+		}
+		return
+	}
+
+	// Store assessment ID for audit logging
+	c.Set("resourceID", assessment.ID)
+	c.Set("auditDetails", map[string]interface{}{"user_id": req.UserID})
+
+	c.JSON(http.StatusCreated, respondent)
 }
 
-// CompleteAssessment completes an assessment and calculates results
-func (h *SurveyHandler) CompleteAssessment(c *gin.Context) {
-	// Get assessment ID from URL
-	assessmentID, err := strconv.Atoi(c.Param("id"))
+// RemoveRespondent removes a respondent and their answers from an
+// assessment
+func (h *SurveyHandler) RemoveRespondent(c *gin.Context) {
+	assessment := requestAssessment(c)
+
+	if !assessment.Editable() {
+		notEditable(c, assessment)
+		return
+	}
+
+	userID, err := strconv.Atoi(c.Param("userId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assessment ID"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
 		return
 	}
 
-	// Get current user
+	if err := h.respondentService.RemoveRespondent(assessment.ID, userID); err != nil {
+		if err == models.ErrRespondentNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Respondent not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove respondent"})
+		return
+	}
+
+	// Store assessment ID for audit logging
+	c.Set("resourceID", assessment.ID)
+	c.Set("auditDetails", map[string]interface{}{"user_id": userID})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Respondent removed successfully"})
+}
+
+// GetAssignedAssessments lists the assessments in progress the current user
+// is a respondent of
+func (h *SurveyHandler) GetAssignedAssessments(c *gin.Context) {
 	user, err := auth.GetCurrentUser(c)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
 		return
 	}
 
-	// Load assessment
-	assessment := &models.Assessment{}
-	if err := h.assessmentService.GetAssessmentByID(assessmentID, assessment); err != nil {
-		if err == models.ErrAssessmentNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Assessment not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load assessment"})
+	if !auth.TokenAllows(c, "assessment", "read") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API token lacks the required scope"})
 		return
 	}
 
-	// Check if user has permission to update this assessment
-	hasPermission, err := h.rbacService.CheckTeamPermission(
-		user.ID, assessment.TeamID, models.ResourceAssessment, models.ActionUpdate,
-	)
+	assessments, err := h.respondentService.ListUserAssessments(user.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list assessments"})
 		return
 	}
-	if !hasPermission {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+
+	c.JSON(http.StatusOK, assessments)
+}
+
+// GetRespondentSurvey retrieves the survey of an assessment with the
+// current user's answers
+func (h *SurveyHandler) GetRespondentSurvey(c *gin.Context) {
+	assessment, respondent, ok := h.requestRespondent(c, "read")
+	if !ok {
 		return
 	}
 
-	// Calculate and save results
-	results, err := h.surveyService.CalculateResults(assessmentID)
+	survey, err := h.surveyService.ContinueRespondent(assessment, respondent)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Load advice
-	advice, err := h.questionService.LoadAdvice()
+	c.JSON(http.StatusOK, gin.H{
+		"assessment": assessment,
+		"respondent": respondent,
+		"survey":     survey,
+	})
+}
+
+// SaveRespondentResponses saves the current user's answers for a section.
+// Answers can be changed after submitting them, until the round is closed.
+func (h *SurveyHandler) SaveRespondentResponses(c *gin.Context) {
+	assessment, respondent, ok := h.requestRespondent(c, "update")
+	if !ok {
+		return
+	}
+
+	sectionName := c.Param("section")
+	if sectionName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Section name required"})
+		return
+	}
+
+	var req SaveResponsesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.surveyService.SaveRespondentResponses(assessment, respondent, sectionName, req.Responses); err != nil {
+		if err == models.ErrNotEditable {
+			notEditable(c, assessment)
+			return
+		}
+		invalidResponses(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Responses saved successfully"})
+}
+
+// SubmitRespondentResponses submits the current user's answers, so that
+// they are counted when the round is closed
+func (h *SurveyHandler) SubmitRespondentResponses(c *gin.Context) {
+	assessment, respondent, ok := h.requestRespondent(c, "update")
+	if !ok {
+		return
+	}
+
+	if err := h.respondentService.Submit(respondent.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit responses"})
+		return
+	}
+
+	// Store assessment ID for audit logging
+	c.Set("resourceID", assessment.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Responses submitted successfully"})
+}
+
+// GetWorkshop lists the questions of a collaborative assessment with the
+// respondents' answers, those they disagree on most first
+func (h *SurveyHandler) GetWorkshop(c *gin.Context) {
+	assessment := requestAssessment(c)
+
+	questions, err := h.surveyService.GetWorkshop(assessment)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load advice"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load workshop"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Assessment completed successfully",
-		"results": results,
-		"advice":  advice,
+		"assessment": assessment,
+		"questions":  questions,
 	})
 }
 
-// GetResults retrieves results for a completed assessment
-func (h *SurveyHandler) GetResults(c *gin.Context) {
-	// Get assessment ID from URL
-	assessmentID, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assessment ID"})
+// AgreeAnswer records the answer respondents agreed on for a question, with
+// a note. It replaces the aggregated answers in the assessment's scores.
+func (h *SurveyHandler) AgreeAnswer(c *gin.Context) {
+	assessment := requestAssessment(c)
+
+	if !assessment.Editable() {
+		notEditable(c, assessment)
+		return
+	}
+
+	var req AgreeAnswerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -289,142 +589,298 @@ func (h *SurveyHandler) GetResults(c *gin.Context) {
 		return
 	}
 
-	// Load assessment
-	assessment := &models.Assessment{}
-	if err := h.assessmentService.GetAssessmentByID(assessmentID, assessment); err != nil {
-		if err == models.ErrAssessmentNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Assessment not found"})
-			return
+	answer := &models.AgreedAnswer{
+		QuestionID: c.Param("questionId"),
+		AnswerIDs:  req.AnswerIDs,
+		Note:       strings.TrimSpace(req.Note),
+		AgreedBy:   user.ID,
+	}
+	if answer.AnswerIDs == nil {
+		answer.AnswerIDs = []string{}
+	}
+
+	if err := h.surveyService.AgreeAnswer(assessment, answer); err != nil {
+		switch {
+		case errors.Is(err, models.ErrQuestionNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Question not found"})
+		case errors.Is(err, models.ErrInvalidAgreedAnswer):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case err == models.ErrNoRespondents:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Only assessments with respondents have agreed answers"})
+		case err == models.ErrNotEditable:
+			notEditable(c, assessment)
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save agreed answer"})
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load assessment"})
 		return
 	}
 
-	// Check if user has permission to view this assessment
-	hasPermission, err := h.rbacService.CheckTeamPermission(
-		user.ID, assessment.TeamID, models.ResourceAssessment, models.ActionRead,
-	)
+	// Store assessment ID for audit logging
+	c.Set("resourceID", assessment.ID)
+	c.Set("auditDetails", map[string]interface{}{
+		"question_id": answer.QuestionID,
+		"answer_ids":  answer.AnswerIDs,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Agreed answer saved successfully"})
+}
+
+// ListTemplates lists the questionnaire templates assessments can be started with
+func (h *SurveyHandler) ListTemplates(c *gin.Context) {
+	defaultTemplate, err := h.surveyService.GetTemplate("")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load templates"})
 		return
 	}
-	if !hasPermission {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
-		return
+
+	templates := h.surveyService.Templates()
+	response := make([]TemplateResponse, 0, len(templates))
+	for _, template := range templates {
+		response = append(response, TemplateResponse{
+			ID:          template.ID,
+			Name:        template.Name,
+			Description: template.Description,
+			Default:     template.ID == defaultTemplate.ID,
+		})
 	}
 
-	// Get results
-	results, err := h.surveyService.GetAssessmentResults(assessmentID)
+	c.JSON(http.StatusOK, response)
+}
+
+// assessmentTeam resolves the team of the assessment in the id parameter,
+// and keeps the assessment for the handler
+func (h *SurveyHandler) assessmentTeam(c *gin.Context) (int, error) {
+	return resolveAssessmentTeam(c, h.assessmentService)
+}
+
+// resolveAssessmentTeam loads the assessment in the id parameter for
+// requestAssessment and returns its team
+func resolveAssessmentTeam(c *gin.Context, assessmentService *models.AssessmentService) (int, error) {
+	assessmentID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		return 0, auth.ErrInvalidResourceID
 	}
 
-	// Load advice
-	advice, err := h.questionService.LoadAdvice()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load advice"})
-		return
+	assessment := &models.Assessment{}
+	if err := assessmentService.GetAssessmentByID(assessmentID, assessment); err != nil {
+		if err == models.ErrAssessmentNotFound {
+			return 0, auth.ErrResourceNotFound
+		}
+		return 0, err
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"assessment": assessment,
-		"results":    results,
-		"advice":     advice,
-	})
+	c.Set("assessment", assessment)
+	return assessment.TeamID, nil
 }
 
-// ExportCSV exports assessment results as CSV
-func (h *SurveyHandler) ExportCSV(c *gin.Context) {
-	// Get assessment ID from URL
+// requestRespondent loads the assessment in the id parameter and the
+// current user's respondent in it, for a request that needs the assessment
+// scope with the given action. Assessments the user isn't a respondent of
+// are reported as not found.
+func (h *SurveyHandler) requestRespondent(c *gin.Context, action string) (*models.Assessment, *models.Respondent, bool) {
+	// Respondents need no permission on the assessment, but API tokens are
+	// still limited to their scopes
+	if !auth.TokenAllows(c, "assessment", action) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API token lacks the required scope"})
+		return nil, nil, false
+	}
+
 	assessmentID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assessment ID"})
-		return
+		return nil, nil, false
 	}
 
-	// Get current user
 	user, err := auth.GetCurrentUser(c)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
-		return
+		return nil, nil, false
+	}
+
+	respondent := &models.Respondent{}
+	if err := h.respondentService.GetRespondent(assessmentID, user.ID, respondent); err != nil {
+		if err == models.ErrRespondentNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Assessment not found"})
+			return nil, nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get respondent"})
+		return nil, nil, false
 	}
 
-	// Load assessment
 	assessment := &models.Assessment{}
 	if err := h.assessmentService.GetAssessmentByID(assessmentID, assessment); err != nil {
-		if err == models.ErrAssessmentNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Assessment not found"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get assessment"})
+		return nil, nil, false
+	}
+
+	if !assessment.Editable() {
+		notEditable(c, assessment)
+		return nil, nil, false
+	}
+
+	return assessment, respondent, true
+}
+
+// SubmitAssessment submits an assessment for completion. It can't be edited
+// until it is returned.
+func (h *SurveyHandler) SubmitAssessment(c *gin.Context) {
+	assessment := requestAssessment(c)
+
+	if err := h.surveyService.SubmitAssessment(assessment); err != nil {
+		if err == models.ErrInvalidTransition {
+			invalidTransition(c, assessment, models.StatusSubmitted)
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load assessment"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit assessment"})
 		return
 	}
 
-	// Check if user has permission to export this assessment
-	hasPermission, err := h.rbacService.CheckTeamPermission(
-		user.ID, assessment.TeamID, models.ResourceReport, models.ActionExport,
-	)
+	c.JSON(http.StatusOK, gin.H{"message": "Assessment submitted successfully"})
+}
+
+// ReturnAssessment returns a submitted assessment for changes
+func (h *SurveyHandler) ReturnAssessment(c *gin.Context) {
+	assessment := requestAssessment(c)
+
+	if err := h.surveyService.ReturnAssessment(assessment); err != nil {
+		if err == models.ErrInvalidTransition {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Only submitted assessments can be returned"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to return assessment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Assessment returned for changes"})
+}
+
+// ReopenAssessment reopens a completed assessment to amend it
+func (h *SurveyHandler) ReopenAssessment(c *gin.Context) {
+	assessment := requestAssessment(c)
+
+	// The reason is optional, and so is the body
+	var req ReopenAssessmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := auth.GetCurrentUser(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
 		return
 	}
-	if !hasPermission {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+
+	revision, err := h.surveyService.ReopenAssessment(assessment, user.ID, strings.TrimSpace(req.Reason))
+	if err != nil {
+		if err == models.ErrInvalidTransition {
+			invalidTransition(c, assessment, models.StatusReopened)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reopen assessment"})
 		return
 	}
 
-	// Create CSV buffer
-	var buf bytes.Buffer
-	if err := h.surveyService.ExportAssessmentCSV(assessmentID, &buf); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	// Store revision for audit logging
+	c.Set("auditDetails", map[string]interface{}{
+		"revision": revision.Revision,
+		"reason":   revision.Reason,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Assessment reopened successfully",
+		"revision": revision.Revision,
+	})
+}
+
+// ArchiveAssessment archives a completed assessment
+func (h *SurveyHandler) ArchiveAssessment(c *gin.Context) {
+	assessment := requestAssessment(c)
+
+	if err := h.surveyService.ArchiveAssessment(assessment); err != nil {
+		if err == models.ErrInvalidTransition {
+			invalidTransition(c, assessment, models.StatusArchived)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to archive assessment"})
 		return
 	}
 
-	// Set headers for CSV download
-	filename := fmt.Sprintf("devops-assessment-%d.csv", assessmentID)
-	c.Header("Content-Type", "text/csv")
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
-	c.Data(http.StatusOK, "text/csv", buf.Bytes())
+	c.JSON(http.StatusOK, gin.H{"message": "Assessment archived successfully"})
 }
 
-// GetTeamAssessments gets all assessments for a team
-func (h *SurveyHandler) GetTeamAssessments(c *gin.Context) {
-	// Get team ID from URL
-	teamID, err := strconv.Atoi(c.Param("teamId"))
+// ListRevisions lists the revisions of an assessment with what changed in
+// each
+func (h *SurveyHandler) ListRevisions(c *gin.Context) {
+	revisions, err := h.revisionService.ListRevisions(requestAssessment(c).ID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list revisions"})
 		return
 	}
 
-	// Get current user
-	user, err := auth.GetCurrentUser(c)
+	c.JSON(http.StatusOK, revisions)
+}
+
+// GetRevision retrieves a revision of an assessment
+func (h *SurveyHandler) GetRevision(c *gin.Context) {
+	number, err := strconv.Atoi(c.Param("revision"))
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid revision"})
 		return
 	}
 
-	// Check if user has permission to view team assessments
-	hasPermission, err := h.rbacService.CheckTeamPermission(
-		user.ID, teamID, models.ResourceAssessment, models.ActionRead,
-	)
+	revision, err := h.revisionService.GetRevision(requestAssessment(c).ID, number)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		if err == models.ErrRevisionNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get revision"})
 		return
 	}
-	if !hasPermission {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+
+	c.JSON(http.StatusOK, revision)
+}
+
+// notEditable writes the error response for changes to an assessment that
+// can't be edited in its status
+func notEditable(c *gin.Context, assessment *models.Assessment) {
+	// The status changed after the assessment was loaded
+	if assessment.Editable() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Assessment can't be edited anymore, its status changed"})
 		return
 	}
 
-	// Get assessment history
-	history, err := h.surveyService.GetTeamAssessmentHistory(teamID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": fmt.Sprintf("Assessment can't be edited while %s", strings.ReplaceAll(assessment.Status, "_", " ")),
+	})
+}
+
+// invalidResponses writes the error response for responses that failed to
+// save: unknown sections and answers are the client's mistake
+func invalidResponses(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrUnknownSection):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrInvalidAnswer):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save responses"})
 	}
+}
 
-	c.JSON(http.StatusOK, history)
+// invalidTransition writes the error response for a status an assessment
+// can't move to from its status
+func invalidTransition(c *gin.Context, assessment *models.Assessment, to string) {
+	c.JSON(http.StatusConflict, gin.H{
+		"error": fmt.Sprintf("Assessment can't become %s while %s",
+			strings.ReplaceAll(to, "_", " "), strings.ReplaceAll(assessment.Status, "_", " ")),
+	})
+}
+
+// requestAssessment returns the assessment resolved by assessmentTeam
+func requestAssessment(c *gin.Context) *models.Assessment {
+	return c.MustGet("assessment").(*models.Assessment)
 }
 
 // RegisterRoutes registers survey routes
@@ -434,13 +890,45 @@ func (h *SurveyHandler) RegisterRoutes(router *gin.RouterGroup, middleware *auth
 	{
 		// Assessment operations
 		survey.POST("/start", middleware.AuditLog("create_assessment", "assessment"), h.StartAssessment)
-		survey.GET("/:id", h.GetAssessment)
-		survey.POST("/:id/sections/:section", h.SaveResponses)
-		survey.POST("/:id/complete", middleware.AuditLog("complete_assessment", "assessment"), h.CompleteAssessment)
-		survey.GET("/:id/results", h.GetResults)
-		survey.GET("/:id/export/csv", middleware.AuditLog("export_assessment", "assessment"), h.ExportCSV)
+		read := middleware.RequireResourceAccess(h.assessmentTeam, "assessment:read")
+		update := middleware.RequireResourceAccess(h.assessmentTeam, "assessment:update")
+		export := middleware.RequireResourceAccess(h.assessmentTeam, "report:export")
+
+		survey.GET("/:id", read, h.GetAssessment)
+		survey.POST("/:id/sections/:section", update, h.SaveResponses)
+		survey.POST("/:id/complete", update, middleware.AuditLog("complete_assessment", "assessment"), h.CompleteAssessment)
+		survey.POST("/:id/submit", update, middleware.AuditLog("submit_assessment", "assessment"), h.SubmitAssessment)
+		survey.POST("/:id/return", update, middleware.AuditLog("return_assessment", "assessment"), h.ReturnAssessment)
+		survey.POST("/:id/reopen", update, middleware.AuditLog("reopen_assessment", "assessment"), h.ReopenAssessment)
+		survey.POST("/:id/archive", update, middleware.AuditLog("archive_assessment", "assessment"), h.ArchiveAssessment)
+		survey.GET("/:id/revisions", read, h.ListRevisions)
+		survey.GET("/:id/revisions/:revision", read, h.GetRevision)
+		survey.GET("/:id/results", read, h.GetResults)
+		survey.GET("/:id/export/csv", export, middleware.AuditLog("export_assessment", "assessment"), h.ExportCSV)
+		survey.PUT("/:id/aggregation", update, middleware.AuditLog("set_aggregation", "assessment"), h.SetAggregation)
+
+		// Respondents of collaborative assessments
+		survey.GET("/:id/respondents", read, h.ListRespondents)
+		survey.POST("/:id/respondents", update, middleware.AuditLog("add_respondent", "assessment"), h.AddRespondent)
+		survey.DELETE("/:id/respondents/:userId", update, middleware.AuditLog("remove_respondent", "assessment"), h.RemoveRespondent)
+
+		// Consensus workshop
+		survey.GET("/:id/workshop", read, h.GetWorkshop)
+		survey.PUT("/:id/workshop/questions/:questionId", update, middleware.AuditLog("agree_answer", "assessment"), h.AgreeAnswer)
+
+		// Answering as a respondent
+		survey.GET("/assigned", h.GetAssignedAssessments)
+		survey.GET("/:id/respond", h.GetRespondentSurvey)
+		survey.POST("/:id/respond/sections/:section", h.SaveRespondentResponses)
+		survey.POST("/:id/respond/submit", middleware.AuditLog("submit_responses", "assessment"), h.SubmitRespondentResponses)
 
 		// Team assessments
-		survey.GET("/teams/:teamId", h.GetTeamAssessments)
+		survey.GET("/teams/:teamId", middleware.RequireTeamAccess("teamId", "assessment:read"), h.GetTeamAssessments)
+	}
+
+	templates := router.Group("/templates")
+	templates.Use(middleware.RequireAuth())
+	{
+		templates.GET("", h.ListTemplates)
 	}
 }
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"devops-assessment/internal/auth"
+	"devops-assessment/internal/models"
+	"devops-assessment/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TargetHandler handles team target and gap analysis endpoints
+type TargetHandler struct {
+	surveyService *services.SurveyService
+	targets       *models.TargetService
+}
+
+// NewTargetHandler creates a new target handler
+func NewTargetHandler(surveyService *services.SurveyService, targets *models.TargetService) *TargetHandler {
+	return &TargetHandler{
+		surveyService: surveyService,
+		targets:       targets,
+	}
+}
+
+// SetTargetRequest represents a request to set the target of a team for a
+// section
+type SetTargetRequest struct {
+	Percentage *float64 `json:"percentage" binding:"required"`
+	DueDate    string   `json:"due_date"` // YYYY-MM-DD, optional
+}
+
+// ListTargets lists the targets of a team
+func (h *TargetHandler) ListTargets(c *gin.Context) {
+	teamID, ok := teamParam(c)
+	if !ok {
+		return
+	}
+
+	targets, err := h.targets.ListTeamTargets(teamID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list targets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, targets)
+}
+
+// SetTarget sets the target of a team for the section in the URL
+func (h *TargetHandler) SetTarget(c *gin.Context) {
+	teamID, ok := teamParam(c)
+	if !ok {
+		return
+	}
+
+	var req SetTargetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	dueDate, ok := parseDueDate(c, req.DueDate)
+	if !ok {
+		return
+	}
+
+	user, err := auth.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	target := &models.TeamTarget{
+		TeamID:      teamID,
+		SectionName: c.Param("section"),
+		Percentage:  *req.Percentage,
+		DueDate:     dueDate,
+		CreatedBy:   user.ID,
+	}
+
+	if err := h.surveyService.SetTeamTarget(target); err != nil {
+		switch err {
+		case models.ErrSectionNotFound:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown section"})
+		case models.ErrInvalidTarget:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Targets must be between 0 and 100%"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set target"})
+		}
+		return
+	}
+
+	// Store team ID for audit logging
+	c.Set("resourceID", teamID)
+	c.Set("auditDetails", map[string]interface{}{
+		"section_name": target.SectionName,
+		"percentage":   target.Percentage,
+	})
+
+	c.JSON(http.StatusOK, target)
+}
+
+// DeleteTarget deletes the target of a team for the section in the URL
+func (h *TargetHandler) DeleteTarget(c *gin.Context) {
+	teamID, ok := teamParam(c)
+	if !ok {
+		return
+	}
+
+	sectionName := c.Param("section")
+	if err := h.targets.DeleteTarget(teamID, sectionName); err != nil {
+		if err == models.ErrTargetNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Target not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete target"})
+		return
+	}
+
+	// Store team ID for audit logging
+	c.Set("resourceID", teamID)
+	c.Set("auditDetails", map[string]interface{}{
+		"section_name": sectionName,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Target deleted successfully"})
+}
+
+// GetGapAnalysis compares the latest completed assessment of a team with
+// its targets
+func (h *TargetHandler) GetGapAnalysis(c *gin.Context) {
+	teamID, ok := teamParam(c)
+	if !ok {
+		return
+	}
+
+	analysis, err := h.surveyService.GetGapAnalysis(teamID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to analyze gaps"})
+		return
+	}
+
+	c.JSON(http.StatusOK, analysis)
+}
+
+// teamParam parses the team ID in the id parameter, and writes the error
+// response if it is invalid
+func teamParam(c *gin.Context) (int, bool) {
+	teamID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
+		return 0, false
+	}
+	return teamID, true
+}
+
+// RegisterRoutes registers team target routes
+func (h *TargetHandler) RegisterRoutes(router *gin.RouterGroup, middleware *auth.Middleware) {
+	teams := router.Group("/teams")
+	teams.Use(middleware.RequireAuth())
+	{
+		read := middleware.RequireTeamAccess("id", "assessment:read")
+		update := middleware.RequireTeamAccess("id", "team:update")
+
+		teams.GET("/:id/targets", read, h.ListTargets)
+		teams.PUT("/:id/targets/:section", update, middleware.AuditLog("set_target", "team"), h.SetTarget)
+		teams.DELETE("/:id/targets/:section", update, middleware.AuditLog("delete_target", "team"), h.DeleteTarget)
+		teams.GET("/:id/gap-analysis", read, h.GetGapAnalysis)
+	}
+}
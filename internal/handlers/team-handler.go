@@ -14,13 +14,19 @@ import (
 type TeamHandler struct {
 	teamService  *models.TeamService
 	groupService *models.GroupService
+	rbacService  *models.RBACService
 }
 
 // NewTeamHandler creates a new team handler
-func NewTeamHandler(teamService *models.TeamService, groupService *models.GroupService) *TeamHandler {
+func NewTeamHandler(
+	teamService *models.TeamService,
+	groupService *models.GroupService,
+	rbacService *models.RBACService,
+) *TeamHandler {
 	return &TeamHandler{
 		teamService:  teamService,
 		groupService: groupService,
+		rbacService:  rbacService,
 	}
 }
 
@@ -42,6 +48,12 @@ type UpdateTeamRequest struct {
 type CreateGroupRequest struct {
 	Name        string `json:"name" binding:"required"`
 	Description string `json:"description"`
+	ParentID    int    `json:"parent_id"`
+}
+
+// MoveGroupRequest represents a request to move a group under another group
+type MoveGroupRequest struct {
+	ParentID *int `json:"parent_id"` // null moves the group to the top level
 }
 
 // UpdateGroupRequest represents a request to update a group
@@ -76,8 +88,21 @@ func (h *TeamHandler) ListTeams(c *gin.Context) {
 		}
 	}
 
+	// Only list the teams the user can read
+	user, err := auth.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	teamIDs, err := h.rbacService.GetPermittedTeamIDs(user.ID, models.ResourceTeam, models.ActionRead)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return
+	}
+
 	// Get teams
-	teams, totalCount, err := h.teamService.ListTeams(offset, limit, groupID)
+	teams, totalCount, err := h.teamService.ListTeams(auth.GetOrganizationID(c), offset, limit, groupID, teamIDs)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list teams"})
 		return
@@ -129,11 +154,18 @@ func (h *TeamHandler) CreateTeam(c *gin.Context) {
 		return
 	}
 
+	// Members of a group can access its teams, so only those who may
+	// update the group can add teams to it
+	if req.GroupID > 0 && !h.checkGroupUpdate(c, req.GroupID) {
+		return
+	}
+
 	// Create team
 	team := &models.Team{
-		Name:        req.Name,
-		Description: req.Description,
-		GroupID:     req.GroupID,
+		OrganizationID: auth.GetOrganizationID(c),
+		Name:           req.Name,
+		Description:    req.Description,
+		GroupID:        req.GroupID,
 	}
 
 	if err := h.teamService.CreateTeam(team); err != nil {
@@ -141,6 +173,10 @@ func (h *TeamHandler) CreateTeam(c *gin.Context) {
 			c.JSON(http.StatusConflict, gin.H{"error": "Team name already exists"})
 			return
 		}
+		if err == models.ErrOrganizationMismatch {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Group not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create team"})
 		return
 	}
@@ -184,7 +220,10 @@ func (h *TeamHandler) UpdateTeam(c *gin.Context) {
 	if req.Description != "" {
 		team.Description = req.Description
 	}
-	if req.GroupID != nil {
+	if req.GroupID != nil && *req.GroupID != team.GroupID {
+		if *req.GroupID > 0 && !h.checkGroupUpdate(c, *req.GroupID) {
+			return
+		}
 		team.GroupID = *req.GroupID
 	}
 
@@ -194,6 +233,10 @@ func (h *TeamHandler) UpdateTeam(c *gin.Context) {
 			c.JSON(http.StatusConflict, gin.H{"error": "Team name already exists"})
 			return
 		}
+		if err == models.ErrOrganizationMismatch {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Group not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update team"})
 		return
 	}
@@ -265,8 +308,21 @@ func (h *TeamHandler) ListGroups(c *gin.Context) {
 
 	offset := (page - 1) * limit
 
+	// Only list the groups the user can read
+	user, err := auth.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	groupIDs, err := h.rbacService.GetPermittedGroupIDs(user.ID, models.ResourceGroup, models.ActionRead)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return
+	}
+
 	// Get groups
-	groups, totalCount, err := h.groupService.ListGroups(offset, limit)
+	groups, totalCount, err := h.groupService.ListGroups(auth.GetOrganizationID(c), offset, limit, groupIDs)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list groups"})
 		return
@@ -303,7 +359,11 @@ func (h *TeamHandler) GetGroup(c *gin.Context) {
 		return
 	}
 
-	// Load group teams
+	// Load subgroups
+	subgroups, _ := h.groupService.GetSubgroups(groupID)
+	group.Subgroups = subgroups
+
+	// Load group teams, including those of subgroups
 	teams, _ := h.groupService.GetGroupTeams(groupID)
 	group.Teams = teams
 
@@ -322,10 +382,18 @@ func (h *TeamHandler) CreateGroup(c *gin.Context) {
 		return
 	}
 
+	// Members of the parent group can access its subgroups, so only those
+	// who may update it can add subgroups to it
+	if req.ParentID > 0 && !h.checkGroupUpdate(c, req.ParentID) {
+		return
+	}
+
 	// Create group
 	group := &models.Group{
-		Name:        req.Name,
-		Description: req.Description,
+		OrganizationID: auth.GetOrganizationID(c),
+		Name:           req.Name,
+		Description:    req.Description,
+		ParentID:       req.ParentID,
 	}
 
 	if err := h.groupService.CreateGroup(group); err != nil {
@@ -333,6 +401,10 @@ func (h *TeamHandler) CreateGroup(c *gin.Context) {
 			c.JSON(http.StatusConflict, gin.H{"error": "Group name already exists"})
 			return
 		}
+		if err == models.ErrGroupNotFound {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parent group not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create group"})
 		return
 	}
@@ -418,6 +490,76 @@ func (h *TeamHandler) DeleteGroup(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Group deleted successfully"})
 }
 
+// MoveGroup moves a group, with its subgroups and teams, under another
+// group or to the top level
+func (h *TeamHandler) MoveGroup(c *gin.Context) {
+	// Get group ID from URL
+	groupID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	var req MoveGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get existing group
+	group := &models.Group{}
+	if err := h.groupService.GetGroupByID(groupID, group); err != nil {
+		if err == models.ErrGroupNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get group"})
+		return
+	}
+
+	parentID := 0
+	if req.ParentID != nil {
+		parentID = *req.ParentID
+	}
+
+	// Moving a subtree changes who can access it, so the user must be able
+	// to update the new parent, or the current one when moving to the top
+	// level
+	switch {
+	case parentID > 0:
+		if !h.checkGroupUpdate(c, parentID) {
+			return
+		}
+	case group.ParentID > 0:
+		if !h.checkGroupUpdate(c, group.ParentID) {
+			return
+		}
+	}
+
+	if err := h.groupService.MoveGroup(groupID, parentID); err != nil {
+		if err == models.ErrGroupNotFound || err == models.ErrOrganizationMismatch {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parent group not found"})
+			return
+		}
+		if err == models.ErrGroupCycle {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A group can't be moved into itself or its subgroups"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move group"})
+		return
+	}
+
+	// Store group ID for audit logging
+	c.Set("resourceID", groupID)
+	c.Set("auditDetails", map[string]interface{}{
+		"previous_parent_id": group.ParentID,
+		"parent_id":          parentID,
+	})
+
+	group.ParentID = parentID
+	c.JSON(http.StatusOK, group)
+}
+
 // GetGroupMembers gets all members of a group
 func (h *TeamHandler) GetGroupMembers(c *gin.Context) {
 	// Get group ID from URL
@@ -437,7 +579,7 @@ func (h *TeamHandler) GetGroupMembers(c *gin.Context) {
 	c.JSON(http.StatusOK, members)
 }
 
-// GetGroupTeams gets all teams in a group
+// GetGroupTeams gets all teams in a group and its subgroups
 func (h *TeamHandler) GetGroupTeams(c *gin.Context) {
 	// Get group ID from URL
 	groupID, err := strconv.Atoi(c.Param("id"))
@@ -456,6 +598,52 @@ func (h *TeamHandler) GetGroupTeams(c *gin.Context) {
 	c.JSON(http.StatusOK, teams)
 }
 
+// checkGroupUpdate checks that the current user may update a group, which
+// adding a team to it amounts to
+func (h *TeamHandler) checkGroupUpdate(c *gin.Context, groupID int) bool {
+	user, err := auth.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return false
+	}
+
+	hasPermission, err := auth.CheckGroupPermission(
+		c, h.rbacService, user.ID, groupID, models.ResourceGroup, models.ActionUpdate,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return false
+	}
+	if !hasPermission {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions for this group"})
+		return false
+	}
+
+	return true
+}
+
+// checkTeamPermission checks that the current user has a permission for a
+// team given in a request body, and writes the error response if not
+func checkTeamPermission(c *gin.Context, rbacService *models.RBACService, teamID int, resource, action string) bool {
+	user, err := auth.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return false
+	}
+
+	hasPermission, err := auth.CheckTeamPermission(c, rbacService, user.ID, teamID, resource, action)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return false
+	}
+	if !hasPermission {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions for this team"})
+		return false
+	}
+
+	return true
+}
+
 // RegisterRoutes registers team and group management routes
 func (h *TeamHandler) RegisterRoutes(router *gin.RouterGroup, middleware *auth.Middleware) {
 	// Team routes
@@ -467,10 +655,12 @@ func (h *TeamHandler) RegisterRoutes(router *gin.RouterGroup, middleware *auth.M
 		read.Use(middleware.RequirePermission(models.ResourceTeam, models.ActionRead))
 		{
 			read.GET("", h.ListTeams)
-			read.GET("/:id", h.GetTeam)
-			read.GET("/:id/members", h.GetTeamMembers)
 		}
 
+		readTeam := middleware.RequireTeamAccess("id", "team:read")
+		teams.GET("/:id", readTeam, h.GetTeam)
+		teams.GET("/:id/members", readTeam, h.GetTeamMembers)
+
 		// Write operations
 		write := teams.Group("")
 		write.Use(middleware.RequirePermission(models.ResourceTeam, models.ActionCreate))
@@ -478,17 +668,8 @@ func (h *TeamHandler) RegisterRoutes(router *gin.RouterGroup, middleware *auth.M
 			write.POST("", middleware.AuditLog("create_team", "team"), h.CreateTeam)
 		}
 
-		update := teams.Group("")
-		update.Use(middleware.RequirePermission(models.ResourceTeam, models.ActionUpdate))
-		{
-			update.PUT("/:id", middleware.AuditLog("update_team", "team"), h.UpdateTeam)
-		}
-
-		del := teams.Group("")
-		del.Use(middleware.RequirePermission(models.ResourceTeam, models.ActionDelete))
-		{
-			del.DELETE("/:id", middleware.AuditLog("delete_team", "team"), h.DeleteTeam)
-		}
+		teams.PUT("/:id", middleware.RequireTeamAccess("id", "team:update"), middleware.AuditLog("update_team", "team"), h.UpdateTeam)
+		teams.DELETE("/:id", middleware.RequireTeamAccess("id", "team:delete"), middleware.AuditLog("delete_team", "team"), h.DeleteTeam)
 	}
 
 	// Group routes
@@ -500,11 +681,13 @@ func (h *TeamHandler) RegisterRoutes(router *gin.RouterGroup, middleware *auth.M
 		read.Use(middleware.RequirePermission(models.ResourceGroup, models.ActionRead))
 		{
 			read.GET("", h.ListGroups)
-			read.GET("/:id", h.GetGroup)
-			read.GET("/:id/members", h.GetGroupMembers)
-			read.GET("/:id/teams", h.GetGroupTeams)
 		}
 
+		readGroup := middleware.RequireGroupAccess("id", "group:read")
+		groups.GET("/:id", readGroup, h.GetGroup)
+		groups.GET("/:id/members", readGroup, h.GetGroupMembers)
+		groups.GET("/:id/teams", readGroup, h.GetGroupTeams)
+
 		// Write operations
 		write := groups.Group("")
 		write.Use(middleware.RequirePermission(models.ResourceGroup, models.ActionCreate))
@@ -512,16 +695,8 @@ func (h *TeamHandler) RegisterRoutes(router *gin.RouterGroup, middleware *auth.M
 			write.POST("", middleware.AuditLog("create_group", "group"), h.CreateGroup)
 		}
 
-		update := groups.Group("")
-		update.Use(middleware.RequirePermission(models.ResourceGroup, models.ActionUpdate))
-		{
-			update.PUT("/:id", middleware.AuditLog("update_group", "group"), h.UpdateGroup)
-		}
-
-		del := groups.Group("")
-		del.Use(middleware.RequirePermission(models.ResourceGroup, models.ActionDelete))
-		{
-			del.DELETE("/:id", middleware.AuditLog("delete_group", "group"), h.DeleteGroup)
-		}
+		groups.PUT("/:id", middleware.RequireGroupAccess("id", "group:update"), middleware.AuditLog("update_group", "group"), h.UpdateGroup)
+		groups.PUT("/:id/parent", middleware.RequireGroupAccess("id", "group:update"), middleware.AuditLog("move_group", "group"), h.MoveGroup)
+		groups.DELETE("/:id", middleware.RequireGroupAccess("id", "group:delete"), middleware.AuditLog("delete_group", "group"), h.DeleteGroup)
 	}
 }
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"devops-assessment/internal/auth"
+	"devops-assessment/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serviceAccountEmailDomain is the email domain of service accounts, below
+// the slug of their organization. The .invalid TLD is reserved, so these
+// addresses can never receive mail.
+const serviceAccountEmailDomain = "service-accounts.invalid"
+
+var serviceAccountNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+
+// TokenHandler handles API token and service account endpoints
+type TokenHandler struct {
+	tokenService *auth.APITokenService
+	userService  *models.UserService
+}
+
+// NewTokenHandler creates a new token handler
+func NewTokenHandler(authService *auth.AuthService, userService *models.UserService) *TokenHandler {
+	return &TokenHandler{
+		tokenService: authService.Tokens(),
+		userService:  userService,
+	}
+}
+
+// CreateTokenRequest represents a request to create an API token
+type CreateTokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`           // "resource:action" permissions
+	ExpiresInDays int      `json:"expires_in_days" binding:"omitempty,min=1"` // Never expires if omitted
+}
+
+// CreateServiceAccountRequest represents a request to create a service account
+type CreateServiceAccountRequest struct {
+	Name        string `json:"name" binding:"required"` // Lowercase letters, digits and dashes
+	Description string `json:"description"`
+}
+
+// CreatedTokenResponse includes the plain token, which is only shown once
+type CreatedTokenResponse struct {
+	auth.APIToken
+	Token string `json:"token"`
+}
+
+// ListTokens lists the current user's API tokens
+func (h *TokenHandler) ListTokens(c *gin.Context) {
+	user, err := auth.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	h.listTokens(c, user.ID)
+}
+
+// CreateToken creates an API token for the current user
+func (h *TokenHandler) CreateToken(c *gin.Context) {
+	user, err := auth.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	h.createToken(c, user.ID, user.ID)
+}
+
+// RevokeToken revokes one of the current user's API tokens
+func (h *TokenHandler) RevokeToken(c *gin.Context) {
+	user, err := auth.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	h.revokeToken(c, user.ID, c.Param("id"))
+}
+
+// ListServiceAccounts lists the service accounts of the organization
+func (h *TokenHandler) ListServiceAccounts(c *gin.Context) {
+	accounts, err := h.userService.ListServiceAccounts(auth.GetOrganizationID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list service accounts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, accounts)
+}
+
+// CreateServiceAccount creates a service account. It gets access like any
+// other user, by adding it to teams or groups.
+func (h *TokenHandler) CreateServiceAccount(c *gin.Context) {
+	var req CreateServiceAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !serviceAccountNamePattern.MatchString(req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name must consist of lowercase letters, digits and dashes"})
+		return
+	}
+
+	// Service accounts have no usable password
+	password, err := auth.GenerateRandomPassword()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create service account"})
+		return
+	}
+
+	// Emails are unique across organizations, so they include the slug
+	organization := auth.GetCurrentOrganization(c)
+	account := &models.User{
+		OrganizationID:   organization.ID,
+		Email:            req.Name + "@" + organization.Slug + "." + serviceAccountEmailDomain,
+		FirstName:        req.Name,
+		LastName:         req.Description,
+		IsActive:         true,
+		IsServiceAccount: true,
+	}
+
+	if err := h.userService.CreateUser(account, password); err != nil {
+		if err == models.ErrEmailAlreadyExists {
+			c.JSON(http.StatusConflict, gin.H{"error": "Service account already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create service account"})
+		return
+	}
+
+	// Store user ID for audit logging
+	c.Set("resourceID", account.ID)
+
+	c.JSON(http.StatusCreated, account)
+}
+
+// ListServiceAccountTokens lists a service account's API tokens
+func (h *TokenHandler) ListServiceAccountTokens(c *gin.Context) {
+	account, ok := h.getServiceAccount(c)
+	if !ok {
+		return
+	}
+
+	h.listTokens(c, account.ID)
+}
+
+// CreateServiceAccountToken creates an API token for a service account
+func (h *TokenHandler) CreateServiceAccountToken(c *gin.Context) {
+	user, err := auth.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	account, ok := h.getServiceAccount(c)
+	if !ok {
+		return
+	}
+
+	h.createToken(c, account.ID, user.ID)
+}
+
+// RevokeServiceAccountToken revokes an API token of a service account
+func (h *TokenHandler) RevokeServiceAccountToken(c *gin.Context) {
+	account, ok := h.getServiceAccount(c)
+	if !ok {
+		return
+	}
+
+	h.revokeToken(c, account.ID, c.Param("tokenId"))
+}
+
+// RegisterRoutes registers API token and service account routes
+func (h *TokenHandler) RegisterRoutes(router *gin.RouterGroup, middleware *auth.Middleware) {
+	// Tokens can't be used to manage tokens
+	tokens := router.Group("/tokens")
+	tokens.Use(middleware.RequireSession())
+	{
+		tokens.GET("", h.ListTokens)
+		tokens.POST("", middleware.AuditLog("create_api_token", "api_token"), h.CreateToken)
+		tokens.DELETE("/:id", middleware.AuditLog("revoke_api_token", "api_token"), h.RevokeToken)
+	}
+
+	accounts := router.Group("/service-accounts")
+	accounts.Use(middleware.RequireSession())
+	{
+		accounts.GET("", middleware.RequirePermission(models.ResourceUser, models.ActionRead), h.ListServiceAccounts)
+		accounts.POST("", middleware.RequirePermission(models.ResourceUser, models.ActionCreate),
+			middleware.AuditLog("create_service_account", "user"), h.CreateServiceAccount)
+		accounts.GET("/:id/tokens", middleware.RequirePermission(models.ResourceUser, models.ActionRead), h.ListServiceAccountTokens)
+		accounts.POST("/:id/tokens", middleware.RequirePermission(models.ResourceUser, models.ActionUpdate),
+			middleware.AuditLog("create_api_token", "api_token"), h.CreateServiceAccountToken)
+		accounts.DELETE("/:id/tokens/:tokenId", middleware.RequirePermission(models.ResourceUser, models.ActionUpdate),
+			middleware.AuditLog("revoke_api_token", "api_token"), h.RevokeServiceAccountToken)
+	}
+}
+
+// listTokens responds with a user's tokens
+func (h *TokenHandler) listTokens(c *gin.Context, userID int) {
+	tokens, err := h.tokenService.ListTokens(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list API tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// createToken creates a token for userID from the request body
+func (h *TokenHandler) createToken(c *gin.Context, userID, createdBy int) {
+	var req CreateTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		expiry := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &expiry
+	}
+
+	token, plain, err := h.tokenService.CreateToken(userID, createdBy, req.Name, req.Scopes, expiresAt)
+	if err != nil {
+		if errors.Is(err, auth.ErrTokenScopeInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API token"})
+		return
+	}
+
+	// Store token ID for audit logging
+	c.Set("resourceID", token.ID)
+
+	c.JSON(http.StatusCreated, CreatedTokenResponse{APIToken: *token, Token: plain})
+}
+
+// revokeToken revokes a token of userID
+func (h *TokenHandler) revokeToken(c *gin.Context, userID int, tokenIDParam string) {
+	tokenID, err := strconv.Atoi(tokenIDParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+		return
+	}
+
+	if err := h.tokenService.RevokeToken(userID, tokenID); err != nil {
+		if err == auth.ErrTokenNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API token not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API token"})
+		return
+	}
+
+	// Store token ID for audit logging
+	c.Set("resourceID", tokenID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "API token revoked successfully"})
+}
+
+// getServiceAccount loads the service account in the URL
+func (h *TokenHandler) getServiceAccount(c *gin.Context) (*models.User, bool) {
+	accountID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid service account ID"})
+		return nil, false
+	}
+
+	account := &models.User{}
+	if err := h.userService.GetUserByID(accountID, account); err != nil {
+		if err == models.ErrUserNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Service account not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get service account"})
+		return nil, false
+	}
+
+	if !account.IsServiceAccount || account.OrganizationID != auth.GetOrganizationID(c) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service account not found"})
+		return nil, false
+	}
+
+	return account, true
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -14,6 +15,7 @@ import (
 type UserHandler struct {
 	userService *models.UserService
 	roleService *models.RoleService
+	rbacService *models.RBACService
 	authService *auth.AuthService
 }
 
@@ -21,11 +23,13 @@ type UserHandler struct {
 func NewUserHandler(
 	userService *models.UserService,
 	roleService *models.RoleService,
+	rbacService *models.RBACService,
 	authService *auth.AuthService,
 ) *UserHandler {
 	return &UserHandler{
 		userService: userService,
 		roleService: roleService,
+		rbacService: rbacService,
 		authService: authService,
 	}
 }
@@ -33,7 +37,7 @@ func NewUserHandler(
 // CreateUserRequest represents a request to create a user
 type CreateUserRequest struct {
 	Email     string `json:"email" binding:"required,email"`
-	Password  string `json:"password" binding:"required,min=8"`
+	Password  string `json:"password" binding:"required"` // Checked against the password policy
 	FirstName string `json:"first_name" binding:"required"`
 	LastName  string `json:"last_name" binding:"required"`
 	IsActive  bool   `json:"is_active"`
@@ -41,15 +45,17 @@ type CreateUserRequest struct {
 
 // UpdateUserRequest represents a request to update a user
 type UpdateUserRequest struct {
-	Email     string `json:"email" binding:"omitempty,email"`
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
-	IsActive  *bool  `json:"is_active"`
+	Email        string `json:"email" binding:"omitempty,email"`
+	FirstName    string `json:"first_name"`
+	LastName     string `json:"last_name"`
+	IsActive     *bool  `json:"is_active"`
+	IsSuperAdmin *bool  `json:"is_super_admin"` // Only super admins can change it
+	IsOrgAdmin   *bool  `json:"is_org_admin"`   // Only organization and super admins can change it
 }
 
 // ResetPasswordRequest represents a request to reset a user's password
 type ResetPasswordRequest struct {
-	NewPassword string `json:"new_password" binding:"required,min=8"`
+	NewPassword string `json:"new_password" binding:"required"` // Checked against the password policy
 }
 
 // AddToTeamRequest represents a request to add a user to a team
@@ -64,6 +70,13 @@ type AddToGroupRequest struct {
 	RoleID  int `json:"role_id" binding:"required"`
 }
 
+// LinkIdentityRequest represents a request to link an external identity to
+// a user
+type LinkIdentityRequest struct {
+	Provider string `json:"provider" binding:"required,oneof=oidc ldap"`
+	Subject  string `json:"subject" binding:"required"` // The OIDC sub claim, or the LDAP subject attribute or DN
+}
+
 // ListUsers lists all users with pagination
 func (h *UserHandler) ListUsers(c *gin.Context) {
 	// Parse query parameters
@@ -81,7 +94,7 @@ func (h *UserHandler) ListUsers(c *gin.Context) {
 	offset := (page - 1) * limit
 
 	// Get users
-	users, totalCount, err := h.userService.ListUsers(offset, limit, activeOnly)
+	users, totalCount, err := h.userService.ListUsers(auth.GetOrganizationID(c), offset, limit, activeOnly)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list users"})
 		return
@@ -138,13 +151,18 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 
 	// Create user
 	user := &models.User{
-		Email:     req.Email,
-		FirstName: req.FirstName,
-		LastName:  req.LastName,
-		IsActive:  req.IsActive,
+		OrganizationID: auth.GetOrganizationID(c),
+		Email:          req.Email,
+		FirstName:      req.FirstName,
+		LastName:       req.LastName,
+		IsActive:       req.IsActive,
 	}
 
-	if err := h.userService.CreateUser(user, req.Password); err != nil {
+	if err := h.authService.CreateUser(user, req.Password); err != nil {
+		if errors.Is(err, auth.ErrPasswordPolicy) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		if err == models.ErrEmailAlreadyExists {
 			c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
 			return
@@ -198,6 +216,23 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 	if req.IsActive != nil {
 		user.IsActive = *req.IsActive
 	}
+	if req.IsSuperAdmin != nil && *req.IsSuperAdmin != user.IsSuperAdmin {
+		currentUser, err := auth.GetCurrentUser(c)
+		if err != nil || !currentUser.IsSuperAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only super admins can grant or revoke super admin rights"})
+			return
+		}
+		user.IsSuperAdmin = *req.IsSuperAdmin
+	}
+	if req.IsOrgAdmin != nil && *req.IsOrgAdmin != user.IsOrgAdmin {
+		currentUser, err := auth.GetCurrentUser(c)
+		_, isToken := c.Get(string(auth.APITokenContextKey))
+		if err != nil || isToken || !(currentUser.IsSuperAdmin || currentUser.IsOrgAdmin) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only organization admins can grant or revoke organization admin rights"})
+			return
+		}
+		user.IsOrgAdmin = *req.IsOrgAdmin
+	}
 
 	// Save updates
 	if err := h.userService.UpdateUser(user); err != nil {
@@ -267,6 +302,10 @@ func (h *UserHandler) ResetPassword(c *gin.Context) {
 
 	// Reset password
 	if err := h.authService.ResetPassword(userID, req.NewPassword); err != nil {
+		if errors.Is(err, auth.ErrPasswordPolicy) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
 		return
 	}
@@ -277,6 +316,71 @@ func (h *UserHandler) ResetPassword(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
 }
 
+// UnlockUser clears the failed logins and any lockout of a user's email
+func (h *UserHandler) UnlockUser(c *gin.Context) {
+	// Get user ID from URL
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	user := &models.User{}
+	if err := h.userService.GetUserByID(userID, user); err != nil {
+		if err == models.ErrUserNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	if err := h.authService.Throttle().Unlock(auth.ThrottleScopeAccount, user.Email); err != nil {
+		if err == auth.ErrLockoutNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User is not locked out"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock user"})
+		return
+	}
+
+	// Store user ID for audit logging
+	c.Set("resourceID", userID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked successfully"})
+}
+
+// LinkIdentity links an external identity to a user, for identities that
+// aren't linked automatically on login
+func (h *UserHandler) LinkIdentity(c *gin.Context) {
+	// Get user ID from URL
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req LinkIdentityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.userService.LinkIdentity(userID, req.Provider, req.Subject); err != nil {
+		if err == models.ErrIdentityAlreadyLinked {
+			c.JSON(http.StatusConflict, gin.H{"error": "Identity is already linked to a user"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link identity"})
+		return
+	}
+
+	// Store user ID for audit logging
+	c.Set("resourceID", userID)
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Identity linked successfully"})
+}
+
 // GetUserTeams gets all teams a user belongs to
 func (h *UserHandler) GetUserTeams(c *gin.Context) {
 	// Get user ID from URL
@@ -311,8 +415,31 @@ func (h *UserHandler) AddUserToTeam(c *gin.Context) {
 		return
 	}
 
+	// Adding members is a change to the team
+	if !checkTeamPermission(c, h.rbacService, req.TeamID, models.ResourceTeam, models.ActionUpdate) {
+		return
+	}
+
+	role, err := h.roleService.GetRoleByID(req.RoleID)
+	if err != nil {
+		if err == models.ErrRoleNotFound {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Role not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get role"})
+		return
+	}
+
+	if !checkRoleAssignable(c, h.rbacService, role) {
+		return
+	}
+
 	// Add user to team
 	if err := h.userService.AddUserToTeam(userID, req.TeamID, req.RoleID); err != nil {
+		if err == models.ErrOrganizationMismatch {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Team not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add user to team"})
 		return
 	}
@@ -335,6 +462,11 @@ func (h *UserHandler) RemoveUserFromTeam(c *gin.Context) {
 		return
 	}
 
+	// Removing members is a change to the team
+	if !checkTeamPermission(c, h.rbacService, teamID, models.ResourceTeam, models.ActionUpdate) {
+		return
+	}
+
 	// Remove user from team
 	if err := h.userService.RemoveUserFromTeam(userID, teamID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove user from team"})
@@ -363,6 +495,56 @@ func (h *UserHandler) GetUserGroups(c *gin.Context) {
 	c.JSON(http.StatusOK, groups)
 }
 
+// GetEffectivePermissions lists a user's permissions with the memberships
+// that grant them, optionally for one team
+func (h *UserHandler) GetEffectivePermissions(c *gin.Context) {
+	// Get user ID from URL
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var teamID int
+	if teamIDStr := c.Query("team_id"); teamIDStr != "" {
+		teamID, err = strconv.Atoi(teamIDStr)
+		if err != nil || teamID < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
+			return
+		}
+	}
+
+	user := &models.User{}
+	if err := h.userService.GetUserByID(userID, user); err != nil {
+		if err == models.ErrUserNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	permissions, err := h.rbacService.ExplainPermissions(userID, teamID)
+	if err != nil {
+		if err == models.ErrTeamNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get effective permissions"})
+		return
+	}
+
+	response := gin.H{
+		"user_id":     userID,
+		"permissions": permissions,
+	}
+	if teamID > 0 {
+		response["team_id"] = teamID
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
 // GetRoles gets all available roles
 func (h *UserHandler) GetRoles(c *gin.Context) {
 	roles, err := h.roleService.ListRoles()
@@ -384,9 +566,10 @@ func (h *UserHandler) RegisterRoutes(router *gin.RouterGroup, middleware *auth.M
 		admin.Use(middleware.RequirePermission(models.ResourceUser, models.ActionRead))
 		{
 			admin.GET("", h.ListUsers)
-			admin.GET("/:id", h.GetUser)
-			admin.GET("/:id/teams", h.GetUserTeams)
-			admin.GET("/:id/groups", h.GetUserGroups)
+			admin.GET("/:id", middleware.RequireOrganizationUser("id"), h.GetUser)
+			admin.GET("/:id/teams", middleware.RequireOrganizationUser("id"), h.GetUserTeams)
+			admin.GET("/:id/groups", middleware.RequireOrganizationUser("id"), h.GetUserGroups)
+			admin.GET("/:id/effective-permissions", middleware.RequireOrganizationUser("id"), h.GetEffectivePermissions)
 		}
 
 		// User modification (admin only)
@@ -399,16 +582,18 @@ func (h *UserHandler) RegisterRoutes(router *gin.RouterGroup, middleware *auth.M
 		adminUpdate := users.Group("")
 		adminUpdate.Use(middleware.RequirePermission(models.ResourceUser, models.ActionUpdate))
 		{
-			adminUpdate.PUT("/:id", middleware.AuditLog("update_user", "user"), h.UpdateUser)
-			adminUpdate.POST("/:id/reset-password", middleware.AuditLog("reset_password", "user"), h.ResetPassword)
-			adminUpdate.POST("/:id/teams", middleware.AuditLog("add_user_to_team", "user"), h.AddUserToTeam)
-			adminUpdate.DELETE("/:id/teams/:teamId", middleware.AuditLog("remove_user_from_team", "user"), h.RemoveUserFromTeam)
+			adminUpdate.PUT("/:id", middleware.RequireOrganizationUser("id"), middleware.RequireAdminTarget("id"), middleware.AuditLog("update_user", "user"), h.UpdateUser)
+			adminUpdate.POST("/:id/reset-password", middleware.RequireOrganizationUser("id"), middleware.RequireAdminTarget("id"), middleware.AuditLog("reset_password", "user"), h.ResetPassword)
+			adminUpdate.POST("/:id/unlock", middleware.RequireOrganizationUser("id"), middleware.RequireAdminTarget("id"), middleware.AuditLog("unlock_user", "user"), h.UnlockUser)
+			adminUpdate.POST("/:id/identities", middleware.RequireOrganizationUser("id"), middleware.RequireAdminTarget("id"), middleware.AuditLog("link_identity", "user"), h.LinkIdentity)
+			adminUpdate.POST("/:id/teams", middleware.RequireOrganizationUser("id"), middleware.RequireAdminTarget("id"), middleware.AuditLog("add_user_to_team", "user"), h.AddUserToTeam)
+			adminUpdate.DELETE("/:id/teams/:teamId", middleware.RequireOrganizationUser("id"), middleware.RequireAdminTarget("id"), middleware.AuditLog("remove_user_from_team", "user"), h.RemoveUserFromTeam)
 		}
 
 		adminDelete := users.Group("")
 		adminDelete.Use(middleware.RequirePermission(models.ResourceUser, models.ActionDelete))
 		{
-			adminDelete.DELETE("/:id", middleware.AuditLog("delete_user", "user"), h.DeleteUser)
+			adminDelete.DELETE("/:id", middleware.RequireOrganizationUser("id"), middleware.RequireAdminTarget("id"), middleware.AuditLog("delete_user", "user"), h.DeleteUser)
 		}
 
 		// Roles endpoint (available to all authenticated users)
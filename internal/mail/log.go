@@ -0,0 +1,48 @@
+package mail
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogMailer writes messages to a file or the application log instead of
+// sending them, for local development
+type LogMailer struct {
+	from string
+	path string // Empty to write to the application log
+	mu   sync.Mutex
+}
+
+// NewLogMailer creates a new log mailer
+func NewLogMailer(from, path string) *LogMailer {
+	return &LogMailer{from: from, path: path}
+}
+
+// Send writes a message
+func (m *LogMailer) Send(msg *Message) error {
+	if m.path == "" {
+		log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open mail file: %w", err)
+	}
+	defer file.Close()
+
+	// Unencoded, so links can be copied from the file
+	_, err = fmt.Fprintf(file, "From: %s\nTo: %s\nDate: %s\nSubject: %s\n\n%s\n\n",
+		m.from, msg.To, time.Now().Format(time.RFC1123Z), msg.Subject, msg.Body)
+	if err != nil {
+		return fmt.Errorf("failed to write mail file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package mail
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// SMTP connection security
+const (
+	TLSModeStartTLS = "starttls" // Upgrade a plain connection, usually on port 587
+	TLSModeImplicit = "tls"      // TLS from the start, usually on port 465
+	TLSModeNone     = "none"     // Only for local relays
+)
+
+// SMTPConfig holds SMTP server configuration
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string // Optional, authenticates with PLAIN
+	Password string
+	TLSMode  string
+	From     string // e.g. "DevOps Assessment <assessment@example.com>"
+	Timeout  time.Duration
+}
+
+// SMTPMailer sends email through an SMTP server
+type SMTPMailer struct {
+	config SMTPConfig
+}
+
+// NewSMTPMailer creates a new SMTP mailer
+func NewSMTPMailer(config SMTPConfig) *SMTPMailer {
+	if config.TLSMode == "" {
+		config.TLSMode = TLSModeStartTLS
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+	return &SMTPMailer{config: config}
+}
+
+// Send sends a message
+func (m *SMTPMailer) Send(msg *Message) error {
+	from, err := mail.ParseAddress(m.config.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender: %w", err)
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient: %w", err)
+	}
+
+	data, err := format(m.config.From, msg)
+	if err != nil {
+		return fmt.Errorf("failed to format message: %w", err)
+	}
+
+	client, err := m.connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	defer client.Close()
+
+	if m.config.Username != "" {
+		auth := smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("failed to authenticate to SMTP server: %w", err)
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("failed to set sender: %w", err)
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return fmt.Errorf("failed to set recipient: %w", err)
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to start message: %w", err)
+	}
+	if _, err := writer.Write(data); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// connect opens a connection with the configured security
+func (m *SMTPMailer) connect() (*smtp.Client, error) {
+	addr := net.JoinHostPort(m.config.Host, strconv.Itoa(m.config.Port))
+	tlsConfig := &tls.Config{ServerName: m.config.Host, MinVersion: tls.VersionTLS12}
+	dialer := &net.Dialer{Timeout: m.config.Timeout}
+
+	var conn net.Conn
+	var err error
+	if m.config.TLSMode == TLSModeImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(m.config.Timeout))
+
+	client, err := smtp.NewClient(conn, m.config.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if m.config.TLSMode == TLSModeStartTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+
+	return client, nil
+}
@@ -0,0 +1,404 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"devops-assessment/internal/database"
+)
+
+// ActionItem is an improvement a team commits to, created from a question
+// or section of a completed assessment
+type ActionItem struct {
+	ID             int        `json:"id"`
+	OrganizationID int        `json:"organization_id"` // Always the team's organization
+	TeamID         int        `json:"team_id"`
+	AssessmentID   int        `json:"assessment_id"`
+	QuestionID     string     `json:"question_id,omitempty"`  // Set for items created from a question
+	SectionName    string     `json:"section_name,omitempty"` // Set for items created from a section
+	Title          string     `json:"title"`
+	Notes          string     `json:"notes,omitempty"`
+	OwnerID        int        `json:"owner_id,omitempty"`
+	OwnerName      string     `json:"owner_name,omitempty"`
+	DueDate        *time.Time `json:"due_date,omitempty"`
+	Status         string     `json:"status"`
+	BaselineScore  float64    `json:"baseline_score"` // Question score or section percentage when created
+	CreatedBy      int        `json:"created_by"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	// Set once a later assessment of the team scores the question or
+	// section higher than the baseline
+	ImprovedAssessmentID int        `json:"improved_assessment_id,omitempty"`
+	ImprovedScore        float64    `json:"improved_score,omitempty"`
+	ImprovedAt           *time.Time `json:"improved_at,omitempty"`
+}
+
+// Action item status constants
+const (
+	ActionItemOpen       = "open"
+	ActionItemInProgress = "in_progress"
+	ActionItemDone       = "done"
+	ActionItemDropped    = "dropped"
+)
+
+// Common errors
+var (
+	ErrActionItemNotFound  = errors.New("action item not found")
+	ErrInvalidActionItem   = errors.New("invalid action item status")
+	ErrActionItemTarget    = errors.New("action item needs a question or a section of the assessment")
+	ErrActionItemNoResults = errors.New("action items can only be created from completed assessments")
+)
+
+// ValidActionItemStatus reports whether an action item status is known
+func ValidActionItemStatus(status string) bool {
+	switch status {
+	case ActionItemOpen, ActionItemInProgress, ActionItemDone, ActionItemDropped:
+		return true
+	}
+	return false
+}
+
+// Overdue reports whether an open or in progress action item is past its
+// due date
+func (i *ActionItem) Overdue() bool {
+	if i.DueDate == nil || (i.Status != ActionItemOpen && i.Status != ActionItemInProgress) {
+		return false
+	}
+	year, month, day := time.Now().Date()
+	return i.DueDate.Before(time.Date(year, month, day, 0, 0, 0, 0, i.DueDate.Location()))
+}
+
+// ActionItemCounts counts action items by status
+type ActionItemCounts struct {
+	Open       int `json:"open"`
+	InProgress int `json:"in_progress"`
+	Done       int `json:"done"`
+	Dropped    int `json:"dropped"`
+	Overdue    int `json:"overdue"`  // Open or in progress past their due date
+	Improved   int `json:"improved"` // Flagged as improved, in any status
+}
+
+// Total returns the number of items that weren't dropped
+func (c ActionItemCounts) Total() int {
+	return c.Open + c.InProgress + c.Done
+}
+
+// PercentDone returns the share of items that weren't dropped that are done
+func (c ActionItemCounts) PercentDone() float64 {
+	if c.Total() == 0 {
+		return 0
+	}
+	return float64(c.Done) / float64(c.Total()) * 100
+}
+
+// ActionItemService handles action item database operations
+type ActionItemService struct {
+	db *database.DB
+}
+
+// NewActionItemService creates a new action item service
+func NewActionItemService(db *database.DB) *ActionItemService {
+	return &ActionItemService{db: db}
+}
+
+// actionItemColumns lists the action item columns read by scanActionItem
+const actionItemColumns = `ai.id, ai.organization_id, ai.team_id, ai.assessment_id, ai.question_id, ai.section_name,
+		       ai.title, ai.notes, ai.owner_id, u.first_name, u.last_name, ai.due_date, ai.status,
+		       ai.baseline_score, ai.created_by, ai.created_at, ai.updated_at,
+		       ai.improved_assessment_id, ai.improved_score, ai.improved_at`
+
+// actionItemFrom selects action items with the names of their owners
+const actionItemFrom = `
+		FROM action_items ai
+		LEFT JOIN users u ON u.id = ai.owner_id
+`
+
+// scanActionItem scans a row selected with actionItemColumns
+func scanActionItem(row rowScanner, item *ActionItem) error {
+	var questionID, sectionName, notes, firstName, lastName sql.NullString
+	var ownerID, improvedAssessmentID sql.NullInt64
+	var improvedScore sql.NullFloat64
+	var dueDate, improvedAt sql.NullTime
+
+	err := row.Scan(
+		&item.ID,
+		&item.OrganizationID,
+		&item.TeamID,
+		&item.AssessmentID,
+		&questionID,
+		&sectionName,
+		&item.Title,
+		&notes,
+		&ownerID,
+		&firstName,
+		&lastName,
+		&dueDate,
+		&item.Status,
+		&item.BaselineScore,
+		&item.CreatedBy,
+		&item.CreatedAt,
+		&item.UpdatedAt,
+		&improvedAssessmentID,
+		&improvedScore,
+		&improvedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	item.QuestionID = questionID.String
+	item.SectionName = sectionName.String
+	item.Notes = notes.String
+	item.OwnerID = int(ownerID.Int64)
+	if firstName.Valid {
+		item.OwnerName = firstName.String + " " + lastName.String
+	}
+	if dueDate.Valid {
+		item.DueDate = &dueDate.Time
+	}
+	item.ImprovedAssessmentID = int(improvedAssessmentID.Int64)
+	item.ImprovedScore = improvedScore.Float64
+	if improvedAt.Valid {
+		item.ImprovedAt = &improvedAt.Time
+	}
+
+	return nil
+}
+
+// nullString stores empty strings as NULL
+func nullString(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// nullID stores IDs of 0 as NULL
+func nullID(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// nullTime stores nil times as NULL
+func nullTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return *t
+}
+
+// CreateActionItem creates an action item in the team's organization
+func (s *ActionItemService) CreateActionItem(item *ActionItem) error {
+	if item.Status == "" {
+		item.Status = ActionItemOpen
+	}
+	if !ValidActionItemStatus(item.Status) {
+		return ErrInvalidActionItem
+	}
+
+	query := `
+		INSERT INTO action_items (organization_id, team_id, assessment_id, question_id, section_name,
+		                          title, notes, owner_id, due_date, status, baseline_score, created_by)
+		SELECT organization_id, id, ?, ?, ?, ?, ?, ?, ?, ?, ?, ? FROM teams WHERE id = ?
+	`
+
+	id, err := s.db.Insert(query,
+		item.AssessmentID,
+		nullString(item.QuestionID),
+		nullString(item.SectionName),
+		item.Title,
+		nullString(item.Notes),
+		nullID(item.OwnerID),
+		nullTime(item.DueDate),
+		item.Status,
+		item.BaselineScore,
+		item.CreatedBy,
+		item.TeamID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create action item: %w", err)
+	}
+	if id == 0 {
+		return ErrTeamNotFound
+	}
+
+	// Load the created item to get timestamps and the owner's name
+	return s.GetActionItemByID(int(id), item)
+}
+
+// GetActionItemByID retrieves an action item by ID
+func (s *ActionItemService) GetActionItemByID(id int, item *ActionItem) error {
+	query := `SELECT ` + actionItemColumns + actionItemFrom + `WHERE ai.id = ?`
+
+	err := scanActionItem(s.db.QueryRowContext(context.Background(), query, id), item)
+	if err == sql.ErrNoRows {
+		return ErrActionItemNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get action item: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateActionItem updates the title, notes, owner, due date and status of
+// an action item
+func (s *ActionItemService) UpdateActionItem(item *ActionItem) error {
+	if !ValidActionItemStatus(item.Status) {
+		return ErrInvalidActionItem
+	}
+
+	query := `
+		UPDATE action_items
+		SET title = ?, notes = ?, owner_id = ?, due_date = ?, status = ?
+		WHERE id = ?
+	`
+
+	_, err := s.db.Update(query,
+		item.Title,
+		nullString(item.Notes),
+		nullID(item.OwnerID),
+		nullTime(item.DueDate),
+		item.Status,
+		item.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update action item: %w", err)
+	}
+
+	return s.GetActionItemByID(item.ID, item)
+}
+
+// DeleteActionItem deletes an action item
+func (s *ActionItemService) DeleteActionItem(id int) error {
+	affected, err := s.db.Delete(`DELETE FROM action_items WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete action item: %w", err)
+	}
+	if affected == 0 {
+		return ErrActionItemNotFound
+	}
+
+	return nil
+}
+
+// listActionItems lists the action items matching a condition, those due
+// first first, items without a due date last
+func (s *ActionItemService) listActionItems(where string, args ...interface{}) ([]ActionItem, error) {
+	query := `SELECT ` + actionItemColumns + actionItemFrom + `WHERE ` + where + `
+		ORDER BY ai.due_date IS NULL, ai.due_date, ai.id
+	`
+
+	rows, err := s.db.GetMany(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list action items: %w", err)
+	}
+	defer rows.Close()
+
+	items := []ActionItem{}
+	for rows.Next() {
+		var item ActionItem
+		if err := scanActionItem(rows, &item); err != nil {
+			return nil, fmt.Errorf("failed to scan action item: %w", err)
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// ListAssessmentActionItems lists the action items created from an
+// assessment
+func (s *ActionItemService) ListAssessmentActionItems(assessmentID int) ([]ActionItem, error) {
+	return s.listActionItems(`ai.assessment_id = ?`, assessmentID)
+}
+
+// ListTeamActionItems lists the action items of a team
+func (s *ActionItemService) ListTeamActionItems(teamID int) ([]ActionItem, error) {
+	return s.listActionItems(`ai.team_id = ?`, teamID)
+}
+
+// ListPendingActionItems lists the open and in progress action items of
+// teams
+func (s *ActionItemService) ListPendingActionItems(teamIDs []int) ([]ActionItem, error) {
+	teamCondition, teamArgs := inClause("ai.team_id", teamIDs)
+	args := append([]interface{}{ActionItemOpen, ActionItemInProgress}, teamArgs...)
+
+	return s.listActionItems(`ai.status IN (?, ?) AND `+teamCondition, args...)
+}
+
+// ListUnimprovedActionItems lists the action items of a team created from
+// assessments before the given one that aren't flagged as improved yet
+func (s *ActionItemService) ListUnimprovedActionItems(teamID, assessmentID int) ([]ActionItem, error) {
+	return s.listActionItems(
+		`ai.team_id = ? AND ai.assessment_id < ? AND ai.improved_assessment_id IS NULL`,
+		teamID, assessmentID,
+	)
+}
+
+// MarkImproved flags an action item as improved by an assessment
+func (s *ActionItemService) MarkImproved(itemID, assessmentID int, score float64) error {
+	query := `
+		UPDATE action_items
+		SET improved_assessment_id = ?, improved_score = ?, improved_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND improved_assessment_id IS NULL
+	`
+
+	if _, err := s.db.Update(query, assessmentID, score, itemID); err != nil {
+		return fmt.Errorf("failed to flag action item: %w", err)
+	}
+
+	return nil
+}
+
+// CountActionItems counts the action items of teams by status
+func (s *ActionItemService) CountActionItems(teamIDs []int) (ActionItemCounts, error) {
+	var counts ActionItemCounts
+	teamCondition, args := inClause("team_id", teamIDs)
+
+	query := `
+		SELECT status,
+		       COUNT(*),
+		       COALESCE(SUM(due_date < CURRENT_DATE), 0),
+		       COUNT(improved_assessment_id)
+		FROM action_items
+		WHERE ` + teamCondition + `
+		GROUP BY status
+	`
+
+	rows, err := s.db.GetMany(query, args...)
+	if err != nil {
+		return counts, fmt.Errorf("failed to count action items: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var status string
+		var count, overdue, improved int
+		if err := rows.Scan(&status, &count, &overdue, &improved); err != nil {
+			return counts, fmt.Errorf("failed to scan action item count: %w", err)
+		}
+
+		switch status {
+		case ActionItemOpen:
+			counts.Open = count
+			counts.Overdue += overdue
+		case ActionItemInProgress:
+			counts.InProgress = count
+			counts.Overdue += overdue
+		case ActionItemDone:
+			counts.Done = count
+		case ActionItemDropped:
+			counts.Dropped = count
+		}
+		counts.Improved += improved
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ValidateAdvice reports the advice of a survey that can never be shown or
+// is ambiguous: advice for sections and subcategories the survey doesn't
+// have, for maturity levels that don't exist, for invalid percentage
+// ranges, and ranges that overlap or leave gaps between them
+func (s *QuestionService) ValidateAdvice(survey *Survey, advice map[string]Advice) []string {
+	subCategories := make(map[string]map[string]bool, len(survey.Sections))
+	for _, section := range survey.Sections {
+		subCategories[section.SectionName] = make(map[string]bool)
+		for _, question := range section.Questions {
+			if question.SubCategory != "" {
+				subCategories[section.SectionName][question.SubCategory] = true
+			}
+		}
+	}
+
+	var problems []string
+	for _, sectionName := range sortedAdviceKeys(advice) {
+		sectionAdvice := advice[sectionName]
+		sectionSubCategories, exists := subCategories[sectionName]
+		if !exists {
+			problems = append(problems, fmt.Sprintf("advice for %q matches no section", sectionName))
+			continue
+		}
+		problems = append(problems, s.validateAdviceVariants(sectionName, sectionAdvice)...)
+
+		for _, subCategory := range sortedAdviceKeys(sectionAdvice.SubCategories) {
+			name := sectionName + " / " + subCategory
+			if !sectionSubCategories[subCategory] {
+				problems = append(problems, fmt.Sprintf("advice for %q matches no subcategory", name))
+				continue
+			}
+			problems = append(problems, s.validateAdviceVariants(name, sectionAdvice.SubCategories[subCategory])...)
+		}
+	}
+
+	return problems
+}
+
+// validateAdviceVariants reports the level and range advice of a section or
+// subcategory that can never be shown
+func (s *QuestionService) validateAdviceVariants(name string, advice Advice) []string {
+	var problems []string
+
+	levels := make([]int, 0, len(advice.Levels))
+	for level := range advice.Levels {
+		levels = append(levels, level)
+	}
+	sort.Ints(levels)
+	for _, level := range levels {
+		if level < 1 || level > len(s.maturity.Levels) {
+			problems = append(problems, fmt.Sprintf("advice for %q has level %d, levels go from 1 to %d",
+				name, level, len(s.maturity.Levels)))
+		}
+	}
+
+	var ranges []RangeAdvice
+	for _, percentageRange := range advice.Ranges {
+		if percentageRange.Min < 0 || percentageRange.Max > 100 || percentageRange.Min >= percentageRange.Max {
+			problems = append(problems, fmt.Sprintf("advice for %q has range %g-%g, ranges must ascend within 0-100",
+				name, percentageRange.Min, percentageRange.Max))
+			continue
+		}
+		ranges = append(ranges, percentageRange)
+	}
+
+	// Ranges include their minimum but not their maximum, so adjacent
+	// ranges end where the next one starts
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].Min < ranges[j].Min })
+	for i := 1; i < len(ranges); i++ {
+		// Each range must start where the ones before it reach
+		reaching := ranges[0]
+		for _, previous := range ranges[1:i] {
+			if previous.Max > reaching.Max {
+				reaching = previous
+			}
+		}
+
+		next := ranges[i]
+		switch {
+		case next.Min < reaching.Max:
+			problems = append(problems, fmt.Sprintf("advice for %q has overlapping ranges %g-%g and %g-%g",
+				name, reaching.Min, reaching.Max, next.Min, next.Max))
+		case next.Min > reaching.Max:
+			problems = append(problems, fmt.Sprintf("advice for %q has a gap from %g to %g between its ranges",
+				name, reaching.Max, next.Min))
+		}
+	}
+
+	return problems
+}
+
+// sortedAdviceKeys returns the section or subcategory names of advice in
+// alphabetical order
+func sortedAdviceKeys(advice map[string]Advice) []string {
+	keys := make([]string, 0, len(advice))
+	for key := range advice {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateAdvice(t *testing.T) {
+	survey := &Survey{Sections: []Section{
+		{SectionName: "Automation", Questions: []Question{{ID: "q1", SubCategory: "CI"}, {ID: "q2"}}},
+	}}
+
+	// ranges returns advice for the Automation section with percentage
+	// ranges, given as minimum and maximum pairs
+	ranges := func(bounds ...float64) map[string]Advice {
+		advice := Advice{}
+		for i := 0; i < len(bounds); i += 2 {
+			advice.Ranges = append(advice.Ranges, RangeAdvice{Min: bounds[i], Max: bounds[i+1]})
+		}
+		return map[string]Advice{"Automation": advice}
+	}
+
+	tests := []struct {
+		name         string
+		advice       map[string]Advice
+		wantProblems []string
+	}{
+		{name: "no advice"},
+		{name: "adjacent ranges", advice: ranges(0, 50, 50, 90, 90, 100)},
+		{name: "adjacent ranges in any order", advice: ranges(50, 100, 0, 50)},
+		{name: "ranges with room before and after", advice: ranges(20, 40, 40, 60)},
+		{
+			name:         "gap between ranges",
+			advice:       ranges(0, 49, 50, 100),
+			wantProblems: []string{`advice for "Automation" has a gap from 49 to 50 between its ranges`},
+		},
+		{
+			name:         "overlapping ranges",
+			advice:       ranges(0, 50, 40, 100),
+			wantProblems: []string{`advice for "Automation" has overlapping ranges 0-50 and 40-100`},
+		},
+		{
+			name:         "range within another",
+			advice:       ranges(0, 100, 10, 20, 30, 40),
+			wantProblems: []string{`advice for "Automation" has overlapping ranges 0-100 and 10-20`, `advice for "Automation" has overlapping ranges 0-100 and 30-40`},
+		},
+		{
+			name:         "empty and out of bounds ranges",
+			advice:       ranges(50, 50, 90, 110),
+			wantProblems: []string{`advice for "Automation" has range 50-50, ranges must ascend within 0-100`, `advice for "Automation" has range 90-110, ranges must ascend within 0-100`},
+		},
+		{
+			name: "ranges of a subcategory",
+			advice: map[string]Advice{"Automation": {SubCategories: map[string]Advice{
+				"CI": ranges(0, 60, 50, 100)["Automation"],
+			}}},
+			wantProblems: []string{`advice for "Automation / CI" has overlapping ranges 0-60 and 50-100`},
+		},
+		{
+			name: "unknown keys and levels",
+			advice: map[string]Advice{
+				"Automation": {Levels: map[int]AdviceVariant{1: {}, 6: {}}, SubCategories: map[string]Advice{"CD": {}}},
+				"Culture":    {},
+			},
+			wantProblems: []string{
+				`advice for "Automation" has level 6, levels go from 1 to 5`,
+				`advice for "Automation / CD" matches no subcategory`,
+				`advice for "Culture" matches no section`,
+			},
+		},
+	}
+
+	service := NewQuestionService("", "")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if problems := service.ValidateAdvice(survey, tt.advice); !reflect.DeepEqual(problems, tt.wantProblems) {
+				t.Errorf("ValidateAdvice() = %q, want %q", problems, tt.wantProblems)
+			}
+		})
+	}
+}
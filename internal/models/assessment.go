@@ -2,7 +2,9 @@ package models
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,17 +15,23 @@ import (
 
 // Assessment represents a DevOps maturity assessment
 type Assessment struct {
-	ID          int        `json:"id"`
-	TeamID      int        `json:"team_id"`
-	CreatedBy   int        `json:"created_by"`
-	SessionID   string     `json:"session_id"`
-	Status      string     `json:"status"` // 'in_progress' or 'completed'
-	CreatedAt   time.Time  `json:"created_at"`
-	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ID                     int        `json:"id"`
+	OrganizationID         int        `json:"organization_id"` // Always the team's organization
+	TeamID                 int        `json:"team_id"`
+	CreatedBy              int        `json:"created_by"`
+	SessionID              string     `json:"session_id"`
+	Status                 string     `json:"status"`      // See the assessment status constants
+	Aggregation            string     `json:"aggregation"` // How respondents' answers are combined
+	Scoring                string     `json:"scoring"`     // How section scores are combined, see the scoring constants
+	QuestionnaireVersionID int        `json:"questionnaire_version_id,omitempty"`
+	ClonedFromID           int        `json:"cloned_from_id,omitempty"` // The assessment its responses were copied from
+	CreatedAt              time.Time  `json:"created_at"`
+	CompletedAt            *time.Time `json:"completed_at,omitempty"`
 
 	// Relationships (loaded separately)
 	Team          *Team          `json:"team,omitempty"`
 	Creator       *User          `json:"creator,omitempty"`
+	Respondents   []Respondent   `json:"respondents,omitempty"`
 	Responses     []Response     `json:"responses,omitempty"`
 	SectionScores []SectionScore `json:"section_scores,omitempty"`
 }
@@ -32,7 +40,7 @@ type Assessment struct {
 type Response struct {
 	ID           int       `json:"id"`
 	AssessmentID int       `json:"assessment_id"`
-	QuestionID   string    `json:"question_id"` // e.g., 'S1-Q1'
+	QuestionID   string    `json:"question_id"` // e.g., 'q-669d5476'
 	AnswerIDs    []string  `json:"answer_ids"`  // Array of answer IDs
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
@@ -46,6 +54,9 @@ type SectionScore struct {
 	Score        float64   `json:"score"`
 	MaxScore     float64   `json:"max_score"`
 	Percentage   float64   `json:"percentage"`
+	Weight       float64   `json:"weight,omitempty"`     // Of the section in the weighted overall score
+	Level        int       `json:"level,omitempty"`      // Maturity level, from 1
+	LevelName    string    `json:"level_name,omitempty"` // Name of the maturity level
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
@@ -63,17 +74,159 @@ func NewAssessmentService(db *database.DB) *AssessmentService {
 // Assessment status constants
 const (
 	StatusInProgress = "in_progress"
+	StatusSubmitted  = "submitted" // Waiting to be completed, or returned for changes
+	StatusReopened   = "reopened"  // Completed before, being amended
 	StatusCompleted  = "completed"
+	StatusArchived   = "archived" // Kept with its results, but out of the team's history
+)
+
+// statusTransitions lists the statuses an assessment can move to from each
+// status
+var statusTransitions = map[string][]string{
+	StatusInProgress: {StatusSubmitted, StatusCompleted},
+	StatusSubmitted:  {StatusInProgress, StatusReopened, StatusCompleted},
+	StatusReopened:   {StatusSubmitted, StatusCompleted},
+	StatusCompleted:  {StatusReopened, StatusArchived},
+}
+
+// CanTransition reports whether an assessment can move from one status to
+// another
+func CanTransition(from, to string) bool {
+	for _, status := range statusTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Editable reports whether the responses of an assessment can be changed in
+// its status
+func (a *Assessment) Editable() bool {
+	return a.Status == StatusInProgress || a.Status == StatusReopened
+}
+
+// HasResults reports whether an assessment's scores are final in its status
+func (a *Assessment) HasResults() bool {
+	return a.Status == StatusCompleted || a.Status == StatusArchived
+}
+
+// Aggregation constants, for combining the answers of several respondents
+// to one score per question
+const (
+	AggregationMean      = "mean"
+	AggregationMedian    = "median"
+	AggregationConsensus = "consensus" // The answer given most often
 )
 
 // Common errors
 var (
 	ErrAssessmentNotFound = errors.New("assessment not found")
 	ErrInvalidStatus      = errors.New("invalid assessment status")
+	ErrInvalidTransition  = errors.New("assessment can't move to this status")
+	ErrNotEditable        = errors.New("assessment can't be edited in its status")
+	ErrInvalidAggregation = errors.New("invalid aggregation")
+	ErrCloneOtherTeam     = errors.New("can't clone an assessment of another team")
 )
 
+// ValidAggregation reports whether an aggregation is known
+func ValidAggregation(aggregation string) bool {
+	switch aggregation {
+	case AggregationMean, AggregationMedian, AggregationConsensus:
+		return true
+	}
+	return false
+}
+
+// assessmentColumns lists the assessment columns read by scanAssessment
+const assessmentColumns = `id, organization_id, team_id, created_by, session_id, status, aggregation,
+		       scoring, questionnaire_version_id, cloned_from, created_at, completed_at`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// execer is implemented by both *database.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// scanAssessment scans a row selected with assessmentColumns
+func scanAssessment(row rowScanner, assessment *Assessment) error {
+	var versionID, clonedFrom sql.NullInt64
+	var scoring sql.NullString
+	var completedAt sql.NullTime
+
+	err := row.Scan(
+		&assessment.ID,
+		&assessment.OrganizationID,
+		&assessment.TeamID,
+		&assessment.CreatedBy,
+		&assessment.SessionID,
+		&assessment.Status,
+		&assessment.Aggregation,
+		&scoring,
+		&versionID,
+		&clonedFrom,
+		&assessment.CreatedAt,
+		&completedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Assessments scored before scoring methods existed were summed
+	assessment.Scoring = ScoringSum
+	if scoring.Valid {
+		assessment.Scoring = scoring.String
+	}
+	if versionID.Valid {
+		assessment.QuestionnaireVersionID = int(versionID.Int64)
+	}
+	if clonedFrom.Valid {
+		assessment.ClonedFromID = int(clonedFrom.Int64)
+	}
+	if completedAt.Valid {
+		assessment.CompletedAt = &completedAt.Time
+	}
+
+	return nil
+}
+
+// PinUnversionedAssessments pins assessments created before questionnaire
+// versioning existed to the given questionnaire version
+func (s *AssessmentService) PinUnversionedAssessments(versionID int) (int64, error) {
+	query := `
+		UPDATE assessments
+		SET questionnaire_version_id = ?
+		WHERE questionnaire_version_id IS NULL
+	`
+
+	affected, err := s.db.Update(query, versionID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to pin assessments to questionnaire version: %w", err)
+	}
+
+	return affected, nil
+}
+
 // CreateAssessment creates a new assessment
 func (s *AssessmentService) CreateAssessment(assessment *Assessment) error {
+	if err := prepareAssessment(assessment); err != nil {
+		return err
+	}
+
+	if err := insertAssessment(s.db, assessment); err != nil {
+		return err
+	}
+
+	// Load the created assessment to get timestamps
+	return s.GetAssessmentByID(assessment.ID, assessment)
+}
+
+// prepareAssessment validates a new assessment and fills in the defaults
+func prepareAssessment(assessment *Assessment) error {
 	// Validate status
 	if assessment.Status == "" {
 		assessment.Status = StatusInProgress
@@ -83,52 +236,80 @@ func (s *AssessmentService) CreateAssessment(assessment *Assessment) error {
 		return ErrInvalidStatus
 	}
 
+	if assessment.Aggregation == "" {
+		assessment.Aggregation = AggregationMean
+	}
+	if !ValidAggregation(assessment.Aggregation) {
+		return ErrInvalidAggregation
+	}
+
+	if assessment.Scoring == "" {
+		assessment.Scoring = ScoringSum
+	}
+	if !ValidScoring(assessment.Scoring) {
+		return ErrInvalidScoring
+	}
+
 	// Generate session ID if not provided
 	if assessment.SessionID == "" {
 		assessment.SessionID = generateSessionID()
 	}
 
-	// Insert assessment
+	return nil
+}
+
+// insertAssessment inserts a prepared assessment in the organization of its
+// team and sets its ID
+func insertAssessment(db execer, assessment *Assessment) error {
 	query := `
-		INSERT INTO assessments (team_id, created_by, session_id, status)
-		VALUES (?, ?, ?, ?)
+		INSERT INTO assessments (organization_id, team_id, created_by, session_id, status, aggregation,
+		                         scoring, questionnaire_version_id, cloned_from)
+		SELECT organization_id, id, ?, ?, ?, ?, ?, ?, ? FROM teams WHERE id = ?
 	`
 
-	id, err := s.db.Insert(query,
-		assessment.TeamID,
+	var versionID, clonedFrom interface{}
+	if assessment.QuestionnaireVersionID > 0 {
+		versionID = assessment.QuestionnaireVersionID
+	}
+	if assessment.ClonedFromID > 0 {
+		clonedFrom = assessment.ClonedFromID
+	}
+
+	result, err := db.Exec(query,
 		assessment.CreatedBy,
 		assessment.SessionID,
 		assessment.Status,
+		assessment.Aggregation,
+		assessment.Scoring,
+		versionID,
+		clonedFrom,
+		assessment.TeamID,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create assessment: %w", err)
 	}
 
-	assessment.ID = int(id)
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to create assessment: %w", err)
+	}
+	if id == 0 {
+		return ErrTeamNotFound
+	}
 
-	// Load the created assessment to get timestamps
-	return s.GetAssessmentByID(assessment.ID, assessment)
+	assessment.ID = int(id)
+	return nil
 }
 
 // GetAssessmentByID retrieves an assessment by ID
 func (s *AssessmentService) GetAssessmentByID(id int, assessment *Assessment) error {
 	query := `
-		SELECT id, team_id, created_by, session_id, status, 
-		       created_at, completed_at
+		SELECT ` + assessmentColumns + `
 		FROM assessments
 		WHERE id = ?
 	`
 
-	var completedAt sql.NullTime
-	err := s.db.QueryRowContext(context.Background(), query, id).Scan(
-		&assessment.ID,
-		&assessment.TeamID,
-		&assessment.CreatedBy,
-		&assessment.SessionID,
-		&assessment.Status,
-		&assessment.CreatedAt,
-		&completedAt,
-	)
+	err := scanAssessment(s.db.QueryRowContext(context.Background(), query, id), assessment)
 
 	if err == sql.ErrNoRows {
 		return ErrAssessmentNotFound
@@ -137,32 +318,18 @@ func (s *AssessmentService) GetAssessmentByID(id int, assessment *Assessment) er
 		return fmt.Errorf("failed to get assessment: %w", err)
 	}
 
-	if completedAt.Valid {
-		assessment.CompletedAt = &completedAt.Time
-	}
-
 	return nil
 }
 
 // GetAssessmentBySessionID retrieves an assessment by session ID
 func (s *AssessmentService) GetAssessmentBySessionID(sessionID string, assessment *Assessment) error {
 	query := `
-		SELECT id, team_id, created_by, session_id, status, 
-		       created_at, completed_at
+		SELECT ` + assessmentColumns + `
 		FROM assessments
 		WHERE session_id = ?
 	`
 
-	var completedAt sql.NullTime
-	err := s.db.QueryRowContext(context.Background(), query, sessionID).Scan(
-		&assessment.ID,
-		&assessment.TeamID,
-		&assessment.CreatedBy,
-		&assessment.SessionID,
-		&assessment.Status,
-		&assessment.CreatedAt,
-		&completedAt,
-	)
+	err := scanAssessment(s.db.QueryRowContext(context.Background(), query, sessionID), assessment)
 
 	if err == sql.ErrNoRows {
 		return ErrAssessmentNotFound
@@ -171,36 +338,113 @@ func (s *AssessmentService) GetAssessmentBySessionID(sessionID string, assessmen
 		return fmt.Errorf("failed to get assessment: %w", err)
 	}
 
-	if completedAt.Valid {
-		assessment.CompletedAt = &completedAt.Time
-	}
-
 	return nil
 }
 
-// SaveResponse saves or updates a response for an assessment
-func (s *AssessmentService) SaveResponse(response *Response) error {
-	// Convert answer IDs to JSON
-	answerJSON, err := json.Marshal(response.AnswerIDs)
+// SaveResponses saves or updates responses of an assessment, confirming
+// those copied from a previous assessment. The assessment is locked while
+// they are saved, and ErrNotEditable is returned if it can't be edited, so
+// they never change a submitted or completed assessment.
+func (s *AssessmentService) SaveResponses(assessmentID int, responses []Response) error {
+	return s.db.Transaction(func(tx *sql.Tx) error {
+		if err := lockEditableAssessment(tx, assessmentID); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO responses (assessment_id, question_id, answer_ids)
+			VALUES (?, ?, ?)
+			ON DUPLICATE KEY UPDATE 
+				answer_ids = VALUES(answer_ids),
+				needs_confirmation = FALSE,
+				updated_at = CURRENT_TIMESTAMP
+		`
+
+		for _, response := range responses {
+			// Convert answer IDs to JSON
+			answerJSON, err := json.Marshal(response.AnswerIDs)
+			if err != nil {
+				return fmt.Errorf("failed to marshal answer IDs: %w", err)
+			}
+
+			if _, err := tx.Exec(query, assessmentID, response.QuestionID, string(answerJSON)); err != nil {
+				return fmt.Errorf("failed to save response: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// lockEditableAssessment locks an assessment that can be edited until the
+// end of a transaction, so its status can't change meanwhile. It fails with
+// ErrNotEditable if the assessment can't be edited.
+func lockEditableAssessment(tx *sql.Tx, assessmentID int) error {
+	var id int
+	err := tx.QueryRow(
+		"SELECT id FROM assessments WHERE id = ? AND status IN (?, ?) FOR UPDATE",
+		assessmentID, StatusInProgress, StatusReopened,
+	).Scan(&id)
+
+	if err == sql.ErrNoRows {
+		return ErrNotEditable
+	}
 	if err != nil {
-		return fmt.Errorf("failed to marshal answer IDs: %w", err)
+		return fmt.Errorf("failed to lock assessment: %w", err)
 	}
 
-	// Use INSERT ... ON DUPLICATE KEY UPDATE
+	return nil
+}
+
+// CopyResponses saves responses copied from a previous assessment, flagged
+// until the team confirms them
+func (s *AssessmentService) CopyResponses(assessmentID int, responses []Response) error {
+	return s.db.Transaction(func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO responses (assessment_id, question_id, answer_ids, needs_confirmation)
+			VALUES (?, ?, ?, TRUE)
+		`
+
+		for _, response := range responses {
+			answerJSON, err := json.Marshal(response.AnswerIDs)
+			if err != nil {
+				return fmt.Errorf("failed to marshal answer IDs: %w", err)
+			}
+
+			if _, err := tx.Exec(query, assessmentID, response.QuestionID, string(answerJSON)); err != nil {
+				return fmt.Errorf("failed to copy response: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetUnconfirmedQuestionIDs returns the questions of an assessment whose
+// copied responses haven't been confirmed yet
+func (s *AssessmentService) GetUnconfirmedQuestionIDs(assessmentID int) (map[string]bool, error) {
 	query := `
-		INSERT INTO responses (assessment_id, question_id, answer_ids)
-		VALUES (?, ?, ?)
-		ON DUPLICATE KEY UPDATE 
-			answer_ids = VALUES(answer_ids),
-			updated_at = CURRENT_TIMESTAMP
+		SELECT question_id
+		FROM responses
+		WHERE assessment_id = ? AND needs_confirmation = TRUE
 	`
 
-	_, err = s.db.Insert(query, response.AssessmentID, response.QuestionID, string(answerJSON))
+	rows, err := s.db.GetMany(query, assessmentID)
 	if err != nil {
-		return fmt.Errorf("failed to save response: %w", err)
+		return nil, fmt.Errorf("failed to get unconfirmed responses: %w", err)
 	}
+	defer rows.Close()
 
-	return nil
+	questionIDs := make(map[string]bool)
+	for rows.Next() {
+		var questionID string
+		if err := rows.Scan(&questionID); err != nil {
+			return nil, fmt.Errorf("failed to scan unconfirmed response: %w", err)
+		}
+		questionIDs[questionID] = true
+	}
+
+	return questionIDs, nil
 }
 
 // GetAssessmentResponses retrieves all responses for an assessment
@@ -221,23 +465,8 @@ func (s *AssessmentService) GetAssessmentResponses(assessmentID int) ([]Response
 	var responses []Response
 	for rows.Next() {
 		var response Response
-		var answerJSON string
-
-		err := rows.Scan(
-			&response.ID,
-			&response.AssessmentID,
-			&response.QuestionID,
-			&answerJSON,
-			&response.CreatedAt,
-			&response.UpdatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan response: %w", err)
-		}
-
-		// Parse answer IDs from JSON
-		if err := json.Unmarshal([]byte(answerJSON), &response.AnswerIDs); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal answer IDs: %w", err)
+		if err := scanResponse(rows, &response); err != nil {
+			return nil, err
 		}
 
 		responses = append(responses, response)
@@ -246,24 +475,56 @@ func (s *AssessmentService) GetAssessmentResponses(assessmentID int) ([]Response
 	return responses, nil
 }
 
-// SaveSectionScore saves or updates a section score
-func (s *AssessmentService) SaveSectionScore(score *SectionScore) error {
+// scanResponse scans a response row of id, assessment_id, question_id,
+// answer_ids, created_at and updated_at
+func scanResponse(row rowScanner, response *Response) error {
+	var answerJSON string
+
+	err := row.Scan(
+		&response.ID,
+		&response.AssessmentID,
+		&response.QuestionID,
+		&answerJSON,
+		&response.CreatedAt,
+		&response.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to scan response: %w", err)
+	}
+
+	// Parse answer IDs from JSON
+	if err := json.Unmarshal([]byte(answerJSON), &response.AnswerIDs); err != nil {
+		return fmt.Errorf("failed to unmarshal answer IDs: %w", err)
+	}
+
+	return nil
+}
+
+// saveSectionScore saves or updates a section score
+func saveSectionScore(db execer, score *SectionScore) error {
 	query := `
-		INSERT INTO section_scores (assessment_id, section_name, score, max_score, percentage)
-		VALUES (?, ?, ?, ?, ?)
+		INSERT INTO section_scores (assessment_id, section_name, score, max_score, percentage,
+		                            weight, maturity_level, maturity_name)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 		ON DUPLICATE KEY UPDATE 
 			score = VALUES(score),
 			max_score = VALUES(max_score),
 			percentage = VALUES(percentage),
+			weight = VALUES(weight),
+			maturity_level = VALUES(maturity_level),
+			maturity_name = VALUES(maturity_name),
 			updated_at = CURRENT_TIMESTAMP
 	`
 
-	_, err := s.db.Insert(query,
+	_, err := db.Exec(query,
 		score.AssessmentID,
 		score.SectionName,
 		score.Score,
 		score.MaxScore,
 		score.Percentage,
+		score.Weight,
+		nullID(score.Level),
+		nullString(score.LevelName),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to save section score: %w", err)
@@ -272,11 +533,44 @@ func (s *AssessmentService) SaveSectionScore(score *SectionScore) error {
 	return nil
 }
 
+// sectionScoreColumns lists the section score columns read by
+// scanSectionScore
+const sectionScoreColumns = `id, assessment_id, section_name, score, max_score, percentage,
+		       weight, maturity_level, maturity_name, created_at, updated_at`
+
+// scanSectionScore scans a row selected with sectionScoreColumns
+func scanSectionScore(row rowScanner, score *SectionScore) error {
+	var weight sql.NullFloat64
+	var level sql.NullInt64
+	var levelName sql.NullString
+
+	err := row.Scan(
+		&score.ID,
+		&score.AssessmentID,
+		&score.SectionName,
+		&score.Score,
+		&score.MaxScore,
+		&score.Percentage,
+		&weight,
+		&level,
+		&levelName,
+		&score.CreatedAt,
+		&score.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	score.Weight = weight.Float64
+	score.Level = int(level.Int64)
+	score.LevelName = levelName.String
+	return nil
+}
+
 // GetAssessmentScores retrieves all section scores for an assessment
 func (s *AssessmentService) GetAssessmentScores(assessmentID int) ([]SectionScore, error) {
 	query := `
-		SELECT id, assessment_id, section_name, score, max_score, percentage,
-		       created_at, updated_at
+		SELECT ` + sectionScoreColumns + `
 		FROM section_scores
 		WHERE assessment_id = ?
 		ORDER BY section_name
@@ -291,18 +585,7 @@ func (s *AssessmentService) GetAssessmentScores(assessmentID int) ([]SectionScor
 	var scores []SectionScore
 	for rows.Next() {
 		var score SectionScore
-
-		err := rows.Scan(
-			&score.ID,
-			&score.AssessmentID,
-			&score.SectionName,
-			&score.Score,
-			&score.MaxScore,
-			&score.Percentage,
-			&score.CreatedAt,
-			&score.UpdatedAt,
-		)
-		if err != nil {
+		if err := scanSectionScore(rows, &score); err != nil {
 			return nil, fmt.Errorf("failed to scan section score: %w", err)
 		}
 
@@ -312,21 +595,91 @@ func (s *AssessmentService) GetAssessmentScores(assessmentID int) ([]SectionScor
 	return scores, nil
 }
 
-// CompleteAssessment marks an assessment as completed
-func (s *AssessmentService) CompleteAssessment(assessmentID int) error {
+// TransitionAssessment moves an assessment from one status to another,
+// failing if its status changed meanwhile. Completing it sets its completion
+// time. With a revision, the assessment's responses and section scores are
+// recorded in it, in the same transaction.
+func (s *AssessmentService) TransitionAssessment(assessmentID int, from, to string, revision *AssessmentRevision) error {
+	if !CanTransition(from, to) {
+		return ErrInvalidTransition
+	}
+
+	return s.db.Transaction(func(tx *sql.Tx) error {
+		if err := transitionAssessment(tx, assessmentID, from, to); err != nil {
+			return err
+		}
+
+		if revision == nil {
+			return nil
+		}
+		revision.AssessmentID = assessmentID
+		return recordRevision(tx, revision)
+	})
+}
+
+// CompleteAssessment completes an assessment with its section scores, like
+// TransitionAssessment. The scores are saved in the same transaction as the
+// status change, so they are left untouched if the status changed meanwhile.
+func (s *AssessmentService) CompleteAssessment(assessmentID int, from string, scores []SectionScore, revision *AssessmentRevision) error {
+	if !CanTransition(from, StatusCompleted) {
+		return ErrInvalidTransition
+	}
+
+	return s.db.Transaction(func(tx *sql.Tx) error {
+		if err := transitionAssessment(tx, assessmentID, from, StatusCompleted); err != nil {
+			return err
+		}
+
+		for i := range scores {
+			if err := saveSectionScore(tx, &scores[i]); err != nil {
+				return err
+			}
+		}
+
+		if revision == nil {
+			return nil
+		}
+		revision.AssessmentID = assessmentID
+		return recordRevision(tx, revision)
+	})
+}
+
+// transitionAssessment changes the status of an assessment in a
+// transaction, failing with ErrInvalidTransition if it isn't from anymore
+func transitionAssessment(tx *sql.Tx, assessmentID int, from, to string) error {
 	query := `
-		UPDATE assessments 
-		SET status = ?, completed_at = CURRENT_TIMESTAMP
+		UPDATE assessments
+		SET status = ?, completed_at = IF(? = ?, CURRENT_TIMESTAMP, completed_at)
 		WHERE id = ? AND status = ?
 	`
 
-	affected, err := s.db.Update(query, StatusCompleted, assessmentID, StatusInProgress)
+	result, err := tx.Exec(query, to, to, StatusCompleted, assessmentID, from)
 	if err != nil {
-		return fmt.Errorf("failed to complete assessment: %w", err)
+		return fmt.Errorf("failed to change assessment status: %w", err)
 	}
 
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to change assessment status: %w", err)
+	}
 	if affected == 0 {
-		return fmt.Errorf("assessment not found or already completed")
+		return ErrInvalidTransition
+	}
+
+	return nil
+}
+
+// SetAggregation changes how the answers of respondents are combined, while
+// the assessment can be edited
+func (s *AssessmentService) SetAggregation(assessmentID int, aggregation string) error {
+	if !ValidAggregation(aggregation) {
+		return ErrInvalidAggregation
+	}
+
+	query := `UPDATE assessments SET aggregation = ? WHERE id = ? AND status IN (?, ?)`
+
+	if _, err := s.db.Update(query, aggregation, assessmentID, StatusInProgress, StatusReopened); err != nil {
+		return fmt.Errorf("failed to set aggregation: %w", err)
 	}
 
 	return nil
@@ -352,8 +705,7 @@ func (s *AssessmentService) DeleteAssessment(assessmentID int) error {
 // ListTeamAssessments returns assessments for a specific team
 func (s *AssessmentService) ListTeamAssessments(teamID int, includeInProgress bool) ([]Assessment, error) {
 	query := `
-		SELECT id, team_id, created_by, session_id, status, 
-		       created_at, completed_at
+		SELECT ` + assessmentColumns + `
 		FROM assessments
 		WHERE team_id = ?
 	`
@@ -376,25 +728,10 @@ func (s *AssessmentService) ListTeamAssessments(teamID int, includeInProgress bo
 	var assessments []Assessment
 	for rows.Next() {
 		var assessment Assessment
-		var completedAt sql.NullTime
-
-		err := rows.Scan(
-			&assessment.ID,
-			&assessment.TeamID,
-			&assessment.CreatedBy,
-			&assessment.SessionID,
-			&assessment.Status,
-			&assessment.CreatedAt,
-			&completedAt,
-		)
-		if err != nil {
+		if err := scanAssessment(rows, &assessment); err != nil {
 			return nil, fmt.Errorf("failed to scan assessment: %w", err)
 		}
 
-		if completedAt.Valid {
-			assessment.CompletedAt = &completedAt.Time
-		}
-
 		assessments = append(assessments, assessment)
 	}
 
@@ -413,8 +750,7 @@ func (s *AssessmentService) ListUserAssessments(userID int, offset, limit int) (
 
 	// Get assessments
 	query := `
-		SELECT id, team_id, created_by, session_id, status, 
-		       created_at, completed_at
+		SELECT ` + assessmentColumns + `
 		FROM assessments
 		WHERE created_by = ?
 		ORDER BY created_at DESC
@@ -430,36 +766,21 @@ func (s *AssessmentService) ListUserAssessments(userID int, offset, limit int) (
 	var assessments []Assessment
 	for rows.Next() {
 		var assessment Assessment
-		var completedAt sql.NullTime
-
-		err := rows.Scan(
-			&assessment.ID,
-			&assessment.TeamID,
-			&assessment.CreatedBy,
-			&assessment.SessionID,
-			&assessment.Status,
-			&assessment.CreatedAt,
-			&completedAt,
-		)
-		if err != nil {
+		if err := scanAssessment(rows, &assessment); err != nil {
 			return nil, 0, fmt.Errorf("failed to scan assessment: %w", err)
 		}
 
-		if completedAt.Valid {
-			assessment.CompletedAt = &completedAt.Time
-		}
-
 		assessments = append(assessments, assessment)
 	}
 
 	return assessments, totalCount, nil
 }
 
-// GetLatestTeamAssessment gets the most recent completed assessment for a team
+// GetLatestTeamAssessment gets the most recent completed assessment for a
+// team, archived assessments aren't considered
 func (s *AssessmentService) GetLatestTeamAssessment(teamID int) (*Assessment, error) {
 	query := `
-		SELECT id, team_id, created_by, session_id, status, 
-		       created_at, completed_at
+		SELECT ` + assessmentColumns + `
 		FROM assessments
 		WHERE team_id = ? AND status = ?
 		ORDER BY completed_at DESC
@@ -467,17 +788,7 @@ func (s *AssessmentService) GetLatestTeamAssessment(teamID int) (*Assessment, er
 	`
 
 	assessment := &Assessment{}
-	var completedAt sql.NullTime
-
-	err := s.db.QueryRowContext(context.Background(), query, teamID, StatusCompleted).Scan(
-		&assessment.ID,
-		&assessment.TeamID,
-		&assessment.CreatedBy,
-		&assessment.SessionID,
-		&assessment.Status,
-		&assessment.CreatedAt,
-		&completedAt,
-	)
+	err := scanAssessment(s.db.QueryRowContext(context.Background(), query, teamID, StatusCompleted), assessment)
 
 	if err == sql.ErrNoRows {
 		return nil, ErrAssessmentNotFound
@@ -486,9 +797,14 @@ func (s *AssessmentService) GetLatestTeamAssessment(teamID int) (*Assessment, er
 		return nil, fmt.Errorf("failed to get latest assessment: %w", err)
 	}
 
-	if completedAt.Valid {
-		assessment.CompletedAt = &completedAt.Time
-	}
-
 	return assessment, nil
 }
+
+// generateSessionID generates a random identifier for an assessment session
+func generateSessionID() string {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(bytes)
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"devops-assessment/internal/database"
+)
+
+// AuditEntry represents an entry in the audit log
+type AuditEntry struct {
+	OrganizationID int // 0 for the organization of the user, if any
+	UserID         int // 0 when the action has no known user
+	Action         string
+	ResourceType   string
+	ResourceID     int
+	Details        map[string]interface{}
+	IPAddress      string
+}
+
+// AuditService handles audit log operations
+type AuditService struct {
+	db *database.DB
+}
+
+// NewAuditService creates a new audit service
+func NewAuditService(db *database.DB) *AuditService {
+	return &AuditService{db: db}
+}
+
+// Log writes an entry to the audit log
+func (s *AuditService) Log(entry *AuditEntry) error {
+	details, err := json.Marshal(entry.Details)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit details: %w", err)
+	}
+
+	var organizationID, userID interface{}
+	if entry.OrganizationID > 0 {
+		organizationID = entry.OrganizationID
+	}
+	if entry.UserID > 0 {
+		userID = entry.UserID
+	}
+
+	query := `
+		INSERT INTO audit_logs (organization_id, user_id, action, resource_type, resource_id, details, ip_address)
+		VALUES (COALESCE(?, (SELECT organization_id FROM users WHERE id = ?)), ?, ?, ?, ?, ?, ?)
+	`
+
+	if _, err := s.db.Insert(query,
+		organizationID,
+		userID,
+		userID,
+		entry.Action,
+		entry.ResourceType,
+		entry.ResourceID,
+		string(details),
+		entry.IPAddress,
+	); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"sync"
+	"time"
+)
+
+// PermissionCacheTTL bounds how long cached permissions are used. Changes
+// made through the services invalidate the cache right away; the TTL
+// covers changes made elsewhere, such as by another server instance.
+const PermissionCacheTTL = 30 * time.Second
+
+// permissionSet holds "resource:action" permissions
+type permissionSet map[string]bool
+
+// userPermissions are the permissions a user holds through memberships
+type userPermissions struct {
+	organizationID int
+	superAdmin     bool                  // Has every permission in every organization
+	orgAdmin       bool                  // Has every permission in their organization
+	admin          bool                  // Has the admin role in a team or group, which grants nothing beyond it
+	all            permissionSet         // Held in any team or group
+	teams          map[int]permissionSet // Held through a role in the team
+	groups         map[int]permissionSet // Held through a role in the group
+	loadedAt       time.Time
+}
+
+// cachedTeamGroup is the group of a team, 0 for none, and its organization
+type cachedTeamGroup struct {
+	groupID        int
+	organizationID int
+	loadedAt       time.Time
+}
+
+// cachedGroupAncestors is a group followed by its ancestors, nearest first,
+// and its organization
+type cachedGroupAncestors struct {
+	ancestors      []int
+	organizationID int
+	loadedAt       time.Time
+}
+
+// permissionCache caches the permissions checked on every request. It is
+// shared by all RBAC services, and invalidated by the services that change
+// memberships, roles, teams and groups.
+type permissionCache struct {
+	mu         sync.RWMutex
+	users      map[int]*userPermissions
+	teamGroups map[int]cachedTeamGroup
+	ancestors  map[int]cachedGroupAncestors
+	generation uint64 // Incremented on invalidation, to drop stale loads
+}
+
+var rbacCache = newPermissionCache()
+
+func newPermissionCache() *permissionCache {
+	return &permissionCache{
+		users:      make(map[int]*userPermissions),
+		teamGroups: make(map[int]cachedTeamGroup),
+		ancestors:  make(map[int]cachedGroupAncestors),
+	}
+}
+
+// getUser returns the cached permissions of a user, or nil. The generation
+// must be passed to putUser when loading them.
+func (c *permissionCache) getUser(userID int) (*userPermissions, uint64) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	permissions := c.users[userID]
+	if permissions != nil && time.Since(permissions.loadedAt) > PermissionCacheTTL {
+		permissions = nil
+	}
+	return permissions, c.generation
+}
+
+// putUser caches the permissions of a user, unless the cache was
+// invalidated since they were loaded
+func (c *permissionCache) putUser(userID int, permissions *userPermissions, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation == c.generation {
+		c.users[userID] = permissions
+	}
+}
+
+// getTeamGroup returns the cached group and organization of a team
+func (c *permissionCache) getTeamGroup(teamID int) (cachedTeamGroup, bool, uint64) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	cached, ok := c.teamGroups[teamID]
+	if !ok || time.Since(cached.loadedAt) > PermissionCacheTTL {
+		return cachedTeamGroup{}, false, c.generation
+	}
+	return cached, true, c.generation
+}
+
+// putTeamGroup caches the group and organization of a team, unless the
+// cache was invalidated since they were loaded
+func (c *permissionCache) putTeamGroup(teamID int, team cachedTeamGroup, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation == c.generation {
+		team.loadedAt = time.Now()
+		c.teamGroups[teamID] = team
+	}
+}
+
+// getGroupAncestors returns the cached ancestors and organization of a
+// group
+func (c *permissionCache) getGroupAncestors(groupID int) (cachedGroupAncestors, bool, uint64) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	cached, ok := c.ancestors[groupID]
+	if !ok || time.Since(cached.loadedAt) > PermissionCacheTTL {
+		return cachedGroupAncestors{}, false, c.generation
+	}
+	return cached, true, c.generation
+}
+
+// putGroupAncestors caches the ancestors and organization of a group,
+// unless the cache was invalidated since they were loaded
+func (c *permissionCache) putGroupAncestors(groupID int, group cachedGroupAncestors, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation == c.generation {
+		group.loadedAt = time.Now()
+		c.ancestors[groupID] = group
+	}
+}
+
+// invalidateUser drops the permissions of a user, after a membership change
+func (c *permissionCache) invalidateUser(userID int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	delete(c.users, userID)
+}
+
+// invalidateAll drops everything, after a change to roles, teams or groups
+func (c *permissionCache) invalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.users = make(map[int]*userPermissions)
+	c.teamGroups = make(map[int]cachedTeamGroup)
+	c.ancestors = make(map[int]cachedGroupAncestors)
+}
@@ -0,0 +1,420 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"devops-assessment/internal/database"
+)
+
+// Campaign starts an assessment for each of its teams when it opens, due by
+// a deadline. Team members are reminded as the deadline nears.
+type Campaign struct {
+	ID             int        `json:"id"`
+	OrganizationID int        `json:"organization_id"`
+	Name           string     `json:"name"`
+	TemplateID     string     `json:"template_id"`
+	OpensAt        time.Time  `json:"opens_at"`
+	DueAt          time.Time  `json:"due_at"`
+	ReminderDays   []int      `json:"reminder_days"` // Days before the deadline to send reminders
+	OpenedAt       *time.Time `json:"opened_at,omitempty"`
+	State          string     `json:"state"` // Scheduled, open or closed when loaded
+	CreatedBy      int        `json:"created_by"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	// Relationships (loaded separately)
+	Teams []CampaignTeam `json:"teams,omitempty"`
+}
+
+// CampaignTeam is the progress of a team in a campaign
+type CampaignTeam struct {
+	TeamID        int        `json:"team_id"`
+	TeamName      string     `json:"team_name"`
+	AssessmentID  int        `json:"assessment_id,omitempty"` // Set when the campaign opened
+	Progress      string     `json:"progress"`
+	CompletedAt   *time.Time `json:"completed_at,omitempty"`
+	RemindersSent int        `json:"reminders_sent"`
+}
+
+// Campaign states
+const (
+	CampaignScheduled = "scheduled" // Not opened yet
+	CampaignOpen      = "open"
+	CampaignClosed    = "closed" // Past the due date
+)
+
+// Progress of a team in a campaign
+const (
+	ProgressNotStarted = "not_started"
+	ProgressInProgress = "in_progress"
+	ProgressCompleted  = "completed"
+)
+
+// CampaignService handles campaign-related database operations
+type CampaignService struct {
+	db *database.DB
+}
+
+// NewCampaignService creates a new campaign service
+func NewCampaignService(db *database.DB) *CampaignService {
+	return &CampaignService{db: db}
+}
+
+// Campaign errors
+var (
+	ErrCampaignNotFound    = errors.New("campaign not found")
+	ErrCampaignNoTeams     = errors.New("campaign has no teams")
+	ErrCampaignDates       = errors.New("campaign must be due after it opens")
+	ErrCampaignAlreadyOpen = errors.New("campaign is already open")
+	ErrCampaignTeamStarted = errors.New("campaign assessment of the team is already started")
+)
+
+const campaignColumns = `
+	id, organization_id, name, template_id, opens_at, due_at, reminder_days,
+	opened_at, created_by, created_at, updated_at
+`
+
+// CreateCampaign creates a campaign for a list of teams of its organization
+func (s *CampaignService) CreateCampaign(campaign *Campaign, teamIDs []int) error {
+	if len(teamIDs) == 0 {
+		return ErrCampaignNoTeams
+	}
+	if !campaign.DueAt.After(campaign.OpensAt) {
+		return ErrCampaignDates
+	}
+
+	reminderJSON, err := json.Marshal(campaign.ReminderDays)
+	if err != nil {
+		return fmt.Errorf("failed to marshal reminder days: %w", err)
+	}
+
+	err = s.db.Transaction(func(tx *sql.Tx) error {
+		result, err := tx.Exec(`
+			INSERT INTO campaigns (organization_id, name, template_id, opens_at, due_at, reminder_days, created_by)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, campaign.OrganizationID, campaign.Name, campaign.TemplateID,
+			campaign.OpensAt, campaign.DueAt, string(reminderJSON), campaign.CreatedBy)
+		if err != nil {
+			return fmt.Errorf("failed to create campaign: %w", err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get campaign ID: %w", err)
+		}
+		campaign.ID = int(id)
+
+		// Only teams of the campaign's organization are added
+		for _, teamID := range teamIDs {
+			result, err := tx.Exec(`
+				INSERT IGNORE INTO campaign_teams (campaign_id, team_id)
+				SELECT ?, id FROM teams WHERE id = ? AND organization_id = ?
+			`, campaign.ID, teamID, campaign.OrganizationID)
+			if err != nil {
+				return fmt.Errorf("failed to add campaign team: %w", err)
+			}
+
+			added, err := result.RowsAffected()
+			if err != nil {
+				return fmt.Errorf("failed to add campaign team: %w", err)
+			}
+			if added == 0 {
+				return ErrOrganizationMismatch
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Load the created campaign to get timestamps
+	return s.GetCampaignByID(campaign.ID, campaign)
+}
+
+// GetCampaignByID retrieves a campaign by ID, without its teams
+func (s *CampaignService) GetCampaignByID(id int, campaign *Campaign) error {
+	query := `SELECT ` + campaignColumns + ` FROM campaigns WHERE id = ?`
+
+	err := scanCampaign(s.db.QueryRowContext(context.Background(), query, id), campaign)
+
+	if err == sql.ErrNoRows {
+		return ErrCampaignNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get campaign: %w", err)
+	}
+
+	return nil
+}
+
+// ListCampaigns returns the campaigns of an organization, latest first
+func (s *CampaignService) ListCampaigns(organizationID int) ([]Campaign, error) {
+	query := `
+		SELECT ` + campaignColumns + `
+		FROM campaigns
+		WHERE organization_id = ?
+		ORDER BY opens_at DESC
+	`
+
+	return s.listCampaigns(query, organizationID)
+}
+
+// ListDueCampaigns returns the campaigns of all organizations that are
+// scheduled to open by a time
+func (s *CampaignService) ListDueCampaigns(now time.Time) ([]Campaign, error) {
+	query := `
+		SELECT ` + campaignColumns + `
+		FROM campaigns
+		WHERE opened_at IS NULL AND opens_at <= ?
+		ORDER BY opens_at
+	`
+
+	return s.listCampaigns(query, now)
+}
+
+// ListOpenCampaigns returns the campaigns of all organizations that are open
+// at a time
+func (s *CampaignService) ListOpenCampaigns(now time.Time) ([]Campaign, error) {
+	query := `
+		SELECT ` + campaignColumns + `
+		FROM campaigns
+		WHERE opened_at IS NOT NULL AND due_at > ?
+		ORDER BY due_at
+	`
+
+	return s.listCampaigns(query, now)
+}
+
+func (s *CampaignService) listCampaigns(query string, args ...interface{}) ([]Campaign, error) {
+	rows, err := s.db.GetMany(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list campaigns: %w", err)
+	}
+	defer rows.Close()
+
+	campaigns := []Campaign{}
+	for rows.Next() {
+		var campaign Campaign
+		if err := scanCampaign(rows, &campaign); err != nil {
+			return nil, fmt.Errorf("failed to scan campaign: %w", err)
+		}
+		campaigns = append(campaigns, campaign)
+	}
+
+	return campaigns, nil
+}
+
+// UpdateCampaign updates the name, dates and reminders of a campaign. The
+// opening date can't change once the campaign is open.
+func (s *CampaignService) UpdateCampaign(campaign *Campaign) error {
+	if !campaign.DueAt.After(campaign.OpensAt) {
+		return ErrCampaignDates
+	}
+
+	reminderJSON, err := json.Marshal(campaign.ReminderDays)
+	if err != nil {
+		return fmt.Errorf("failed to marshal reminder days: %w", err)
+	}
+
+	query := `
+		UPDATE campaigns
+		SET name = ?, opens_at = IF(opened_at IS NULL, ?, opens_at), due_at = ?, reminder_days = ?
+		WHERE id = ?
+	`
+
+	_, err = s.db.Update(query, campaign.Name, campaign.OpensAt, campaign.DueAt, string(reminderJSON), campaign.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update campaign: %w", err)
+	}
+
+	return s.GetCampaignByID(campaign.ID, campaign)
+}
+
+// DeleteCampaign deletes a campaign. Assessments it started are kept.
+func (s *CampaignService) DeleteCampaign(campaignID int) error {
+	affected, err := s.db.Delete("DELETE FROM campaigns WHERE id = ?", campaignID)
+	if err != nil {
+		return fmt.Errorf("failed to delete campaign: %w", err)
+	}
+
+	if affected == 0 {
+		return ErrCampaignNotFound
+	}
+
+	return nil
+}
+
+// GetCampaignTeams returns the progress of the teams of a campaign. A team
+// that hasn't answered a question yet hasn't started.
+func (s *CampaignService) GetCampaignTeams(campaignID int) ([]CampaignTeam, error) {
+	query := `
+		SELECT ct.team_id, t.name, ct.assessment_id, ct.reminders_sent, a.status, a.completed_at,
+		       EXISTS (SELECT 1 FROM responses r WHERE r.assessment_id = ct.assessment_id)
+		       OR EXISTS (
+		           SELECT 1 FROM respondent_responses rr
+		           JOIN assessment_respondents ar ON rr.respondent_id = ar.id
+		           WHERE ar.assessment_id = ct.assessment_id
+		       ) AS started
+		FROM campaign_teams ct
+		JOIN teams t ON ct.team_id = t.id
+		LEFT JOIN assessments a ON ct.assessment_id = a.id
+		WHERE ct.campaign_id = ?
+		ORDER BY t.name
+	`
+
+	rows, err := s.db.GetMany(query, campaignID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get campaign teams: %w", err)
+	}
+	defer rows.Close()
+
+	teams := []CampaignTeam{}
+	for rows.Next() {
+		var team CampaignTeam
+		var assessmentID sql.NullInt64
+		var status sql.NullString
+		var completedAt sql.NullTime
+		var started bool
+
+		err := rows.Scan(
+			&team.TeamID,
+			&team.TeamName,
+			&assessmentID,
+			&team.RemindersSent,
+			&status,
+			&completedAt,
+			&started,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan campaign team: %w", err)
+		}
+
+		team.AssessmentID = int(assessmentID.Int64)
+		if completedAt.Valid {
+			team.CompletedAt = &completedAt.Time
+		}
+
+		switch {
+		case status.String == StatusCompleted || status.String == StatusArchived:
+			team.Progress = ProgressCompleted
+		case started:
+			team.Progress = ProgressInProgress
+		default:
+			team.Progress = ProgressNotStarted
+		}
+
+		teams = append(teams, team)
+	}
+
+	return teams, nil
+}
+
+// StartTeamAssessment creates the assessment of a team of a campaign and
+// records it in the same transaction, so that no assessment is left behind
+// unrecorded to be started again. It returns ErrCampaignTeamStarted if the
+// team's assessment was started meanwhile.
+func (s *CampaignService) StartTeamAssessment(campaignID int, assessment *Assessment) error {
+	if err := prepareAssessment(assessment); err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *sql.Tx) error {
+		if err := insertAssessment(tx, assessment); err != nil {
+			return err
+		}
+
+		result, err := tx.Exec(`
+			UPDATE campaign_teams SET assessment_id = ?
+			WHERE campaign_id = ? AND team_id = ? AND assessment_id IS NULL
+		`, assessment.ID, campaignID, assessment.TeamID)
+		if err != nil {
+			return fmt.Errorf("failed to set campaign assessment: %w", err)
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to set campaign assessment: %w", err)
+		}
+		if affected == 0 {
+			return ErrCampaignTeamStarted
+		}
+
+		return nil
+	})
+}
+
+// SetRemindersSent records how many reminders were sent to a team of a
+// campaign
+func (s *CampaignService) SetRemindersSent(campaignID, teamID, count int) error {
+	query := `UPDATE campaign_teams SET reminders_sent = ? WHERE campaign_id = ? AND team_id = ?`
+
+	if _, err := s.db.Update(query, count, campaignID, teamID); err != nil {
+		return fmt.Errorf("failed to set campaign reminders: %w", err)
+	}
+
+	return nil
+}
+
+// MarkOpened records that the assessments of a campaign were started
+func (s *CampaignService) MarkOpened(campaignID int) error {
+	query := `UPDATE campaigns SET opened_at = CURRENT_TIMESTAMP WHERE id = ? AND opened_at IS NULL`
+
+	affected, err := s.db.Update(query, campaignID)
+	if err != nil {
+		return fmt.Errorf("failed to open campaign: %w", err)
+	}
+
+	if affected == 0 {
+		return ErrCampaignAlreadyOpen
+	}
+
+	return nil
+}
+
+// scanCampaign scans a row selected with campaignColumns
+func scanCampaign(row rowScanner, campaign *Campaign) error {
+	var reminderJSON string
+	var openedAt sql.NullTime
+
+	err := row.Scan(
+		&campaign.ID,
+		&campaign.OrganizationID,
+		&campaign.Name,
+		&campaign.TemplateID,
+		&campaign.OpensAt,
+		&campaign.DueAt,
+		&reminderJSON,
+		&openedAt,
+		&campaign.CreatedBy,
+		&campaign.CreatedAt,
+		&campaign.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal([]byte(reminderJSON), &campaign.ReminderDays); err != nil {
+		return fmt.Errorf("failed to unmarshal reminder days: %w", err)
+	}
+	if openedAt.Valid {
+		campaign.OpenedAt = &openedAt.Time
+	}
+
+	switch {
+	case campaign.OpenedAt == nil:
+		campaign.State = CampaignScheduled
+	case time.Now().After(campaign.DueAt):
+		campaign.State = CampaignClosed
+	default:
+		campaign.State = CampaignOpen
+	}
+
+	return nil
+}
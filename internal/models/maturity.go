@@ -0,0 +1,169 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+)
+
+// MaturityLevel is a band of section percentages, like Defined from 40%
+type MaturityLevel struct {
+	Level       int    `json:"level"` // 1 for the lowest
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// String returns the level as "3 - Defined"
+func (l MaturityLevel) String() string {
+	return strconv.Itoa(l.Level) + " - " + l.Name
+}
+
+// SectionThresholds overrides the thresholds of the maturity levels for a
+// section and its subcategories
+type SectionThresholds struct {
+	Thresholds    []float64            `json:"Thresholds,omitempty"`
+	SubCategories map[string][]float64 `json:"SubCategories,omitempty"`
+}
+
+// MaturityModel maps section and subcategory percentages to maturity
+// levels. Thresholds hold the minimum percentage of every level but the
+// first, lowest first.
+type MaturityModel struct {
+	Levels     []MaturityLevel              `json:"Levels"`
+	Thresholds []float64                    `json:"Thresholds"`
+	Sections   map[string]SectionThresholds `json:"Sections,omitempty"`
+}
+
+// DefaultMaturityModel returns the five levels used by questionnaires
+// without a maturity file, in steps of 20%
+func DefaultMaturityModel() *MaturityModel {
+	return &MaturityModel{
+		Levels: []MaturityLevel{
+			{Level: 1, Name: "Initial", Description: "Practices are ad hoc and depend on individuals"},
+			{Level: 2, Name: "Managed", Description: "Practices are planned and repeated within the team"},
+			{Level: 3, Name: "Defined", Description: "Practices are standardized and documented"},
+			{Level: 4, Name: "Measured", Description: "Practices are measured and controlled"},
+			{Level: 5, Name: "Optimising", Description: "Practices are continuously improved"},
+		},
+		Thresholds: []float64{20, 40, 60, 80},
+	}
+}
+
+// LoadMaturityModel loads the maturity levels of a questionnaire from a
+// JSON file
+func LoadMaturityModel(file string) (*MaturityModel, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read maturity file: %w", err)
+	}
+
+	model := &MaturityModel{}
+	if err := json.Unmarshal(data, model); err != nil {
+		return nil, fmt.Errorf("failed to parse maturity JSON: %w", err)
+	}
+
+	// Levels are numbered in file order
+	for i := range model.Levels {
+		model.Levels[i].Level = i + 1
+	}
+
+	if err := model.validate(); err != nil {
+		return nil, fmt.Errorf("invalid maturity file %s: %w", file, err)
+	}
+
+	return model, nil
+}
+
+// validate checks that there are at least two levels, and that every list
+// of thresholds has one ascending percentage per level above the first
+func (m *MaturityModel) validate() error {
+	if len(m.Levels) < 2 {
+		return fmt.Errorf("at least two levels are required")
+	}
+	for _, level := range m.Levels {
+		if level.Name == "" {
+			return fmt.Errorf("level %d has no name", level.Level)
+		}
+	}
+
+	if err := m.validateThresholds("the default thresholds", m.Thresholds); err != nil {
+		return err
+	}
+	for sectionName, section := range m.Sections {
+		if section.Thresholds != nil {
+			if err := m.validateThresholds(sectionName, section.Thresholds); err != nil {
+				return err
+			}
+		}
+		for subCategory, thresholds := range section.SubCategories {
+			if err := m.validateThresholds(sectionName+" / "+subCategory, thresholds); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateThresholds checks one list of thresholds
+func (m *MaturityModel) validateThresholds(name string, thresholds []float64) error {
+	if len(thresholds) != len(m.Levels)-1 {
+		return fmt.Errorf("%s need %d thresholds, one per level above the first", name, len(m.Levels)-1)
+	}
+
+	previous := 0.0
+	for _, threshold := range thresholds {
+		if threshold <= previous || threshold > 100 {
+			return fmt.Errorf("%s must ascend from above 0 to at most 100", name)
+		}
+		previous = threshold
+	}
+
+	return nil
+}
+
+// thresholds returns the thresholds of a subcategory of a section, of the
+// section when subCategory is empty, falling back to the section's and the
+// default thresholds
+func (m *MaturityModel) thresholds(sectionName, subCategory string) []float64 {
+	section, exists := m.Sections[sectionName]
+	if !exists {
+		return m.Thresholds
+	}
+	if subCategory != "" {
+		if thresholds, exists := section.SubCategories[subCategory]; exists {
+			return thresholds
+		}
+	}
+	if section.Thresholds != nil {
+		return section.Thresholds
+	}
+	return m.Thresholds
+}
+
+// Level returns the maturity level of a section percentage, or of a
+// subcategory of the section when subCategory is set
+func (m *MaturityModel) Level(sectionName, subCategory string, percentage float64) MaturityLevel {
+	level := 0
+	for _, threshold := range m.thresholds(sectionName, subCategory) {
+		if percentage >= threshold {
+			level++
+		}
+	}
+	return m.Levels[level]
+}
+
+// AssignLevel sets the maturity level of a section score, or of a
+// subcategory score of the section when subCategory is set
+func (m *MaturityModel) AssignLevel(score *SectionScore, sectionName, subCategory string) {
+	level := m.Level(sectionName, subCategory, score.Percentage)
+	score.Level = level.Level
+	score.LevelName = level.Name
+}
+
+// MaturityLevel returns the maturity level of a section score, as assigned
+// by AssignLevel
+func (s SectionScore) MaturityLevel() MaturityLevel {
+	return MaturityLevel{Level: s.Level, Name: s.LevelName}
+}
@@ -0,0 +1,172 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"devops-assessment/internal/database"
+)
+
+// Organization represents a tenant. Users, groups, teams and assessments
+// belong to exactly one organization and are invisible to the others.
+type Organization struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"` // Subdomain and X-Organization header value
+	IsActive  bool      `json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DefaultOrganizationSlug is the organization created by the migration that
+// introduced organizations, holding all data that existed before
+const DefaultOrganizationSlug = "default"
+
+// OrganizationService handles organization-related database operations
+type OrganizationService struct {
+	db *database.DB
+}
+
+// NewOrganizationService creates a new organization service
+func NewOrganizationService(db *database.DB) *OrganizationService {
+	return &OrganizationService{db: db}
+}
+
+// Organization errors
+var (
+	ErrOrganizationNotFound   = errors.New("organization not found")
+	ErrOrganizationSlugExists = errors.New("organization slug already exists")
+	ErrOrganizationMismatch   = errors.New("resources belong to different organizations")
+)
+
+const organizationColumns = `id, name, slug, is_active, created_at, updated_at`
+
+// CreateOrganization creates a new organization
+func (s *OrganizationService) CreateOrganization(organization *Organization) error {
+	// Check if slug already exists
+	exists, err := s.db.Exists("SELECT 1 FROM organizations WHERE slug = ?", organization.Slug)
+	if err != nil {
+		return fmt.Errorf("failed to check organization slug existence: %w", err)
+	}
+	if exists {
+		return ErrOrganizationSlugExists
+	}
+
+	query := `
+		INSERT INTO organizations (name, slug, is_active)
+		VALUES (?, ?, ?)
+	`
+
+	id, err := s.db.Insert(query, organization.Name, organization.Slug, organization.IsActive)
+	if err != nil {
+		return fmt.Errorf("failed to create organization: %w", err)
+	}
+
+	organization.ID = int(id)
+
+	// Load the created organization to get timestamps
+	return s.GetOrganizationByID(organization.ID, organization)
+}
+
+// GetOrganizationByID retrieves an organization by ID
+func (s *OrganizationService) GetOrganizationByID(id int, organization *Organization) error {
+	query := `SELECT ` + organizationColumns + ` FROM organizations WHERE id = ?`
+
+	return s.getOrganization(organization, query, id)
+}
+
+// GetOrganizationBySlug retrieves an organization by slug
+func (s *OrganizationService) GetOrganizationBySlug(slug string, organization *Organization) error {
+	query := `SELECT ` + organizationColumns + ` FROM organizations WHERE slug = ?`
+
+	return s.getOrganization(organization, query, slug)
+}
+
+// ListOrganizations returns all organizations
+func (s *OrganizationService) ListOrganizations() ([]Organization, error) {
+	query := `SELECT ` + organizationColumns + ` FROM organizations ORDER BY name`
+
+	rows, err := s.db.GetMany(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organizations: %w", err)
+	}
+	defer rows.Close()
+
+	organizations := []Organization{}
+	for rows.Next() {
+		var organization Organization
+		if err := scanOrganization(rows, &organization); err != nil {
+			return nil, fmt.Errorf("failed to scan organization: %w", err)
+		}
+		organizations = append(organizations, organization)
+	}
+
+	return organizations, nil
+}
+
+// UpdateOrganization updates the name and status of an organization. The
+// slug can't change, as it is part of the organization's URLs.
+func (s *OrganizationService) UpdateOrganization(organization *Organization) error {
+	query := `
+		UPDATE organizations
+		SET name = ?, is_active = ?
+		WHERE id = ?
+	`
+
+	affected, err := s.db.Update(query, organization.Name, organization.IsActive, organization.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update organization: %w", err)
+	}
+
+	if affected == 0 {
+		return ErrOrganizationNotFound
+	}
+
+	return nil
+}
+
+// getOrganization runs a query selecting one organization
+func (s *OrganizationService) getOrganization(organization *Organization, query string, args ...interface{}) error {
+	err := scanOrganization(s.db.QueryRowContext(context.Background(), query, args...), organization)
+
+	if err == sql.ErrNoRows {
+		return ErrOrganizationNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get organization: %w", err)
+	}
+
+	return nil
+}
+
+// scanOrganization scans a row selected with organizationColumns
+func scanOrganization(row rowScanner, organization *Organization) error {
+	return row.Scan(
+		&organization.ID,
+		&organization.Name,
+		&organization.Slug,
+		&organization.IsActive,
+		&organization.CreatedAt,
+		&organization.UpdatedAt,
+	)
+}
+
+// checkSameOrganization checks that a row of a tenant table belongs to an
+// organization. It returns ErrOrganizationMismatch for rows of other
+// organizations and missing rows alike.
+func checkSameOrganization(db *database.DB, table string, id, organizationID int) error {
+	query := fmt.Sprintf("SELECT 1 FROM %s WHERE id = ? AND organization_id = ?", table)
+
+	exists, err := db.Exists(query, id, organizationID)
+	if err != nil {
+		return fmt.Errorf("failed to check %s organization: %w", table, err)
+	}
+	if !exists {
+		return ErrOrganizationMismatch
+	}
+
+	return nil
+}
@@ -1,15 +1,32 @@
 package models
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"strconv"
 	"strings"
 )
 
+// Survey errors
+var (
+	ErrQuestionNotFound = errors.New("question not found")
+	ErrUnknownSection   = errors.New("section not found in the survey")
+	ErrInvalidAnswer    = errors.New("answer doesn't fit the question")
+)
+
 // Survey represents the entire survey structure
 type Survey struct {
 	Sections []Section `json:"sections"`
+
+	// TemplateID is the questionnaire template the survey belongs to
+	TemplateID string `json:"template_id,omitempty"`
+
+	// VersionID is the questionnaire version the survey was loaded from
+	VersionID int `json:"version_id,omitempty"`
 }
 
 // Section represents a section of the survey
@@ -18,36 +35,71 @@ type Section struct {
 	SpiderPos         int        `json:"SpiderPos,omitempty"`
 	Questions         []Question `json:"Questions"`
 	HasSubCategories  bool       `json:"HasSubCategories,omitempty"`
+	Weight            float64    `json:"Weight,omitempty"` // In the weighted overall score, 1 when omitted
 }
 
 // Question represents a survey question
 type Question struct {
-	ID           string   `json:"ID,omitempty"`          // Generated ID like S1-Q1
+	ID           string   `json:"ID,omitempty"`          // Stable ID like q-669d5476
 	Type         string   `json:"Type"`                  // "Option", "Checkbox", "Banner"
 	SubCategory  string   `json:"SubCategory,omitempty"`
 	QuestionText string   `json:"QuestionText"`
 	Answers      []Answer `json:"Answers,omitempty"`
+	Weight       float64  `json:"Weight,omitempty"` // Multiplies the question's scores, 1 when omitted
+
+	// LegacyID is the positional ID (S1-Q1) used before stable IDs existed
+	LegacyID string `json:"-"`
+
+	// Set in the survey of an assessment cloned from a previous one
+	NeedsConfirmation bool `json:"NeedsConfirmation,omitempty"` // Answer copied and not confirmed yet
+	Changed           bool `json:"Changed,omitempty"`           // Answer differs from the previous assessment
 }
 
 // Answer represents a possible answer to a question
 type Answer struct {
-	ID     string  `json:"ID,omitempty"`     // Generated ID like S1-Q1-A1
+	ID     string  `json:"ID,omitempty"`     // Stable ID like a-9a0dcdfa
 	Answer string  `json:"Answer"`
 	Score  float64 `json:"Score"`
 	Value  string  `json:"Value,omitempty"`  // "checked" or empty
+
+	// LegacyID is the positional ID (S1-Q1-A1) used before stable IDs existed
+	LegacyID string `json:"-"`
 }
 
 // QuestionService handles question-related operations
 type QuestionService struct {
 	questionsFile string
 	adviceFile    string
+	maturity      *MaturityModel
 }
 
-// NewQuestionService creates a new question service
+// NewQuestionService creates a new question service with the default
+// maturity levels
 func NewQuestionService(questionsFile, adviceFile string) *QuestionService {
 	return &QuestionService{
 		questionsFile: questionsFile,
 		adviceFile:    adviceFile,
+		maturity:      DefaultMaturityModel(),
+	}
+}
+
+// SetMaturityModel replaces the maturity levels sections are banded into
+func (s *QuestionService) SetMaturityModel(maturity *MaturityModel) {
+	s.maturity = maturity
+}
+
+// MaturityModel returns the maturity levels sections are banded into
+func (s *QuestionService) MaturityModel() *MaturityModel {
+	return s.maturity
+}
+
+// AssignLevels sets the maturity level of section scores that have none,
+// such as those saved before maturity levels existed
+func (s *QuestionService) AssignLevels(scores []SectionScore) {
+	for i := range scores {
+		if scores[i].Level == 0 {
+			s.maturity.AssignLevel(&scores[i], scores[i].SectionName, "")
+		}
 	}
 }
 
@@ -64,21 +116,55 @@ func (s *QuestionService) LoadQuestions() (*Survey, error) {
 		return nil, fmt.Errorf("failed to parse questions JSON: %w", err)
 	}
 
+	// Weights can only scale scores up or down
+	for _, section := range sections {
+		if section.Weight < 0 {
+			return nil, fmt.Errorf("section %s has a negative weight", section.SectionName)
+		}
+		for _, question := range section.Questions {
+			if question.Weight < 0 {
+				return nil, fmt.Errorf("question %q of section %s has a negative weight", question.QuestionText, section.SectionName)
+			}
+		}
+	}
+
 	// Process sections and assign IDs
 	survey := &Survey{Sections: sections}
-	s.assignQuestionIDs(survey)
+	if err := s.assignQuestionIDs(survey); err != nil {
+		return nil, err
+	}
 	s.detectSubCategories(survey)
 
 	return survey, nil
 }
 
-// assignQuestionIDs assigns unique IDs to questions and answers
-func (s *QuestionService) assignQuestionIDs(survey *Survey) {
+// assignQuestionIDs assigns unique IDs to questions and answers.
+// IDs declared in the questions file are kept as-is so that reordering or
+// inserting questions never changes them. Questions and answers without a
+// declared ID get a content-addressed one derived from their text.
+func (s *QuestionService) assignQuestionIDs(survey *Survey) error {
+	seen := make(map[string]string)
+	claim := func(id, owner string) error {
+		if other, exists := seen[id]; exists {
+			return fmt.Errorf("duplicate question/answer ID %s (%s and %s)", id, other, owner)
+		}
+		seen[id] = owner
+		return nil
+	}
+
 	for sectionIndex, section := range survey.Sections {
 		for questionIndex, question := range section.Questions {
 			if question.Type != "Banner" {
+				// Keep the positional ID so old responses can be migrated
+				question.LegacyID = fmt.Sprintf("S%d-Q%d", sectionIndex+1, questionIndex+1)
+
 				// Assign question ID
-				question.ID = fmt.Sprintf("S%d-Q%d", sectionIndex+1, questionIndex+1)
+				if question.ID == "" {
+					question.ID = ContentID("q", section.SectionName, question.QuestionText)
+				}
+				if err := claim(question.ID, question.LegacyID); err != nil {
+					return err
+				}
 				
 				// Add default yes/no answers if not specified
 				if len(question.Answers) == 0 {
@@ -90,12 +176,14 @@ func (s *QuestionService) assignQuestionIDs(survey *Survey) {
 				
 				// Assign answer IDs
 				for answerIndex := range question.Answers {
-					question.Answers[answerIndex].ID = fmt.Sprintf("S%d-Q%d-A%d", 
-						sectionIndex+1, questionIndex+1, answerIndex+1)
-					
-					// Initialize value if not set
-					if question.Answers[answerIndex].Value == "" {
-						question.Answers[answerIndex].Value = ""
+					answer := &question.Answers[answerIndex]
+					answer.LegacyID = fmt.Sprintf("%s-A%d", question.LegacyID, answerIndex+1)
+
+					if answer.ID == "" {
+						answer.ID = ContentID("a", question.ID, answer.Answer)
+					}
+					if err := claim(answer.ID, answer.LegacyID); err != nil {
+						return err
 					}
 				}
 				
@@ -104,6 +192,33 @@ func (s *QuestionService) assignQuestionIDs(survey *Survey) {
 			}
 		}
 	}
+
+	return nil
+}
+
+// ContentID derives a short, stable ID from the given content. It is used for
+// questions and answers that don't declare an ID in the questions file.
+func ContentID(prefix string, parts ...string) string {
+	sum := sha1.Sum([]byte(strings.Join(parts, "\x00")))
+	return prefix + "-" + hex.EncodeToString(sum[:4])
+}
+
+// LegacyIDMap maps the positional IDs (S1-Q1, S1-Q1-A1) of the given survey
+// to the stable IDs of the same questions and answers
+func (s *QuestionService) LegacyIDMap(survey *Survey) map[string]string {
+	idMap := make(map[string]string)
+	for _, section := range survey.Sections {
+		for _, question := range section.Questions {
+			if question.LegacyID == "" {
+				continue
+			}
+			idMap[question.LegacyID] = question.ID
+			for _, answer := range question.Answers {
+				idMap[answer.LegacyID] = answer.ID
+			}
+		}
+	}
+	return idMap
 }
 
 // detectSubCategories detects if sections have subcategories
@@ -137,7 +252,7 @@ func (s *QuestionService) GetSectionByURLName(survey *Survey, urlName string) (*
 			return &survey.Sections[i], nil
 		}
 	}
-	return nil, fmt.Errorf("section not found: %s", urlName)
+	return nil, fmt.Errorf("%w: %s", ErrUnknownSection, urlName)
 }
 
 // GetQuestionByID returns a question by its ID
@@ -149,7 +264,7 @@ func (s *QuestionService) GetQuestionByID(survey *Survey, questionID string) (*Q
 			}
 		}
 	}
-	return nil, fmt.Errorf("question not found: %s", questionID)
+	return nil, fmt.Errorf("%w: %s", ErrQuestionNotFound, questionID)
 }
 
 // CalculateQuestionScore calculates the score for a question based on selected answers
@@ -258,39 +373,99 @@ func (s *QuestionService) ExtractResponses(survey *Survey, assessmentID int) []R
 	return responses
 }
 
-// CalculateSectionScores calculates scores for all sections
+// ScoreResponses returns the score of each answered question, computed from
+// the answer IDs of the responses without changing the survey
+func (s *QuestionService) ScoreResponses(survey *Survey, responses []Response) map[string]float64 {
+	responseMap := make(map[string][]string)
+	for _, response := range responses {
+		responseMap[response.QuestionID] = response.AnswerIDs
+	}
+
+	scores := make(map[string]float64)
+	for _, section := range survey.Sections {
+		for _, question := range section.Questions {
+			answerIDs, exists := responseMap[question.ID]
+			if !exists || question.Type == "Banner" {
+				continue
+			}
+
+			score := 0.0
+			for _, answer := range question.Answers {
+				for _, answerID := range answerIDs {
+					if answer.ID == answerID {
+						score += answer.Score
+					}
+				}
+			}
+			scores[question.ID] = score
+		}
+	}
+
+	return scores
+}
+
+// checkedScores returns the score of the checked answers of each question
+func (s *QuestionService) checkedScores(survey *Survey) map[string]float64 {
+	scores := make(map[string]float64)
+	for _, section := range survey.Sections {
+		for _, question := range section.Questions {
+			scores[question.ID] += s.CalculateQuestionScore(&question)
+		}
+	}
+	return scores
+}
+
+// CalculateSectionScores calculates scores for all sections from the checked
+// answers
 func (s *QuestionService) CalculateSectionScores(survey *Survey, assessmentID int) []SectionScore {
+	return s.ScoreSections(survey, assessmentID, s.checkedScores(survey))
+}
+
+// ScoreSections calculates scores for all sections from the given question
+// scores, such as those of one respondent or the aggregate of all of them.
+// Questions without a score count as 0.
+func (s *QuestionService) ScoreSections(survey *Survey, assessmentID int, questionScores map[string]float64) []SectionScore {
 	var scores []SectionScore
-	
+
 	for _, section := range survey.Sections {
 		score := 0.0
 		maxScore := 0.0
-		
+
 		// Calculate scores for all questions in the section
 		for _, question := range section.Questions {
-			score += s.CalculateQuestionScore(&question)
-			maxScore += s.CalculateQuestionMaxScore(&question)
+			score += questionScores[question.ID] * question.ScoreWeight()
+			maxScore += s.CalculateQuestionMaxScore(&question) * question.ScoreWeight()
 		}
 		
 		// Only include sections that have scoreable questions
 		if maxScore > 0 {
 			percentage := (score / maxScore) * 100
 			
-			scores = append(scores, SectionScore{
+			sectionScore := SectionScore{
 				AssessmentID: assessmentID,
 				SectionName:  section.SectionName,
 				Score:        score,
 				MaxScore:     maxScore,
 				Percentage:   percentage,
-			})
+				Weight:       section.ScoreWeight(),
+			}
+			s.maturity.AssignLevel(&sectionScore, section.SectionName, "")
+			scores = append(scores, sectionScore)
 		}
 	}
 	
 	return scores
 }
 
-// CalculateSubCategoryScores calculates scores for subcategories within a section
+// CalculateSubCategoryScores calculates scores for subcategories within a
+// section from the checked answers
 func (s *QuestionService) CalculateSubCategoryScores(survey *Survey, sectionName string, assessmentID int) []SectionScore {
+	return s.ScoreSubCategories(survey, sectionName, assessmentID, s.checkedScores(survey))
+}
+
+// ScoreSubCategories calculates scores for subcategories within a section
+// from the given question scores
+func (s *QuestionService) ScoreSubCategories(survey *Survey, sectionName string, assessmentID int, questionScores map[string]float64) []SectionScore {
 	var scores []SectionScore
 	subCategoryScores := make(map[string]*SectionScore)
 	
@@ -319,8 +494,8 @@ func (s *QuestionService) CalculateSubCategoryScores(survey *Survey, sectionName
 				}
 			}
 			
-			subCategoryScores[question.SubCategory].Score += s.CalculateQuestionScore(&question)
-			subCategoryScores[question.SubCategory].MaxScore += s.CalculateQuestionMaxScore(&question)
+			subCategoryScores[question.SubCategory].Score += questionScores[question.ID] * question.ScoreWeight()
+			subCategoryScores[question.SubCategory].MaxScore += s.CalculateQuestionMaxScore(&question) * question.ScoreWeight()
 		}
 	}
 	
@@ -328,6 +503,7 @@ func (s *QuestionService) CalculateSubCategoryScores(survey *Survey, sectionName
 	for _, score := range subCategoryScores {
 		if score.MaxScore > 0 {
 			score.Percentage = (score.Score / score.MaxScore) * 100
+			s.maturity.AssignLevel(score, sectionName, score.SectionName)
 			scores = append(scores, *score)
 		}
 	}
@@ -335,12 +511,80 @@ func (s *QuestionService) CalculateSubCategoryScores(survey *Survey, sectionName
 	return scores
 }
 
-// Advice represents improvement advice for a section
+// Advice represents improvement advice for a section, or for a subcategory
+// of a section
 type Advice struct {
-	SectionName string             `json:"section_name"`
-	Advice      string             `json:"advice"`
-	ReadMore    string             `json:"read_more,omitempty"`
-	Links       []AdviceLink       `json:"links"`
+	SectionName   string                `json:"section_name"`
+	SubCategory   string                `json:"sub_category,omitempty"`
+	Advice        string                `json:"advice"`
+	ReadMore      string                `json:"read_more,omitempty"`
+	Links         []AdviceLink          `json:"links"`
+	Level         int                   `json:"level,omitempty"`         // Set by ForScore
+	Levels        map[int]AdviceVariant `json:"levels,omitempty"`        // Advice by maturity level
+	Ranges        []RangeAdvice         `json:"ranges,omitempty"`        // Advice by percentage range
+	SubCategories map[string]Advice     `json:"subcategories,omitempty"` // Advice by subcategory
+}
+
+// AdviceVariant replaces the advice for a section at one maturity level or
+// percentage range. Empty fields keep the section advice.
+type AdviceVariant struct {
+	Advice   string       `json:"Advice"`
+	ReadMore string       `json:"ReadMore,omitempty"`
+	Links    []AdviceLink `json:"Links,omitempty"`
+}
+
+// RangeAdvice is the advice for percentages from Min up to Max, exclusive.
+// A range up to 100 includes 100.
+type RangeAdvice struct {
+	Min float64 `json:"Min"`
+	Max float64 `json:"Max"`
+	AdviceVariant
+}
+
+// ForScore returns the advice for a section or subcategory score. Advice for
+// a percentage range containing the score takes precedence over advice for
+// the score's maturity level, which takes precedence over the general advice.
+func (a Advice) ForScore(score SectionScore) Advice {
+	advice := Advice{
+		SectionName: a.SectionName,
+		SubCategory: a.SubCategory,
+		Advice:      a.Advice,
+		ReadMore:    a.ReadMore,
+		Links:       a.Links,
+		Level:       score.Level,
+	}
+
+	if variant, exists := a.Levels[score.Level]; exists {
+		advice.apply(variant)
+	}
+	for _, percentageRange := range a.Ranges {
+		if percentageRange.Contains(score.Percentage) {
+			advice.apply(percentageRange.AdviceVariant)
+			break
+		}
+	}
+
+	return advice
+}
+
+// Contains reports whether a percentage is in the range. Ranges are
+// half-open, so that adjacent ranges such as 0-50 and 50-100 leave no gap
+// between them for fractional percentages.
+func (r RangeAdvice) Contains(percentage float64) bool {
+	return percentage >= r.Min && (percentage < r.Max || percentage == 100 && r.Max == 100)
+}
+
+// apply replaces the advice with the fields a variant sets
+func (a *Advice) apply(variant AdviceVariant) {
+	if variant.Advice != "" {
+		a.Advice = variant.Advice
+	}
+	if variant.ReadMore != "" {
+		a.ReadMore = variant.ReadMore
+	}
+	if len(variant.Links) > 0 {
+		a.Links = variant.Links
+	}
 }
 
 // AdviceLink represents a resource link
@@ -351,6 +595,74 @@ type AdviceLink struct {
 	Paid string `json:"Paid,omitempty"`
 }
 
+// adviceEntry is the advice for a section or subcategory in the advice file.
+// Levels and subcategories are decoded by advice, so that they can hold
+// "//" comments too.
+type adviceEntry struct {
+	Advice        string                     `json:"Advice"`
+	ReadMore      string                     `json:"ReadMore,omitempty"`
+	Links         []AdviceLink               `json:"Links"`
+	Levels        map[string]json.RawMessage `json:"Levels,omitempty"` // Keyed by level number
+	Ranges        []RangeAdvice              `json:"Ranges,omitempty"`
+	SubCategories map[string]json.RawMessage `json:"SubCategories,omitempty"`
+}
+
+// advice converts an entry of the advice file
+func (e adviceEntry) advice(sectionName, subCategory string) (Advice, error) {
+	advice := Advice{
+		SectionName: sectionName,
+		SubCategory: subCategory,
+		Advice:      e.Advice,
+		ReadMore:    e.ReadMore,
+		Links:       e.Links,
+		Ranges:      e.Ranges,
+	}
+
+	for key, value := range e.Levels {
+		if key == "//" {
+			continue // Skip comments
+		}
+
+		level, err := strconv.Atoi(key)
+		if err != nil {
+			return Advice{}, fmt.Errorf("level %q is not a number", key)
+		}
+
+		var variant AdviceVariant
+		if err := json.Unmarshal(value, &variant); err != nil {
+			return Advice{}, fmt.Errorf("failed to parse advice for level %d: %w", level, err)
+		}
+
+		if advice.Levels == nil {
+			advice.Levels = make(map[int]AdviceVariant)
+		}
+		advice.Levels[level] = variant
+	}
+
+	for name, value := range e.SubCategories {
+		if name == "//" {
+			continue // Skip comments
+		}
+
+		var entry adviceEntry
+		if err := json.Unmarshal(value, &entry); err != nil {
+			return Advice{}, fmt.Errorf("failed to parse advice for subcategory %s: %w", name, err)
+		}
+
+		subCategoryAdvice, err := entry.advice(sectionName, name)
+		if err != nil {
+			return Advice{}, fmt.Errorf("subcategory %s: %w", name, err)
+		}
+
+		if advice.SubCategories == nil {
+			advice.SubCategories = make(map[string]Advice)
+		}
+		advice.SubCategories[name] = subCategoryAdvice
+	}
+
+	return advice, nil
+}
+
 // LoadAdvice loads advice from the JSON file
 func (s *QuestionService) LoadAdvice() (map[string]Advice, error) {
 	data, err := ioutil.ReadFile(s.adviceFile)
@@ -368,25 +680,19 @@ func (s *QuestionService) LoadAdvice() (map[string]Advice, error) {
 		if key == "//" {
 			continue // Skip comments
 		}
-		
-		var sectionAdvice struct {
-			Advice   string       `json:"Advice"`
-			ReadMore string       `json:"ReadMore,omitempty"`
-			Links    []AdviceLink `json:"Links"`
-		}
-		
-		if err := json.Unmarshal(value, &sectionAdvice); err != nil {
+
+		var entry adviceEntry
+		if err := json.Unmarshal(value, &entry); err != nil {
 			return nil, fmt.Errorf("failed to parse advice for section %s: %w", key, err)
 		}
-		
-		advice[key] = Advice{
-			SectionName: key,
-			Advice:      sectionAdvice.Advice,
-			ReadMore:    sectionAdvice.ReadMore,
-			Links:       sectionAdvice.Links,
+
+		sectionAdvice, err := entry.advice(key, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse advice for section %s: %w", key, err)
 		}
+		advice[key] = sectionAdvice
 	}
-	
+
 	return advice, nil
 }
 
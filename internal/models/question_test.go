@@ -0,0 +1,145 @@
+package models
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeAdvice writes an advice file and returns a question service that
+// loads it
+func writeAdvice(t *testing.T, content string) *QuestionService {
+	t.Helper()
+
+	adviceFile := filepath.Join(t.TempDir(), "advice.json")
+	if err := os.WriteFile(adviceFile, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return NewQuestionService("", adviceFile)
+}
+
+func TestLoadAdvice(t *testing.T) {
+	service := writeAdvice(t, `{
+		"//" : "Advice by section",
+		"Automation" : {
+			"Advice" : "Automate the build.",
+			"Links" : [{"Type" : "Book", "Text" : "Continuous Delivery", "Href" : "https://example.com/cd"}],
+			"Levels" : {
+				"//" : "Keyed by level number",
+				"1" : {"Advice" : "Build every commit."}
+			},
+			"Ranges" : [{"Min" : 90, "Max" : 100, "Advice" : "Share what works."}],
+			"SubCategories" : {
+				"//" : "Keyed by subcategory",
+				"CI" : {
+					"Advice" : "Integrate daily.",
+					"Links" : [],
+					"Levels" : {"//" : "Nested comments too", "2" : {"ReadMore" : "More on CI."}}
+				}
+			}
+		}
+	}`)
+
+	advice, err := service.LoadAdvice()
+	if err != nil {
+		t.Fatalf("LoadAdvice() error = %v", err)
+	}
+
+	want := map[string]Advice{
+		"Automation": {
+			SectionName: "Automation",
+			Advice:      "Automate the build.",
+			Links:       []AdviceLink{{Type: "Book", Text: "Continuous Delivery", Href: "https://example.com/cd"}},
+			Levels:      map[int]AdviceVariant{1: {Advice: "Build every commit."}},
+			Ranges:      []RangeAdvice{{Min: 90, Max: 100, AdviceVariant: AdviceVariant{Advice: "Share what works."}}},
+			SubCategories: map[string]Advice{
+				"CI": {
+					SectionName: "Automation",
+					SubCategory: "CI",
+					Advice:      "Integrate daily.",
+					Links:       []AdviceLink{},
+					Levels:      map[int]AdviceVariant{2: {ReadMore: "More on CI."}},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(advice, want) {
+		t.Errorf("LoadAdvice() = %+v, want %+v", advice, want)
+	}
+}
+
+func TestLoadAdviceErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "level that is not a number", content: `{"Automation" : {"Levels" : {"one" : {"Advice" : "..."}}}}`},
+		{name: "invalid level advice", content: `{"Automation" : {"Levels" : {"1" : "..."}}}`},
+		{name: "invalid subcategory advice", content: `{"Automation" : {"SubCategories" : {"CI" : "..."}}}`},
+		{
+			name:    "invalid level of a subcategory",
+			content: `{"Automation" : {"SubCategories" : {"CI" : {"Levels" : {"first" : {}}}}}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := writeAdvice(t, tt.content).LoadAdvice(); err == nil {
+				t.Error("LoadAdvice() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestAdviceForScore(t *testing.T) {
+	advice := Advice{
+		SectionName: "Automation",
+		Advice:      "general",
+		ReadMore:    "read more",
+		Levels:      map[int]AdviceVariant{2: {Advice: "level 2", ReadMore: "level 2 reading"}},
+		Ranges: []RangeAdvice{
+			{Min: 0, Max: 50, AdviceVariant: AdviceVariant{Advice: "below half"}},
+			{Min: 50, Max: 90, AdviceVariant: AdviceVariant{Advice: "above half"}},
+			{Min: 90, Max: 100, AdviceVariant: AdviceVariant{Advice: "top"}},
+		},
+	}
+	levelsOnly := Advice{Advice: "general", Levels: advice.Levels}
+	partial := Advice{Advice: "general", Ranges: []RangeAdvice{{Min: 20, Max: 40, AdviceVariant: AdviceVariant{Advice: "low"}}}}
+
+	tests := []struct {
+		name         string
+		advice       Advice
+		score        SectionScore
+		wantAdvice   string
+		wantReadMore string
+	}{
+		{name: "lowest percentage", advice: advice, score: SectionScore{Percentage: 0}, wantAdvice: "below half", wantReadMore: "read more"},
+		{name: "just below a bound", advice: advice, score: SectionScore{Percentage: 49.5}, wantAdvice: "below half", wantReadMore: "read more"},
+		{name: "on a bound", advice: advice, score: SectionScore{Percentage: 50}, wantAdvice: "above half", wantReadMore: "read more"},
+		{name: "just below the last range", advice: advice, score: SectionScore{Percentage: 89.99}, wantAdvice: "above half", wantReadMore: "read more"},
+		{name: "on the last bound", advice: advice, score: SectionScore{Percentage: 90}, wantAdvice: "top", wantReadMore: "read more"},
+		{name: "last range includes 100", advice: advice, score: SectionScore{Percentage: 100}, wantAdvice: "top", wantReadMore: "read more"},
+		{
+			name:         "range takes precedence over level",
+			advice:       advice,
+			score:        SectionScore{Percentage: 30, Level: 2},
+			wantAdvice:   "below half",
+			wantReadMore: "level 2 reading",
+		},
+		{name: "level", advice: levelsOnly, score: SectionScore{Percentage: 30, Level: 2}, wantAdvice: "level 2", wantReadMore: "level 2 reading"},
+		{name: "level without advice", advice: levelsOnly, score: SectionScore{Percentage: 30, Level: 3}, wantAdvice: "general"},
+		{name: "below a range", advice: partial, score: SectionScore{Percentage: 19.9}, wantAdvice: "general"},
+		{name: "range maximum is excluded", advice: partial, score: SectionScore{Percentage: 40}, wantAdvice: "general"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.advice.ForScore(tt.score)
+			if got.Advice != tt.wantAdvice || got.ReadMore != tt.wantReadMore || got.Level != tt.score.Level {
+				t.Errorf("ForScore(%g%%, level %d) = %q, %q, level %d, want %q, %q",
+					tt.score.Percentage, tt.score.Level, got.Advice, got.ReadMore, got.Level, tt.wantAdvice, tt.wantReadMore)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"devops-assessment/internal/database"
+)
+
+// Common errors
+var (
+	ErrQuestionnaireVersionNotFound = errors.New("questionnaire version not found")
+)
+
+// QuestionnaireVersion represents an imported version of the questionnaire
+type QuestionnaireVersion struct {
+	ID         int       `json:"id"`
+	TemplateID string    `json:"template_id"`
+	Checksum   string    `json:"checksum"`
+	SourceFile string    `json:"source_file"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// QuestionnaireService handles questionnaire version operations
+type QuestionnaireService struct {
+	db *database.DB
+
+	// Version content never changes once imported, so it is cached by ID
+	mu      sync.RWMutex
+	content map[int][]byte
+}
+
+// NewQuestionnaireService creates a new questionnaire service
+func NewQuestionnaireService(db *database.DB) *QuestionnaireService {
+	return &QuestionnaireService{
+		db:      db,
+		content: make(map[int][]byte),
+	}
+}
+
+// ImportSurvey stores a processed survey as a version of its template.
+// Versions are deduplicated by the checksum of their content, so importing
+// an unchanged questionnaire returns the existing version.
+func (s *QuestionnaireService) ImportSurvey(survey *Survey, sourceFile string) (*QuestionnaireVersion, error) {
+	content, err := json.Marshal(survey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal survey: %w", err)
+	}
+
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+
+	version := &QuestionnaireVersion{}
+	err = s.getVersion(`WHERE checksum = ?`, checksum, version)
+	if err == nil {
+		return version, nil
+	}
+	if err != ErrQuestionnaireVersionNotFound {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO questionnaire_versions (template_id, checksum, source_file, content)
+		VALUES (?, ?, ?, ?)
+	`
+
+	id, err := s.db.Insert(query, survey.TemplateID, checksum, sourceFile, string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to import questionnaire version: %w", err)
+	}
+
+	s.mu.Lock()
+	s.content[int(id)] = content
+	s.mu.Unlock()
+
+	if err := s.GetVersionByID(int(id), version); err != nil {
+		return nil, err
+	}
+
+	return version, nil
+}
+
+// GetVersionByID retrieves a questionnaire version by ID
+func (s *QuestionnaireService) GetVersionByID(id int, version *QuestionnaireVersion) error {
+	return s.getVersion(`WHERE id = ?`, id, version)
+}
+
+// getVersion retrieves a single questionnaire version matching the condition
+func (s *QuestionnaireService) getVersion(condition string, arg interface{}, version *QuestionnaireVersion) error {
+	query := `
+		SELECT id, template_id, checksum, source_file, created_at
+		FROM questionnaire_versions
+		` + condition
+
+	var templateID, sourceFile sql.NullString
+	err := s.db.QueryRowContext(context.Background(), query, arg).Scan(
+		&version.ID,
+		&templateID,
+		&version.Checksum,
+		&sourceFile,
+		&version.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return ErrQuestionnaireVersionNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get questionnaire version: %w", err)
+	}
+
+	version.TemplateID = templateID.String
+	version.SourceFile = sourceFile.String
+	return nil
+}
+
+// ListVersions lists the imported versions of a template, newest first
+func (s *QuestionnaireService) ListVersions(templateID string) ([]QuestionnaireVersion, error) {
+	query := `
+		SELECT id, template_id, checksum, source_file, created_at
+		FROM questionnaire_versions
+		WHERE template_id = ?
+		ORDER BY id DESC
+	`
+
+	rows, err := s.db.GetMany(query, templateID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list questionnaire versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []QuestionnaireVersion
+	for rows.Next() {
+		var version QuestionnaireVersion
+		var templateID, sourceFile sql.NullString
+
+		if err := rows.Scan(&version.ID, &templateID, &version.Checksum, &sourceFile, &version.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan questionnaire version: %w", err)
+		}
+
+		version.TemplateID = templateID.String
+		version.SourceFile = sourceFile.String
+		versions = append(versions, version)
+	}
+
+	return versions, nil
+}
+
+// LoadVersionSurvey loads the survey of a questionnaire version.
+// Every call returns a fresh copy, so callers may apply responses to it.
+func (s *QuestionnaireService) LoadVersionSurvey(versionID int) (*Survey, error) {
+	s.mu.RLock()
+	content, cached := s.content[versionID]
+	s.mu.RUnlock()
+
+	if !cached {
+		var stored string
+		err := s.db.QueryRowContext(context.Background(),
+			"SELECT content FROM questionnaire_versions WHERE id = ?", versionID,
+		).Scan(&stored)
+
+		if err == sql.ErrNoRows {
+			return nil, ErrQuestionnaireVersionNotFound
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load questionnaire version: %w", err)
+		}
+
+		content = []byte(stored)
+		s.mu.Lock()
+		s.content[versionID] = content
+		s.mu.Unlock()
+	}
+
+	survey := &Survey{}
+	if err := json.Unmarshal(content, survey); err != nil {
+		return nil, fmt.Errorf("failed to parse questionnaire version %d: %w", versionID, err)
+	}
+	survey.VersionID = versionID
+
+	return survey, nil
+}
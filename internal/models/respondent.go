@@ -0,0 +1,393 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"devops-assessment/internal/database"
+)
+
+// Respondent is a team member invited to answer an assessment separately.
+// The answers of all respondents who submitted them are aggregated into the
+// assessment's scores when the round is closed.
+type Respondent struct {
+	ID           int        `json:"id"`
+	AssessmentID int        `json:"assessment_id"`
+	UserID       int        `json:"user_id"`
+	Email        string     `json:"email"`
+	FirstName    string     `json:"first_name"`
+	LastName     string     `json:"last_name"`
+	InvitedBy    int        `json:"invited_by,omitempty"`
+	SubmittedAt  *time.Time `json:"submitted_at,omitempty"` // Only submitted answers are aggregated
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// RespondentService handles respondent-related database operations
+type RespondentService struct {
+	db *database.DB
+}
+
+// NewRespondentService creates a new respondent service
+func NewRespondentService(db *database.DB) *RespondentService {
+	return &RespondentService{db: db}
+}
+
+// Respondent errors
+var (
+	ErrRespondentNotFound    = errors.New("respondent not found")
+	ErrRespondentExists      = errors.New("user is already a respondent")
+	ErrAnsweredByRespondents = errors.New("assessment is answered by its respondents")
+	ErrNoSubmittedResponses  = errors.New("no respondent has submitted answers")
+	ErrNoRespondents         = errors.New("assessment has no respondents")
+	ErrInvalidAgreedAnswer   = errors.New("agreed answer doesn't fit the question")
+)
+
+// AgreedAnswer is the answer to a question that the respondents of an
+// assessment agreed on in a workshop. Agreed answers are the assessment's
+// official responses, and take precedence over the aggregated answers.
+type AgreedAnswer struct {
+	QuestionID string    `json:"question_id"`
+	AnswerIDs  []string  `json:"answer_ids"`
+	Note       string    `json:"note,omitempty"`
+	AgreedBy   int       `json:"agreed_by,omitempty"` // The facilitator who recorded the answer
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+const respondentColumns = `
+	ar.id, ar.assessment_id, ar.user_id, u.email, u.first_name, u.last_name,
+	ar.invited_by, ar.submitted_at, ar.created_at
+`
+
+// AddRespondent invites a user of the assessment's organization to answer it
+func (s *RespondentService) AddRespondent(respondent *Respondent) error {
+	// Respondents must be in the organization of the assessment
+	exists, err := s.db.Exists(`
+		SELECT 1 FROM users u
+		JOIN assessments a ON a.organization_id = u.organization_id
+		WHERE u.id = ? AND a.id = ?
+	`, respondent.UserID, respondent.AssessmentID)
+	if err != nil {
+		return fmt.Errorf("failed to check respondent organization: %w", err)
+	}
+	if !exists {
+		return ErrOrganizationMismatch
+	}
+
+	exists, err = s.db.Exists(
+		"SELECT 1 FROM assessment_respondents WHERE assessment_id = ? AND user_id = ?",
+		respondent.AssessmentID, respondent.UserID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to check respondent existence: %w", err)
+	}
+	if exists {
+		return ErrRespondentExists
+	}
+
+	var invitedBy interface{}
+	if respondent.InvitedBy > 0 {
+		invitedBy = respondent.InvitedBy
+	}
+
+	_, err = s.db.Insert(`
+		INSERT INTO assessment_respondents (assessment_id, user_id, invited_by)
+		VALUES (?, ?, ?)
+	`, respondent.AssessmentID, respondent.UserID, invitedBy)
+	if err != nil {
+		return fmt.Errorf("failed to add respondent: %w", err)
+	}
+
+	// Load the created respondent to get the user's name and timestamps
+	return s.GetRespondent(respondent.AssessmentID, respondent.UserID, respondent)
+}
+
+// RemoveRespondent removes a respondent and their answers from an assessment
+func (s *RespondentService) RemoveRespondent(assessmentID, userID int) error {
+	affected, err := s.db.Delete(
+		"DELETE FROM assessment_respondents WHERE assessment_id = ? AND user_id = ?",
+		assessmentID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to remove respondent: %w", err)
+	}
+
+	if affected == 0 {
+		return ErrRespondentNotFound
+	}
+
+	return nil
+}
+
+// GetRespondent retrieves the respondent of a user in an assessment
+func (s *RespondentService) GetRespondent(assessmentID, userID int, respondent *Respondent) error {
+	query := `SELECT ` + respondentColumns + `
+		FROM assessment_respondents ar
+		JOIN users u ON ar.user_id = u.id
+		WHERE ar.assessment_id = ? AND ar.user_id = ?
+	`
+
+	err := scanRespondent(s.db.QueryRowContext(context.Background(), query, assessmentID, userID), respondent)
+
+	if err == sql.ErrNoRows {
+		return ErrRespondentNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get respondent: %w", err)
+	}
+
+	return nil
+}
+
+// ListRespondents returns the respondents of an assessment
+func (s *RespondentService) ListRespondents(assessmentID int) ([]Respondent, error) {
+	query := `SELECT ` + respondentColumns + `
+		FROM assessment_respondents ar
+		JOIN users u ON ar.user_id = u.id
+		WHERE ar.assessment_id = ?
+		ORDER BY u.last_name, u.first_name
+	`
+
+	rows, err := s.db.GetMany(query, assessmentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list respondents: %w", err)
+	}
+	defer rows.Close()
+
+	respondents := []Respondent{}
+	for rows.Next() {
+		var respondent Respondent
+		if err := scanRespondent(rows, &respondent); err != nil {
+			return nil, fmt.Errorf("failed to scan respondent: %w", err)
+		}
+		respondents = append(respondents, respondent)
+	}
+
+	return respondents, nil
+}
+
+// HasRespondents reports whether an assessment is answered by respondents
+// rather than by one person for the whole team
+func (s *RespondentService) HasRespondents(assessmentID int) (bool, error) {
+	exists, err := s.db.Exists("SELECT 1 FROM assessment_respondents WHERE assessment_id = ?", assessmentID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check respondents: %w", err)
+	}
+	return exists, nil
+}
+
+// ListUserAssessments returns the assessments a user is a respondent of
+// that can be answered
+func (s *RespondentService) ListUserAssessments(userID int) ([]Assessment, error) {
+	query := `
+		SELECT ` + assessmentColumns + `
+		FROM assessments
+		WHERE status IN (?, ?) AND id IN (
+			SELECT assessment_id FROM assessment_respondents WHERE user_id = ?
+		)
+		ORDER BY created_at DESC
+	`
+
+	rows, err := s.db.GetMany(query, StatusInProgress, StatusReopened, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list respondent assessments: %w", err)
+	}
+	defer rows.Close()
+
+	assessments := []Assessment{}
+	for rows.Next() {
+		var assessment Assessment
+		if err := scanAssessment(rows, &assessment); err != nil {
+			return nil, fmt.Errorf("failed to scan assessment: %w", err)
+		}
+		assessments = append(assessments, assessment)
+	}
+
+	return assessments, nil
+}
+
+// SaveResponses saves or updates a respondent's answers to questions of an
+// assessment, while the assessment can be edited, like
+// AssessmentService.SaveResponses
+func (s *RespondentService) SaveResponses(assessmentID, respondentID int, responses []Response) error {
+	return s.db.Transaction(func(tx *sql.Tx) error {
+		if err := lockEditableAssessment(tx, assessmentID); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO respondent_responses (respondent_id, question_id, answer_ids)
+			VALUES (?, ?, ?)
+			ON DUPLICATE KEY UPDATE
+				answer_ids = VALUES(answer_ids),
+				updated_at = CURRENT_TIMESTAMP
+		`
+
+		for _, response := range responses {
+			answerJSON, err := json.Marshal(response.AnswerIDs)
+			if err != nil {
+				return fmt.Errorf("failed to marshal answer IDs: %w", err)
+			}
+
+			if _, err := tx.Exec(query, respondentID, response.QuestionID, string(answerJSON)); err != nil {
+				return fmt.Errorf("failed to save respondent response: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetResponses retrieves the answers of a respondent
+func (s *RespondentService) GetResponses(respondentID int) ([]Response, error) {
+	query := `
+		SELECT rr.id, ar.assessment_id, rr.question_id, rr.answer_ids, rr.created_at, rr.updated_at
+		FROM respondent_responses rr
+		JOIN assessment_respondents ar ON rr.respondent_id = ar.id
+		WHERE rr.respondent_id = ?
+		ORDER BY rr.question_id
+	`
+
+	rows, err := s.db.GetMany(query, respondentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get respondent responses: %w", err)
+	}
+	defer rows.Close()
+
+	var responses []Response
+	for rows.Next() {
+		var response Response
+		if err := scanResponse(rows, &response); err != nil {
+			return nil, err
+		}
+		responses = append(responses, response)
+	}
+
+	return responses, nil
+}
+
+// Submit marks a respondent's answers as final, so that they are counted
+// when the round is closed. Answers can still change until then.
+func (s *RespondentService) Submit(respondentID int) error {
+	affected, err := s.db.Update(
+		"UPDATE assessment_respondents SET submitted_at = CURRENT_TIMESTAMP WHERE id = ?", respondentID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to submit responses: %w", err)
+	}
+
+	if affected == 0 {
+		return ErrRespondentNotFound
+	}
+
+	return nil
+}
+
+// SaveAgreedAnswer records the agreed answer to a question as the
+// assessment's response, while the assessment can be edited. The answers of
+// the respondents are kept.
+func (s *RespondentService) SaveAgreedAnswer(assessmentID int, answer *AgreedAnswer) error {
+	answerJSON, err := json.Marshal(answer.AnswerIDs)
+	if err != nil {
+		return fmt.Errorf("failed to marshal answer IDs: %w", err)
+	}
+
+	var agreedBy interface{}
+	if answer.AgreedBy > 0 {
+		agreedBy = answer.AgreedBy
+	}
+
+	return s.db.Transaction(func(tx *sql.Tx) error {
+		if err := lockEditableAssessment(tx, assessmentID); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO responses (assessment_id, question_id, answer_ids, note, agreed_by)
+			VALUES (?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE
+				answer_ids = VALUES(answer_ids),
+				note = VALUES(note),
+				agreed_by = VALUES(agreed_by),
+				needs_confirmation = FALSE,
+				updated_at = CURRENT_TIMESTAMP
+		`
+
+		_, err := tx.Exec(query, assessmentID, answer.QuestionID, string(answerJSON), answer.Note, agreedBy)
+		if err != nil {
+			return fmt.Errorf("failed to save agreed answer: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// ListAgreedAnswers returns the agreed answers of an assessment
+func (s *RespondentService) ListAgreedAnswers(assessmentID int) ([]AgreedAnswer, error) {
+	query := `
+		SELECT question_id, answer_ids, note, agreed_by, updated_at
+		FROM responses
+		WHERE assessment_id = ?
+		ORDER BY question_id
+	`
+
+	rows, err := s.db.GetMany(query, assessmentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list agreed answers: %w", err)
+	}
+	defer rows.Close()
+
+	answers := []AgreedAnswer{}
+	for rows.Next() {
+		var answer AgreedAnswer
+		var answerJSON string
+		var note sql.NullString
+		var agreedBy sql.NullInt64
+
+		if err := rows.Scan(&answer.QuestionID, &answerJSON, &note, &agreedBy, &answer.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan agreed answer: %w", err)
+		}
+		if err := json.Unmarshal([]byte(answerJSON), &answer.AnswerIDs); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal answer IDs: %w", err)
+		}
+
+		answer.Note = note.String
+		answer.AgreedBy = int(agreedBy.Int64)
+		answers = append(answers, answer)
+	}
+
+	return answers, nil
+}
+
+// scanRespondent scans a row selected with respondentColumns
+func scanRespondent(row rowScanner, respondent *Respondent) error {
+	var invitedBy sql.NullInt64
+	var submittedAt sql.NullTime
+
+	err := row.Scan(
+		&respondent.ID,
+		&respondent.AssessmentID,
+		&respondent.UserID,
+		&respondent.Email,
+		&respondent.FirstName,
+		&respondent.LastName,
+		&invitedBy,
+		&submittedAt,
+		&respondent.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	if invitedBy.Valid {
+		respondent.InvitedBy = int(invitedBy.Int64)
+	}
+	if submittedAt.Valid {
+		respondent.SubmittedAt = &submittedAt.Time
+	}
+
+	return nil
+}
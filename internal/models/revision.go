@@ -0,0 +1,345 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"devops-assessment/internal/database"
+)
+
+// AssessmentRevision is a snapshot of an assessment's responses and section
+// scores, taken when it is reopened and when it is completed again
+type AssessmentRevision struct {
+	ID            int            `json:"id"`
+	AssessmentID  int            `json:"assessment_id"`
+	Revision      int            `json:"revision"` // Numbered from 1 per assessment
+	Action        string         `json:"action"`   // 'reopened' or 'completed'
+	Reason        string         `json:"reason,omitempty"`
+	CreatedBy     int            `json:"created_by,omitempty"`
+	CreatorName   string         `json:"creator_name,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	Responses     []Response     `json:"responses,omitempty"`
+	SectionScores []SectionScore `json:"section_scores,omitempty"`
+
+	// Changes compared to the previous revision (computed)
+	Changes []ResponseChange `json:"changes,omitempty"`
+}
+
+// ResponseChange is a question answered differently in two revisions
+type ResponseChange struct {
+	QuestionID string   `json:"question_id"`
+	Before     []string `json:"before"` // Answer IDs, empty when unanswered
+	After      []string `json:"after"`
+}
+
+// Revision actions
+const (
+	RevisionReopened  = "reopened"
+	RevisionCompleted = "completed"
+)
+
+// Common errors
+var (
+	ErrRevisionNotFound = errors.New("revision not found")
+)
+
+// RevisionService handles assessment revision database operations
+type RevisionService struct {
+	db *database.DB
+}
+
+// NewRevisionService creates a new revision service
+func NewRevisionService(db *database.DB) *RevisionService {
+	return &RevisionService{db: db}
+}
+
+// revisionColumns lists the revision columns read by scanRevision
+const revisionColumns = `r.id, r.assessment_id, r.revision, r.action, r.reason, r.created_by,
+		       u.first_name, u.last_name, r.created_at, r.responses, r.section_scores`
+
+// recordRevision snapshots the current responses and section scores of an
+// assessment as its next revision, within a transaction
+func recordRevision(tx *sql.Tx, revision *AssessmentRevision) error {
+	responses, err := queryResponses(tx, revision.AssessmentID)
+	if err != nil {
+		return err
+	}
+	scores, err := queryScores(tx, revision.AssessmentID)
+	if err != nil {
+		return err
+	}
+
+	responsesJSON, err := json.Marshal(responses)
+	if err != nil {
+		return fmt.Errorf("failed to marshal responses: %w", err)
+	}
+	scoresJSON, err := json.Marshal(scores)
+	if err != nil {
+		return fmt.Errorf("failed to marshal section scores: %w", err)
+	}
+
+	// Lock the assessment's revisions while numbering the new one
+	err = tx.QueryRow(`
+		SELECT COALESCE(MAX(revision), 0) + 1 FROM assessment_revisions
+		WHERE assessment_id = ?
+		FOR UPDATE
+	`, revision.AssessmentID).Scan(&revision.Revision)
+	if err != nil {
+		return fmt.Errorf("failed to number revision: %w", err)
+	}
+
+	var createdBy interface{}
+	if revision.CreatedBy > 0 {
+		createdBy = revision.CreatedBy
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO assessment_revisions
+			(assessment_id, revision, action, reason, responses, section_scores, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, revision.AssessmentID, revision.Revision, revision.Action, revision.Reason,
+		string(responsesJSON), string(scoresJSON), createdBy)
+	if err != nil {
+		return fmt.Errorf("failed to record revision: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get revision ID: %w", err)
+	}
+	revision.ID = int(id)
+	revision.Responses = responses
+	revision.SectionScores = scores
+
+	return nil
+}
+
+// queryResponses reads the responses of an assessment within a transaction
+func queryResponses(tx *sql.Tx, assessmentID int) ([]Response, error) {
+	rows, err := tx.Query(`
+		SELECT id, assessment_id, question_id, answer_ids, created_at, updated_at
+		FROM responses
+		WHERE assessment_id = ?
+		ORDER BY question_id
+	`, assessmentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get responses: %w", err)
+	}
+	defer rows.Close()
+
+	responses := []Response{}
+	for rows.Next() {
+		var response Response
+		if err := scanResponse(rows, &response); err != nil {
+			return nil, err
+		}
+		responses = append(responses, response)
+	}
+
+	return responses, rows.Err()
+}
+
+// queryScores reads the section scores of an assessment within a transaction
+func queryScores(tx *sql.Tx, assessmentID int) ([]SectionScore, error) {
+	rows, err := tx.Query(`
+		SELECT `+sectionScoreColumns+`
+		FROM section_scores
+		WHERE assessment_id = ?
+		ORDER BY section_name
+	`, assessmentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get section scores: %w", err)
+	}
+	defer rows.Close()
+
+	scores := []SectionScore{}
+	for rows.Next() {
+		var score SectionScore
+		if err := scanSectionScore(rows, &score); err != nil {
+			return nil, fmt.Errorf("failed to scan section score: %w", err)
+		}
+		scores = append(scores, score)
+	}
+
+	return scores, rows.Err()
+}
+
+// scanRevision scans a row selected with revisionColumns
+func scanRevision(row rowScanner, revision *AssessmentRevision) error {
+	var reason, firstName, lastName sql.NullString
+	var createdBy sql.NullInt64
+	var responsesJSON, scoresJSON string
+
+	err := row.Scan(
+		&revision.ID,
+		&revision.AssessmentID,
+		&revision.Revision,
+		&revision.Action,
+		&reason,
+		&createdBy,
+		&firstName,
+		&lastName,
+		&revision.CreatedAt,
+		&responsesJSON,
+		&scoresJSON,
+	)
+	if err != nil {
+		return err
+	}
+
+	revision.Reason = reason.String
+	revision.CreatedBy = int(createdBy.Int64)
+	if firstName.Valid {
+		revision.CreatorName = firstName.String + " " + lastName.String
+	}
+
+	if err := json.Unmarshal([]byte(responsesJSON), &revision.Responses); err != nil {
+		return fmt.Errorf("failed to unmarshal revision responses: %w", err)
+	}
+	if err := json.Unmarshal([]byte(scoresJSON), &revision.SectionScores); err != nil {
+		return fmt.Errorf("failed to unmarshal revision section scores: %w", err)
+	}
+
+	return nil
+}
+
+// ListRevisions returns the revisions of an assessment, oldest first, with
+// the changes of each compared to the one before it
+func (s *RevisionService) ListRevisions(assessmentID int) ([]AssessmentRevision, error) {
+	query := `
+		SELECT ` + revisionColumns + `
+		FROM assessment_revisions r
+		LEFT JOIN users u ON u.id = r.created_by
+		WHERE r.assessment_id = ?
+		ORDER BY r.revision
+	`
+
+	rows, err := s.db.GetMany(query, assessmentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list revisions: %w", err)
+	}
+	defer rows.Close()
+
+	revisions := []AssessmentRevision{}
+	for rows.Next() {
+		var revision AssessmentRevision
+		if err := scanRevision(rows, &revision); err != nil {
+			return nil, fmt.Errorf("failed to scan revision: %w", err)
+		}
+
+		if len(revisions) > 0 {
+			revision.Changes = CompareResponses(revisions[len(revisions)-1].Responses, revision.Responses)
+		}
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, nil
+}
+
+// GetRevision retrieves a revision of an assessment by its number, with its
+// changes compared to the revision before it
+func (s *RevisionService) GetRevision(assessmentID, number int) (*AssessmentRevision, error) {
+	query := `
+		SELECT ` + revisionColumns + `
+		FROM assessment_revisions r
+		LEFT JOIN users u ON u.id = r.created_by
+		WHERE r.assessment_id = ? AND r.revision IN (?, ?)
+		ORDER BY r.revision
+	`
+
+	rows, err := s.db.GetMany(query, assessmentID, number-1, number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get revision: %w", err)
+	}
+	defer rows.Close()
+
+	var previous, revision *AssessmentRevision
+	for rows.Next() {
+		current := &AssessmentRevision{}
+		if err := scanRevision(rows, current); err != nil {
+			return nil, fmt.Errorf("failed to scan revision: %w", err)
+		}
+
+		if current.Revision == number {
+			revision = current
+		} else {
+			previous = current
+		}
+	}
+
+	if revision == nil {
+		return nil, ErrRevisionNotFound
+	}
+	if previous != nil {
+		revision.Changes = CompareResponses(previous.Responses, revision.Responses)
+	}
+
+	return revision, nil
+}
+
+// CompareResponses lists the questions answered differently in two sets of
+// responses, ordered by question ID as the responses are
+func CompareResponses(before, after []Response) []ResponseChange {
+	beforeAnswers := make(map[string][]string, len(before))
+	for _, response := range before {
+		beforeAnswers[response.QuestionID] = response.AnswerIDs
+	}
+	afterAnswers := make(map[string][]string, len(after))
+	for _, response := range after {
+		afterAnswers[response.QuestionID] = response.AnswerIDs
+	}
+
+	var changes []ResponseChange
+	addChange := func(questionID string) {
+		previous, current := beforeAnswers[questionID], afterAnswers[questionID]
+		if !sameAnswerIDs(previous, current) {
+			changes = append(changes, ResponseChange{
+				QuestionID: questionID,
+				Before:     nonNil(previous),
+				After:      nonNil(current),
+			})
+		}
+	}
+
+	for _, response := range after {
+		addChange(response.QuestionID)
+	}
+	for _, response := range before {
+		if _, answered := afterAnswers[response.QuestionID]; !answered {
+			addChange(response.QuestionID)
+		}
+	}
+
+	return changes
+}
+
+// sameAnswerIDs reports whether two lists hold the same answer IDs, in any
+// order
+func sameAnswerIDs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	counts := make(map[string]int, len(a))
+	for _, answerID := range a {
+		counts[answerID]++
+	}
+	for _, answerID := range b {
+		if counts[answerID] == 0 {
+			return false
+		}
+		counts[answerID]--
+	}
+	return true
+}
+
+// nonNil returns an empty list for nil, so unanswered questions marshal as []
+func nonNil(answerIDs []string) []string {
+	if answerIDs == nil {
+		return []string{}
+	}
+	return answerIDs
+}
@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"devops-assessment/internal/database"
@@ -15,6 +17,7 @@ type Role struct {
 	ID          int          `json:"id"`
 	Name        string       `json:"name"`
 	Description string       `json:"description"`
+	IsBuiltin   bool         `json:"is_builtin"`
 	CreatedAt   time.Time    `json:"created_at"`
 	Permissions []Permission `json:"permissions,omitempty"`
 }
@@ -28,6 +31,32 @@ type Permission struct {
 	CreatedAt   time.Time `json:"created_at"`
 }
 
+// Sources of permission grants
+const (
+	GrantSourceTeam       = "team"        // A role in the team
+	GrantSourceGroup      = "group"       // A role in the group, or the team's group
+	GrantSourceOrgAdmin   = "org_admin"   // Organization admins have every permission in their organization
+	GrantSourceSuperAdmin = "super_admin" // Super admins have every permission in every organization
+)
+
+// PermissionGrant is a membership that grants a permission
+type PermissionGrant struct {
+	Source    string `json:"source"`
+	TeamID    int    `json:"team_id,omitempty"`
+	TeamName  string `json:"team_name,omitempty"`
+	GroupID   int    `json:"group_id,omitempty"`
+	GroupName string `json:"group_name,omitempty"`
+	RoleID    int    `json:"role_id"`
+	RoleName  string `json:"role_name"`
+}
+
+// EffectivePermission is a permission with the memberships that grant it
+type EffectivePermission struct {
+	Resource  string            `json:"resource"`
+	Action    string            `json:"action"`
+	GrantedBy []PermissionGrant `json:"granted_by"`
+}
+
 // RoleService handles role-related database operations
 type RoleService struct {
 	db *database.DB
@@ -55,6 +84,9 @@ func NewRBACService(db *database.DB) *RBACService {
 // Common errors
 var (
 	ErrRoleNotFound       = errors.New("role not found")
+	ErrRoleNameExists     = errors.New("role name already exists")
+	ErrRoleBuiltin        = errors.New("built-in roles cannot be modified")
+	ErrRoleInUse          = errors.New("role is assigned to team or group members")
 	ErrPermissionNotFound = errors.New("permission not found")
 	ErrAccessDenied       = errors.New("access denied")
 )
@@ -75,6 +107,7 @@ const (
 	ResourceReport     = "report"
 	ResourceSystem     = "system"
 	ResourceAudit      = "audit"
+	ResourceRole       = "role"
 
 	ActionCreate = "create"
 	ActionRead   = "read"
@@ -89,7 +122,7 @@ const (
 // GetRoleByID retrieves a role by ID
 func (s *RoleService) GetRoleByID(id int) (*Role, error) {
 	query := `
-		SELECT id, name, description, created_at
+		SELECT id, name, description, is_builtin, created_at
 		FROM roles
 		WHERE id = ?
 	`
@@ -99,6 +132,7 @@ func (s *RoleService) GetRoleByID(id int) (*Role, error) {
 		&role.ID,
 		&role.Name,
 		&role.Description,
+		&role.IsBuiltin,
 		&role.CreatedAt,
 	)
 
@@ -122,7 +156,7 @@ func (s *RoleService) GetRoleByID(id int) (*Role, error) {
 // GetRoleByName retrieves a role by name
 func (s *RoleService) GetRoleByName(name string) (*Role, error) {
 	query := `
-		SELECT id, name, description, created_at
+		SELECT id, name, description, is_builtin, created_at
 		FROM roles
 		WHERE name = ?
 	`
@@ -132,6 +166,7 @@ func (s *RoleService) GetRoleByName(name string) (*Role, error) {
 		&role.ID,
 		&role.Name,
 		&role.Description,
+		&role.IsBuiltin,
 		&role.CreatedAt,
 	)
 
@@ -190,7 +225,7 @@ func (s *RoleService) GetRolePermissions(roleID int) ([]Permission, error) {
 // ListRoles returns all available roles
 func (s *RoleService) ListRoles() ([]Role, error) {
 	query := `
-		SELECT id, name, description, created_at
+		SELECT id, name, description, is_builtin, created_at
 		FROM roles
 		ORDER BY name
 	`
@@ -208,6 +243,7 @@ func (s *RoleService) ListRoles() ([]Role, error) {
 			&role.ID,
 			&role.Name,
 			&role.Description,
+			&role.IsBuiltin,
 			&role.CreatedAt,
 		)
 		if err != nil {
@@ -227,44 +263,267 @@ func (s *RoleService) ListRoles() ([]Role, error) {
 	return roles, nil
 }
 
-// RBAC Service Methods
+// ListPermissions returns all permissions that can be granted to roles
+func (s *RoleService) ListPermissions() ([]Permission, error) {
+	query := `
+		SELECT id, resource, action, description, created_at
+		FROM permissions
+		ORDER BY resource, action
+	`
+
+	rows, err := s.db.GetMany(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list permissions: %w", err)
+	}
+	defer rows.Close()
+
+	permissions := []Permission{}
+	for rows.Next() {
+		var perm Permission
+		err := rows.Scan(
+			&perm.ID,
+			&perm.Resource,
+			&perm.Action,
+			&perm.Description,
+			&perm.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan permission: %w", err)
+		}
+		permissions = append(permissions, perm)
+	}
+
+	return permissions, nil
+}
+
+// CreateRole creates a custom role with permissions given as
+// "resource:action" names
+func (s *RoleService) CreateRole(role *Role, permissions []string) error {
+	// Check if role name already exists
+	exists, err := s.db.Exists("SELECT 1 FROM roles WHERE name = ?", role.Name)
+	if err != nil {
+		return fmt.Errorf("failed to check role name existence: %w", err)
+	}
+	if exists {
+		return ErrRoleNameExists
+	}
+
+	permissionIDs, err := s.resolvePermissions(permissions)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.Transaction(func(tx *sql.Tx) error {
+		result, err := tx.Exec(
+			"INSERT INTO roles (name, description, is_builtin) VALUES (?, ?, FALSE)",
+			role.Name, role.Description,
+		)
+		if err != nil {
+			return err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		role.ID = int(id)
+
+		for _, permissionID := range permissionIDs {
+			if _, err := tx.Exec(
+				"INSERT INTO role_permissions (role_id, permission_id) VALUES (?, ?)",
+				role.ID, permissionID,
+			); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create role: %w", err)
+	}
+
+	// Load the created role to get timestamps and permissions
+	created, err := s.GetRoleByID(role.ID)
+	if err != nil {
+		return err
+	}
+	*role = *created
+
+	return nil
+}
+
+// UpdateRole updates the name and description of a custom role
+func (s *RoleService) UpdateRole(role *Role) error {
+	if err := s.checkCustomRole(role.ID); err != nil {
+		return err
+	}
+
+	exists, err := s.db.Exists("SELECT 1 FROM roles WHERE name = ? AND id != ?", role.Name, role.ID)
+	if err != nil {
+		return fmt.Errorf("failed to check role name existence: %w", err)
+	}
+	if exists {
+		return ErrRoleNameExists
+	}
+
+	query := `UPDATE roles SET name = ?, description = ? WHERE id = ?`
+
+	if _, err := s.db.Update(query, role.Name, role.Description, role.ID); err != nil {
+		return fmt.Errorf("failed to update role: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteRole deletes a custom role that no team or group member has.
+// Pending invitations with the role are deleted with it.
+func (s *RoleService) DeleteRole(roleID int) error {
+	if err := s.checkCustomRole(roleID); err != nil {
+		return err
+	}
+
+	inUse, err := s.db.Exists(`
+		SELECT 1 FROM user_teams WHERE role_id = ?
+		UNION ALL
+		SELECT 1 FROM user_groups WHERE role_id = ?
+	`, roleID, roleID)
+	if err != nil {
+		return fmt.Errorf("failed to check role assignments: %w", err)
+	}
+	if inUse {
+		return ErrRoleInUse
+	}
+
+	affected, err := s.db.Delete("DELETE FROM roles WHERE id = ?", roleID)
+	if err != nil {
+		return fmt.Errorf("failed to delete role: %w", err)
+	}
+
+	rbacCache.invalidateAll()
+
+	if affected == 0 {
+		return ErrRoleNotFound
+	}
+
+	return nil
+}
+
+// GrantPermission grants a permission to a custom role
+func (s *RoleService) GrantPermission(roleID int, resource, action string) error {
+	if err := s.checkCustomRole(roleID); err != nil {
+		return err
+	}
+
+	permissionIDs, err := s.resolvePermissions([]string{resource + ":" + action})
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT IGNORE INTO role_permissions (role_id, permission_id) VALUES (?, ?)`
+
+	if _, err := s.db.Insert(query, roleID, permissionIDs[0]); err != nil {
+		return fmt.Errorf("failed to grant permission: %w", err)
+	}
+
+	rbacCache.invalidateAll()
+
+	return nil
+}
+
+// RevokePermission revokes a permission from a custom role
+func (s *RoleService) RevokePermission(roleID int, resource, action string) error {
+	if err := s.checkCustomRole(roleID); err != nil {
+		return err
+	}
 
-// CheckUserPermission checks if a user has a specific permission
-func (s *RBACService) CheckUserPermission(userID int, resource, action string) (bool, error) {
 	query := `
-		SELECT COUNT(*) > 0
-		FROM (
-			-- Check team permissions
-			SELECT p.id
-			FROM user_teams ut
-			JOIN role_permissions rp ON ut.role_id = rp.role_id
-			JOIN permissions p ON rp.permission_id = p.id
-			WHERE ut.user_id = ? AND p.resource = ? AND p.action = ?
-			
-			UNION
-			
-			-- Check group permissions
-			SELECT p.id
-			FROM user_groups ug
-			JOIN role_permissions rp ON ug.role_id = rp.role_id
-			JOIN permissions p ON rp.permission_id = p.id
-			WHERE ug.user_id = ? AND p.resource = ? AND p.action = ?
-		) AS combined_permissions
+		DELETE rp FROM role_permissions rp
+		JOIN permissions p ON rp.permission_id = p.id
+		WHERE rp.role_id = ? AND p.resource = ? AND p.action = ?
 	`
 
-	var hasPermission bool
+	affected, err := s.db.Delete(query, roleID, resource, action)
+	if err != nil {
+		return fmt.Errorf("failed to revoke permission: %w", err)
+	}
+
+	rbacCache.invalidateAll()
+
+	if affected == 0 {
+		return ErrPermissionNotFound
+	}
+
+	return nil
+}
+
+// checkCustomRole checks that a role exists and isn't built in
+func (s *RoleService) checkCustomRole(roleID int) error {
+	var builtin bool
 	err := s.db.QueryRowContext(
 		context.Background(),
-		query,
-		userID, resource, action,
-		userID, resource, action,
-	).Scan(&hasPermission)
+		"SELECT is_builtin FROM roles WHERE id = ?",
+		roleID,
+	).Scan(&builtin)
 
+	if err == sql.ErrNoRows {
+		return ErrRoleNotFound
+	}
 	if err != nil {
-		return false, fmt.Errorf("failed to check user permission: %w", err)
+		return fmt.Errorf("failed to get role: %w", err)
+	}
+
+	if builtin {
+		return ErrRoleBuiltin
 	}
 
-	return hasPermission, nil
+	return nil
+}
+
+// resolvePermissions maps "resource:action" names to permission IDs
+func (s *RoleService) resolvePermissions(names []string) ([]int, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	permissions, err := s.ListPermissions()
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]int, len(permissions))
+	for _, permission := range permissions {
+		known[permission.Resource+":"+permission.Action] = permission.ID
+	}
+
+	seen := make(map[string]bool, len(names))
+	var ids []int
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrPermissionNotFound, name)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// RBAC Service Methods
+
+// CheckUserPermission checks if a user has a specific permission in any
+// team or group. Organization and super admins have every permission.
+func (s *RBACService) CheckUserPermission(userID int, resource, action string) (bool, error) {
+	permissions, err := s.userPermissions(userID)
+	if err != nil {
+		return false, err
+	}
+
+	return permissions.superAdmin || permissions.orgAdmin || permissions.all[resource+":"+action], nil
 }
 
 // GetUserPermissions retrieves all permissions for a user
@@ -319,7 +578,7 @@ func (s *RBACService) GetUserPermissions(userID int) ([]Permission, error) {
 // GetUserRoles retrieves all roles assigned to a user (from teams and groups)
 func (s *RBACService) GetUserRoles(userID int) ([]Role, error) {
 	query := `
-		SELECT DISTINCT r.id, r.name, r.description, r.created_at
+		SELECT DISTINCT r.id, r.name, r.description, r.is_builtin, r.created_at
 		FROM (
 			-- Get roles from teams
 			SELECT r.*
@@ -351,6 +610,7 @@ func (s *RBACService) GetUserRoles(userID int) ([]Role, error) {
 			&role.ID,
 			&role.Name,
 			&role.Description,
+			&role.IsBuiltin,
 			&role.CreatedAt,
 		)
 		if err != nil {
@@ -370,96 +630,494 @@ func (s *RBACService) GetUserRoles(userID int) ([]Role, error) {
 	return roles, nil
 }
 
-// IsUserAdmin checks if a user has admin role in any team or group
+// IsUserAdmin checks if a user has the admin role in any team or group, or
+// is an organization or super admin. It decides who security settings treat
+// as an admin, and grants no permissions.
 func (s *RBACService) IsUserAdmin(userID int) (bool, error) {
-	query := `
-		SELECT COUNT(*) > 0
-		FROM (
-			SELECT r.id
-			FROM user_teams ut
-			JOIN roles r ON ut.role_id = r.id
-			WHERE ut.user_id = ? AND r.name = ?
-			
-			UNION
-			
-			SELECT r.id
-			FROM user_groups ug
-			JOIN roles r ON ug.role_id = r.id
-			WHERE ug.user_id = ? AND r.name = ?
-		) AS admin_roles
-	`
+	permissions, err := s.userPermissions(userID)
+	if err != nil {
+		return false, err
+	}
 
-	var isAdmin bool
-	err := s.db.QueryRowContext(
-		context.Background(),
-		query,
-		userID, RoleAdmin,
-		userID, RoleAdmin,
-	).Scan(&isAdmin)
+	return permissions.superAdmin || permissions.orgAdmin || permissions.admin, nil
+}
 
+// IsOrgAdmin checks if a user is an admin of their organization, or a
+// super admin
+func (s *RBACService) IsOrgAdmin(userID int) (bool, error) {
+	permissions, err := s.userPermissions(userID)
 	if err != nil {
-		return false, fmt.Errorf("failed to check admin status: %w", err)
+		return false, err
 	}
 
-	return isAdmin, nil
+	return permissions.superAdmin || permissions.orgAdmin, nil
 }
 
-// CheckTeamPermission checks if a user has a specific permission for a team
+// CheckTeamPermission checks if a user has a specific permission for a team,
+// through a role in the team, in the team's group or in any group above it.
+// Roles only apply where they are held, the admin role included. Organization
+// admins have every permission for every team of their organization, and
+// super admins for every team.
 func (s *RBACService) CheckTeamPermission(userID, teamID int, resource, action string) (bool, error) {
-	// First check if user is a member of the team
+	permissions, err := s.userPermissions(userID)
+	if err != nil {
+		return false, err
+	}
+
+	key := resource + ":" + action
+	if permissions.superAdmin || permissions.teams[teamID][key] {
+		return true, nil
+	}
+
+	// Check if user has permission as organization admin or through group
+	// membership
+	if !permissions.orgAdmin && len(permissions.groups) == 0 {
+		return false, nil
+	}
+
+	team, err := s.teamGroup(teamID)
+	if err != nil {
+		return false, err
+	}
+	if team.organizationID != permissions.organizationID {
+		return false, nil
+	}
+	if permissions.orgAdmin {
+		return true, nil
+	}
+	if team.groupID == 0 {
+		return false, nil
+	}
+
+	group, err := s.groupAncestors(team.groupID)
+	if err != nil {
+		return false, err
+	}
+
+	return permissions.groupsAllow(group.ancestors, key), nil
+}
+
+// CheckGroupPermission checks if a user has a specific permission for a
+// group, through a role in the group or in any group above it. Organization
+// admins have every permission for every group of their organization, and
+// super admins for every group.
+func (s *RBACService) CheckGroupPermission(userID, groupID int, resource, action string) (bool, error) {
+	permissions, err := s.userPermissions(userID)
+	if err != nil {
+		return false, err
+	}
+
+	if permissions.superAdmin {
+		return true, nil
+	}
+	if !permissions.orgAdmin && len(permissions.groups) == 0 {
+		return false, nil
+	}
+
+	group, err := s.groupAncestors(groupID)
+	if err != nil {
+		return false, err
+	}
+	if group.organizationID != permissions.organizationID {
+		return false, nil
+	}
+
+	return permissions.orgAdmin || permissions.groupsAllow(group.ancestors, resource+":"+action), nil
+}
+
+// groupsAllow checks if a permission is held through a role in any of the
+// given groups
+func (permissions *userPermissions) groupsAllow(groupIDs []int, key string) bool {
+	for _, groupID := range groupIDs {
+		if permissions.groups[groupID][key] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetPermittedTeamIDs returns the teams for which a user has a specific
+// permission, including the teams of subgroups of the groups they have it
+// for, or nil for organization admins, who have it for all teams of their
+// organization
+func (s *RBACService) GetPermittedTeamIDs(userID int, resource, action string) ([]int, error) {
+	isAdmin, err := s.IsOrgAdmin(userID)
+	if err != nil {
+		return nil, err
+	}
+	if isAdmin {
+		return nil, nil
+	}
+
 	query := `
-		SELECT COUNT(*) > 0
+		WITH RECURSIVE permitted_groups (id) AS (
+			` + permittedGroupsQuery + `
+		)
+		SELECT ut.team_id
 		FROM user_teams ut
 		JOIN role_permissions rp ON ut.role_id = rp.role_id
 		JOIN permissions p ON rp.permission_id = p.id
-		WHERE ut.user_id = ? AND ut.team_id = ? 
-		AND p.resource = ? AND p.action = ?
+		WHERE ut.user_id = ? AND p.resource = ? AND p.action = ?
+
+		UNION
+
+		SELECT t.id
+		FROM teams t
+		JOIN permitted_groups pg ON t.group_id = pg.id
+	`
+
+	return s.getIDs(query, userID, resource, action, userID, resource, action)
+}
+
+// GetPermittedGroupIDs returns the groups for which a user has a specific
+// permission, including their subgroups, or nil for organization admins,
+// who have it for all groups of their organization
+func (s *RBACService) GetPermittedGroupIDs(userID int, resource, action string) ([]int, error) {
+	isAdmin, err := s.IsOrgAdmin(userID)
+	if err != nil {
+		return nil, err
+	}
+	if isAdmin {
+		return nil, nil
+	}
+
+	query := `
+		WITH RECURSIVE permitted_groups (id) AS (
+			` + permittedGroupsQuery + `
+		)
+		SELECT id FROM permitted_groups
 	`
 
-	var hasDirectPermission bool
+	return s.getIDs(query, userID, resource, action)
+}
+
+// permittedGroupsQuery is the body of a recursive query selecting the groups
+// for which a user has a permission, through a role in the group or in a
+// group above it. It takes the user ID, resource and action. It must stay a
+// UNION: discarding groups already selected ends the recursion on cycles.
+const permittedGroupsQuery = `
+	SELECT ug.group_id
+	FROM user_groups ug
+	JOIN role_permissions rp ON ug.role_id = rp.role_id
+	JOIN permissions p ON rp.permission_id = p.id
+	WHERE ug.user_id = ? AND p.resource = ? AND p.action = ?
+
+	UNION
+
+	SELECT g.id
+	FROM groups g
+	JOIN permitted_groups pg ON g.parent_id = pg.id
+`
+
+// getIDs runs a query that selects IDs. It never returns a nil slice.
+func (s *RBACService) getIDs(query string, args ...interface{}) ([]int, error) {
+	rows, err := s.db.GetMany(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get permitted resources: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan resource ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// ExplainPermissions returns the permissions of a user and the memberships
+// that grant them. With a team ID, only permissions for that team are
+// returned, including those granted through the groups above the team and
+// organization or super admin rights; otherwise those of all memberships. It
+// bypasses the cache.
+func (s *RBACService) ExplainPermissions(userID, teamID int) ([]EffectivePermission, error) {
+	groupCondition := ""
+	var groupArgs []interface{}
+	var teamOrganizationID int
+	if teamID > 0 {
+		var groupID sql.NullInt64
+		err := s.db.QueryRowContext(
+			context.Background(),
+			"SELECT group_id, organization_id FROM teams WHERE id = ?",
+			teamID,
+		).Scan(&groupID, &teamOrganizationID)
+		if err == sql.ErrNoRows {
+			return nil, ErrTeamNotFound
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get team group: %w", err)
+		}
+
+		ancestors := []int{}
+		if groupID.Valid {
+			ancestors, _, err = getGroupAncestors(s.db, int(groupID.Int64))
+			if err != nil {
+				return nil, err
+			}
+		}
+		condition, args := inClause("g.id", ancestors)
+		groupCondition = " AND " + condition
+		groupArgs = args
+	}
+
+	query := `
+		SELECT 'team', t.id, t.name, 0, '', r.id, r.name, p.resource, p.action
+		FROM user_teams ut
+		JOIN teams t ON ut.team_id = t.id
+		JOIN roles r ON ut.role_id = r.id
+		JOIN role_permissions rp ON r.id = rp.role_id
+		JOIN permissions p ON rp.permission_id = p.id
+		WHERE ut.user_id = ? AND (? = 0 OR t.id = ?)
+
+		UNION ALL
+
+		SELECT 'group', 0, '', g.id, g.name, r.id, r.name, p.resource, p.action
+		FROM user_groups ug
+		JOIN groups g ON ug.group_id = g.id
+		JOIN roles r ON ug.role_id = r.id
+		JOIN role_permissions rp ON r.id = rp.role_id
+		JOIN permissions p ON rp.permission_id = p.id
+		WHERE ug.user_id = ?` + groupCondition + `
+	`
+
+	args := append([]interface{}{userID, teamID, teamID, userID}, groupArgs...)
+	rows, err := s.db.GetMany(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to explain permissions: %w", err)
+	}
+	defer rows.Close()
+
+	grants := make(map[string][]PermissionGrant)
+	for rows.Next() {
+		var grant PermissionGrant
+		var resource, action string
+
+		err := rows.Scan(
+			&grant.Source,
+			&grant.TeamID,
+			&grant.TeamName,
+			&grant.GroupID,
+			&grant.GroupName,
+			&grant.RoleID,
+			&grant.RoleName,
+			&resource,
+			&action,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan permission grant: %w", err)
+		}
+
+		key := resource + ":" + action
+		grants[key] = append(grants[key], grant)
+	}
+
+	// Organization admins have every permission in every team of their
+	// organization, whatever their membership there
+	if teamID > 0 {
+		if err := s.explainAdmin(userID, teamOrganizationID, grants); err != nil {
+			return nil, err
+		}
+	}
+
+	keys := make([]string, 0, len(grants))
+	for key := range grants {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	permissions := make([]EffectivePermission, 0, len(keys))
+	for _, key := range keys {
+		resource, action, _ := strings.Cut(key, ":")
+		permissions = append(permissions, EffectivePermission{
+			Resource:  resource,
+			Action:    action,
+			GrantedBy: grants[key],
+		})
+	}
+
+	return permissions, nil
+}
+
+// explainAdmin adds the super and organization admin flags of a user as
+// grants of every permission in a team of an organization
+func (s *RBACService) explainAdmin(userID, organizationID int, grants map[string][]PermissionGrant) error {
+	var userOrganizationID int
+	var superAdmin, orgAdmin bool
 	err := s.db.QueryRowContext(
 		context.Background(),
-		query,
-		userID, teamID, resource, action,
-	).Scan(&hasDirectPermission)
+		"SELECT organization_id, is_super_admin, is_org_admin FROM users WHERE id = ?",
+		userID,
+	).Scan(&userOrganizationID, &superAdmin, &orgAdmin)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to get user organization: %w", err)
+	}
+
+	var adminGrants []PermissionGrant
+	if superAdmin {
+		adminGrants = append(adminGrants, PermissionGrant{Source: GrantSourceSuperAdmin})
+	}
+
+	// Organization admins only count in their own organization
+	if orgAdmin && userOrganizationID == organizationID {
+		adminGrants = append(adminGrants, PermissionGrant{Source: GrantSourceOrgAdmin})
+	}
+
+	if len(adminGrants) == 0 {
+		return nil
+	}
 
+	permissions, err := s.roleService.ListPermissions()
 	if err != nil {
-		return false, fmt.Errorf("failed to check team permission: %w", err)
+		return err
 	}
 
-	if hasDirectPermission {
-		return true, nil
+	for _, permission := range permissions {
+		key := permission.Resource + ":" + permission.Action
+		grants[key] = append(grants[key], adminGrants...)
 	}
 
-	// Check if user has permission through group membership
-	query = `
-		SELECT COUNT(*) > 0
-		FROM teams t
-		JOIN user_groups ug ON t.group_id = ug.group_id
-		JOIN role_permissions rp ON ug.role_id = rp.role_id
-		JOIN permissions p ON rp.permission_id = p.id
-		WHERE t.id = ? AND ug.user_id = ?
-		AND p.resource = ? AND p.action = ?
+	return nil
+}
+
+// userPermissions returns the permissions of a user from the cache, loading
+// them on a miss
+func (s *RBACService) userPermissions(userID int) (*userPermissions, error) {
+	cached, generation := rbacCache.getUser(userID)
+	if cached != nil {
+		return cached, nil
+	}
+
+	permissions := &userPermissions{
+		all:      permissionSet{},
+		teams:    make(map[int]permissionSet),
+		groups:   make(map[int]permissionSet),
+		loadedAt: time.Now(),
+	}
+
+	err := s.db.QueryRowContext(
+		context.Background(),
+		"SELECT organization_id, is_super_admin, is_org_admin FROM users WHERE id = ?",
+		userID,
+	).Scan(&permissions.organizationID, &permissions.superAdmin, &permissions.orgAdmin)
+
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to load user organization: %w", err)
+	}
+
+	query := `
+		SELECT 'team', ut.team_id, r.name, p.resource, p.action
+		FROM user_teams ut
+		JOIN roles r ON ut.role_id = r.id
+		LEFT JOIN role_permissions rp ON r.id = rp.role_id
+		LEFT JOIN permissions p ON rp.permission_id = p.id
+		WHERE ut.user_id = ?
+
+		UNION ALL
+
+		SELECT 'group', ug.group_id, r.name, p.resource, p.action
+		FROM user_groups ug
+		JOIN roles r ON ug.role_id = r.id
+		LEFT JOIN role_permissions rp ON r.id = rp.role_id
+		LEFT JOIN permissions p ON rp.permission_id = p.id
+		WHERE ug.user_id = ?
 	`
 
-	var hasGroupPermission bool
-	err = s.db.QueryRowContext(
+	rows, err := s.db.GetMany(query, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user permissions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var source, roleName string
+		var id int
+		var resource, action sql.NullString
+
+		if err := rows.Scan(&source, &id, &roleName, &resource, &action); err != nil {
+			return nil, fmt.Errorf("failed to scan user permission: %w", err)
+		}
+
+		if roleName == RoleAdmin {
+			permissions.admin = true
+		}
+
+		// Roles without permissions still show up once
+		if !resource.Valid {
+			continue
+		}
+
+		memberships := permissions.teams
+		if source == "group" {
+			memberships = permissions.groups
+		}
+		if memberships[id] == nil {
+			memberships[id] = permissionSet{}
+		}
+
+		key := resource.String + ":" + action.String
+		memberships[id][key] = true
+		permissions.all[key] = true
+	}
+
+	rbacCache.putUser(userID, permissions, generation)
+	return permissions, nil
+}
+
+// teamGroup returns the group and organization of a team from the cache,
+// loading them on a miss. Both are 0 for unknown teams, and the group for
+// teams without one.
+func (s *RBACService) teamGroup(teamID int) (cachedTeamGroup, error) {
+	team, ok, generation := rbacCache.getTeamGroup(teamID)
+	if ok {
+		return team, nil
+	}
+
+	var groupID, organizationID sql.NullInt64
+	err := s.db.QueryRowContext(
 		context.Background(),
-		query,
-		teamID, userID, resource, action,
-	).Scan(&hasGroupPermission)
+		"SELECT group_id, organization_id FROM teams WHERE id = ?",
+		teamID,
+	).Scan(&groupID, &organizationID)
+
+	if err != nil && err != sql.ErrNoRows {
+		return team, fmt.Errorf("failed to get team group: %w", err)
+	}
+
+	team = cachedTeamGroup{
+		groupID:        int(groupID.Int64),
+		organizationID: int(organizationID.Int64),
+	}
+	rbacCache.putTeamGroup(teamID, team, generation)
+	return team, nil
+}
+
+// groupAncestors returns a group followed by its ancestors, and its
+// organization, from the cache, loading them on a miss
+func (s *RBACService) groupAncestors(groupID int) (cachedGroupAncestors, error) {
+	group, ok, generation := rbacCache.getGroupAncestors(groupID)
+	if ok {
+		return group, nil
+	}
 
+	ancestors, organizationID, err := getGroupAncestors(s.db, groupID)
 	if err != nil {
-		return false, fmt.Errorf("failed to check group permission: %w", err)
+		return group, err
 	}
 
-	return hasGroupPermission, nil
+	group = cachedGroupAncestors{ancestors: ancestors, organizationID: organizationID}
+	rbacCache.putGroupAncestors(groupID, group, generation)
+	return group, nil
 }
 
 // GetUserTeamRole gets the user's role in a specific team
 func (s *RBACService) GetUserTeamRole(userID, teamID int) (*Role, error) {
 	query := `
-		SELECT r.id, r.name, r.description, r.created_at
+		SELECT r.id, r.name, r.description, r.is_builtin, r.created_at
 		FROM user_teams ut
 		JOIN roles r ON ut.role_id = r.id
 		WHERE ut.user_id = ? AND ut.team_id = ?
@@ -470,6 +1128,7 @@ func (s *RBACService) GetUserTeamRole(userID, teamID int) (*Role, error) {
 		&role.ID,
 		&role.Name,
 		&role.Description,
+		&role.IsBuiltin,
 		&role.CreatedAt,
 	)
 
@@ -0,0 +1,75 @@
+package models
+
+import "errors"
+
+// Scoring constants, for combining the section scores of an assessment into
+// its overall score
+const (
+	ScoringSum      = "sum"      // Total score over total maximum score
+	ScoringAverage  = "average"  // Mean of the section percentages
+	ScoringWeighted = "weighted" // Mean of the section percentages by section weight
+)
+
+// ErrInvalidScoring is returned for unknown scoring methods
+var ErrInvalidScoring = errors.New("invalid scoring")
+
+// ValidScoring reports whether a scoring method is known
+func ValidScoring(scoring string) bool {
+	switch scoring {
+	case ScoringSum, ScoringAverage, ScoringWeighted:
+		return true
+	}
+	return false
+}
+
+// ScoreWeight returns the weight of a section in the weighted overall score,
+// 1 when the questions file doesn't set one
+func (s *Section) ScoreWeight() float64 {
+	if s.Weight == 0 {
+		return 1
+	}
+	return s.Weight
+}
+
+// ScoreWeight returns the factor the scores of a question are multiplied by,
+// 1 when the questions file doesn't set one
+func (q *Question) ScoreWeight() float64 {
+	if q.Weight == 0 {
+		return 1
+	}
+	return q.Weight
+}
+
+// OverallScore combines section scores into an overall percentage with a
+// scoring method. Assessments scored before scoring methods existed have
+// none and are summed.
+func OverallScore(scoring string, scores []SectionScore) float64 {
+	if len(scores) == 0 {
+		return 0
+	}
+
+	switch scoring {
+	case ScoringAverage, ScoringWeighted:
+		var total, weights float64
+		for _, score := range scores {
+			weight := 1.0
+			if scoring == ScoringWeighted && score.Weight > 0 {
+				weight = score.Weight
+			}
+			total += score.Percentage * weight
+			weights += weight
+		}
+		return total / weights
+	}
+
+	var totalScore, totalMaxScore float64
+	for _, score := range scores {
+		totalScore += score.Score
+		totalMaxScore += score.MaxScore
+	}
+	if totalMaxScore == 0 {
+		return 0
+	}
+
+	return (totalScore / totalMaxScore) * 100
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"devops-assessment/internal/database"
+)
+
+// System settings
+const (
+	// SettingMFARequiredForAdmins forces users with the admin role to use
+	// multi-factor authentication
+	SettingMFARequiredForAdmins = "mfa_required_for_admins"
+)
+
+// SettingService handles system settings stored in the database
+type SettingService struct {
+	db *database.DB
+}
+
+// NewSettingService creates a new setting service
+func NewSettingService(db *database.DB) *SettingService {
+	return &SettingService{db: db}
+}
+
+// Get returns a setting, or defaultValue if it has never been set
+func (s *SettingService) Get(name, defaultValue string) (string, error) {
+	var value string
+	err := s.db.QueryRowContext(context.Background(),
+		"SELECT value FROM system_settings WHERE name = ?",
+		name,
+	).Scan(&value)
+
+	if err == sql.ErrNoRows {
+		return defaultValue, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get setting %s: %w", name, err)
+	}
+
+	return value, nil
+}
+
+// Set stores a setting
+func (s *SettingService) Set(name, value string) error {
+	query := `
+		INSERT INTO system_settings (name, value)
+		VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE value = VALUES(value)
+	`
+
+	if _, err := s.db.Insert(query, name, value); err != nil {
+		return fmt.Errorf("failed to set setting %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// GetBool returns a boolean setting
+func (s *SettingService) GetBool(name string, defaultValue bool) (bool, error) {
+	value, err := s.Get(name, strconv.FormatBool(defaultValue))
+	if err != nil {
+		return false, err
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid boolean setting %s: %q", name, value)
+	}
+
+	return parsed, nil
+}
+
+// SetBool stores a boolean setting
+func (s *SettingService) SetBool(name string, value bool) error {
+	return s.Set(name, strconv.FormatBool(value))
+}
@@ -0,0 +1,161 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"devops-assessment/internal/database"
+)
+
+// TeamTarget is the maturity a team intends to reach in a section, such as
+// 80% in Automation by the end of the quarter
+type TeamTarget struct {
+	ID          int        `json:"id"`
+	TeamID      int        `json:"team_id"`
+	SectionName string     `json:"section_name"`
+	Percentage  float64    `json:"percentage"`         // Target section percentage, 0 to 100
+	DueDate     *time.Time `json:"due_date,omitempty"` // When the target should be reached
+	CreatedBy   int        `json:"created_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// Common errors
+var (
+	ErrTargetNotFound  = errors.New("target not found")
+	ErrInvalidTarget   = errors.New("target percentage must be between 0 and 100")
+	ErrSectionNotFound = errors.New("section not found in any questionnaire template")
+)
+
+// TargetService handles team target database operations
+type TargetService struct {
+	db *database.DB
+}
+
+// NewTargetService creates a new target service
+func NewTargetService(db *database.DB) *TargetService {
+	return &TargetService{db: db}
+}
+
+// targetColumns lists the target columns read by scanTarget
+const targetColumns = `id, team_id, section_name, percentage, due_date, created_by, created_at, updated_at`
+
+// scanTarget scans a row selected with targetColumns
+func scanTarget(row rowScanner, target *TeamTarget) error {
+	var dueDate sql.NullTime
+
+	err := row.Scan(
+		&target.ID,
+		&target.TeamID,
+		&target.SectionName,
+		&target.Percentage,
+		&dueDate,
+		&target.CreatedBy,
+		&target.CreatedAt,
+		&target.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	if dueDate.Valid {
+		target.DueDate = &dueDate.Time
+	}
+
+	return nil
+}
+
+// SetTarget creates the target of a team for a section, or replaces it
+func (s *TargetService) SetTarget(target *TeamTarget) error {
+	if target.Percentage < 0 || target.Percentage > 100 {
+		return ErrInvalidTarget
+	}
+
+	query := `
+		INSERT INTO team_targets (team_id, section_name, percentage, due_date, created_by)
+		VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			percentage = VALUES(percentage),
+			due_date = VALUES(due_date),
+			created_by = VALUES(created_by),
+			updated_at = CURRENT_TIMESTAMP
+	`
+
+	if _, err := s.db.Insert(query,
+		target.TeamID,
+		target.SectionName,
+		target.Percentage,
+		nullTime(target.DueDate),
+		target.CreatedBy,
+	); err != nil {
+		return fmt.Errorf("failed to set target: %w", err)
+	}
+
+	// Load the target to get its ID and timestamps
+	return s.GetTarget(target.TeamID, target.SectionName, target)
+}
+
+// GetTarget retrieves the target of a team for a section
+func (s *TargetService) GetTarget(teamID int, sectionName string, target *TeamTarget) error {
+	query := `
+		SELECT ` + targetColumns + `
+		FROM team_targets
+		WHERE team_id = ? AND section_name = ?
+	`
+
+	err := scanTarget(s.db.QueryRowContext(context.Background(), query, teamID, sectionName), target)
+	if err == sql.ErrNoRows {
+		return ErrTargetNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get target: %w", err)
+	}
+
+	return nil
+}
+
+// ListTeamTargets lists the targets of a team by section name
+func (s *TargetService) ListTeamTargets(teamID int) ([]TeamTarget, error) {
+	query := `
+		SELECT ` + targetColumns + `
+		FROM team_targets
+		WHERE team_id = ?
+		ORDER BY section_name
+	`
+
+	rows, err := s.db.GetMany(query, teamID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list targets: %w", err)
+	}
+	defer rows.Close()
+
+	targets := []TeamTarget{}
+	for rows.Next() {
+		var target TeamTarget
+		if err := scanTarget(rows, &target); err != nil {
+			return nil, fmt.Errorf("failed to scan target: %w", err)
+		}
+		targets = append(targets, target)
+	}
+
+	return targets, nil
+}
+
+// DeleteTarget deletes the target of a team for a section
+func (s *TargetService) DeleteTarget(teamID int, sectionName string) error {
+	affected, err := s.db.Delete(
+		`DELETE FROM team_targets WHERE team_id = ? AND section_name = ?`,
+		teamID, sectionName,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete target: %w", err)
+	}
+	if affected == 0 {
+		return ErrTargetNotFound
+	}
+
+	return nil
+}
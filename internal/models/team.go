@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"devops-assessment/internal/database"
@@ -12,12 +13,13 @@ import (
 
 // Team represents an organizational team
 type Team struct {
-	ID          int       `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	GroupID     int       `json:"group_id,omitempty"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID             int       `json:"id"`
+	OrganizationID int       `json:"organization_id"`
+	Name           string    `json:"name"`
+	Description    string    `json:"description"`
+	GroupID        int       `json:"group_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
 
 	// Relationships (loaded separately)
 	Group       *Group       `json:"group,omitempty"`
@@ -32,17 +34,21 @@ type TeamMember struct {
 	JoinedAt time.Time `json:"joined_at"`
 }
 
-// Group represents an organizational group (collection of teams)
+// Group represents an organizational group (collection of teams). Groups
+// can be nested, e.g. division, department and tribe.
 type Group struct {
-	ID          int       `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID             int       `json:"id"`
+	OrganizationID int       `json:"organization_id"`
+	Name           string    `json:"name"`
+	Description    string    `json:"description"`
+	ParentID       int       `json:"parent_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
 
 	// Relationships (loaded separately)
-	Teams   []Team        `json:"teams,omitempty"`
-	Members []GroupMember `json:"members,omitempty"`
+	Subgroups []Group       `json:"subgroups,omitempty"`
+	Teams     []Team        `json:"teams,omitempty"`
+	Members   []GroupMember `json:"members,omitempty"`
 }
 
 // GroupMember represents a member of a group
@@ -78,14 +84,18 @@ var (
 	ErrGroupNotFound   = errors.New("group not found")
 	ErrTeamNameExists  = errors.New("team name already exists")
 	ErrGroupNameExists = errors.New("group name already exists")
+	ErrGroupCycle      = errors.New("a group can't be moved into itself or its subgroups")
 )
 
 // Team Service Methods
 
-// CreateTeam creates a new team
+// CreateTeam creates a new team in the team's organization
 func (s *TeamService) CreateTeam(team *Team) error {
-	// Check if team name already exists
-	exists, err := s.db.Exists("SELECT 1 FROM teams WHERE name = ?", team.Name)
+	// Check if team name already exists in the organization
+	exists, err := s.db.Exists(
+		"SELECT 1 FROM teams WHERE organization_id = ? AND name = ?",
+		team.OrganizationID, team.Name,
+	)
 	if err != nil {
 		return fmt.Errorf("failed to check team name existence: %w", err)
 	}
@@ -95,18 +105,21 @@ func (s *TeamService) CreateTeam(team *Team) error {
 
 	// Insert team
 	query := `
-		INSERT INTO teams (name, description, group_id)
-		VALUES (?, ?, ?)
+		INSERT INTO teams (organization_id, name, description, group_id)
+		VALUES (?, ?, ?, ?)
 	`
 
 	var groupID interface{}
 	if team.GroupID > 0 {
+		if err := checkSameOrganization(s.db, "groups", team.GroupID, team.OrganizationID); err != nil {
+			return err
+		}
 		groupID = team.GroupID
 	} else {
 		groupID = nil
 	}
 
-	id, err := s.db.Insert(query, team.Name, team.Description, groupID)
+	id, err := s.db.Insert(query, team.OrganizationID, team.Name, team.Description, groupID)
 	if err != nil {
 		return fmt.Errorf("failed to create team: %w", err)
 	}
@@ -120,20 +133,12 @@ func (s *TeamService) CreateTeam(team *Team) error {
 // GetTeamByID retrieves a team by ID
 func (s *TeamService) GetTeamByID(id int, team *Team) error {
 	query := `
-		SELECT id, name, description, group_id, created_at, updated_at
+		SELECT ` + teamColumns + `
 		FROM teams
 		WHERE id = ?
 	`
 
-	var groupID sql.NullInt64
-	err := s.db.QueryRowContext(context.Background(), query, id).Scan(
-		&team.ID,
-		&team.Name,
-		&team.Description,
-		&groupID,
-		&team.CreatedAt,
-		&team.UpdatedAt,
-	)
+	err := scanTeam(s.db.QueryRowContext(context.Background(), query, id), team)
 
 	if err == sql.ErrNoRows {
 		return ErrTeamNotFound
@@ -142,11 +147,23 @@ func (s *TeamService) GetTeamByID(id int, team *Team) error {
 		return fmt.Errorf("failed to get team: %w", err)
 	}
 
-	if groupID.Valid {
-		team.GroupID = int(groupID.Int64)
+	return nil
+}
+
+// GetTeamByName retrieves a team of an organization by name
+func (s *TeamService) GetTeamByName(organizationID int, name string, team *Team) error {
+	var id int
+	err := s.db.QueryRowContext(context.Background(),
+		"SELECT id FROM teams WHERE organization_id = ? AND name = ?", organizationID, name,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return ErrTeamNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get team: %w", err)
 	}
 
-	return nil
+	return s.GetTeamByID(id, team)
 }
 
 // UpdateTeam updates team information
@@ -159,6 +176,9 @@ func (s *TeamService) UpdateTeam(team *Team) error {
 
 	var groupID interface{}
 	if team.GroupID > 0 {
+		if err := checkSameOrganization(s.db, "groups", team.GroupID, team.OrganizationID); err != nil {
+			return err
+		}
 		groupID = team.GroupID
 	} else {
 		groupID = nil
@@ -169,6 +189,9 @@ func (s *TeamService) UpdateTeam(team *Team) error {
 		return fmt.Errorf("failed to update team: %w", err)
 	}
 
+	// Members of the old and new group lose or gain access to the team
+	rbacCache.invalidateAll()
+
 	if affected == 0 {
 		return ErrTeamNotFound
 	}
@@ -194,6 +217,9 @@ func (s *TeamService) DeleteTeam(teamID int) error {
 		return fmt.Errorf("failed to delete team: %w", err)
 	}
 
+	// Team memberships are deleted with the team
+	rbacCache.invalidateAll()
+
 	if affected == 0 {
 		return ErrTeamNotFound
 	}
@@ -248,17 +274,27 @@ func (s *TeamService) GetTeamMembers(teamID int) ([]TeamMember, error) {
 	return members, nil
 }
 
-// ListTeams returns a paginated list of teams
-func (s *TeamService) ListTeams(offset, limit int, groupID *int) ([]Team, int, error) {
+// ListTeams returns a paginated list of the teams of an organization,
+// optionally limited to a group and to a list of team IDs (nil for all
+// teams)
+func (s *TeamService) ListTeams(organizationID, offset, limit int, groupID *int, teamIDs []int) ([]Team, int, error) {
 	// Build query
-	whereClause := ""
-	args := []interface{}{}
+	conditions := []string{"organization_id = ?"}
+	args := []interface{}{organizationID}
 
 	if groupID != nil {
-		whereClause = "WHERE group_id = ?"
+		conditions = append(conditions, "group_id = ?")
 		args = append(args, *groupID)
 	}
 
+	if teamIDs != nil {
+		condition, ids := inClause("id", teamIDs)
+		conditions = append(conditions, condition)
+		args = append(args, ids...)
+	}
+
+	whereClause := "WHERE " + strings.Join(conditions, " AND ")
+
 	// Get total count
 	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM teams %s", whereClause)
 	var totalCount int
@@ -269,7 +305,7 @@ func (s *TeamService) ListTeams(offset, limit int, groupID *int) ([]Team, int, e
 
 	// Get teams
 	query := fmt.Sprintf(`
-		SELECT id, name, description, group_id, created_at, updated_at
+		SELECT `+teamColumns+`
 		FROM teams
 		%s
 		ORDER BY name
@@ -286,24 +322,9 @@ func (s *TeamService) ListTeams(offset, limit int, groupID *int) ([]Team, int, e
 	var teams []Team
 	for rows.Next() {
 		var team Team
-		var groupID sql.NullInt64
-
-		err := rows.Scan(
-			&team.ID,
-			&team.Name,
-			&team.Description,
-			&groupID,
-			&team.CreatedAt,
-			&team.UpdatedAt,
-		)
-		if err != nil {
+		if err := scanTeam(rows, &team); err != nil {
 			return nil, 0, fmt.Errorf("failed to scan team: %w", err)
 		}
-
-		if groupID.Valid {
-			team.GroupID = int(groupID.Int64)
-		}
-
 		teams = append(teams, team)
 	}
 
@@ -312,10 +333,13 @@ func (s *TeamService) ListTeams(offset, limit int, groupID *int) ([]Team, int, e
 
 // Group Service Methods
 
-// CreateGroup creates a new group
+// CreateGroup creates a new group in the group's organization
 func (s *GroupService) CreateGroup(group *Group) error {
-	// Check if group name already exists
-	exists, err := s.db.Exists("SELECT 1 FROM groups WHERE name = ?", group.Name)
+	// Check if group name already exists in the organization
+	exists, err := s.db.Exists(
+		"SELECT 1 FROM groups WHERE organization_id = ? AND name = ?",
+		group.OrganizationID, group.Name,
+	)
 	if err != nil {
 		return fmt.Errorf("failed to check group name existence: %w", err)
 	}
@@ -323,13 +347,29 @@ func (s *GroupService) CreateGroup(group *Group) error {
 		return ErrGroupNameExists
 	}
 
+	// Check if parent group exists in the organization
+	if group.ParentID > 0 {
+		err := checkSameOrganization(s.db, "groups", group.ParentID, group.OrganizationID)
+		if err == ErrOrganizationMismatch {
+			return ErrGroupNotFound
+		}
+		if err != nil {
+			return err
+		}
+	}
+
 	// Insert group
 	query := `
-		INSERT INTO groups (name, description)
-		VALUES (?, ?)
+		INSERT INTO groups (organization_id, name, description, parent_id)
+		VALUES (?, ?, ?, ?)
 	`
 
-	id, err := s.db.Insert(query, group.Name, group.Description)
+	var parentID interface{}
+	if group.ParentID > 0 {
+		parentID = group.ParentID
+	}
+
+	id, err := s.db.Insert(query, group.OrganizationID, group.Name, group.Description, parentID)
 	if err != nil {
 		return fmt.Errorf("failed to create group: %w", err)
 	}
@@ -343,18 +383,12 @@ func (s *GroupService) CreateGroup(group *Group) error {
 // GetGroupByID retrieves a group by ID
 func (s *GroupService) GetGroupByID(id int, group *Group) error {
 	query := `
-		SELECT id, name, description, created_at, updated_at
+		SELECT ` + groupColumns + `
 		FROM groups
 		WHERE id = ?
 	`
 
-	err := s.db.QueryRowContext(context.Background(), query, id).Scan(
-		&group.ID,
-		&group.Name,
-		&group.Description,
-		&group.CreatedAt,
-		&group.UpdatedAt,
-	)
+	err := scanGroup(s.db.QueryRowContext(context.Background(), query, id), group)
 
 	if err == sql.ErrNoRows {
 		return ErrGroupNotFound
@@ -366,6 +400,22 @@ func (s *GroupService) GetGroupByID(id int, group *Group) error {
 	return nil
 }
 
+// GetGroupByName retrieves a group of an organization by name
+func (s *GroupService) GetGroupByName(organizationID int, name string, group *Group) error {
+	var id int
+	err := s.db.QueryRowContext(context.Background(),
+		"SELECT id FROM groups WHERE organization_id = ? AND name = ?", organizationID, name,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return ErrGroupNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get group: %w", err)
+	}
+
+	return s.GetGroupByID(id, group)
+}
+
 // UpdateGroup updates group information
 func (s *GroupService) UpdateGroup(group *Group) error {
 	query := `
@@ -386,6 +436,86 @@ func (s *GroupService) UpdateGroup(group *Group) error {
 	return nil
 }
 
+// MoveGroup moves a group, with its subgroups and teams, under another
+// group of its organization, or to the top level when parentID is 0
+func (s *GroupService) MoveGroup(groupID, parentID int) error {
+	err := s.db.Transaction(func(tx *sql.Tx) error {
+		var organizationID int
+		err := tx.QueryRow("SELECT organization_id FROM groups WHERE id = ?", groupID).Scan(&organizationID)
+		if err == sql.ErrNoRows {
+			return ErrGroupNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get group: %w", err)
+		}
+
+		var newParent interface{}
+		if parentID > 0 {
+			// Concurrent moves each checked on their own could make a cycle
+			// together, so the hierarchy stays locked until the move is done
+			parents, err := lockGroupParents(tx, organizationID)
+			if err != nil {
+				return err
+			}
+			if _, exists := parents[parentID]; !exists {
+				return ErrGroupNotFound
+			}
+
+			// Moving a group under one of its descendants would make a cycle
+			visited := make(map[int]bool)
+			for ancestor := parentID; ancestor != 0 && !visited[ancestor]; ancestor = parents[ancestor] {
+				if ancestor == groupID {
+					return ErrGroupCycle
+				}
+				visited[ancestor] = true
+			}
+
+			newParent = parentID
+		}
+
+		if _, err := tx.Exec("UPDATE groups SET parent_id = ? WHERE id = ?", newParent, groupID); err != nil {
+			return fmt.Errorf("failed to move group: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Members of the old and new ancestors lose or gain access
+	rbacCache.invalidateAll()
+
+	return nil
+}
+
+// GetSubgroups retrieves the direct subgroups of a group
+func (s *GroupService) GetSubgroups(groupID int) ([]Group, error) {
+	query := `
+		SELECT ` + groupColumns + `
+		FROM groups
+		WHERE parent_id = ?
+		ORDER BY name
+	`
+
+	rows, err := s.db.GetMany(query, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subgroups: %w", err)
+	}
+	defer rows.Close()
+
+	var groups []Group
+	for rows.Next() {
+		var group Group
+		if err := scanGroup(rows, &group); err != nil {
+			return nil, fmt.Errorf("failed to scan group: %w", err)
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, nil
+}
+
 // DeleteGroup deletes a group
 func (s *GroupService) DeleteGroup(groupID int) error {
 	// Check if group has teams
@@ -397,6 +527,15 @@ func (s *GroupService) DeleteGroup(groupID int) error {
 		return fmt.Errorf("cannot delete group with existing teams")
 	}
 
+	// Check if group has subgroups
+	hasSubgroups, err := s.db.Exists("SELECT 1 FROM groups WHERE parent_id = ?", groupID)
+	if err != nil {
+		return fmt.Errorf("failed to check subgroups: %w", err)
+	}
+	if hasSubgroups {
+		return fmt.Errorf("cannot delete group with existing subgroups")
+	}
+
 	query := `DELETE FROM groups WHERE id = ?`
 
 	affected, err := s.db.Delete(query, groupID)
@@ -404,6 +543,9 @@ func (s *GroupService) DeleteGroup(groupID int) error {
 		return fmt.Errorf("failed to delete group: %w", err)
 	}
 
+	// Group memberships are deleted with the group
+	rbacCache.invalidateAll()
+
 	if affected == 0 {
 		return ErrGroupNotFound
 	}
@@ -458,13 +600,19 @@ func (s *GroupService) GetGroupMembers(groupID int) ([]GroupMember, error) {
 	return members, nil
 }
 
-// GetGroupTeams retrieves all teams in a group
+// GetGroupTeams retrieves all teams in a group and its subgroups. UNION
+// discards groups already selected, which ends the recursion on cycles.
 func (s *GroupService) GetGroupTeams(groupID int) ([]Team, error) {
 	query := `
-		SELECT id, name, description, group_id, created_at, updated_at
-		FROM teams
-		WHERE group_id = ?
-		ORDER BY name
+		WITH RECURSIVE descendants (id) AS (
+			SELECT id FROM groups WHERE id = ?
+			UNION
+			SELECT g.id FROM groups g JOIN descendants d ON g.parent_id = d.id
+		)
+		SELECT t.id, t.organization_id, t.name, t.description, t.group_id, t.created_at, t.updated_at
+		FROM teams t
+		JOIN descendants d ON t.group_id = d.id
+		ORDER BY t.name
 	`
 
 	rows, err := s.db.GetMany(query, groupID)
@@ -476,49 +624,47 @@ func (s *GroupService) GetGroupTeams(groupID int) ([]Team, error) {
 	var teams []Team
 	for rows.Next() {
 		var team Team
-		var gID sql.NullInt64
-
-		err := rows.Scan(
-			&team.ID,
-			&team.Name,
-			&team.Description,
-			&gID,
-			&team.CreatedAt,
-			&team.UpdatedAt,
-		)
-		if err != nil {
+		if err := scanTeam(rows, &team); err != nil {
 			return nil, fmt.Errorf("failed to scan team: %w", err)
 		}
-
-		if gID.Valid {
-			team.GroupID = int(gID.Int64)
-		}
-
 		teams = append(teams, team)
 	}
 
 	return teams, nil
 }
 
-// ListGroups returns a paginated list of groups
-func (s *GroupService) ListGroups(offset, limit int) ([]Group, int, error) {
+// ListGroups returns a paginated list of the groups of an organization,
+// optionally limited to a list of group IDs (nil for all groups)
+func (s *GroupService) ListGroups(organizationID, offset, limit int, groupIDs []int) ([]Group, int, error) {
+	// Build query
+	whereClause := "WHERE organization_id = ?"
+	args := []interface{}{organizationID}
+
+	if groupIDs != nil {
+		condition, ids := inClause("id", groupIDs)
+		whereClause += " AND " + condition
+		args = append(args, ids...)
+	}
+
 	// Get total count
-	countQuery := "SELECT COUNT(*) FROM groups"
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM groups %s", whereClause)
 	var totalCount int
-	err := s.db.QueryRowContext(context.Background(), countQuery).Scan(&totalCount)
+	err := s.db.QueryRowContext(context.Background(), countQuery, args...).Scan(&totalCount)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to get group count: %w", err)
 	}
 
 	// Get groups
-	query := `
-		SELECT id, name, description, created_at, updated_at
+	query := fmt.Sprintf(`
+		SELECT `+groupColumns+`
 		FROM groups
+		%s
 		ORDER BY name
 		LIMIT ? OFFSET ?
-	`
+	`, whereClause)
 
-	rows, err := s.db.GetMany(query, limit, offset)
+	args = append(args, limit, offset)
+	rows, err := s.db.GetMany(query, args...)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to list groups: %w", err)
 	}
@@ -528,14 +674,7 @@ func (s *GroupService) ListGroups(offset, limit int) ([]Group, int, error) {
 	for rows.Next() {
 		var group Group
 
-		err := rows.Scan(
-			&group.ID,
-			&group.Name,
-			&group.Description,
-			&group.CreatedAt,
-			&group.UpdatedAt,
-		)
-		if err != nil {
+		if err := scanGroup(rows, &group); err != nil {
 			return nil, 0, fmt.Errorf("failed to scan group: %w", err)
 		}
 
@@ -544,3 +683,132 @@ func (s *GroupService) ListGroups(offset, limit int) ([]Group, int, error) {
 
 	return groups, totalCount, nil
 }
+
+// teamColumns lists the columns scanned by scanTeam
+const teamColumns = `id, organization_id, name, description, group_id, created_at, updated_at`
+
+// scanTeam scans a row selected with teamColumns
+func scanTeam(row rowScanner, team *Team) error {
+	var groupID sql.NullInt64
+
+	err := row.Scan(
+		&team.ID,
+		&team.OrganizationID,
+		&team.Name,
+		&team.Description,
+		&groupID,
+		&team.CreatedAt,
+		&team.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	team.GroupID = int(groupID.Int64)
+	return nil
+}
+
+// groupColumns lists the columns scanned by scanGroup
+const groupColumns = `id, organization_id, name, description, parent_id, created_at, updated_at`
+
+// scanGroup scans a row selected with groupColumns
+func scanGroup(row rowScanner, group *Group) error {
+	var parentID sql.NullInt64
+
+	err := row.Scan(
+		&group.ID,
+		&group.OrganizationID,
+		&group.Name,
+		&group.Description,
+		&parentID,
+		&group.CreatedAt,
+		&group.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	group.ParentID = int(parentID.Int64)
+	return nil
+}
+
+// lockGroupParents locks the groups of an organization for the rest of a
+// transaction and returns the parent of each, 0 for top-level groups
+func lockGroupParents(tx *sql.Tx, organizationID int) (map[int]int, error) {
+	rows, err := tx.Query(`
+		SELECT id, parent_id FROM groups
+		WHERE organization_id = ?
+		ORDER BY id
+		FOR UPDATE
+	`, organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock groups: %w", err)
+	}
+	defer rows.Close()
+
+	parents := make(map[int]int)
+	for rows.Next() {
+		var id int
+		var parentID sql.NullInt64
+		if err := rows.Scan(&id, &parentID); err != nil {
+			return nil, fmt.Errorf("failed to scan group: %w", err)
+		}
+		parents[id] = int(parentID.Int64)
+	}
+
+	return parents, rows.Err()
+}
+
+// getGroupAncestors returns a group followed by its ancestors, nearest
+// first, and the organization of the group. It returns an empty list for
+// unknown groups. The path of visited groups ends the recursion should the
+// hierarchy ever contain a cycle.
+func getGroupAncestors(db *database.DB, groupID int) ([]int, int, error) {
+	query := `
+		WITH RECURSIVE ancestors (id, organization_id, parent_id, depth, path) AS (
+			SELECT id, organization_id, parent_id, 0, CAST(id AS CHAR(1000)) FROM groups WHERE id = ?
+			UNION ALL
+			SELECT g.id, g.organization_id, g.parent_id, a.depth + 1, CONCAT(a.path, ',', g.id)
+			FROM groups g
+			JOIN ancestors a ON g.id = a.parent_id
+			WHERE FIND_IN_SET(g.id, a.path) = 0
+		)
+		SELECT id, organization_id FROM ancestors ORDER BY depth
+	`
+
+	rows, err := db.GetMany(query, groupID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get group ancestors: %w", err)
+	}
+	defer rows.Close()
+
+	ancestors := []int{}
+	var organizationID int
+	for rows.Next() {
+		var id, ancestorOrganizationID int
+		if err := rows.Scan(&id, &ancestorOrganizationID); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan group: %w", err)
+		}
+		if len(ancestors) == 0 {
+			organizationID = ancestorOrganizationID
+		}
+		ancestors = append(ancestors, id)
+	}
+
+	return ancestors, organizationID, nil
+}
+
+// inClause returns an "IN" condition on a column for a list of IDs, and its
+// arguments. An empty list matches nothing.
+func inClause(column string, ids []int) (string, []interface{}) {
+	if len(ids) == 0 {
+		return "FALSE", nil
+	}
+
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	return column + " IN (?" + strings.Repeat(", ?", len(ids)-1) + ")", args
+}
@@ -0,0 +1,165 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// DefaultTemplateID is the ID of the built-in DevOps maturity questionnaire
+const DefaultTemplateID = "devops"
+
+// Common errors
+var (
+	ErrTemplateNotFound = errors.New("questionnaire template not found")
+)
+
+// QuestionnaireTemplate represents a maturity model with its own questions
+// and advice, e.g. DevOps, DevSecOps or SRE
+type QuestionnaireTemplate struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Description   string `json:"description,omitempty"`
+	QuestionsFile string `json:"questions_file"`
+	AdviceFile    string `json:"advice_file"`
+	MaturityFile  string `json:"maturity_file,omitempty"` // Default maturity levels when empty
+	Scoring       string `json:"scoring,omitempty"`       // Overall score of new assessments, sum when empty
+	Default       bool   `json:"default,omitempty"`
+}
+
+// TemplateRegistry holds the questionnaire templates that assessments can be
+// started with
+type TemplateRegistry struct {
+	templates []QuestionnaireTemplate
+	services  map[string]*QuestionService
+	defaultID string
+}
+
+// NewTemplateRegistry creates a registry from a list of templates. The
+// template marked as default (or the first one) is used when no template is
+// requested.
+func NewTemplateRegistry(templates []QuestionnaireTemplate) (*TemplateRegistry, error) {
+	if len(templates) == 0 {
+		return nil, fmt.Errorf("at least one questionnaire template is required")
+	}
+
+	registry := &TemplateRegistry{
+		templates: templates,
+		services:  make(map[string]*QuestionService),
+		defaultID: templates[0].ID,
+	}
+
+	defaults := 0
+	for _, template := range templates {
+		if template.ID == "" {
+			return nil, fmt.Errorf("questionnaire template %q has no id", template.Name)
+		}
+		if _, exists := registry.services[template.ID]; exists {
+			return nil, fmt.Errorf("duplicate questionnaire template id %q", template.ID)
+		}
+		if template.QuestionsFile == "" || template.AdviceFile == "" {
+			return nil, fmt.Errorf("questionnaire template %q needs a questions and an advice file", template.ID)
+		}
+
+		if template.Scoring != "" && !ValidScoring(template.Scoring) {
+			return nil, fmt.Errorf("questionnaire template %q: scoring must be sum, average or weighted", template.ID)
+		}
+
+		if template.Default {
+			registry.defaultID = template.ID
+			defaults++
+		}
+
+		questionService := NewQuestionService(template.QuestionsFile, template.AdviceFile)
+		if template.MaturityFile != "" {
+			maturity, err := LoadMaturityModel(template.MaturityFile)
+			if err != nil {
+				return nil, fmt.Errorf("questionnaire template %q: %w", template.ID, err)
+			}
+			questionService.SetMaturityModel(maturity)
+		}
+		registry.services[template.ID] = questionService
+	}
+
+	if defaults > 1 {
+		return nil, fmt.Errorf("only one questionnaire template can be the default")
+	}
+
+	return registry, nil
+}
+
+// LoadTemplateRegistry loads the templates listed in registryFile. When the
+// file does not exist the registry holds a single default template made of
+// questionsFile and adviceFile, with the maturity levels in maturityFile if it
+// exists.
+func LoadTemplateRegistry(registryFile, questionsFile, adviceFile, maturityFile string) (*TemplateRegistry, error) {
+	data, err := ioutil.ReadFile(registryFile)
+	if os.IsNotExist(err) || registryFile == "" {
+		if _, err := os.Stat(maturityFile); err != nil {
+			maturityFile = ""
+		}
+		return NewTemplateRegistry([]QuestionnaireTemplate{{
+			ID:            DefaultTemplateID,
+			Name:          "DevOps Maturity Assessment",
+			QuestionsFile: questionsFile,
+			AdviceFile:    adviceFile,
+			MaturityFile:  maturityFile,
+			Default:       true,
+		}})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read questionnaire templates file: %w", err)
+	}
+
+	var templates []QuestionnaireTemplate
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return nil, fmt.Errorf("failed to parse questionnaire templates JSON: %w", err)
+	}
+
+	return NewTemplateRegistry(templates)
+}
+
+// List returns all templates in registry order
+func (r *TemplateRegistry) List() []QuestionnaireTemplate {
+	templates := make([]QuestionnaireTemplate, len(r.templates))
+	copy(templates, r.templates)
+	return templates
+}
+
+// DefaultID returns the ID of the default template
+func (r *TemplateRegistry) DefaultID() string {
+	return r.defaultID
+}
+
+// Get retrieves a template by ID, an empty ID returns the default template
+func (r *TemplateRegistry) Get(id string) (*QuestionnaireTemplate, error) {
+	if id == "" {
+		id = r.defaultID
+	}
+
+	for i := range r.templates {
+		if r.templates[i].ID == id {
+			template := r.templates[i]
+			return &template, nil
+		}
+	}
+
+	return nil, ErrTemplateNotFound
+}
+
+// QuestionService returns the question service of a template, an empty ID
+// returns the one of the default template
+func (r *TemplateRegistry) QuestionService(id string) (*QuestionService, error) {
+	if id == "" {
+		id = r.defaultID
+	}
+
+	service, exists := r.services[id]
+	if !exists {
+		return nil, ErrTemplateNotFound
+	}
+
+	return service, nil
+}
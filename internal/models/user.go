@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"devops-assessment/internal/database"
@@ -14,14 +15,18 @@ import (
 
 // User represents a system user
 type User struct {
-	ID           int       `json:"id"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"` // Never expose password hash in JSON
-	FirstName    string    `json:"first_name"`
-	LastName     string    `json:"last_name"`
-	IsActive     bool      `json:"is_active"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID               int       `json:"id"`
+	OrganizationID   int       `json:"organization_id"`
+	Email            string    `json:"email"`
+	PasswordHash     string    `json:"-"` // Never expose password hash in JSON
+	FirstName        string    `json:"first_name"`
+	LastName         string    `json:"last_name"`
+	IsActive         bool      `json:"is_active"`
+	IsServiceAccount bool      `json:"is_service_account"` // Authenticates with API tokens only
+	IsSuperAdmin     bool      `json:"is_super_admin"`     // Manages and acts in all organizations
+	IsOrgAdmin       bool      `json:"is_org_admin"`       // Has every permission in their organization
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
 
 	// Relationships (loaded separately)
 	Teams  []TeamMembership  `json:"teams,omitempty"`
@@ -47,6 +52,28 @@ type UserService struct {
 	db *database.DB
 }
 
+// userColumns lists the columns scanned by scanUser
+const userColumns = `id, organization_id, email, password_hash, first_name, last_name,
+		       is_active, is_service_account, is_super_admin, is_org_admin, created_at, updated_at`
+
+// scanUser scans a row selected with userColumns
+func scanUser(row rowScanner, user *User) error {
+	return row.Scan(
+		&user.ID,
+		&user.OrganizationID,
+		&user.Email,
+		&user.PasswordHash,
+		&user.FirstName,
+		&user.LastName,
+		&user.IsActive,
+		&user.IsServiceAccount,
+		&user.IsSuperAdmin,
+		&user.IsOrgAdmin,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+}
+
 // NewUserService creates a new user service
 func NewUserService(db *database.DB) *UserService {
 	return &UserService{db: db}
@@ -58,9 +85,15 @@ var (
 	ErrEmailAlreadyExists = errors.New("email already exists")
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrUserInactive       = errors.New("user account is inactive")
+
+	ErrIdentityAlreadyLinked = errors.New("identity is already linked to a user")
 )
 
-// CreateUser creates a new user
+// MaxPasswordHistory is the number of previous password hashes kept per user
+const MaxPasswordHistory = 24
+
+// CreateUser creates a new user in the user's organization. Emails are
+// unique across organizations, as users log in with them.
 func (s *UserService) CreateUser(user *User, password string) error {
 	// Hash the password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -80,16 +113,21 @@ func (s *UserService) CreateUser(user *User, password string) error {
 
 	// Insert user
 	query := `
-		INSERT INTO users (email, password_hash, first_name, last_name, is_active)
-		VALUES (?, ?, ?, ?, ?)
+		INSERT INTO users (organization_id, email, password_hash, first_name, last_name,
+		                   is_active, is_service_account, is_super_admin, is_org_admin)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	id, err := s.db.Insert(query,
+		user.OrganizationID,
 		user.Email,
 		user.PasswordHash,
 		user.FirstName,
 		user.LastName,
 		user.IsActive,
+		user.IsServiceAccount,
+		user.IsSuperAdmin,
+		user.IsOrgAdmin,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create user: %w", err)
@@ -104,22 +142,12 @@ func (s *UserService) CreateUser(user *User, password string) error {
 // GetUserByID retrieves a user by ID
 func (s *UserService) GetUserByID(id int, user *User) error {
 	query := `
-		SELECT id, email, password_hash, first_name, last_name, 
-		       is_active, created_at, updated_at
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE id = ?
 	`
 
-	err := s.db.QueryRowContext(context.Background(), query, id).Scan(
-		&user.ID,
-		&user.Email,
-		&user.PasswordHash,
-		&user.FirstName,
-		&user.LastName,
-		&user.IsActive,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	err := scanUser(s.db.QueryRowContext(context.Background(), query, id), user)
 
 	if err == sql.ErrNoRows {
 		return ErrUserNotFound
@@ -134,22 +162,33 @@ func (s *UserService) GetUserByID(id int, user *User) error {
 // GetUserByEmail retrieves a user by email
 func (s *UserService) GetUserByEmail(email string, user *User) error {
 	query := `
-		SELECT id, email, password_hash, first_name, last_name, 
-		       is_active, created_at, updated_at
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE email = ?
 	`
 
-	err := s.db.QueryRowContext(context.Background(), query, email).Scan(
-		&user.ID,
-		&user.Email,
-		&user.PasswordHash,
-		&user.FirstName,
-		&user.LastName,
-		&user.IsActive,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	err := scanUser(s.db.QueryRowContext(context.Background(), query, email), user)
+
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return nil
+}
+
+// GetOrganizationUserByEmail retrieves a user of an organization by email.
+// Users of other organizations are not found.
+func (s *UserService) GetOrganizationUserByEmail(organizationID int, email string, user *User) error {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE organization_id = ? AND email = ?
+	`
+
+	err := scanUser(s.db.QueryRowContext(context.Background(), query, organizationID, email), user)
 
 	if err == sql.ErrNoRows {
 		return ErrUserNotFound
@@ -165,7 +204,7 @@ func (s *UserService) GetUserByEmail(email string, user *User) error {
 func (s *UserService) UpdateUser(user *User) error {
 	query := `
 		UPDATE users 
-		SET email = ?, first_name = ?, last_name = ?, is_active = ?
+		SET email = ?, first_name = ?, last_name = ?, is_active = ?, is_super_admin = ?, is_org_admin = ?
 		WHERE id = ?
 	`
 
@@ -174,6 +213,8 @@ func (s *UserService) UpdateUser(user *User) error {
 		user.FirstName,
 		user.LastName,
 		user.IsActive,
+		user.IsSuperAdmin,
+		user.IsOrgAdmin,
 		user.ID,
 	)
 
@@ -181,6 +222,9 @@ func (s *UserService) UpdateUser(user *User) error {
 		return fmt.Errorf("failed to update user: %w", err)
 	}
 
+	// The admin flags are part of the cached permissions
+	rbacCache.invalidateUser(user.ID)
+
 	if affected == 0 {
 		return ErrUserNotFound
 	}
@@ -188,25 +232,93 @@ func (s *UserService) UpdateUser(user *User) error {
 	return nil
 }
 
-// UpdatePassword updates a user's password
+// UpdatePassword updates a user's password. The previous hash is kept in
+// the password history, which holds at most MaxPasswordHistory entries.
 func (s *UserService) UpdatePassword(userID int, newPassword string) error {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
 	if err != nil {
 		return fmt.Errorf("failed to hash password: %w", err)
 	}
 
-	query := `UPDATE users SET password_hash = ? WHERE id = ?`
+	err = s.db.Transaction(func(tx *sql.Tx) error {
+		// Archive the current hash
+		result, err := tx.Exec(`
+			INSERT INTO password_history (user_id, password_hash)
+			SELECT id, password_hash FROM users WHERE id = ?
+		`, userID)
+		if err != nil {
+			return err
+		}
+
+		archived, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if archived == 0 {
+			return ErrUserNotFound
+		}
+
+		if _, err := tx.Exec("UPDATE users SET password_hash = ? WHERE id = ?", string(hashedPassword), userID); err != nil {
+			return err
+		}
 
-	affected, err := s.db.Update(query, string(hashedPassword), userID)
+		// Drop entries beyond the history limit
+		_, err = tx.Exec(`
+			DELETE FROM password_history
+			WHERE user_id = ? AND id NOT IN (
+				SELECT id FROM (
+					SELECT id FROM password_history
+					WHERE user_id = ?
+					ORDER BY id DESC
+					LIMIT ?
+				) recent
+			)
+		`, userID, userID, MaxPasswordHistory)
+		return err
+	})
+	if err == ErrUserNotFound {
+		return err
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update password: %w", err)
 	}
 
-	if affected == 0 {
-		return ErrUserNotFound
+	return nil
+}
+
+// GetPasswordHashes returns the current password hash of a user followed by
+// up to limit-1 previous ones, newest first
+func (s *UserService) GetPasswordHashes(userID, limit int) ([]string, error) {
+	if limit < 1 {
+		return nil, nil
 	}
 
-	return nil
+	query := `
+		SELECT password_hash FROM (
+			SELECT password_hash, 0 AS age, 0 AS id FROM users WHERE id = ?
+			UNION ALL
+			SELECT password_hash, 1 AS age, id FROM password_history WHERE user_id = ?
+		) hashes
+		ORDER BY age, id DESC
+		LIMIT ?
+	`
+
+	rows, err := s.db.GetMany(query, userID, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get password history: %w", err)
+	}
+	defer rows.Close()
+
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, fmt.Errorf("failed to scan password hash: %w", err)
+		}
+		hashes = append(hashes, hash)
+	}
+
+	return hashes, nil
 }
 
 // DeleteUser soft deletes a user by setting is_active to false
@@ -343,12 +455,18 @@ func (s *UserService) GetUserGroups(userID int) ([]GroupMembership, error) {
 	return memberships, nil
 }
 
-// AddUserToTeam adds a user to a team with a specific role
+// AddUserToTeam adds a user to a team with a specific role. The team must
+// be in the user's organization. A membership granted by a group mapping
+// becomes one granted by hand.
 func (s *UserService) AddUserToTeam(userID, teamID, roleID int) error {
+	if err := s.checkMembershipOrganization(userID, "teams", teamID); err != nil {
+		return err
+	}
+
 	query := `
 		INSERT INTO user_teams (user_id, team_id, role_id)
 		VALUES (?, ?, ?)
-		ON DUPLICATE KEY UPDATE role_id = VALUES(role_id)
+		ON DUPLICATE KEY UPDATE role_id = VALUES(role_id), source = NULL
 	`
 
 	_, err := s.db.Insert(query, userID, teamID, roleID)
@@ -356,6 +474,223 @@ func (s *UserService) AddUserToTeam(userID, teamID, roleID int) error {
 		return fmt.Errorf("failed to add user to team: %w", err)
 	}
 
+	rbacCache.invalidateUser(userID)
+
+	return nil
+}
+
+// AddUserToGroup adds a user to a group with a specific role. The group
+// must be in the user's organization. A membership granted by a group
+// mapping becomes one granted by hand.
+func (s *UserService) AddUserToGroup(userID, groupID, roleID int) error {
+	if err := s.checkMembershipOrganization(userID, "groups", groupID); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO user_groups (user_id, group_id, role_id)
+		VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE role_id = VALUES(role_id), source = NULL
+	`
+
+	_, err := s.db.Insert(query, userID, groupID, roleID)
+	if err != nil {
+		return fmt.Errorf("failed to add user to group: %w", err)
+	}
+
+	rbacCache.invalidateUser(userID)
+
+	return nil
+}
+
+// GrantMappedTeamMembership adds a user to a team on behalf of the group
+// mappings of an identity provider, the source. Memberships granted by hand
+// are left alone; those of the source follow the mapped role.
+func (s *UserService) GrantMappedTeamMembership(userID, teamID, roleID int, source string) error {
+	if err := s.checkMembershipOrganization(userID, "teams", teamID); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO user_teams (user_id, team_id, role_id, source)
+		VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE role_id = IF(source <=> VALUES(source), VALUES(role_id), role_id)
+	`
+
+	_, err := s.db.Insert(query, userID, teamID, roleID, source)
+	if err != nil {
+		return fmt.Errorf("failed to add user to team: %w", err)
+	}
+
+	rbacCache.invalidateUser(userID)
+
+	return nil
+}
+
+// GrantMappedGroupMembership adds a user to a group on behalf of the group
+// mappings of an identity provider, like GrantMappedTeamMembership
+func (s *UserService) GrantMappedGroupMembership(userID, groupID, roleID int, source string) error {
+	if err := s.checkMembershipOrganization(userID, "groups", groupID); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO user_groups (user_id, group_id, role_id, source)
+		VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE role_id = IF(source <=> VALUES(source), VALUES(role_id), role_id)
+	`
+
+	_, err := s.db.Insert(query, userID, groupID, roleID, source)
+	if err != nil {
+		return fmt.Errorf("failed to add user to group: %w", err)
+	}
+
+	rbacCache.invalidateUser(userID)
+
+	return nil
+}
+
+// RevokeMappedMemberships removes the team and group memberships a source
+// granted to a user, except those of the given teams and groups
+func (s *UserService) RevokeMappedMemberships(userID int, source string, keepTeams, keepGroups []int) error {
+	revoked := false
+
+	for _, membership := range []struct {
+		table, column string
+		keep          []int
+	}{
+		{"user_teams", "team_id", keepTeams},
+		{"user_groups", "group_id", keepGroups},
+	} {
+		keep := make(map[int]bool, len(membership.keep))
+		for _, id := range membership.keep {
+			keep[id] = true
+		}
+
+		granted, err := s.getMappedMemberships(membership.table, membership.column, userID, source)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range granted {
+			if keep[id] {
+				continue
+			}
+
+			// The source guard spares memberships taken over by hand since
+			query := fmt.Sprintf("DELETE FROM %s WHERE user_id = ? AND %s = ? AND source = ?", membership.table, membership.column)
+			affected, err := s.db.Delete(query, userID, id, source)
+			if err != nil {
+				return fmt.Errorf("failed to revoke membership: %w", err)
+			}
+			revoked = revoked || affected > 0
+		}
+	}
+
+	if revoked {
+		rbacCache.invalidateUser(userID)
+	}
+
+	return nil
+}
+
+// getMappedMemberships returns the teams or groups a source granted a user
+// membership of
+func (s *UserService) getMappedMemberships(table, column string, userID int, source string) ([]int, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE user_id = ? AND source = ?", column, table)
+
+	rows, err := s.db.GetMany(query, userID, source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mapped memberships: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan mapped membership: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// checkMembershipOrganization checks that a team or group is in the
+// organization of a user, so that memberships never cross organizations
+func (s *UserService) checkMembershipOrganization(userID int, table string, id int) error {
+	var organizationID int
+	err := s.db.QueryRowContext(context.Background(),
+		"SELECT organization_id FROM users WHERE id = ?", userID,
+	).Scan(&organizationID)
+
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get user organization: %w", err)
+	}
+
+	return checkSameOrganization(s.db, table, id, organizationID)
+}
+
+// GetUserByIdentity retrieves the user linked to an external identity
+func (s *UserService) GetUserByIdentity(provider, subject string, user *User) error {
+	var userID int
+	err := s.db.QueryRowContext(context.Background(),
+		"SELECT user_id FROM user_identities WHERE provider = ? AND subject = ?",
+		provider, subject,
+	).Scan(&userID)
+
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get user identity: %w", err)
+	}
+
+	return s.GetUserByID(userID, user)
+}
+
+// LinkIdentity links an external identity to a user
+func (s *UserService) LinkIdentity(userID int, provider, subject string) error {
+	exists, err := s.db.Exists(
+		"SELECT 1 FROM user_identities WHERE provider = ? AND subject = ?",
+		provider, subject,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to check identity existence: %w", err)
+	}
+	if exists {
+		return ErrIdentityAlreadyLinked
+	}
+
+	query := `
+		INSERT INTO user_identities (user_id, provider, subject)
+		VALUES (?, ?, ?)
+	`
+
+	if _, err := s.db.Insert(query, userID, provider, subject); err != nil {
+		return fmt.Errorf("failed to link identity: %w", err)
+	}
+
+	return nil
+}
+
+// TouchIdentity records a login through an external identity
+func (s *UserService) TouchIdentity(provider, subject string) error {
+	query := `
+		UPDATE user_identities
+		SET last_login_at = CURRENT_TIMESTAMP
+		WHERE provider = ? AND subject = ?
+	`
+
+	_, err := s.db.Update(query, provider, subject)
+	if err != nil {
+		return fmt.Errorf("failed to update identity: %w", err)
+	}
+
 	return nil
 }
 
@@ -368,6 +703,8 @@ func (s *UserService) RemoveUserFromTeam(userID, teamID int) error {
 		return fmt.Errorf("failed to remove user from team: %w", err)
 	}
 
+	rbacCache.invalidateUser(userID)
+
 	if affected == 0 {
 		return fmt.Errorf("user not found in team")
 	}
@@ -375,14 +712,25 @@ func (s *UserService) RemoveUserFromTeam(userID, teamID int) error {
 	return nil
 }
 
-// ListUsers returns a paginated list of users
-func (s *UserService) ListUsers(offset, limit int, activeOnly bool) ([]User, int, error) {
+// ListUsers returns a paginated list of the users of an organization, or
+// of all organizations for organizationID 0
+func (s *UserService) ListUsers(organizationID, offset, limit int, activeOnly bool) ([]User, int, error) {
 	// Build query
-	whereClause := ""
+	var conditions []string
 	args := []interface{}{}
 
+	if organizationID > 0 {
+		conditions = append(conditions, "organization_id = ?")
+		args = append(args, organizationID)
+	}
+
 	if activeOnly {
-		whereClause = "WHERE is_active = true"
+		conditions = append(conditions, "is_active = true")
+	}
+
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = "WHERE " + strings.Join(conditions, " AND ")
 	}
 
 	// Get total count
@@ -395,8 +743,7 @@ func (s *UserService) ListUsers(offset, limit int, activeOnly bool) ([]User, int
 
 	// Get users
 	query := fmt.Sprintf(`
-		SELECT id, email, password_hash, first_name, last_name, 
-		       is_active, created_at, updated_at
+		SELECT `+userColumns+`
 		FROM users
 		%s
 		ORDER BY created_at DESC
@@ -413,17 +760,7 @@ func (s *UserService) ListUsers(offset, limit int, activeOnly bool) ([]User, int
 	var users []User
 	for rows.Next() {
 		var user User
-		err := rows.Scan(
-			&user.ID,
-			&user.Email,
-			&user.PasswordHash,
-			&user.FirstName,
-			&user.LastName,
-			&user.IsActive,
-			&user.CreatedAt,
-			&user.UpdatedAt,
-		)
-		if err != nil {
+		if err := scanUser(rows, &user); err != nil {
 			return nil, 0, fmt.Errorf("failed to scan user: %w", err)
 		}
 		users = append(users, user)
@@ -431,3 +768,30 @@ func (s *UserService) ListUsers(offset, limit int, activeOnly bool) ([]User, int
 
 	return users, totalCount, nil
 }
+
+// ListServiceAccounts returns the service accounts of an organization
+func (s *UserService) ListServiceAccounts(organizationID int) ([]User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE is_service_account = true AND organization_id = ?
+		ORDER BY email
+	`
+
+	rows, err := s.db.GetMany(query, organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list service accounts: %w", err)
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		if err := scanUser(rows, &user); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	return users, nil
+}
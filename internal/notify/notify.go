@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+
+	"devops-assessment/internal/mail"
+)
+
+// Notification events
+const (
+	EventCampaignOpened   = "campaign_opened"
+	EventCampaignReminder = "campaign_reminder"
+)
+
+// Notification is a message to a user about an assessment
+type Notification struct {
+	Event   string `json:"event"`
+	Email   string `json:"email"`
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+	URL     string `json:"url,omitempty"` // Where to act on the notification
+}
+
+// Notifier delivers notifications to users
+type Notifier interface {
+	Notify(notification *Notification) error
+}
+
+// MailNotifier delivers notifications by email
+type MailNotifier struct {
+	mailer mail.Mailer
+}
+
+// NewMailNotifier creates a new mail notifier
+func NewMailNotifier(mailer mail.Mailer) *MailNotifier {
+	return &MailNotifier{mailer: mailer}
+}
+
+// Notify sends a notification by email
+func (n *MailNotifier) Notify(notification *Notification) error {
+	body := notification.Body
+	if notification.URL != "" {
+		body += "\n\n" + notification.URL
+	}
+
+	return n.mailer.Send(&mail.Message{
+		To:      notification.Email,
+		Subject: notification.Subject,
+		Body:    body,
+	})
+}
+
+// MultiNotifier delivers notifications through several notifiers
+type MultiNotifier []Notifier
+
+// Notify delivers a notification through every notifier, even if some fail
+func (m MultiNotifier) Notify(notification *Notification) error {
+	var errs []error
+	for _, notifier := range m {
+		if err := notifier.Notify(notification); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to notify %s: %w", notification.Email, errors.Join(errs...))
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Scheduler runs background jobs, each at its own interval
+type Scheduler struct {
+	jobs []job
+}
+
+type job struct {
+	name     string
+	interval time.Duration
+	run      func() error
+}
+
+// New creates a scheduler without jobs
+func New() *Scheduler {
+	return &Scheduler{}
+}
+
+// Every adds a job run at an interval. Errors are logged with the job's
+// name, e.g. "cleaning up sessions".
+func (s *Scheduler) Every(interval time.Duration, name string, run func() error) {
+	s.jobs = append(s.jobs, job{name: name, interval: interval, run: run})
+}
+
+// Run runs the jobs until the context is canceled. A job's first run is
+// one interval after Run is called; runs of a job never overlap.
+func (s *Scheduler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, j := range s.jobs {
+		wg.Add(1)
+		go func(j job) {
+			defer wg.Done()
+
+			ticker := time.NewTicker(j.interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if err := j.run(); err != nil {
+						log.Printf("Error %s: %v", j.name, err)
+					}
+				}
+			}
+		}(j)
+	}
+
+	wg.Wait()
+}
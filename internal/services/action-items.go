@@ -0,0 +1,174 @@
+package services
+
+import (
+	"fmt"
+
+	"devops-assessment/internal/models"
+)
+
+// CreateActionItem creates an action item from a question or a section of
+// an assessment with results. The item's baseline is the question's score,
+// aggregated for assessments with respondents, or the section's percentage.
+func (s *SurveyService) CreateActionItem(assessment *models.Assessment, item *models.ActionItem) error {
+	if !assessment.HasResults() {
+		return models.ErrActionItemNoResults
+	}
+	if (item.QuestionID == "") == (item.SectionName == "") {
+		return models.ErrActionItemTarget
+	}
+
+	if err := s.checkActionItemOwner(assessment.TeamID, item.OwnerID); err != nil {
+		return err
+	}
+
+	if item.QuestionID != "" {
+		survey, scores, err := s.questionScores(assessment)
+		if err != nil {
+			return err
+		}
+		if !hasQuestion(survey, item.QuestionID) {
+			return models.ErrActionItemTarget
+		}
+		item.BaselineScore = scores[item.QuestionID]
+	} else {
+		scores, err := s.sectionPercentages(assessment.ID)
+		if err != nil {
+			return err
+		}
+		percentage, ok := scores[item.SectionName]
+		if !ok {
+			return models.ErrActionItemTarget
+		}
+		item.BaselineScore = percentage
+	}
+
+	item.TeamID = assessment.TeamID
+	item.AssessmentID = assessment.ID
+	return s.actionItemService.CreateActionItem(item)
+}
+
+// UpdateActionItem updates the title, notes, owner, due date and status of
+// an action item
+func (s *SurveyService) UpdateActionItem(item *models.ActionItem) error {
+	if err := s.checkActionItemOwner(item.TeamID, item.OwnerID); err != nil {
+		return err
+	}
+	return s.actionItemService.UpdateActionItem(item)
+}
+
+// checkActionItemOwner checks that the owner of an action item, if any, is
+// in the organization of the item's team
+func (s *SurveyService) checkActionItemOwner(teamID, ownerID int) error {
+	if ownerID == 0 {
+		return nil
+	}
+
+	team := &models.Team{}
+	if err := s.teamService.GetTeamByID(teamID, team); err != nil {
+		return err
+	}
+	owner := &models.User{}
+	if err := s.userService.GetUserByID(ownerID, owner); err != nil {
+		return err
+	}
+	if owner.OrganizationID != team.OrganizationID {
+		return models.ErrOrganizationMismatch
+	}
+
+	return nil
+}
+
+// flagImprovedActionItems flags the action items of earlier assessments of
+// the team whose question or section scores higher in a completed
+// assessment than when the item was created. Dropped items are skipped.
+func (s *SurveyService) flagImprovedActionItems(assessment *models.Assessment) ([]models.ActionItem, error) {
+	items, err := s.actionItemService.ListUnimprovedActionItems(assessment.TeamID, assessment.ID)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+
+	_, questionScores, err := s.questionScores(assessment)
+	if err != nil {
+		return nil, err
+	}
+	sectionScores, err := s.sectionPercentages(assessment.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var improved []models.ActionItem
+	for _, item := range items {
+		if item.Status == models.ActionItemDropped {
+			continue
+		}
+
+		var score float64
+		var scored bool
+		if item.QuestionID != "" {
+			score, scored = questionScores[item.QuestionID]
+		} else {
+			score, scored = sectionScores[item.SectionName]
+		}
+		if !scored || score <= item.BaselineScore {
+			continue
+		}
+
+		if err := s.actionItemService.MarkImproved(item.ID, assessment.ID, score); err != nil {
+			return improved, err
+		}
+		item.ImprovedAssessmentID = assessment.ID
+		item.ImprovedScore = score
+		improved = append(improved, item)
+	}
+
+	return improved, nil
+}
+
+// questionScores returns the survey of an assessment with its responses
+// applied, and the score of each answered question, aggregated for
+// assessments with respondents
+func (s *SurveyService) questionScores(assessment *models.Assessment) (*models.Survey, map[string]float64, error) {
+	survey, err := s.loadAssessmentSurvey(assessment)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load questions: %w", err)
+	}
+
+	results := &AssessmentResults{AssessmentID: assessment.ID, Survey: survey}
+	aggregate, err := s.applyAnswers(assessment, results)
+	if err != nil {
+		return nil, nil, err
+	}
+	if aggregate == nil {
+		responses := s.questions(survey).ExtractResponses(survey, assessment.ID)
+		aggregate = s.questions(survey).ScoreResponses(survey, responses)
+	}
+
+	return survey, aggregate, nil
+}
+
+// sectionPercentages returns the saved percentage of each section of an
+// assessment
+func (s *SurveyService) sectionPercentages(assessmentID int) (map[string]float64, error) {
+	scores, err := s.assessmentService.GetAssessmentScores(assessmentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load section scores: %w", err)
+	}
+
+	percentages := make(map[string]float64, len(scores))
+	for _, score := range scores {
+		percentages[score.SectionName] = score.Percentage
+	}
+	return percentages, nil
+}
+
+// hasQuestion reports whether a survey has a scored question
+func hasQuestion(survey *models.Survey, questionID string) bool {
+	for _, section := range survey.Sections {
+		for _, question := range section.Questions {
+			if question.ID == questionID && question.Type != "Banner" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"devops-assessment/internal/models"
+)
+
+// The results page advises on the weakest sections, and within each on the
+// weakest subcategories that have advice of their own
+const (
+	improvementAreas         = 3
+	improvementSubCategories = 2
+)
+
+// ImprovementArea is a section a team should improve first, with the advice
+// for its score and for its weakest subcategories
+type ImprovementArea struct {
+	Score         models.SectionScore `json:"score"`
+	Advice        models.Advice       `json:"advice"`
+	SubCategories []SubCategoryAdvice `json:"subcategories,omitempty"` // Weakest first
+}
+
+// SubCategoryAdvice is the advice for the score of a subcategory
+type SubCategoryAdvice struct {
+	Score  models.SectionScore `json:"score"`
+	Advice models.Advice       `json:"advice"`
+}
+
+// ResultsAdvice loads the advice of the template of assessment results, for
+// the score of each section and of its subcategories
+func (s *SurveyService) ResultsAdvice(results *AssessmentResults) (map[string]models.Advice, error) {
+	advice, err := s.questions(results.Survey).LoadAdvice()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, score := range results.SectionScores {
+		sectionAdvice, exists := advice[score.SectionName]
+		if !exists {
+			continue
+		}
+
+		scoreAdvice := sectionAdvice.ForScore(score)
+		for _, subScore := range results.SubCategoryScores[score.SectionName] {
+			if subAdvice, exists := sectionAdvice.SubCategories[subScore.SectionName]; exists {
+				if scoreAdvice.SubCategories == nil {
+					scoreAdvice.SubCategories = make(map[string]models.Advice)
+				}
+				scoreAdvice.SubCategories[subScore.SectionName] = subAdvice.ForScore(subScore)
+			}
+		}
+		advice[score.SectionName] = scoreAdvice
+	}
+
+	return advice, nil
+}
+
+// ImprovementAreas picks the weakest sections of assessment results that have
+// advice, from advice returned by ResultsAdvice
+func ImprovementAreas(results *AssessmentResults, advice map[string]models.Advice) []ImprovementArea {
+	scores := make([]models.SectionScore, len(results.SectionScores))
+	copy(scores, results.SectionScores)
+	sort.SliceStable(scores, func(i, j int) bool {
+		return scores[i].Percentage < scores[j].Percentage
+	})
+
+	areas := []ImprovementArea{}
+	for _, score := range scores {
+		sectionAdvice, exists := advice[score.SectionName]
+		if !exists {
+			continue
+		}
+
+		area := ImprovementArea{Score: score, Advice: sectionAdvice}
+		area.Advice.SubCategories = nil
+		area.SubCategories = weakestSubCategories(results.SubCategoryScores[score.SectionName], sectionAdvice)
+
+		areas = append(areas, area)
+		if len(areas) == improvementAreas {
+			break
+		}
+	}
+
+	return areas
+}
+
+// weakestSubCategories returns the advice for the weakest subcategories of a
+// section that have advice of their own
+func weakestSubCategories(scores []models.SectionScore, sectionAdvice models.Advice) []SubCategoryAdvice {
+	var subCategories []SubCategoryAdvice
+	for _, score := range scores {
+		if advice, exists := sectionAdvice.SubCategories[score.SectionName]; exists {
+			subCategories = append(subCategories, SubCategoryAdvice{Score: score, Advice: advice})
+		}
+	}
+
+	sort.SliceStable(subCategories, func(i, j int) bool {
+		return subCategories[i].Score.Percentage < subCategories[j].Score.Percentage
+	})
+	if len(subCategories) > improvementSubCategories {
+		subCategories = subCategories[:improvementSubCategories]
+	}
+
+	return subCategories
+}
+
+// checkAdvice checks the advice of a template against its survey, so
+// mistakes in the advice file, such as advice that matches nothing or
+// percentage ranges that overlap or leave gaps, stop the startup instead of
+// going unnoticed
+func (s *SurveyService) checkAdvice(templateID string, survey *models.Survey) error {
+	questionService := s.questions(survey)
+	advice, err := questionService.LoadAdvice()
+	if err != nil {
+		return fmt.Errorf("failed to load advice of template %s: %w", templateID, err)
+	}
+
+	problems := questionService.ValidateAdvice(survey, advice)
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid advice of template %s: %s", templateID, strings.Join(problems, "; "))
+	}
+
+	return nil
+}
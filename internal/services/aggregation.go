@@ -0,0 +1,133 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"devops-assessment/internal/models"
+)
+
+// QuestionSpread shows how the scores of respondents differ on a question
+type QuestionSpread struct {
+	Respondents int     `json:"respondents"` // Respondents who answered the question
+	Score       float64 `json:"score"`       // The aggregated score, or the agreed answer's
+	Min         float64 `json:"min"`
+	Max         float64 `json:"max"`
+	StdDev      float64 `json:"std_dev"`
+	Agreed      bool    `json:"agreed,omitempty"` // The score is of an agreed answer
+}
+
+// RespondentScores are the section scores of one respondent
+type RespondentScores struct {
+	Respondent    models.Respondent     `json:"respondent"`
+	SectionScores []models.SectionScore `json:"section_scores"`
+}
+
+// respondentAnswers are the submitted answers of one respondent
+type respondentAnswers struct {
+	respondent models.Respondent
+	answers    map[string][]string // Answer IDs by question ID
+	scores     map[string]float64  // Scores by question ID
+}
+
+// aggregateScores combines the scores of respondents per question, and
+// returns the aggregated scores with the spread between respondents.
+// Questions a respondent didn't answer don't count for that respondent.
+func aggregateScores(respondents []respondentAnswers, aggregation string) (map[string]float64, map[string]QuestionSpread) {
+	byQuestion := make(map[string][]respondentAnswers)
+	for _, respondent := range respondents {
+		for questionID := range respondent.scores {
+			byQuestion[questionID] = append(byQuestion[questionID], respondent)
+		}
+	}
+
+	scores := make(map[string]float64, len(byQuestion))
+	spread := make(map[string]QuestionSpread, len(byQuestion))
+	for questionID, answered := range byQuestion {
+		values := make([]float64, len(answered))
+		for i, respondent := range answered {
+			values[i] = respondent.scores[questionID]
+		}
+		sort.Float64s(values)
+
+		var score float64
+		switch aggregation {
+		case models.AggregationMedian:
+			score = median(values)
+		case models.AggregationConsensus:
+			score = consensusScore(questionID, answered)
+		default:
+			score = mean(values)
+		}
+
+		scores[questionID] = score
+		spread[questionID] = QuestionSpread{
+			Respondents: len(values),
+			Score:       score,
+			Min:         values[0],
+			Max:         values[len(values)-1],
+			StdDev:      stdDev(values),
+		}
+	}
+
+	return scores, spread
+}
+
+// consensusScore returns the score of the answer given most often to a
+// question. Ties go to the lowest score, so that disagreement is never
+// rounded up.
+func consensusScore(questionID string, answered []respondentAnswers) float64 {
+	counts := make(map[string]int)
+	scores := make(map[string]float64)
+	for _, respondent := range answered {
+		answerIDs := append([]string(nil), respondent.answers[questionID]...)
+		sort.Strings(answerIDs)
+
+		key := strings.Join(answerIDs, ",")
+		counts[key]++
+		scores[key] = respondent.scores[questionID]
+	}
+
+	var best string
+	for key, count := range counts {
+		switch {
+		case best == "", count > counts[best]:
+			best = key
+		case count == counts[best] && scores[key] < scores[best]:
+			best = key
+		}
+	}
+
+	return scores[best]
+}
+
+// mean returns the mean of values, which must not be empty
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+	return sum / float64(len(values))
+}
+
+// median returns the median of sorted values, which must not be empty
+func median(values []float64) float64 {
+	middle := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[middle-1] + values[middle]) / 2
+	}
+	return values[middle]
+}
+
+// stdDev returns the population standard deviation of values, which must
+// not be empty
+func stdDev(values []float64) float64 {
+	average := mean(values)
+
+	sum := 0.0
+	for _, value := range values {
+		sum += (value - average) * (value - average)
+	}
+	return math.Sqrt(sum / float64(len(values)))
+}
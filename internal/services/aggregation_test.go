@@ -0,0 +1,204 @@
+package services
+
+import (
+	"math"
+	"testing"
+
+	"devops-assessment/internal/models"
+)
+
+// answered builds the answers of a respondent to one question
+func answered(respondentID int, questionID string, score float64, answerIDs ...string) respondentAnswers {
+	return respondentAnswers{
+		respondent: models.Respondent{ID: respondentID},
+		answers:    map[string][]string{questionID: answerIDs},
+		scores:     map[string]float64{questionID: score},
+	}
+}
+
+// approx reports whether two floats are equal up to rounding
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestMedian(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   float64
+	}{
+		{name: "single value", values: []float64{3}, want: 3},
+		{name: "odd count", values: []float64{1, 2, 5}, want: 2},
+		{name: "even count", values: []float64{1, 2, 4, 5}, want: 3},
+		{name: "even count of two", values: []float64{0, 5}, want: 2.5},
+		{name: "repeated values", values: []float64{2, 2, 2, 5, 5}, want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := median(tt.values); !approx(got, tt.want) {
+				t.Errorf("median(%v) = %g, want %g", tt.values, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStdDev(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   float64
+	}{
+		{name: "single value", values: []float64{4}, want: 0},
+		{name: "equal values", values: []float64{3, 3, 3}, want: 0},
+		{name: "two values", values: []float64{1, 5}, want: 2},
+		{name: "population, not sample", values: []float64{2, 4, 4, 4, 5, 5, 7, 9}, want: 2},
+		{name: "odd count", values: []float64{1, 2, 3}, want: math.Sqrt(2.0 / 3)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stdDev(tt.values); !approx(got, tt.want) {
+				t.Errorf("stdDev(%v) = %g, want %g", tt.values, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConsensusScore(t *testing.T) {
+	tests := []struct {
+		name     string
+		answered []respondentAnswers
+		want     float64
+	}{
+		{
+			name:     "single respondent",
+			answered: []respondentAnswers{answered(1, "q1", 3, "a3")},
+			want:     3,
+		},
+		{
+			name: "majority",
+			answered: []respondentAnswers{
+				answered(1, "q1", 1, "a1"),
+				answered(2, "q1", 4, "a4"),
+				answered(3, "q1", 4, "a4"),
+			},
+			want: 4,
+		},
+		{
+			name: "tie goes to the lowest score",
+			answered: []respondentAnswers{
+				answered(1, "q1", 4, "a4"),
+				answered(2, "q1", 2, "a2"),
+				answered(3, "q1", 2, "a2"),
+				answered(4, "q1", 4, "a4"),
+			},
+			want: 2,
+		},
+		{
+			name: "tie between all answers",
+			answered: []respondentAnswers{
+				answered(1, "q1", 5, "a5"),
+				answered(2, "q1", 3, "a3"),
+				answered(3, "q1", 4, "a4"),
+			},
+			want: 3,
+		},
+		{
+			name: "multi-select answers match in any order",
+			answered: []respondentAnswers{
+				answered(1, "q1", 5, "a1", "a2", "a3"),
+				answered(2, "q1", 5, "a3", "a1", "a2"),
+				answered(3, "q1", 2, "a1"),
+			},
+			want: 5,
+		},
+		{
+			name: "multi-select answers only match as a whole",
+			answered: []respondentAnswers{
+				answered(1, "q1", 3, "a1", "a2"),
+				answered(2, "q1", 2, "a1"),
+				answered(3, "q1", 2, "a1"),
+			},
+			want: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := consensusScore("q1", tt.answered); !approx(got, tt.want) {
+				t.Errorf("consensusScore() = %g, want %g", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAggregateScores(t *testing.T) {
+	// Three respondents answer q1, two of them q2 and one q3; q4 is a
+	// multi-select question
+	respondents := []respondentAnswers{
+		{
+			respondent: models.Respondent{ID: 1},
+			answers:    map[string][]string{"q1": {"a1"}, "q2": {"a2"}, "q3": {"a3"}, "q4": {"a1", "a2"}},
+			scores:     map[string]float64{"q1": 1, "q2": 2, "q3": 3, "q4": 4},
+		},
+		{
+			respondent: models.Respondent{ID: 2},
+			answers:    map[string][]string{"q1": {"a2"}, "q2": {"a4"}, "q4": {"a2", "a1"}},
+			scores:     map[string]float64{"q1": 2, "q2": 4, "q4": 4},
+		},
+		{
+			respondent: models.Respondent{ID: 3},
+			answers:    map[string][]string{"q1": {"a5"}, "q4": {"a1"}},
+			scores:     map[string]float64{"q1": 5, "q4": 1},
+		},
+	}
+
+	tests := []struct {
+		aggregation string
+		want        map[string]float64
+	}{
+		{aggregation: models.AggregationMean, want: map[string]float64{"q1": 8.0 / 3, "q2": 3, "q3": 3, "q4": 3}},
+		{aggregation: models.AggregationMedian, want: map[string]float64{"q1": 2, "q2": 3, "q3": 3, "q4": 4}},
+		{aggregation: models.AggregationConsensus, want: map[string]float64{"q1": 1, "q2": 2, "q3": 3, "q4": 4}},
+		{aggregation: "", want: map[string]float64{"q1": 8.0 / 3, "q2": 3, "q3": 3, "q4": 3}},
+	}
+
+	// The spread doesn't depend on the aggregation
+	wantSpread := map[string]QuestionSpread{
+		"q1": {Respondents: 3, Min: 1, Max: 5, StdDev: math.Sqrt(26.0 / 9)},
+		"q2": {Respondents: 2, Min: 2, Max: 4, StdDev: 1},
+		"q3": {Respondents: 1, Min: 3, Max: 3, StdDev: 0},
+		"q4": {Respondents: 3, Min: 1, Max: 4, StdDev: math.Sqrt(2)},
+	}
+
+	for _, tt := range tests {
+		t.Run("aggregation "+tt.aggregation, func(t *testing.T) {
+			scores, spread := aggregateScores(respondents, tt.aggregation)
+
+			if len(scores) != len(tt.want) || len(spread) != len(tt.want) {
+				t.Fatalf("scores = %v, spread = %v, want questions %v", scores, spread, tt.want)
+			}
+			for questionID, want := range tt.want {
+				if !approx(scores[questionID], want) {
+					t.Errorf("score of %s = %g, want %g", questionID, scores[questionID], want)
+				}
+
+				got, wantSpread := spread[questionID], wantSpread[questionID]
+				wantSpread.Score = want
+				if got.Respondents != wantSpread.Respondents || !approx(got.Score, wantSpread.Score) ||
+					!approx(got.Min, wantSpread.Min) || !approx(got.Max, wantSpread.Max) ||
+					!approx(got.StdDev, wantSpread.StdDev) || got.Agreed {
+					t.Errorf("spread of %s = %+v, want %+v", questionID, got, wantSpread)
+				}
+			}
+		})
+	}
+
+	t.Run("no respondents", func(t *testing.T) {
+		scores, spread := aggregateScores(nil, models.AggregationMedian)
+		if len(scores) != 0 || len(spread) != 0 {
+			t.Errorf("scores = %v, spread = %v, want none", scores, spread)
+		}
+	})
+}
@@ -0,0 +1,336 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"devops-assessment/internal/models"
+	"devops-assessment/internal/notify"
+)
+
+// CampaignService opens campaigns and reminds their teams of the deadline
+type CampaignService struct {
+	campaignService   *models.CampaignService
+	teamService       *models.TeamService
+	groupService      *models.GroupService
+	respondentService *models.RespondentService
+	rbacService       *models.RBACService
+	surveyService     *SurveyService
+	notifier          notify.Notifier
+	publicURL         string
+}
+
+// NewCampaignService creates a new campaign service
+func NewCampaignService(
+	campaignService *models.CampaignService,
+	teamService *models.TeamService,
+	groupService *models.GroupService,
+	respondentService *models.RespondentService,
+	rbacService *models.RBACService,
+	surveyService *SurveyService,
+	notifier notify.Notifier,
+	publicURL string,
+) *CampaignService {
+	return &CampaignService{
+		campaignService:   campaignService,
+		teamService:       teamService,
+		groupService:      groupService,
+		respondentService: respondentService,
+		rbacService:       rbacService,
+		surveyService:     surveyService,
+		notifier:          notifier,
+		publicURL:         publicURL,
+	}
+}
+
+// CampaignProgress counts the teams of a campaign by progress
+type CampaignProgress struct {
+	NotStarted int                   `json:"not_started"`
+	InProgress int                   `json:"in_progress"`
+	Completed  int                   `json:"completed"`
+	Teams      []models.CampaignTeam `json:"teams"`
+}
+
+// CreateCampaign creates a campaign for teams and the teams of groups,
+// including their subgroups. Groups are resolved to their teams now, teams
+// added to a group later aren't part of the campaign.
+func (s *CampaignService) CreateCampaign(campaign *models.Campaign, teamIDs, groupIDs []int) error {
+	// An empty template ID selects the default template, which is stored, so
+	// that changing the default doesn't change the campaign
+	template, err := s.surveyService.GetTemplate(campaign.TemplateID)
+	if err != nil {
+		return err
+	}
+	campaign.TemplateID = template.ID
+	campaign.ReminderDays = normalizeReminderDays(campaign.ReminderDays)
+
+	seen := make(map[int]bool)
+	var campaignTeamIDs []int
+	addTeam := func(teamID int) {
+		if !seen[teamID] {
+			seen[teamID] = true
+			campaignTeamIDs = append(campaignTeamIDs, teamID)
+		}
+	}
+
+	for _, teamID := range teamIDs {
+		addTeam(teamID)
+	}
+	for _, groupID := range groupIDs {
+		group := &models.Group{}
+		if err := s.groupService.GetGroupByID(groupID, group); err != nil {
+			return err
+		}
+		if group.OrganizationID != campaign.OrganizationID {
+			return models.ErrOrganizationMismatch
+		}
+
+		teams, err := s.groupService.GetGroupTeams(groupID)
+		if err != nil {
+			return err
+		}
+		for _, team := range teams {
+			addTeam(team.ID)
+		}
+	}
+
+	return s.campaignService.CreateCampaign(campaign, campaignTeamIDs)
+}
+
+// UpdateCampaign updates the name, dates and reminders of a campaign
+func (s *CampaignService) UpdateCampaign(campaign *models.Campaign) error {
+	campaign.ReminderDays = normalizeReminderDays(campaign.ReminderDays)
+	return s.campaignService.UpdateCampaign(campaign)
+}
+
+// GetProgress returns the progress of the teams of a campaign, limited to a
+// list of team IDs (nil for all teams)
+func (s *CampaignService) GetProgress(campaignID int, teamIDs []int) (*CampaignProgress, error) {
+	teams, err := s.campaignService.GetCampaignTeams(campaignID)
+	if err != nil {
+		return nil, err
+	}
+
+	var permitted map[int]bool
+	if teamIDs != nil {
+		permitted = make(map[int]bool, len(teamIDs))
+		for _, teamID := range teamIDs {
+			permitted[teamID] = true
+		}
+	}
+
+	progress := &CampaignProgress{Teams: []models.CampaignTeam{}}
+	for _, team := range teams {
+		if permitted != nil && !permitted[team.TeamID] {
+			continue
+		}
+
+		switch team.Progress {
+		case models.ProgressCompleted:
+			progress.Completed++
+		case models.ProgressInProgress:
+			progress.InProgress++
+		default:
+			progress.NotStarted++
+		}
+		progress.Teams = append(progress.Teams, team)
+	}
+
+	return progress, nil
+}
+
+// ProcessCampaigns opens the campaigns that are due to open and sends the
+// reminders that are due. It runs in the background scheduler.
+func (s *CampaignService) ProcessCampaigns() error {
+	now := time.Now()
+	var errs []error
+
+	due, err := s.campaignService.ListDueCampaigns(now)
+	if err != nil {
+		return err
+	}
+	for i := range due {
+		// Claim the campaign, so it opens only once
+		if err := s.campaignService.MarkOpened(due[i].ID); err != nil {
+			if err != models.ErrCampaignAlreadyOpen {
+				errs = append(errs, fmt.Errorf("campaign %d: %w", due[i].ID, err))
+			}
+		}
+	}
+
+	open, err := s.campaignService.ListOpenCampaigns(now)
+	if err != nil {
+		return err
+	}
+	for i := range open {
+		if err := s.processCampaign(&open[i], now); err != nil {
+			errs = append(errs, fmt.Errorf("campaign %d: %w", open[i].ID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// processCampaign starts the assessments of an open campaign that haven't
+// been started yet, and reminds the teams that haven't completed theirs.
+// A failure for one team doesn't hold up the others.
+func (s *CampaignService) processCampaign(campaign *models.Campaign, now time.Time) error {
+	teams, err := s.campaignService.GetCampaignTeams(campaign.ID)
+	if err != nil {
+		return err
+	}
+
+	remindersDue := 0
+	for _, days := range campaign.ReminderDays {
+		if !now.Before(campaign.DueAt.Add(-time.Duration(days) * 24 * time.Hour)) {
+			remindersDue++
+		}
+	}
+
+	var errs []error
+	for _, team := range teams {
+		if err := s.processCampaignTeam(campaign, team, remindersDue); err != nil {
+			errs = append(errs, fmt.Errorf("team %d: %w", team.TeamID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// processCampaignTeam starts the assessment of a team of an open campaign,
+// or reminds the team if a reminder is due
+func (s *CampaignService) processCampaignTeam(campaign *models.Campaign, team models.CampaignTeam, remindersDue int) error {
+	if team.AssessmentID == 0 {
+		assessment := &models.Assessment{
+			TeamID:    team.TeamID,
+			CreatedBy: campaign.CreatedBy,
+			Status:    models.StatusInProgress,
+		}
+		_, err := s.surveyService.createAssessment(assessment, campaign.TemplateID, func(assessment *models.Assessment) error {
+			return s.campaignService.StartTeamAssessment(campaign.ID, assessment)
+		})
+		if err == models.ErrCampaignTeamStarted {
+			// Started by a concurrent run, which notifies the team
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to start assessment: %w", err)
+		}
+
+		s.notifyTeam(campaign, team.TeamID, assessment.ID, &notify.Notification{
+			Event:   notify.EventCampaignOpened,
+			Subject: fmt.Sprintf("%s: your assessment is open", campaign.Name),
+			Body: fmt.Sprintf("The %s assessment of %s is open. Please complete it by %s.",
+				campaign.Name, team.TeamName, campaign.DueAt.Format("January 2, 2006")),
+		})
+
+		// The opening notice stands in for reminders that are already due
+		if remindersDue > 0 {
+			return s.campaignService.SetRemindersSent(campaign.ID, team.TeamID, remindersDue)
+		}
+		return nil
+	}
+
+	if team.Progress == models.ProgressCompleted || team.RemindersSent >= remindersDue {
+		return nil
+	}
+
+	s.notifyTeam(campaign, team.TeamID, team.AssessmentID, &notify.Notification{
+		Event:   notify.EventCampaignReminder,
+		Subject: fmt.Sprintf("%s: due %s", campaign.Name, campaign.DueAt.Format("January 2")),
+		Body: fmt.Sprintf("The %s assessment of %s is due by %s and isn't completed yet.",
+			campaign.Name, team.TeamName, campaign.DueAt.Format("January 2, 2006")),
+	})
+
+	// Reminders missed while the scheduler wasn't running are sent as one
+	return s.campaignService.SetRemindersSent(campaign.ID, team.TeamID, remindersDue)
+}
+
+// notifyTeam sends a notification to those who answer an assessment: its
+// respondents who haven't submitted their answers, or, without respondents,
+// the team members who can update it. Failures are logged, so that
+// notifications are never sent twice.
+func (s *CampaignService) notifyTeam(campaign *models.Campaign, teamID, assessmentID int, notification *notify.Notification) {
+	notification.URL = fmt.Sprintf("%s/survey/?assessment_id=%d", s.publicURL, assessmentID)
+
+	recipients, err := s.recipients(teamID, assessmentID)
+	if err != nil {
+		log.Printf("Error notifying team %d of campaign %d: %v", teamID, campaign.ID, err)
+		return
+	}
+
+	for _, recipient := range recipients {
+		message := *notification
+		message.Email = recipient.Email
+		message.Name = recipient.FirstName + " " + recipient.LastName
+
+		if err := s.notifier.Notify(&message); err != nil {
+			log.Printf("Error notifying team %d of campaign %d: %v", teamID, campaign.ID, err)
+		}
+	}
+}
+
+// recipients returns the users who answer an assessment
+func (s *CampaignService) recipients(teamID, assessmentID int) ([]models.User, error) {
+	respondents, err := s.respondentService.ListRespondents(assessmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []models.User
+	if len(respondents) > 0 {
+		for _, respondent := range respondents {
+			if respondent.SubmittedAt == nil {
+				users = append(users, models.User{
+					ID:        respondent.UserID,
+					Email:     respondent.Email,
+					FirstName: respondent.FirstName,
+					LastName:  respondent.LastName,
+				})
+			}
+		}
+		return users, nil
+	}
+
+	members, err := s.teamService.GetTeamMembers(teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, member := range members {
+		if !member.User.IsActive {
+			continue
+		}
+
+		canUpdate, err := s.rbacService.CheckTeamPermission(
+			member.User.ID, teamID, models.ResourceAssessment, models.ActionUpdate,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if canUpdate {
+			users = append(users, member.User)
+		}
+	}
+
+	return users, nil
+}
+
+// normalizeReminderDays sorts reminder days, latest reminder last, and drops
+// duplicates and days that aren't positive
+func normalizeReminderDays(days []int) []int {
+	normalized := []int{}
+	seen := make(map[int]bool)
+	for _, day := range days {
+		if day > 0 && !seen[day] {
+			seen[day] = true
+			normalized = append(normalized, day)
+		}
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(normalized)))
+	return normalized
+}
@@ -1,11 +1,15 @@
 package services
 
 import (
+	"database/sql"
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"strconv"
 	"strings"
+	"time"
 
 	"devops-assessment/internal/database"
 	"devops-assessment/internal/models"
@@ -13,45 +17,304 @@ import (
 
 // SurveyService handles survey-related business logic
 type SurveyService struct {
-	db                *database.DB
-	assessmentService *models.AssessmentService
-	questionService   *models.QuestionService
-	teamService       *models.TeamService
+	db                   *database.DB
+	assessmentService    *models.AssessmentService
+	respondentService    *models.RespondentService
+	questionnaireService *models.QuestionnaireService
+	teamService          *models.TeamService
+	userService          *models.UserService
+	actionItemService    *models.ActionItemService
+	targetService        *models.TargetService
+	templates            *models.TemplateRegistry
+
+	// currentVersionIDs maps each template to the questionnaire version new
+	// assessments are pinned to
+	currentVersionIDs map[string]int
 }
 
 // NewSurveyService creates a new survey service
-func NewSurveyService(db *database.DB, questionsFile, adviceFile string) *SurveyService {
+func NewSurveyService(db *database.DB, templates *models.TemplateRegistry) *SurveyService {
 	return &SurveyService{
-		db:                db,
-		assessmentService: models.NewAssessmentService(db),
-		questionService:   models.NewQuestionService(questionsFile, adviceFile),
-		teamService:       models.NewTeamService(db),
+		db:                   db,
+		assessmentService:    models.NewAssessmentService(db),
+		respondentService:    models.NewRespondentService(db),
+		questionnaireService: models.NewQuestionnaireService(db),
+		teamService:          models.NewTeamService(db),
+		userService:          models.NewUserService(db),
+		actionItemService:    models.NewActionItemService(db),
+		targetService:        models.NewTargetService(db),
+		templates:            templates,
+		currentVersionIDs:    make(map[string]int),
 	}
 }
 
-// StartAssessment creates a new assessment for a team
-func (s *SurveyService) StartAssessment(teamID, userID int) (*models.Assessment, *models.Survey, error) {
-	// Create new assessment
+// Templates returns the questionnaire templates assessments can be started with
+func (s *SurveyService) Templates() []models.QuestionnaireTemplate {
+	return s.templates.List()
+}
+
+// GetTemplate retrieves a questionnaire template, an empty ID returns the
+// default template
+func (s *SurveyService) GetTemplate(templateID string) (*models.QuestionnaireTemplate, error) {
+	return s.templates.Get(templateID)
+}
+
+// SyncQuestionnaire imports the questions file of every template as a
+// questionnaire version (a no-op when its content is unchanged) and makes it
+// the version new assessments of that template are pinned to. Assessments
+// that predate versioning are pinned to the default template. Must be called
+// once at startup, before serving requests.
+func (s *SurveyService) SyncQuestionnaire() error {
+	for _, template := range s.templates.List() {
+		survey, err := s.loadTemplateQuestions(template.ID)
+		if err != nil {
+			return err
+		}
+		if err := s.checkAdvice(template.ID, survey); err != nil {
+			return err
+		}
+
+		version, err := s.questionnaireService.ImportSurvey(survey, template.QuestionsFile)
+		if err != nil {
+			return err
+		}
+		s.currentVersionIDs[template.ID] = version.ID
+
+		log.Printf("Using questionnaire version %d (%s) for template %s",
+			version.ID, version.Checksum[:12], template.ID)
+	}
+
+	defaultVersionID := s.currentVersionIDs[s.templates.DefaultID()]
+	pinned, err := s.assessmentService.PinUnversionedAssessments(defaultVersionID)
+	if err != nil {
+		return err
+	}
+	if pinned > 0 {
+		log.Printf("Pinned %d existing assessments to questionnaire version %d", pinned, defaultVersionID)
+	}
+
+	return nil
+}
+
+// loadTemplateQuestions loads the questions file of a template
+func (s *SurveyService) loadTemplateQuestions(templateID string) (*models.Survey, error) {
+	template, err := s.templates.Get(templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	questionService, err := s.templates.QuestionService(template.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	survey, err := questionService.LoadQuestions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load questions of template %s: %w", template.ID, err)
+	}
+	survey.TemplateID = template.ID
+
+	return survey, nil
+}
+
+// CurrentSurvey returns the survey new assessments of a template are taken
+// with, an empty ID returns the survey of the default template
+func (s *SurveyService) CurrentSurvey(templateID string) (*models.Survey, error) {
+	if templateID == "" {
+		templateID = s.templates.DefaultID()
+	}
+
+	versionID, exists := s.currentVersionIDs[templateID]
+	if !exists {
+		return s.loadTemplateQuestions(templateID)
+	}
+	return s.questionnaireService.LoadVersionSurvey(versionID)
+}
+
+// loadAssessmentSurvey returns the survey an assessment is pinned to
+func (s *SurveyService) loadAssessmentSurvey(assessment *models.Assessment) (*models.Survey, error) {
+	if assessment.QuestionnaireVersionID == 0 {
+		return s.CurrentSurvey("")
+	}
+	return s.questionnaireService.LoadVersionSurvey(assessment.QuestionnaireVersionID)
+}
+
+// questions returns the question service of the template a survey belongs to.
+// Surveys imported before templates existed belong to the default template.
+func (s *SurveyService) questions(survey *models.Survey) *models.QuestionService {
+	questionService, err := s.templates.QuestionService(survey.TemplateID)
+	if err != nil {
+		questionService, _ = s.templates.QuestionService("")
+	}
+	return questionService
+}
+
+// LoadAdvice loads the advice of a template, an empty ID returns the advice
+// of the default template
+func (s *SurveyService) LoadAdvice(templateID string) (map[string]models.Advice, error) {
+	questionService, err := s.templates.QuestionService(templateID)
+	if err != nil {
+		return nil, err
+	}
+	return questionService.LoadAdvice()
+}
+
+// StartAssessment creates a new assessment for a team using the given
+// questionnaire template, an empty ID selects the default template. The
+// aggregation applies once respondents are invited, an empty one selects
+// the mean.
+func (s *SurveyService) StartAssessment(teamID, userID int, templateID, aggregation string) (*models.Assessment, *models.Survey, error) {
 	assessment := &models.Assessment{
-		TeamID:    teamID,
-		CreatedBy: userID,
-		Status:    models.StatusInProgress,
+		TeamID:      teamID,
+		CreatedBy:   userID,
+		Status:      models.StatusInProgress,
+		Aggregation: aggregation,
+	}
+
+	survey, err := s.createAssessment(assessment, templateID, s.assessmentService.CreateAssessment)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return assessment, survey, nil
+}
+
+// CloneAssessment starts a new assessment for a team pre-filled with the
+// responses of one of its previous assessments, an ID of 0 selects its latest
+// completed assessment, and starts blank if it has none. The template
+// defaults to the one of the previous assessment. Responses to questions
+// that aren't asked anymore are dropped, and the copied responses are
+// flagged until the team confirms them.
+func (s *SurveyService) CloneAssessment(teamID, userID int, templateID, aggregation string, sourceID int) (*models.Assessment, *models.Survey, error) {
+	source := &models.Assessment{}
+	if sourceID == 0 {
+		latest, err := s.assessmentService.GetLatestTeamAssessment(teamID)
+		if err == models.ErrAssessmentNotFound {
+			return s.StartAssessment(teamID, userID, templateID, aggregation)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		source = latest
+	} else if err := s.assessmentService.GetAssessmentByID(sourceID, source); err != nil {
+		return nil, nil, err
+	}
+
+	if source.TeamID != teamID {
+		return nil, nil, models.ErrCloneOtherTeam
+	}
+
+	if templateID == "" {
+		sourceSurvey, err := s.loadAssessmentSurvey(source)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load questions: %w", err)
+		}
+		templateID = sourceSurvey.TemplateID
+	}
+
+	responses, err := s.assessmentService.GetAssessmentResponses(source.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load responses: %w", err)
 	}
 
-	if err := s.assessmentService.CreateAssessment(assessment); err != nil {
-		return nil, nil, fmt.Errorf("failed to create assessment: %w", err)
+	assessment := &models.Assessment{
+		TeamID:       teamID,
+		CreatedBy:    userID,
+		Status:       models.StatusInProgress,
+		Aggregation:  aggregation,
+		ClonedFromID: source.ID,
 	}
 
+	survey, err := s.createAssessment(assessment, templateID, s.assessmentService.CreateAssessment)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.assessmentService.CopyResponses(assessment.ID, validResponses(survey, responses)); err != nil {
+		// Don't leave a half-copied assessment behind
+		if deleteErr := s.assessmentService.DeleteAssessment(assessment.ID); deleteErr != nil {
+			log.Printf("Error deleting assessment %d: %v", assessment.ID, deleteErr)
+		}
+		return nil, nil, err
+	}
+
+	// Return the survey with the copied responses and their flags
+	return s.ContinueAssessment(assessment.ID)
+}
+
+// createAssessment creates an assessment pinned to the current questionnaire
+// version of a template with create, and returns its survey
+func (s *SurveyService) createAssessment(assessment *models.Assessment, templateID string, create func(*models.Assessment) error) (*models.Survey, error) {
 	// Load survey questions
-	survey, err := s.questionService.LoadQuestions()
+	survey, err := s.CurrentSurvey(templateID)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to load questions: %w", err)
+		if err == models.ErrTemplateNotFound {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to load questions: %w", err)
 	}
 
-	return assessment, survey, nil
+	// Create new assessment pinned to the current questionnaire version, and
+	// to the scoring of its template so later changes don't alter its score
+	assessment.QuestionnaireVersionID = survey.VersionID
+	if template, err := s.templates.Get(templateID); err == nil {
+		assessment.Scoring = template.Scoring
+	}
+
+	if err := create(assessment); err != nil {
+		if err == models.ErrInvalidAggregation || err == models.ErrCampaignTeamStarted {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to create assessment: %w", err)
+	}
+
+	return survey, nil
 }
 
-// ContinueAssessment loads an existing assessment
+// validResponses keeps the responses that still fit a survey: answers that
+// aren't offered anymore are dropped, and so are responses to questions that
+// aren't asked anymore or have no answer left
+func validResponses(survey *models.Survey, responses []models.Response) []models.Response {
+	questions := make(map[string]*models.Question)
+	for sectionIndex := range survey.Sections {
+		for questionIndex := range survey.Sections[sectionIndex].Questions {
+			question := &survey.Sections[sectionIndex].Questions[questionIndex]
+			if question.Type != "Banner" && question.ID != "" {
+				questions[question.ID] = question
+			}
+		}
+	}
+
+	var valid []models.Response
+	for _, response := range responses {
+		question, exists := questions[response.QuestionID]
+		if !exists {
+			continue
+		}
+
+		var answerIDs []string
+		for _, answerID := range response.AnswerIDs {
+			for _, answer := range question.Answers {
+				if answer.ID == answerID {
+					answerIDs = append(answerIDs, answerID)
+					break
+				}
+			}
+		}
+
+		if len(answerIDs) == 0 || (question.Type == "Option" && len(answerIDs) > 1) {
+			continue
+		}
+
+		response.AnswerIDs = answerIDs
+		valid = append(valid, response)
+	}
+
+	return valid
+}
+
+// ContinueAssessment loads an existing assessment with its responses, in
+// any status; whether it can be edited depends on its status
 func (s *SurveyService) ContinueAssessment(assessmentID int) (*models.Assessment, *models.Survey, error) {
 	// Load assessment
 	assessment := &models.Assessment{}
@@ -59,13 +322,8 @@ func (s *SurveyService) ContinueAssessment(assessmentID int) (*models.Assessment
 		return nil, nil, err
 	}
 
-	// Check if assessment is still in progress
-	if assessment.Status != models.StatusInProgress {
-		return nil, nil, fmt.Errorf("assessment is already completed")
-	}
-
-	// Load survey questions
-	survey, err := s.questionService.LoadQuestions()
+	// Load the questionnaire version the assessment was started with
+	survey, err := s.loadAssessmentSurvey(assessment)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to load questions: %w", err)
 	}
@@ -77,43 +335,180 @@ func (s *SurveyService) ContinueAssessment(assessmentID int) (*models.Assessment
 	}
 
 	// Apply responses to survey
-	if err := s.questionService.ApplyResponses(survey, responses); err != nil {
+	if err := s.questions(survey).ApplyResponses(survey, responses); err != nil {
 		return nil, nil, fmt.Errorf("failed to apply responses: %w", err)
 	}
 
+	if assessment.ClonedFromID != 0 {
+		if err := s.markClonedResponses(assessment, survey, responses); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	return assessment, survey, nil
 }
 
-// SaveResponses saves responses for a specific section
+// markClonedResponses marks the questions of a cloned assessment whose
+// copied responses aren't confirmed yet, and those whose response differs
+// from the assessment it was cloned from
+func (s *SurveyService) markClonedResponses(assessment *models.Assessment, survey *models.Survey, responses []models.Response) error {
+	unconfirmed, err := s.assessmentService.GetUnconfirmedQuestionIDs(assessment.ID)
+	if err != nil {
+		return err
+	}
+
+	previousResponses, err := s.assessmentService.GetAssessmentResponses(assessment.ClonedFromID)
+	if err != nil {
+		return fmt.Errorf("failed to load previous responses: %w", err)
+	}
+
+	previous := answerSets(previousResponses)
+	current := answerSets(responses)
+
+	for sectionIndex := range survey.Sections {
+		for questionIndex := range survey.Sections[sectionIndex].Questions {
+			question := &survey.Sections[sectionIndex].Questions[questionIndex]
+			if question.Type == "Banner" || question.ID == "" {
+				continue
+			}
+
+			question.NeedsConfirmation = unconfirmed[question.ID]
+			question.Changed = !sameAnswers(previous[question.ID], current[question.ID])
+		}
+	}
+
+	return nil
+}
+
+// answerSets maps question IDs to the set of answer IDs of their responses
+func answerSets(responses []models.Response) map[string]map[string]bool {
+	sets := make(map[string]map[string]bool, len(responses))
+	for _, response := range responses {
+		set := make(map[string]bool, len(response.AnswerIDs))
+		for _, answerID := range response.AnswerIDs {
+			set[answerID] = true
+		}
+		sets[response.QuestionID] = set
+	}
+	return sets
+}
+
+// sameAnswers reports whether two sets of answer IDs are equal, no response
+// being equal to an empty one
+func sameAnswers(a, b map[string]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for answerID := range a {
+		if !b[answerID] {
+			return false
+		}
+	}
+	return true
+}
+
+// SaveResponses saves responses for a specific section. Assessments with
+// respondents are answered by them instead.
 func (s *SurveyService) SaveResponses(assessmentID int, sectionName string, formData map[string][]string) error {
-	// Load survey questions
-	survey, err := s.questionService.LoadQuestions()
+	// Load assessment
+	assessment := &models.Assessment{}
+	if err := s.assessmentService.GetAssessmentByID(assessmentID, assessment); err != nil {
+		return err
+	}
+
+	if !assessment.Editable() {
+		return models.ErrNotEditable
+	}
+
+	hasRespondents, err := s.respondentService.HasRespondents(assessmentID)
 	if err != nil {
-		return fmt.Errorf("failed to load questions: %w", err)
+		return err
+	}
+	if hasRespondents {
+		return models.ErrAnsweredByRespondents
 	}
 
-	// Find the section
-	section, err := s.questionService.GetSectionByURLName(survey, sectionName)
+	responses, err := s.sectionResponses(assessment, sectionName, formData)
 	if err != nil {
 		return err
 	}
 
+	return s.assessmentService.SaveResponses(assessmentID, responses)
+}
+
+// ContinueRespondent loads the survey of an assessment with the answers of
+// one of its respondents
+func (s *SurveyService) ContinueRespondent(assessment *models.Assessment, respondent *models.Respondent) (*models.Survey, error) {
+	if !assessment.Editable() {
+		return nil, models.ErrNotEditable
+	}
+
+	survey, err := s.loadAssessmentSurvey(assessment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load questions: %w", err)
+	}
+
+	responses, err := s.respondentService.GetResponses(respondent.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load responses: %w", err)
+	}
+
+	if err := s.questions(survey).ApplyResponses(survey, responses); err != nil {
+		return nil, fmt.Errorf("failed to apply responses: %w", err)
+	}
+
+	return survey, nil
+}
+
+// SaveRespondentResponses saves a respondent's answers for a specific section
+func (s *SurveyService) SaveRespondentResponses(assessment *models.Assessment, respondent *models.Respondent, sectionName string, formData map[string][]string) error {
+	if !assessment.Editable() {
+		return models.ErrNotEditable
+	}
+
+	responses, err := s.sectionResponses(assessment, sectionName, formData)
+	if err != nil {
+		return err
+	}
+
+	return s.respondentService.SaveResponses(assessment.ID, respondent.ID, responses)
+}
+
+// sectionResponses converts the form data of a section to the responses to
+// save, one per answered question
+func (s *SurveyService) sectionResponses(assessment *models.Assessment, sectionName string, formData map[string][]string) ([]models.Response, error) {
+	// Load the questionnaire version the assessment was started with
+	survey, err := s.loadAssessmentSurvey(assessment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load questions: %w", err)
+	}
+
+	// Find the section
+	section, err := s.questions(survey).GetSectionByURLName(survey, sectionName)
+	if err != nil {
+		return nil, err
+	}
+
 	// Process responses for each question in the section
+	var responses []models.Response
 	for _, question := range section.Questions {
 		if question.Type == "Banner" || question.ID == "" {
 			continue
 		}
 
-		response := &models.Response{
-			AssessmentID: assessmentID,
+		response := models.Response{
+			AssessmentID: assessment.ID,
 			QuestionID:   question.ID,
 			AnswerIDs:    []string{},
 		}
 
 		switch question.Type {
 		case "Option":
-			// Radio button - single value
+			// Radio button - single value, which must be one of the answers
 			if values, exists := formData[question.ID]; exists && len(values) > 0 {
+				if !hasAnswer(&question, values[0]) {
+					return nil, fmt.Errorf("%w: %q is not an answer to question %s", models.ErrInvalidAnswer, values[0], question.ID)
+				}
 				response.AnswerIDs = []string{values[0]}
 			}
 
@@ -126,68 +521,88 @@ func (s *SurveyService) SaveResponses(assessmentID int, sectionName string, form
 			}
 		}
 
-		// Save response if any answers were selected
+		// Keep response if any answers were selected
 		if len(response.AnswerIDs) > 0 {
-			if err := s.assessmentService.SaveResponse(response); err != nil {
-				return fmt.Errorf("failed to save response: %w", err)
-			}
+			responses = append(responses, response)
 		}
 	}
 
-	return nil
+	return responses, nil
 }
 
-// CalculateResults calculates and saves the assessment results
-func (s *SurveyService) CalculateResults(assessmentID int) (*AssessmentResults, error) {
-	// Load survey questions
-	survey, err := s.questionService.LoadQuestions()
+// hasAnswer reports whether an answer ID is one of a question's answers
+func hasAnswer(question *models.Question, answerID string) bool {
+	for _, answer := range question.Answers {
+		if answer.ID == answerID {
+			return true
+		}
+	}
+	return false
+}
+
+// CalculateResults calculates and saves the assessment results, completing
+// it. For assessments with respondents this closes the round: the submitted
+// answers are aggregated, and respondents can't change them anymore. Completing
+// a reopened assessment records the new responses and scores as a revision.
+func (s *SurveyService) CalculateResults(assessmentID, userID int) (*AssessmentResults, error) {
+	// Load assessment
+	assessment := &models.Assessment{}
+	if err := s.assessmentService.GetAssessmentByID(assessmentID, assessment); err != nil {
+		return nil, err
+	}
+
+	// Check the status first, so scores of completed assessments never change
+	if !models.CanTransition(assessment.Status, models.StatusCompleted) {
+		return nil, models.ErrInvalidTransition
+	}
+
+	// Load the questionnaire version the assessment was started with
+	survey, err := s.loadAssessmentSurvey(assessment)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load questions: %w", err)
 	}
 
-	// Load responses
-	responses, err := s.assessmentService.GetAssessmentResponses(assessmentID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load responses: %w", err)
+	// Create results structure
+	results := &AssessmentResults{
+		AssessmentID: assessmentID,
+		Survey:       survey,
 	}
 
-	// Apply responses to survey
-	if err := s.questionService.ApplyResponses(survey, responses); err != nil {
-		return nil, fmt.Errorf("failed to apply responses: %w", err)
+	aggregate, err := s.applyAnswers(assessment, results)
+	if err != nil {
+		return nil, err
 	}
 
 	// Calculate section scores
-	sectionScores := s.questionService.CalculateSectionScores(survey, assessmentID)
+	results.SectionScores = s.sectionScores(survey, assessmentID, aggregate)
 
-	// Save section scores
-	for _, score := range sectionScores {
-		if err := s.assessmentService.SaveSectionScore(&score); err != nil {
-			return nil, fmt.Errorf("failed to save section score: %w", err)
-		}
-	}
+	results.Scoring = assessment.Scoring
+	results.OverallScore = models.OverallScore(assessment.Scoring, results.SectionScores)
 
-	// Mark assessment as completed
-	if err := s.assessmentService.CompleteAssessment(assessmentID); err != nil {
-		return nil, fmt.Errorf("failed to complete assessment: %w", err)
+	// Mark assessment as completed, saving the section scores only if its
+	// status hasn't changed meanwhile
+	var revision *models.AssessmentRevision
+	if assessment.CompletedAt != nil {
+		revision = &models.AssessmentRevision{Action: models.RevisionCompleted, CreatedBy: userID}
 	}
-
-	// Create results structure
-	results := &AssessmentResults{
-		AssessmentID:  assessmentID,
-		SectionScores: sectionScores,
-		Survey:        survey,
+	if err := s.assessmentService.CompleteAssessment(
+		assessmentID, assessment.Status, results.SectionScores, revision,
+	); err != nil {
+		if err == models.ErrInvalidTransition {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to complete assessment: %w", err)
 	}
 
 	// Calculate subcategory scores for sections that have them
-	results.SubCategoryScores = make(map[string][]models.SectionScore)
-	for _, section := range survey.Sections {
-		if section.HasSubCategories {
-			subScores := s.questionService.CalculateSubCategoryScores(survey, section.SectionName, assessmentID)
-			if len(subScores) > 0 {
-				results.SubCategoryScores[section.SectionName] = subScores
-			}
-		}
+	results.SubCategoryScores = s.subCategoryScores(survey, assessmentID, aggregate)
+
+	// The assessment is completed, so flagging is best effort
+	improved, err := s.flagImprovedActionItems(assessment)
+	if err != nil {
+		log.Printf("Error flagging improved action items of assessment %d: %v", assessmentID, err)
 	}
+	results.ImprovedActionItems = improved
 
 	return results, nil
 }
@@ -201,7 +616,7 @@ func (s *SurveyService) GetAssessmentResults(assessmentID int) (*AssessmentResul
 	}
 
 	// Check if assessment is completed
-	if assessment.Status != models.StatusCompleted {
+	if !assessment.HasResults() {
 		return nil, fmt.Errorf("assessment is not completed")
 	}
 
@@ -211,41 +626,34 @@ func (s *SurveyService) GetAssessmentResults(assessmentID int) (*AssessmentResul
 		return nil, fmt.Errorf("failed to load section scores: %w", err)
 	}
 
-	// Load survey for subcategory calculation
-	survey, err := s.questionService.LoadQuestions()
+	// Load the questionnaire version the assessment was taken with, so
+	// results don't change when the questions file evolves
+	survey, err := s.loadAssessmentSurvey(assessment)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load questions: %w", err)
 	}
 
-	// Load responses to calculate subcategory scores
-	responses, err := s.assessmentService.GetAssessmentResponses(assessmentID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load responses: %w", err)
-	}
-
-	// Apply responses to survey
-	if err := s.questionService.ApplyResponses(survey, responses); err != nil {
-		return nil, fmt.Errorf("failed to apply responses: %w", err)
-	}
+	// Scores saved before maturity levels existed get theirs now
+	s.questions(survey).AssignLevels(sectionScores)
 
 	// Create results structure
 	results := &AssessmentResults{
 		AssessmentID:  assessmentID,
 		SectionScores: sectionScores,
+		Scoring:       assessment.Scoring,
+		OverallScore:  models.OverallScore(assessment.Scoring, sectionScores),
 		Survey:        survey,
 	}
 
-	// Calculate subcategory scores
-	results.SubCategoryScores = make(map[string][]models.SectionScore)
-	for _, section := range survey.Sections {
-		if section.HasSubCategories {
-			subScores := s.questionService.CalculateSubCategoryScores(survey, section.SectionName, assessmentID)
-			if len(subScores) > 0 {
-				results.SubCategoryScores[section.SectionName] = subScores
-			}
-		}
+	// Load answers to calculate subcategory scores
+	aggregate, err := s.applyAnswers(assessment, results)
+	if err != nil {
+		return nil, err
 	}
 
+	// Calculate subcategory scores
+	results.SubCategoryScores = s.subCategoryScores(survey, assessmentID, aggregate)
+
 	// Load team information
 	team := &models.Team{}
 	if err := s.teamService.GetTeamByID(assessment.TeamID, team); err == nil {
@@ -255,7 +663,133 @@ func (s *SurveyService) GetAssessmentResults(assessmentID int) (*AssessmentResul
 	return results, nil
 }
 
-// ExportAssessmentCSV exports assessment results to CSV format
+// applyAnswers prepares scoring an assessment. The responses of the
+// assessment are applied to the survey; for an assessment answered by one
+// person nil is returned. For assessments with respondents, the aggregated
+// question scores of the submitted answers are returned, overridden by the
+// agreed answers, which are the assessment's responses. The respondents'
+// section scores and the spread between them are added to the results.
+func (s *SurveyService) applyAnswers(assessment *models.Assessment, results *AssessmentResults) (map[string]float64, error) {
+	survey := results.Survey
+
+	responses, err := s.assessmentService.GetAssessmentResponses(assessment.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load responses: %w", err)
+	}
+
+	if err := s.questions(survey).ApplyResponses(survey, responses); err != nil {
+		return nil, fmt.Errorf("failed to apply responses: %w", err)
+	}
+
+	hasRespondents, err := s.respondentService.HasRespondents(assessment.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !hasRespondents {
+		return nil, nil
+	}
+
+	submitted, err := s.submittedAnswers(assessment, survey)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(submitted) == 0 && len(responses) == 0 {
+		return nil, models.ErrNoSubmittedResponses
+	}
+
+	aggregate, spread := aggregateScores(submitted, assessment.Aggregation)
+
+	// Agreed answers take precedence over the aggregated ones
+	for questionID, score := range s.questions(survey).ScoreResponses(survey, responses) {
+		aggregate[questionID] = score
+
+		questionSpread := spread[questionID]
+		questionSpread.Score = score
+		questionSpread.Agreed = true
+		spread[questionID] = questionSpread
+	}
+
+	results.Aggregation = assessment.Aggregation
+	results.QuestionSpread = spread
+	for _, answers := range submitted {
+		results.Respondents = append(results.Respondents, RespondentScores{
+			Respondent:    answers.respondent,
+			SectionScores: s.questions(survey).ScoreSections(survey, assessment.ID, answers.scores),
+		})
+	}
+
+	return aggregate, nil
+}
+
+// submittedAnswers loads the answers of the respondents of an assessment
+// who submitted them, scored against the survey
+func (s *SurveyService) submittedAnswers(assessment *models.Assessment, survey *models.Survey) ([]respondentAnswers, error) {
+	respondents, err := s.respondentService.ListRespondents(assessment.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var submitted []respondentAnswers
+	for _, respondent := range respondents {
+		if respondent.SubmittedAt == nil {
+			continue
+		}
+
+		responses, err := s.respondentService.GetResponses(respondent.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load responses: %w", err)
+		}
+
+		answers := make(map[string][]string, len(responses))
+		for _, response := range responses {
+			answers[response.QuestionID] = response.AnswerIDs
+		}
+
+		submitted = append(submitted, respondentAnswers{
+			respondent: respondent,
+			answers:    answers,
+			scores:     s.questions(survey).ScoreResponses(survey, responses),
+		})
+	}
+
+	return submitted, nil
+}
+
+// sectionScores calculates the section scores from the aggregated question
+// scores, or from the answers applied to the survey when aggregate is nil
+func (s *SurveyService) sectionScores(survey *models.Survey, assessmentID int, aggregate map[string]float64) []models.SectionScore {
+	if aggregate == nil {
+		return s.questions(survey).CalculateSectionScores(survey, assessmentID)
+	}
+	return s.questions(survey).ScoreSections(survey, assessmentID, aggregate)
+}
+
+// subCategoryScores calculates the subcategory scores of sections that have
+// them, like sectionScores
+func (s *SurveyService) subCategoryScores(survey *models.Survey, assessmentID int, aggregate map[string]float64) map[string][]models.SectionScore {
+	scores := make(map[string][]models.SectionScore)
+	for _, section := range survey.Sections {
+		if !section.HasSubCategories {
+			continue
+		}
+
+		var subScores []models.SectionScore
+		if aggregate == nil {
+			subScores = s.questions(survey).CalculateSubCategoryScores(survey, section.SectionName, assessmentID)
+		} else {
+			subScores = s.questions(survey).ScoreSubCategories(survey, section.SectionName, assessmentID, aggregate)
+		}
+		if len(subScores) > 0 {
+			scores[section.SectionName] = subScores
+		}
+	}
+	return scores
+}
+
+// ExportAssessmentCSV exports assessment results to CSV format. Assessments
+// with respondents get their aggregated scores and the spread between
+// respondents instead of answers.
 func (s *SurveyService) ExportAssessmentCSV(assessmentID int, writer io.Writer) error {
 	// Get assessment results
 	results, err := s.GetAssessmentResults(assessmentID)
@@ -277,6 +811,10 @@ func (s *SurveyService) ExportAssessmentCSV(assessmentID int, writer io.Writer)
 		"Answer(s)",
 		"Score",
 	}
+	if results.QuestionSpread != nil {
+		header = append(header, "Respondents", "Min Score", "Max Score", "Std Dev")
+	}
+	header = append(header, "Section Level", "Sub Category Level")
 	if err := csvWriter.Write(header); err != nil {
 		return fmt.Errorf("failed to write CSV header: %w", err)
 	}
@@ -293,6 +831,23 @@ func (s *SurveyService) ExportAssessmentCSV(assessmentID int, writer io.Writer)
 		responseMap[response.QuestionID] = response.AnswerIDs
 	}
 
+	// Maturity levels by section and by subcategory of each section
+	sectionLevels := make(map[string]string)
+	for _, score := range results.SectionScores {
+		if score.Level > 0 {
+			sectionLevels[score.SectionName] = score.MaturityLevel().String()
+		}
+	}
+	subCategoryLevels := make(map[string]map[string]string)
+	for sectionName, scores := range results.SubCategoryScores {
+		subCategoryLevels[sectionName] = make(map[string]string)
+		for _, score := range scores {
+			if score.Level > 0 {
+				subCategoryLevels[sectionName][score.SectionName] = score.MaturityLevel().String()
+			}
+		}
+	}
+
 	// Write data rows
 	for _, section := range results.Survey.Sections {
 		for _, question := range section.Questions {
@@ -327,7 +882,7 @@ func (s *SurveyService) ExportAssessmentCSV(assessmentID int, writer io.Writer)
 			}
 
 			// Calculate scores
-			maxScore := s.questionService.CalculateQuestionMaxScore(&question)
+			maxScore := s.questions(results.Survey).CalculateQuestionMaxScore(&question)
 			score := 0.0
 			if answerIDs, exists := responseMap[question.ID]; exists {
 				for _, answerID := range answerIDs {
@@ -339,6 +894,18 @@ func (s *SurveyService) ExportAssessmentCSV(assessmentID int, writer io.Writer)
 				}
 			}
 
+			var spreadColumns []string
+			if results.QuestionSpread != nil {
+				spread := results.QuestionSpread[question.ID]
+				score = spread.Score
+				spreadColumns = []string{
+					strconv.Itoa(spread.Respondents),
+					strconv.FormatFloat(spread.Min, 'f', 1, 64),
+					strconv.FormatFloat(spread.Max, 'f', 1, 64),
+					strconv.FormatFloat(spread.StdDev, 'f', 2, 64),
+				}
+			}
+
 			// Write row
 			row := []string{
 				section.SectionName,
@@ -349,6 +916,8 @@ func (s *SurveyService) ExportAssessmentCSV(assessmentID int, writer io.Writer)
 				strings.TrimSpace(selectedAnswers.String()),
 				strconv.FormatFloat(score, 'f', 1, 64),
 			}
+			row = append(row, spreadColumns...)
+			row = append(row, sectionLevels[section.SectionName], subCategoryLevels[section.SectionName][question.SubCategory])
 
 			if err := csvWriter.Write(row); err != nil {
 				return fmt.Errorf("failed to write CSV row: %w", err)
@@ -359,13 +928,143 @@ func (s *SurveyService) ExportAssessmentCSV(assessmentID int, writer io.Writer)
 	return nil
 }
 
-// GetTeamAssessmentHistory gets assessment history for a team
-func (s *SurveyService) GetTeamAssessmentHistory(teamID int) ([]AssessmentSummary, error) {
+// MigrateLegacyResponseIDs rewrites responses saved with positional IDs
+// (S2-Q3, S2-Q3-A1) to the stable IDs of the same questions and answers.
+// The positional IDs are resolved against the current questions file, so this
+// must run before the questionnaire is reordered.
+func (s *SurveyService) MigrateLegacyResponseIDs(tx *sql.Tx) error {
+	// Positional IDs predate templates, so they refer to the default template
+	survey, err := s.loadTemplateQuestions("")
+	if err != nil {
+		return err
+	}
+
+	idMap := s.questions(survey).LegacyIDMap(survey)
+
+	// Collect all responses first, the rows must be closed before updating
+	rows, err := tx.Query(`SELECT id, question_id, answer_ids FROM responses`)
+	if err != nil {
+		return fmt.Errorf("failed to load responses: %w", err)
+	}
+
+	type storedResponse struct {
+		id         int
+		questionID string
+		answerJSON string
+	}
+
+	var stored []storedResponse
+	for rows.Next() {
+		var response storedResponse
+		if err := rows.Scan(&response.id, &response.questionID, &response.answerJSON); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan response: %w", err)
+		}
+		stored = append(stored, response)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load responses: %w", err)
+	}
+
+	rewritten := 0
+	for _, response := range stored {
+		questionID, exists := idMap[response.questionID]
+		if !exists {
+			// Already stable, or a question that no longer exists
+			continue
+		}
+
+		var answerIDs []string
+		if err := json.Unmarshal([]byte(response.answerJSON), &answerIDs); err != nil {
+			return fmt.Errorf("failed to unmarshal answer IDs of response %d: %w", response.id, err)
+		}
+
+		for i, answerID := range answerIDs {
+			if stableID, exists := idMap[answerID]; exists {
+				answerIDs[i] = stableID
+			}
+		}
+
+		answerJSON, err := json.Marshal(answerIDs)
+		if err != nil {
+			return fmt.Errorf("failed to marshal answer IDs: %w", err)
+		}
+
+		if _, err := tx.Exec(
+			"UPDATE responses SET question_id = ?, answer_ids = ? WHERE id = ?",
+			questionID, string(answerJSON), response.id,
+		); err != nil {
+			return fmt.Errorf("failed to rewrite response %d: %w", response.id, err)
+		}
+		rewritten++
+	}
+
+	log.Printf("Rewrote %d responses to stable question IDs", rewritten)
+	return nil
+}
+
+// SubmitAssessment submits an assessment being edited for completion, after
+// which it can't be edited until it is returned
+func (s *SurveyService) SubmitAssessment(assessment *models.Assessment) error {
+	if !assessment.Editable() {
+		return models.ErrInvalidTransition
+	}
+	return s.assessmentService.TransitionAssessment(assessment.ID, assessment.Status, models.StatusSubmitted, nil)
+}
+
+// ReturnAssessment returns a submitted assessment for changes. Assessments
+// that were completed before return to being reopened.
+func (s *SurveyService) ReturnAssessment(assessment *models.Assessment) error {
+	if assessment.Status != models.StatusSubmitted {
+		return models.ErrInvalidTransition
+	}
+
+	status := models.StatusInProgress
+	if assessment.CompletedAt != nil {
+		status = models.StatusReopened
+	}
+	return s.assessmentService.TransitionAssessment(assessment.ID, assessment.Status, status, nil)
+}
+
+// ReopenAssessment reopens a completed assessment to amend it, recording its
+// responses and scores as completed as a revision. Its results stay
+// unavailable until it is completed again.
+func (s *SurveyService) ReopenAssessment(assessment *models.Assessment, userID int, reason string) (*models.AssessmentRevision, error) {
+	revision := &models.AssessmentRevision{
+		Action:    models.RevisionReopened,
+		Reason:    reason,
+		CreatedBy: userID,
+	}
+
+	if err := s.assessmentService.TransitionAssessment(
+		assessment.ID, assessment.Status, models.StatusReopened, revision,
+	); err != nil {
+		return nil, err
+	}
+
+	return revision, nil
+}
+
+// ArchiveAssessment archives a completed assessment. Its results stay
+// available, but it no longer counts as the team's latest assessment.
+func (s *SurveyService) ArchiveAssessment(assessment *models.Assessment) error {
+	return s.assessmentService.TransitionAssessment(assessment.ID, assessment.Status, models.StatusArchived, nil)
+}
+
+// GetTeamAssessmentHistory gets assessment history for a team, with the
+// projections of its targets from the section scores of its assessments
+func (s *SurveyService) GetTeamAssessmentHistory(teamID int) (*TeamAssessmentHistory, error) {
 	assessments, err := s.assessmentService.ListTeamAssessments(teamID, false)
 	if err != nil {
 		return nil, err
 	}
 
+	targets, err := s.targetService.ListTeamTargets(teamID)
+	if err != nil {
+		return nil, err
+	}
+
 	summaries := make([]AssessmentSummary, 0, len(assessments))
 	for _, assessment := range assessments {
 		if assessment.Status == models.StatusCompleted {
@@ -377,14 +1076,17 @@ func (s *SurveyService) GetTeamAssessmentHistory(teamID int) ([]AssessmentSummar
 			summary := AssessmentSummary{
 				Assessment:    assessment,
 				SectionScores: scores,
-				OverallScore:  calculateOverallScore(scores),
+				OverallScore:  models.OverallScore(assessment.Scoring, scores),
 			}
 
 			summaries = append(summaries, summary)
 		}
 	}
 
-	return summaries, nil
+	return &TeamAssessmentHistory{
+		Assessments: summaries,
+		Targets:     projectTargets(targets, summaries, time.Now()),
+	}, nil
 }
 
 // Helper structures
@@ -395,7 +1097,18 @@ type AssessmentResults struct {
 	Team              *models.Team                     `json:"team,omitempty"`
 	SectionScores     []models.SectionScore            `json:"section_scores"`
 	SubCategoryScores map[string][]models.SectionScore `json:"subcategory_scores,omitempty"`
+	Scoring           string                           `json:"scoring"`       // How the section scores are combined
+	OverallScore      float64                          `json:"overall_score"` // Percentage, by the scoring
 	Survey            *models.Survey                   `json:"survey,omitempty"`
+
+	// Set for assessments answered by several respondents
+	Aggregation    string                    `json:"aggregation,omitempty"`
+	Respondents    []RespondentScores        `json:"respondents,omitempty"`
+	QuestionSpread map[string]QuestionSpread `json:"question_spread,omitempty"`
+
+	// Set when completing an assessment: action items of earlier assessments
+	// of the team that scored higher this time
+	ImprovedActionItems []models.ActionItem `json:"improved_action_items,omitempty"`
 }
 
 // AssessmentSummary contains summary information about an assessment
@@ -404,24 +1117,3 @@ type AssessmentSummary struct {
 	SectionScores []models.SectionScore `json:"section_scores"`
 	OverallScore  float64               `json:"overall_score"`
 }
-
-// calculateOverallScore calculates the overall percentage score
-func calculateOverallScore(scores []models.SectionScore) float64 {
-	if len(scores) == 0 {
-		return 0
-	}
-
-	totalScore := 0.0
-	totalMaxScore := 0.0
-
-	for _, score := range scores {
-		totalScore += score.Score
-		totalMaxScore += score.MaxScore
-	}
-
-	if totalMaxScore == 0 {
-		return 0
-	}
-
-	return (totalScore / totalMaxScore) * 100
-}
@@ -0,0 +1,228 @@
+package services
+
+import (
+	"sort"
+	"time"
+
+	"devops-assessment/internal/models"
+)
+
+// Target statuses, projected from the team's completed assessments
+const (
+	TargetAchieved = "achieved"  // The latest assessment reached the target
+	TargetOnTrack  = "on_track"  // The trend reaches the target by its due date
+	TargetOffTrack = "off_track" // The trend falls short, or the due date passed
+	TargetNoData   = "no_data"   // Fewer than two assessments to project from
+)
+
+// TargetProjection is a team target with the section's latest percentage
+// and where the trend of past assessments leads
+type TargetProjection struct {
+	models.TeamTarget
+	Current   *float64 `json:"current"`   // Nil before the section is assessed
+	Gap       float64  `json:"gap"`       // Percentage points left, 0 once reached
+	Trend     *float64 `json:"trend"`     // Percentage points per 30 days
+	Projected *float64 `json:"projected"` // Projected percentage at the due date
+	Status    string   `json:"status"`
+}
+
+// TeamAssessmentHistory contains the completed assessments of a team, most
+// recent first, and the projections of its targets
+type TeamAssessmentHistory struct {
+	Assessments []AssessmentSummary `json:"assessments"`
+	Targets     []TargetProjection  `json:"targets"`
+}
+
+// GapAnalysis compares the latest completed assessment of a team with its
+// targets
+type GapAnalysis struct {
+	TeamID       int          `json:"team_id"`
+	AssessmentID int          `json:"assessment_id,omitempty"` // Latest completed assessment
+	Sections     []SectionGap `json:"sections"`                // Largest gap first
+}
+
+// SectionGap is the current and target percentage of a section
+type SectionGap struct {
+	SectionName string     `json:"section_name"`
+	Current     *float64   `json:"current"`
+	Target      *float64   `json:"target"`
+	Gap         float64    `json:"gap"`
+	DueDate     *time.Time `json:"due_date,omitempty"`
+	Status      string     `json:"status,omitempty"` // Set for sections with a target
+}
+
+// trendPeriod is the period trends are expressed in
+const trendPeriod = 30 * 24 * time.Hour
+
+// SetTeamTarget sets the target of a team for a section of one of the
+// questionnaire templates
+func (s *SurveyService) SetTeamTarget(target *models.TeamTarget) error {
+	if !s.hasSection(target.SectionName) {
+		return models.ErrSectionNotFound
+	}
+	return s.targetService.SetTarget(target)
+}
+
+// hasSection reports whether a section is part of the current version of a
+// questionnaire template
+func (s *SurveyService) hasSection(sectionName string) bool {
+	for _, template := range s.Templates() {
+		survey, err := s.CurrentSurvey(template.ID)
+		if err != nil {
+			continue
+		}
+		for _, section := range survey.Sections {
+			if section.SectionName == sectionName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetGapAnalysis compares the section percentages of the latest completed
+// assessment of a team with its targets
+func (s *SurveyService) GetGapAnalysis(teamID int) (*GapAnalysis, error) {
+	history, err := s.GetTeamAssessmentHistory(teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	analysis := &GapAnalysis{TeamID: teamID, Sections: []SectionGap{}}
+	targeted := make(map[string]bool, len(history.Targets))
+	for i := range history.Targets {
+		projection := &history.Targets[i]
+		targeted[projection.SectionName] = true
+		analysis.Sections = append(analysis.Sections, SectionGap{
+			SectionName: projection.SectionName,
+			Current:     projection.Current,
+			Target:      &projection.Percentage,
+			Gap:         projection.Gap,
+			DueDate:     projection.DueDate,
+			Status:      projection.Status,
+		})
+	}
+
+	// Sections without a target are listed for comparison
+	if len(history.Assessments) > 0 {
+		latest := history.Assessments[0]
+		analysis.AssessmentID = latest.Assessment.ID
+		for _, score := range latest.SectionScores {
+			if !targeted[score.SectionName] {
+				current := score.Percentage
+				analysis.Sections = append(analysis.Sections, SectionGap{
+					SectionName: score.SectionName,
+					Current:     &current,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(analysis.Sections, func(i, j int) bool {
+		return analysis.Sections[i].Gap > analysis.Sections[j].Gap
+	})
+
+	return analysis, nil
+}
+
+// projectTargets projects each target from the section percentages of the
+// completed assessments, which are ordered most recent first
+func projectTargets(targets []models.TeamTarget, assessments []AssessmentSummary, now time.Time) []TargetProjection {
+	projections := make([]TargetProjection, 0, len(targets))
+	for _, target := range targets {
+		projections = append(projections, projectTarget(target, assessments, now))
+	}
+	return projections
+}
+
+// projectTarget fits a linear trend through the percentages of the target's
+// section and extends it to the due date. Targets without a due date are on
+// track while the trend rises.
+func projectTarget(target models.TeamTarget, assessments []AssessmentSummary, now time.Time) TargetProjection {
+	projection := TargetProjection{TeamTarget: target, Status: TargetNoData}
+
+	// Oldest first
+	var times []time.Time
+	var percentages []float64
+	for i := len(assessments) - 1; i >= 0; i-- {
+		assessment := assessments[i].Assessment
+		if assessment.CompletedAt == nil {
+			continue
+		}
+		for _, score := range assessments[i].SectionScores {
+			if score.SectionName == target.SectionName {
+				times = append(times, *assessment.CompletedAt)
+				percentages = append(percentages, score.Percentage)
+			}
+		}
+	}
+
+	if len(percentages) == 0 {
+		projection.Gap = target.Percentage
+		return projection
+	}
+
+	current := percentages[len(percentages)-1]
+	projection.Current = &current
+	if current >= target.Percentage {
+		projection.Status = TargetAchieved
+		return projection
+	}
+	projection.Gap = target.Percentage - current
+
+	slope, ok := linearTrend(times, percentages)
+	if !ok {
+		return projection
+	}
+	trend := slope * float64(trendPeriod)
+	projection.Trend = &trend
+
+	if target.DueDate == nil {
+		projection.Status = TargetOffTrack
+		if slope > 0 {
+			projection.Status = TargetOnTrack
+		}
+		return projection
+	}
+
+	projected := current + slope*float64(target.DueDate.Sub(times[len(times)-1]))
+	projected = min(max(projected, 0), 100)
+	projection.Projected = &projected
+
+	projection.Status = TargetOffTrack
+	if target.DueDate.After(now) && projected >= target.Percentage {
+		projection.Status = TargetOnTrack
+	}
+
+	return projection
+}
+
+// linearTrend returns the least-squares slope of percentages over time, in
+// percentage points per nanosecond. It fails for fewer than two points in
+// time.
+func linearTrend(times []time.Time, percentages []float64) (float64, bool) {
+	if len(times) < 2 {
+		return 0, false
+	}
+
+	// Offsets from the first point keep the sums small
+	n := float64(len(times))
+	var sumX, sumY float64
+	for i := range times {
+		sumX += float64(times[i].Sub(times[0]))
+		sumY += percentages[i]
+	}
+	meanX, meanY := sumX/n, sumY/n
+
+	var covariance, variance float64
+	for i := range times {
+		dx := float64(times[i].Sub(times[0])) - meanX
+		covariance += dx * (percentages[i] - meanY)
+		variance += dx * dx
+	}
+	if variance == 0 {
+		return 0, false
+	}
+
+	return covariance / variance, true
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+
+	"devops-assessment/internal/models"
+)
+
+// WorkshopQuestion is a question of a collaborative assessment with the
+// answers of its respondents, for discussing where they disagree
+type WorkshopQuestion struct {
+	SectionName  string          `json:"section_name"`
+	QuestionID   string          `json:"question_id"`
+	QuestionText string          `json:"question_text"`
+	Type         string          `json:"type"`
+	Answers      []models.Answer `json:"answers"` // The possible answers
+	Spread       QuestionSpread  `json:"spread"`
+	Variance     float64         `json:"variance"` // Of the respondents' scores
+
+	RespondentAnswers []RespondentAnswer   `json:"respondent_answers"`
+	Agreed            *models.AgreedAnswer `json:"agreed,omitempty"`
+}
+
+// RespondentAnswer is the answer of one respondent to a question
+type RespondentAnswer struct {
+	RespondentID int      `json:"respondent_id"`
+	UserID       int      `json:"user_id"`
+	FirstName    string   `json:"first_name"`
+	LastName     string   `json:"last_name"`
+	AnswerIDs    []string `json:"answer_ids"`
+	Score        float64  `json:"score"`
+}
+
+// GetWorkshop returns the questions answered by the respondents of an
+// assessment who submitted their answers, those they disagree on most
+// first, with the answers agreed on so far
+func (s *SurveyService) GetWorkshop(assessment *models.Assessment) ([]WorkshopQuestion, error) {
+	survey, err := s.loadAssessmentSurvey(assessment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load questions: %w", err)
+	}
+
+	submitted, err := s.submittedAnswers(assessment, survey)
+	if err != nil {
+		return nil, err
+	}
+
+	agreedAnswers, err := s.respondentService.ListAgreedAnswers(assessment.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	agreed := make(map[string]*models.AgreedAnswer, len(agreedAnswers))
+	for i := range agreedAnswers {
+		agreed[agreedAnswers[i].QuestionID] = &agreedAnswers[i]
+	}
+
+	_, spread := aggregateScores(submitted, assessment.Aggregation)
+
+	questions := []WorkshopQuestion{}
+	for _, section := range survey.Sections {
+		for _, question := range section.Questions {
+			questionSpread, answered := spread[question.ID]
+			if !answered {
+				continue
+			}
+
+			workshopQuestion := WorkshopQuestion{
+				SectionName:       section.SectionName,
+				QuestionID:        question.ID,
+				QuestionText:      question.QuestionText,
+				Type:              question.Type,
+				Answers:           question.Answers,
+				Spread:            questionSpread,
+				Variance:          questionSpread.StdDev * questionSpread.StdDev,
+				RespondentAnswers: []RespondentAnswer{},
+				Agreed:            agreed[question.ID],
+			}
+
+			for _, answers := range submitted {
+				answerIDs, exists := answers.answers[question.ID]
+				if !exists {
+					continue
+				}
+
+				workshopQuestion.RespondentAnswers = append(workshopQuestion.RespondentAnswers, RespondentAnswer{
+					RespondentID: answers.respondent.ID,
+					UserID:       answers.respondent.UserID,
+					FirstName:    answers.respondent.FirstName,
+					LastName:     answers.respondent.LastName,
+					AnswerIDs:    answerIDs,
+					Score:        answers.scores[question.ID],
+				})
+			}
+
+			questions = append(questions, workshopQuestion)
+		}
+	}
+
+	// Most disagreement first, otherwise in questionnaire order
+	sort.SliceStable(questions, func(i, j int) bool {
+		return questions[i].Variance > questions[j].Variance
+	})
+
+	return questions, nil
+}
+
+// AgreeAnswer records the answer the respondents of an assessment agreed on
+// for a question, which becomes the assessment's response to it
+func (s *SurveyService) AgreeAnswer(assessment *models.Assessment, answer *models.AgreedAnswer) error {
+	hasRespondents, err := s.respondentService.HasRespondents(assessment.ID)
+	if err != nil {
+		return err
+	}
+	if !hasRespondents {
+		return models.ErrNoRespondents
+	}
+
+	survey, err := s.loadAssessmentSurvey(assessment)
+	if err != nil {
+		return fmt.Errorf("failed to load questions: %w", err)
+	}
+
+	question, err := s.questions(survey).GetQuestionByID(survey, answer.QuestionID)
+	if err != nil {
+		return err
+	}
+
+	if err := validateAgreedAnswer(question, answer.AnswerIDs); err != nil {
+		return err
+	}
+
+	return s.respondentService.SaveAgreedAnswer(assessment.ID, answer)
+}
+
+// validateAgreedAnswer checks that the answer IDs are answers of the
+// question: exactly one for options, any number of distinct ones for
+// checkboxes
+func validateAgreedAnswer(question *models.Question, answerIDs []string) error {
+	switch question.Type {
+	case "Option":
+		if len(answerIDs) != 1 {
+			return fmt.Errorf("%w: choose exactly one answer", models.ErrInvalidAgreedAnswer)
+		}
+	case "Checkbox":
+	default:
+		return fmt.Errorf("%w: question can't be answered", models.ErrInvalidAgreedAnswer)
+	}
+
+	valid := make(map[string]bool, len(question.Answers))
+	for _, answer := range question.Answers {
+		valid[answer.ID] = true
+	}
+
+	seen := make(map[string]bool, len(answerIDs))
+	for _, answerID := range answerIDs {
+		if !valid[answerID] || seen[answerID] {
+			return fmt.Errorf("%w: unknown or repeated answer %s", models.ErrInvalidAgreedAnswer, answerID)
+		}
+		seen[answerID] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"devops-assessment/internal/models"
+)
+
+func TestValidateAgreedAnswer(t *testing.T) {
+	answers := []models.Answer{{ID: "a1", Score: 1}, {ID: "a2", Score: 2}, {ID: "a3", Score: 3}}
+	option := &models.Question{ID: "q1", Type: "Option", Answers: answers}
+	checkbox := &models.Question{ID: "q2", Type: "Checkbox", Answers: answers}
+	banner := &models.Question{ID: "q3", Type: "Banner"}
+
+	tests := []struct {
+		name      string
+		question  *models.Question
+		answerIDs []string
+		wantErr   bool
+	}{
+		{name: "option", question: option, answerIDs: []string{"a2"}},
+		{name: "option without answer", question: option, wantErr: true},
+		{name: "option with two answers", question: option, answerIDs: []string{"a1", "a2"}, wantErr: true},
+		{name: "option with unknown answer", question: option, answerIDs: []string{"a9"}, wantErr: true},
+		{name: "checkbox without answers", question: checkbox},
+		{name: "checkbox with one answer", question: checkbox, answerIDs: []string{"a3"}},
+		{name: "checkbox with all answers", question: checkbox, answerIDs: []string{"a3", "a1", "a2"}},
+		{name: "checkbox with repeated answer", question: checkbox, answerIDs: []string{"a1", "a1"}, wantErr: true},
+		{name: "checkbox with unknown answer", question: checkbox, answerIDs: []string{"a1", "a9"}, wantErr: true},
+		{name: "banner", question: banner, answerIDs: []string{"a1"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAgreedAnswer(tt.question, tt.answerIDs)
+			if tt.wantErr != errors.Is(err, models.ErrInvalidAgreedAnswer) || (!tt.wantErr && err != nil) {
+				t.Errorf("validateAgreedAnswer(%v) = %v, want error %v", tt.answerIDs, err, tt.wantErr)
+			}
+		})
+	}
+}